@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/dunglas/mercure/hub"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exportCmd writes the history of the configured transport as NDJSON.
+var exportCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "export [file]",
+	Short: "Export the history of the transport as NDJSON",
+	Long: `Write the updates stored by the transport, one JSON document per line, in the given file or
+on the standard output. The hub using the transport must be stopped.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setTransportURL(cmd)
+
+		var w io.Writer = os.Stdout
+		if len(args) == 1 {
+			f, err := os.Create(args[0])
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := hub.ExportHistory(viper.GetViper(), w); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+// importCmd stores in the configured transport a history exported as NDJSON.
+var importCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "import [file]",
+	Short: "Import a history exported as NDJSON in the transport",
+	Long: `Store the updates read from the given file or from the standard input, as written by the
+export command, after the updates already stored by the transport. The hub using the transport must be stopped.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setTransportURL(cmd)
+
+		var r io.Reader = os.Stdin
+		if len(args) == 1 {
+			f, err := os.Open(args[0])
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		if err := hub.ImportHistory(viper.GetViper(), r); err != nil {
+			log.Fatalln(err)
+		}
+	},
+}
+
+// migrateCmd copies the history of a transport to another one.
+var migrateCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "migrate",
+	Short: "Copy the history of a transport to another transport",
+	Long: `Copy the updates stored by the source transport to the destination transport, in order, preserving
+their IDs, so the subscribers can still reconnect using Last-Event-ID once the hub is switched to the
+destination. The source must support exporting its history (Bolt). The hubs using the transports must be stopped.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+
+		n, err := hub.MigrateHistory(viper.GetViper(), from, to)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Infof("%d updates migrated", n)
+	},
+}
+
+// setTransportURL overrides the configured transport with the one passed to the command, if any.
+func setTransportURL(cmd *cobra.Command) {
+	if tu, _ := cmd.Flags().GetString("transport-url"); tu != "" {
+		viper.Set("transport_url", tu)
+	}
+}
+
+func init() { //nolint:gochecknoinits
+	for _, c := range []*cobra.Command{exportCmd, importCmd} {
+		// The other configuration parameters are read from the environment and the configuration file
+		c.Flags().StringP("transport-url", "t", "", "transport URL, defaults to the configured one")
+		rootCmd.AddCommand(c)
+	}
+
+	migrateCmd.Flags().String("from", "", "URL of the source transport")
+	migrateCmd.Flags().String("to", "", "URL of the destination transport")
+	migrateCmd.MarkFlagRequired("from")
+	migrateCmd.MarkFlagRequired("to")
+	rootCmd.AddCommand(migrateCmd)
+}
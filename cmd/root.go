@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/dunglas/mercure/hub"
@@ -18,6 +20,14 @@ The Mercure Hub is the reference implementation of the Mercure protocol.
 
 Go to https://mercure.rocks for more information!`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if selfTest, _ := cmd.Flags().GetBool("self-test"); selfTest {
+			if err := hub.SelfTest(viper.GetViper(), os.Stdout); err != nil {
+				log.Fatalln(err)
+			}
+
+			return
+		}
+
 		hub.Start()
 	},
 }
@@ -37,4 +47,7 @@ func init() { //nolint:gochecknoinits
 	})
 	fs := rootCmd.Flags()
 	hub.SetFlags(fs, v)
+
+	// Not a configuration parameter, so not bound to Viper
+	fs.Bool("self-test", false, "check that the configured transport delivers updates live and through the history, then exit")
 }
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dunglas/mercure/hub"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "Mercure"
+	serviceDisplayName = "Mercure Hub"
+	serviceStopTimeout = 30 * time.Second
+)
+
+// serviceCmd manages the Windows service.
+var serviceCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "service",
+	Short: "Manage the Mercure Windows service",
+}
+
+func init() { //nolint:gochecknoinits
+	serviceCmd.AddCommand(
+		&cobra.Command{
+			Use:   "install",
+			Short: "Install the Windows service, started automatically at boot",
+			Args:  cobra.NoArgs,
+			RunE:  func(cmd *cobra.Command, args []string) error { return installService() },
+		},
+		&cobra.Command{
+			Use:   "uninstall",
+			Short: "Uninstall the Windows service",
+			Args:  cobra.NoArgs,
+			RunE:  func(cmd *cobra.Command, args []string) error { return uninstallService() },
+		},
+		&cobra.Command{
+			Use:   "start",
+			Short: "Start the Windows service",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return withService(func(s *mgr.Service) error { return s.Start() })
+			},
+		},
+		&cobra.Command{
+			Use:   "stop",
+			Short: "Stop the Windows service",
+			Args:  cobra.NoArgs,
+			RunE:  func(cmd *cobra.Command, args []string) error { return withService(stopService) },
+		},
+		&cobra.Command{
+			Use:    "run",
+			Short:  "Run the hub under the control of the Windows service manager",
+			Args:   cobra.NoArgs,
+			Hidden: true,
+			RunE:   func(cmd *cobra.Command, args []string) error { return svc.Run(serviceName, &service{}) },
+		},
+	)
+
+	rootCmd.AddCommand(serviceCmd)
+}
+
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %q already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: "Mercure protocol hub, pushing data updates to web browsers and other HTTP clients",
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("install event log source: %w", err)
+	}
+
+	return nil
+}
+
+func uninstallService() error {
+	if err := withService(func(s *mgr.Service) error { return s.Delete() }); err != nil {
+		return err
+	}
+
+	return eventlog.Remove(serviceName)
+}
+
+// withService opens the service and calls f.
+func withService(f func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %q: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	return f(s)
+}
+
+// stopService asks the service to stop and waits until it is stopped.
+func stopService(s *mgr.Service) error {
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %q: timeout while waiting for the service to stop", serviceName)
+		}
+
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// service implements svc.Handler.
+type service struct{}
+
+// Execute runs the hub until the service manager asks to stop it.
+func (*service) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		defer elog.Close()
+		log.AddHook(&eventLogHook{elog})
+	}
+
+	// The working directory of services is System32, use the directory of the executable to find the configuration and the database
+	if exe, err := os.Executable(); err == nil {
+		dir := filepath.Dir(exe)
+		if err := os.Chdir(dir); err != nil {
+			log.Error(err)
+		}
+
+		v := viper.GetViper()
+		v.AddConfigPath(dir)
+		v.ReadInConfig()
+	}
+
+	h, err := hub.NewHub(viper.GetViper())
+	if err != nil {
+		log.Error(err)
+		return false, 1
+	}
+
+	served := make(chan struct{})
+	go func() {
+		h.Serve()
+		close(served)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-served:
+			return false, 1
+
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+
+				ctx, cancel := context.WithTimeout(context.Background(), serviceStopTimeout)
+				if err := h.Shutdown(ctx); err != nil {
+					log.Error(err)
+				}
+				cancel()
+				<-served
+
+				return false, 0
+			}
+		}
+	}
+}
+
+// eventLogHook writes the log records to the Windows event log.
+type eventLogHook struct {
+	log *eventlog.Log
+}
+
+func (h *eventLogHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel}
+}
+
+func (h *eventLogHook) Fire(entry *log.Entry) error {
+	msg, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	switch entry.Level {
+	case log.InfoLevel:
+		return h.log.Info(1, msg)
+	case log.WarnLevel:
+		return h.log.Warning(1, msg)
+	default:
+		return h.log.Error(1, msg)
+	}
+}
@@ -0,0 +1,335 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	dnsRenewBefore   = 30 * 24 * time.Hour
+	dnsRenewInterval = 12 * time.Hour
+	dnsAccountKey    = "acme_account+key"
+)
+
+var (
+	// ErrInvalidDNSProviderDSN is returned when the DSN of the DNS provider is invalid.
+	ErrInvalidDNSProviderDSN = errors.New("invalid DNS provider DSN")
+	// ErrNoDNSChallenge is returned when the ACME server doesn't offer the dns-01 challenge.
+	ErrNoDNSChallenge = errors.New("acme: dns-01 challenge not offered")
+)
+
+// dnsProvider creates and deletes the TXT records used by the ACME dns-01 challenge.
+type dnsProvider interface {
+	// Present creates a TXT record for fqdn containing value, and waits until it is visible.
+	Present(ctx context.Context, fqdn, value string) error
+
+	// CleanUp deletes the TXT record created by Present.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// newDNSProvider creates the DNS provider matching the given DSN.
+// The DSN isn't included in errors because it contains credentials.
+func newDNSProvider(dsn string) (dnsProvider, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("acme_dns_provider: %w", ErrInvalidDNSProviderDSN)
+	}
+
+	switch u.Scheme {
+	case "cloudflare":
+		return newCloudflareProvider(u)
+
+	case "route53":
+		return newRoute53Provider(u)
+	}
+
+	return nil, fmt.Errorf("%q: no such DNS provider available: %w", u.Scheme, ErrInvalidDNSProviderDSN)
+}
+
+// dnsCertManager obtains and renews a certificate covering all the configured hosts, wildcards included, using the dns-01 challenge.
+type dnsCertManager struct {
+	sync.RWMutex
+	hosts    []string
+	provider dnsProvider
+	cache    autocert.Cache
+	client   *acme.Client
+	cert     *tls.Certificate
+}
+
+// newDNSCertManager creates a dnsCertManager, cache is optional.
+func newDNSCertManager(hosts []string, provider dnsProvider, cache autocert.Cache) *dnsCertManager {
+	return &dnsCertManager{
+		hosts:    hosts,
+		provider: provider,
+		cache:    cache,
+		client:   &acme.Client{},
+	}
+}
+
+// cacheKey is the name of the cache entry containing the certificate.
+func (m *dnsCertManager) cacheKey() string {
+	return "dns01+" + strings.Join(m.hosts, ",")
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (m *dnsCertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.RLock()
+	cert := m.cert
+	m.RUnlock()
+
+	if cert == nil {
+		return nil, errors.New("acme: certificate not available yet")
+	}
+	if hello.ServerName != "" && !m.matches(strings.ToLower(hello.ServerName)) {
+		return nil, fmt.Errorf("acme: host %q not configured", hello.ServerName)
+	}
+
+	return cert, nil
+}
+
+// matches checks if the host is covered by the configured hosts, wildcards only match one label.
+func (m *dnsCertManager) matches(host string) bool {
+	for _, h := range m.hosts {
+		if h == host {
+			return true
+		}
+
+		if strings.HasPrefix(h, "*.") {
+			if i := strings.IndexByte(host, '.'); i > 0 && host[i+1:] == h[2:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// needsRenewal returns true if there is no certificate, or if it expires soon.
+func (m *dnsCertManager) needsRenewal(now time.Time) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.cert == nil || m.cert.Leaf.NotAfter.Sub(now) < dnsRenewBefore
+}
+
+// Start loads the certificate from the cache, or obtains a new one, then renews it in the background until done is closed.
+func (m *dnsCertManager) Start(done <-chan struct{}) error {
+	ctx := context.Background()
+	if m.cache != nil {
+		if data, err := m.cache.Get(ctx, m.cacheKey()); err == nil {
+			if err := m.setCertificate(data); err != nil {
+				log.WithFields(log.Fields{"hosts": m.hosts}).Error(err)
+			}
+		}
+	}
+
+	if m.needsRenewal(time.Now()) {
+		if err := m.obtain(ctx); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(dnsRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !m.needsRenewal(time.Now()) {
+					continue
+				}
+				if err := m.obtain(ctx); err != nil {
+					log.WithFields(log.Fields{"hosts": m.hosts}).Error(err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// obtain requests a new certificate to the ACME server.
+func (m *dnsCertManager) obtain(ctx context.Context) error {
+	log.WithFields(log.Fields{"hosts": m.hosts}).Info("Obtaining certificate using the dns-01 challenge")
+
+	if err := m.register(ctx); err != nil {
+		return err
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.hosts...))
+	if err != nil {
+		return err
+	}
+
+	// Authorizations are processed sequentially because a host and its wildcard share the same TXT record name
+	for _, u := range order.AuthzURLs {
+		if err := m.authorize(ctx, u); err != nil {
+			return err
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: m.hosts}, key)
+	if err != nil {
+		return err
+	}
+
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	for _, c := range der {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c})
+	}
+
+	if err := m.setCertificate(buf.Bytes()); err != nil {
+		return err
+	}
+	if m.cache != nil {
+		if err := m.cache.Put(ctx, m.cacheKey(), buf.Bytes()); err != nil {
+			log.WithFields(log.Fields{"hosts": m.hosts}).Error(err)
+		}
+	}
+
+	return nil
+}
+
+// register loads or creates the account key, and registers it.
+func (m *dnsCertManager) register(ctx context.Context) error {
+	if m.client.Key != nil {
+		return nil
+	}
+
+	var key crypto.Signer
+	if m.cache != nil {
+		if data, err := m.cache.Get(ctx, dnsAccountKey); err == nil {
+			if block, _ := pem.Decode(data); block != nil {
+				key, _ = x509.ParseECPrivateKey(block.Bytes)
+			}
+		}
+	}
+
+	if key == nil {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		key = k
+
+		if m.cache != nil {
+			b, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return err
+			}
+			if err := m.cache.Put(ctx, dnsAccountKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	m.client.Key = key
+	if _, err := m.client.Register(ctx, &acme.Account{}, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		m.client.Key = nil
+		return err
+	}
+
+	return nil
+}
+
+// authorize fulfills the dns-01 challenge of the given authorization.
+func (m *dnsCertManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s: %w", authz.Identifier.Value, ErrNoDNSChallenge)
+	}
+
+	value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+	if err := m.provider.Present(ctx, fqdn, value); err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.provider.CleanUp(ctx, fqdn, value); err != nil {
+			log.WithFields(log.Fields{"fqdn": fqdn}).Error(err)
+		}
+	}()
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, authz.URI)
+
+	return err
+}
+
+// setCertificate parses a PEM bundle containing the private key followed by the certificate chain.
+func (m *dnsCertManager) setCertificate(data []byte) error {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.cert = &cert
+	m.Unlock()
+
+	return nil
+}
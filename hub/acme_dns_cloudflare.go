@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider manages the dns-01 TXT records using the Cloudflare API.
+// The DSN is formatted as cloudflare://?api_token=TOKEN&zone_id=ZONE, the token must have the "Zone.DNS" edit permission.
+type cloudflareProvider struct {
+	sync.Mutex
+	apiURL   string
+	apiToken string
+	zoneID   string
+	client   *http.Client
+
+	// records contains the IDs of the records created by Present
+	records map[string]string
+}
+
+func newCloudflareProvider(u *url.URL) (*cloudflareProvider, error) {
+	q := u.Query()
+	for _, p := range []string{"api_token", "zone_id"} {
+		if q.Get(p) == "" {
+			return nil, fmt.Errorf("cloudflare: missing %q parameter: %w", p, ErrInvalidDNSProviderDSN)
+		}
+	}
+
+	return &cloudflareProvider{
+		apiURL:   cloudflareAPIURL,
+		apiToken: q.Get("api_token"),
+		zoneID:   q.Get("zone_id"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		records:  make(map[string]string),
+	}, nil
+}
+
+// Present creates the TXT record, Cloudflare serves it immediately.
+func (p *cloudflareProvider) Present(ctx context.Context, fqdn, value string) error {
+	body, _ := json.Marshal(map[string]interface{}{"type": "TXT", "name": fqdn, "content": value, "ttl": 120})
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, "POST", "/zones/"+p.zoneID+"/dns_records", body, &result); err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.records[fqdn+" "+value] = result.ID
+	p.Unlock()
+
+	return nil
+}
+
+// CleanUp deletes the TXT record.
+func (p *cloudflareProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.Lock()
+	id, ok := p.records[fqdn+" "+value]
+	delete(p.records, fqdn+" "+value)
+	p.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return p.do(ctx, "DELETE", "/zones/"+p.zoneID+"/dns_records/"+id, nil, nil)
+}
+
+// do calls the API and decodes the "result" property of the response in result.
+func (p *cloudflareProvider) do(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&response); err != nil {
+		return fmt.Errorf("cloudflare: invalid response (status code %d): %w", resp.StatusCode, err)
+	}
+
+	if !response.Success {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(messages, ", "))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
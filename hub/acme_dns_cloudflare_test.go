@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCloudflareProviderInvalidDSN(t *testing.T) {
+	u, _ := url.Parse("cloudflare://?zone_id=zone")
+	_, err := newCloudflareProvider(u)
+	assert.EqualError(t, err, `cloudflare: missing "api_token" parameter: invalid DNS provider DSN`)
+}
+
+func TestCloudflareProvider(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.Method {
+		case "POST":
+			var record map[string]interface{}
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&record))
+			assert.Equal(t, map[string]interface{}{"type": "TXT", "name": "_acme-challenge.example.com", "content": "value", "ttl": float64(120)}, record)
+
+			io.WriteString(w, `{"success": true, "errors": [], "result": {"id": "record"}}`)
+		case "DELETE":
+			io.WriteString(w, `{"success": true, "errors": [], "result": {"id": "record"}}`)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse("cloudflare://?api_token=secret&zone_id=zone")
+	p, err := newCloudflareProvider(u)
+	require.Nil(t, err)
+	p.apiURL = server.URL
+
+	ctx := context.Background()
+	require.Nil(t, p.Present(ctx, "_acme-challenge.example.com", "value"))
+	require.Nil(t, p.CleanUp(ctx, "_acme-challenge.example.com", "value"))
+
+	// Unknown records are ignored
+	require.Nil(t, p.CleanUp(ctx, "_acme-challenge.example.com", "value"))
+
+	assert.Equal(t, []string{"POST /zones/zone/dns_records", "DELETE /zones/zone/dns_records/record"}, requests)
+}
+
+func TestCloudflareProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse("cloudflare://?api_token=secret&zone_id=zone")
+	p, err := newCloudflareProvider(u)
+	require.Nil(t, err)
+	p.apiURL = server.URL
+
+	err = p.Present(context.Background(), "_acme-challenge.example.com", "value")
+	assert.EqualError(t, err, "cloudflare: POST /zones/zone/dns_records: Authentication error")
+}
@@ -0,0 +1,206 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	route53APIURL       = "https://route53.amazonaws.com"
+	route53Region       = "us-east-1"
+	route53PollInterval = 5 * time.Second
+)
+
+// route53Provider manages the dns-01 TXT records using the AWS Route 53 API.
+// The DSN is formatted as route53://?hosted_zone_id=ZONE&access_key_id=KEY&secret_access_key=SECRET,
+// credentials default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type route53Provider struct {
+	apiURL          string
+	hostedZoneID    string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	pollInterval    time.Duration
+	client          *http.Client
+}
+
+func newRoute53Provider(u *url.URL) (*route53Provider, error) {
+	q := u.Query()
+	param := func(name, env string) string {
+		if v := q.Get(name); v != "" {
+			return v
+		}
+
+		return os.Getenv(env)
+	}
+
+	p := &route53Provider{
+		apiURL:          route53APIURL,
+		hostedZoneID:    strings.TrimPrefix(q.Get("hosted_zone_id"), "/hostedzone/"),
+		accessKeyID:     param("access_key_id", "AWS_ACCESS_KEY_ID"),
+		secretAccessKey: param("secret_access_key", "AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    param("session_token", "AWS_SESSION_TOKEN"),
+		pollInterval:    route53PollInterval,
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}
+
+	switch {
+	case p.hostedZoneID == "":
+		return nil, fmt.Errorf(`route53: missing "hosted_zone_id" parameter: %w`, ErrInvalidDNSProviderDSN)
+	case p.accessKeyID == "" || p.secretAccessKey == "":
+		return nil, fmt.Errorf(`route53: missing "access_key_id" or "secret_access_key" parameter: %w`, ErrInvalidDNSProviderDSN)
+	}
+
+	return p, nil
+}
+
+type route53ChangeInfo struct {
+	ID     string `xml:"ChangeInfo>Id"`
+	Status string `xml:"ChangeInfo>Status"`
+}
+
+// Present upserts the TXT record and waits until the change is propagated to all Route 53 DNS servers.
+func (p *route53Provider) Present(ctx context.Context, fqdn, value string) error {
+	return p.change(ctx, "UPSERT", fqdn, value)
+}
+
+// CleanUp deletes the TXT record.
+func (p *route53Provider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.change(ctx, "DELETE", fqdn, value)
+}
+
+func (p *route53Provider) change(ctx context.Context, action, fqdn, value string) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ChangeResourceRecordSetsRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ChangeBatch><Changes><Change><Action>`)
+	xml.EscapeText(&body, []byte(action))
+	body.WriteString(`</Action><ResourceRecordSet><Name>`)
+	xml.EscapeText(&body, []byte(fqdn+"."))
+	body.WriteString(`</Name><Type>TXT</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>`)
+	xml.EscapeText(&body, []byte(`"`+value+`"`))
+	body.WriteString(`</Value></ResourceRecord></ResourceRecords></ResourceRecordSet></Change></Changes></ChangeBatch></ChangeResourceRecordSetsRequest>`)
+
+	var info route53ChangeInfo
+	if err := p.do(ctx, "POST", "/2013-04-01/hostedzone/"+p.hostedZoneID+"/rrset", body.Bytes(), &info); err != nil {
+		return err
+	}
+
+	for info.Status != "INSYNC" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.pollInterval):
+		}
+
+		if err := p.do(ctx, "GET", "/2013-04-01/"+strings.TrimPrefix(info.ID, "/"), nil, &info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// do calls the API and decodes the XML response in result.
+func (p *route53Provider) do(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	signAWSRequest(req, body, p.accessKeyID, p.secretAccessKey, p.sessionToken, route53Region, "route53", time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `xml:"Error>Message"`
+		}
+		xml.Unmarshal(data, &e)
+
+		return fmt.Errorf("route53: %s %s: status code %d: %s", method, path, resp.StatusCode, e.Message)
+	}
+
+	return xml.Unmarshal(data, result)
+}
+
+// signAWSRequest adds the headers of the AWS Signature Version 4 to the request.
+func signAWSRequest(req *http.Request, body []byte, accessKeyID, secretAccessKey, sessionToken, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
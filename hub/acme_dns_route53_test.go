@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoute53ProviderInvalidDSN(t *testing.T) {
+	u, _ := url.Parse("route53://?access_key_id=key&secret_access_key=secret")
+	_, err := newRoute53Provider(u)
+	assert.EqualError(t, err, `route53: missing "hosted_zone_id" parameter: invalid DNS provider DSN`)
+
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	u, _ = url.Parse("route53://?hosted_zone_id=zone&access_key_id=key")
+	_, err = newRoute53Provider(u)
+	assert.EqualError(t, err, `route53: missing "access_key_id" or "secret_access_key" parameter: invalid DNS provider DSN`)
+}
+
+func TestNewRoute53ProviderEnv(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	u, _ := url.Parse("route53://?hosted_zone_id=/hostedzone/zone")
+	p, err := newRoute53Provider(u)
+	require.Nil(t, err)
+	assert.Equal(t, "zone", p.hostedZoneID)
+	assert.Equal(t, "key", p.accessKeyID)
+	assert.Equal(t, "secret", p.secretAccessKey)
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// "get-vanilla" example of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signAWSRequest(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestRoute53Provider(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"))
+		assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.Method {
+		case "POST":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Contains(t, string(body), "<Name>_acme-challenge.example.com.</Name><Type>TXT</Type>")
+			assert.Contains(t, string(body), "<Value>&#34;value&#34;</Value>")
+
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+		case "GET":
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><GetChangeResponse><ChangeInfo><Id>/change/C1</Id><Status>INSYNC</Status></ChangeInfo></GetChangeResponse>`)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse("route53://?hosted_zone_id=zone&access_key_id=key&secret_access_key=secret&session_token=token")
+	p, err := newRoute53Provider(u)
+	require.Nil(t, err)
+	p.apiURL = server.URL
+	p.pollInterval = time.Millisecond
+
+	require.Nil(t, p.Present(context.Background(), "_acme-challenge.example.com", "value"))
+	assert.Equal(t, []string{"POST /2013-04-01/hostedzone/zone/rrset", "GET /2013-04-01/change/C1"}, requests)
+}
+
+func TestRoute53ProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<?xml version="1.0"?><ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>Access denied</Message></Error></ErrorResponse>`)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse("route53://?hosted_zone_id=zone&access_key_id=key&secret_access_key=secret")
+	p, err := newRoute53Provider(u)
+	require.Nil(t, err)
+	p.apiURL = server.URL
+
+	err = p.CleanUp(context.Background(), "_acme-challenge.example.com", "value")
+	assert.EqualError(t, err, "route53: POST /2013-04-01/hostedzone/zone/rrset: status code 403: Access denied")
+}
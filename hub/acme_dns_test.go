@@ -0,0 +1,121 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// createPEMBundle creates a self-signed certificate in the format stored by dnsCertManager.
+func createPEMBundle(t *testing.T, hosts []string, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), DNSNames: hosts, NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	b, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return buf.Bytes()
+}
+
+type memoryCache map[string][]byte
+
+func (c memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	if data, ok := c[key]; ok {
+		return data, nil
+	}
+
+	return nil, autocert.ErrCacheMiss
+}
+
+func (c memoryCache) Put(_ context.Context, key string, data []byte) error {
+	c[key] = data
+	return nil
+}
+
+func (c memoryCache) Delete(_ context.Context, key string) error {
+	delete(c, key)
+	return nil
+}
+
+func TestNewDNSProvider(t *testing.T) {
+	_, err := newDNSProvider("foo://")
+	assert.EqualError(t, err, `"foo": no such DNS provider available: invalid DNS provider DSN`)
+
+	_, err = newDNSProvider("cloudflare://?api_token=secret")
+	assert.EqualError(t, err, `cloudflare: missing "zone_id" parameter: invalid DNS provider DSN`)
+	assert.True(t, errors.Is(err, ErrInvalidDNSProviderDSN))
+
+	p, err := newDNSProvider("cloudflare://?api_token=secret&zone_id=zone")
+	require.Nil(t, err)
+	assert.IsType(t, &cloudflareProvider{}, p)
+
+	p, err = newDNSProvider("route53://?hosted_zone_id=zone&access_key_id=key&secret_access_key=secret")
+	require.Nil(t, err)
+	assert.IsType(t, &route53Provider{}, p)
+}
+
+func TestDNSCertManagerMatches(t *testing.T) {
+	m := newDNSCertManager([]string{"example.com", "*.example.com"}, nil, nil)
+
+	assert.True(t, m.matches("example.com"))
+	assert.True(t, m.matches("hub.example.com"))
+	assert.False(t, m.matches("a.hub.example.com"))
+	assert.False(t, m.matches("example.org"))
+	assert.False(t, m.matches(".example.com"))
+}
+
+func TestDNSCertManagerGetCertificate(t *testing.T) {
+	m := newDNSCertManager([]string{"*.example.com"}, nil, nil)
+
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "hub.example.com"})
+	assert.EqualError(t, err, "acme: certificate not available yet")
+	assert.True(t, m.needsRenewal(time.Now()))
+
+	require.Nil(t, m.setCertificate(createPEMBundle(t, []string{"*.example.com"}, time.Now().Add(90*24*time.Hour))))
+	assert.False(t, m.needsRenewal(time.Now()))
+	assert.True(t, m.needsRenewal(time.Now().Add(70*24*time.Hour)))
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "HUB.example.com"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"*.example.com"}, cert.Leaf.DNSNames)
+
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	assert.EqualError(t, err, `acme: host "example.org" not configured`)
+}
+
+func TestDNSCertManagerStartFromCache(t *testing.T) {
+	hosts := []string{"example.com", "*.example.com"}
+	cache := memoryCache{"dns01+example.com,*.example.com": createPEMBundle(t, hosts, time.Now().Add(60*24*time.Hour))}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// The cached certificate is still valid, the ACME server isn't contacted
+	m := newDNSCertManager(hosts, nil, cache)
+	require.Nil(t, m.Start(done))
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.Nil(t, err)
+	assert.Equal(t, hosts, cert.Leaf.DNSNames)
+}
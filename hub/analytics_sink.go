@@ -0,0 +1,334 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAnalyticsBatchSize     = 500
+	defaultAnalyticsFlushInterval = 10 * time.Second
+	defaultAnalyticsQueueSize     = 10000
+	defaultAnalyticsTimeout       = 10 * time.Second
+	// analyticsTimeLayout is understood by all the destinations, BigQuery timestamps have a microsecond precision
+	analyticsTimeLayout = "2006-01-02T15:04:05.000000Z"
+)
+
+// ErrInvalidAnalyticsSinkDSN is returned when the DSN of an analytics sink is invalid.
+var ErrInvalidAnalyticsSinkDSN = errors.New("invalid analytics sink DSN")
+
+// analyticsRow is the copy of a published update stored in the analytics destinations.
+type analyticsRow struct {
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Topics    []string `json:"topics"`
+	Data      string   `json:"data"`
+	Targets   []string `json:"targets"`
+	Publisher string   `json:"publisher"`
+	Time      string   `json:"time"`
+	Instance  string   `json:"instance"`
+}
+
+// analyticsWriter stores batches of rows in an analytics destination.
+type analyticsWriter interface {
+	// write stores the rows, it is never called concurrently.
+	write(ctx context.Context, rows []*analyticsRow) error
+}
+
+// analyticsSink asynchronously mirrors the published updates, or a filtered sample of them, to an analytics destination.
+// The updates are batched by a dedicated goroutine: failures and slowness of the destination never affect the publishers,
+// updates are dropped when the queue is full or when a batch can't be stored.
+type analyticsSink struct {
+	// name identifies the destination in the logs and in the metrics, it never contains credentials
+	name   string
+	writer analyticsWriter
+
+	sampleRate float64
+	// matchTopic returns true for the topics to mirror, nil if all the topics are mirrored
+	matchTopic func(string) bool
+	// targeted is true if the updates having targets (private updates) are mirrored
+	targeted bool
+
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	instanceID    string
+	metrics       *Metrics
+	queue         chan *Update
+	done          chan struct{}
+	stopped       chan struct{}
+}
+
+// newAnalyticsSinks creates the sinks defined by the DSNs of the "analytics_sinks" configuration parameter.
+// The sinks start mirroring once run is called.
+func newAnalyticsSinks(dsns []string, instanceID string, metrics *Metrics) ([]*analyticsSink, error) {
+	sinks := make([]*analyticsSink, 0, len(dsns))
+	for _, dsn := range dsns {
+		s, err := newAnalyticsSink(dsn, instanceID, metrics)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
+}
+
+// newAnalyticsSink creates the sink matching the scheme of the DSN.
+// The DSN isn't included in errors because it contains credentials.
+func newAnalyticsSink(dsn, instanceID string, metrics *Metrics) (*analyticsSink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("analytics_sinks: %w", ErrInvalidAnalyticsSinkDSN)
+	}
+
+	var (
+		writer analyticsWriter
+		name   string
+	)
+	client := &http.Client{}
+	switch u.Scheme {
+	case "s3":
+		writer, name, err = newS3AnalyticsWriter(u, client)
+
+	case "bigquery":
+		writer, name, err = newBigQueryAnalyticsWriter(u, client)
+
+	case "clickhouse":
+		writer, name, err = newClickHouseAnalyticsWriter(u, client)
+
+	default:
+		return nil, fmt.Errorf("%q: no such analytics sink available: %w", u.Scheme, ErrInvalidAnalyticsSinkDSN)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	s := &analyticsSink{
+		name:          name,
+		writer:        writer,
+		sampleRate:    100,
+		batchSize:     defaultAnalyticsBatchSize,
+		flushInterval: defaultAnalyticsFlushInterval,
+		timeout:       defaultAnalyticsTimeout,
+		instanceID:    instanceID,
+		metrics:       metrics,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	if p := q.Get("sample_rate"); p != "" {
+		if s.sampleRate, err = strconv.ParseFloat(p, 64); err != nil || s.sampleRate <= 0 || s.sampleRate > 100 {
+			return nil, fmt.Errorf(`%s: invalid "sample_rate" parameter %q, must be a percentage greater than 0: %w`, name, p, ErrInvalidAnalyticsSinkDSN)
+		}
+	}
+
+	if topics := q["topic"]; len(topics) > 0 {
+		s.matchTopic = topicSelectorsMatcher(topics)
+	}
+
+	if p := q.Get("targeted"); p != "" {
+		if s.targeted, err = strconv.ParseBool(p); err != nil {
+			return nil, fmt.Errorf(`%s: invalid "targeted" parameter %q: %w`, name, p, ErrInvalidAnalyticsSinkDSN)
+		}
+	}
+
+	if p := q.Get("batch_size"); p != "" {
+		if s.batchSize, err = strconv.Atoi(p); err != nil || s.batchSize <= 0 {
+			return nil, fmt.Errorf(`%s: invalid "batch_size" parameter %q: %w`, name, p, ErrInvalidAnalyticsSinkDSN)
+		}
+	}
+
+	queueSize := defaultAnalyticsQueueSize
+	if p := q.Get("queue_size"); p != "" {
+		if queueSize, err = strconv.Atoi(p); err != nil || queueSize <= 0 {
+			return nil, fmt.Errorf(`%s: invalid "queue_size" parameter %q: %w`, name, p, ErrInvalidAnalyticsSinkDSN)
+		}
+	}
+	s.queue = make(chan *Update, queueSize)
+
+	for _, p := range []struct {
+		name  string
+		value *time.Duration
+	}{{"flush_interval", &s.flushInterval}, {"timeout", &s.timeout}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.value, err = time.ParseDuration(v); err != nil || *p.value <= 0 {
+				return nil, fmt.Errorf(`%s: invalid %q parameter %q: %w`, name, p.name, v, ErrInvalidAnalyticsSinkDSN)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// publish queues the update if it must be mirrored, it never blocks.
+func (s *analyticsSink) publish(u *Update) {
+	if !s.targeted && len(u.Targets) > 0 {
+		return
+	}
+
+	if s.matchTopic != nil && !s.matches(u) {
+		return
+	}
+
+	if s.sampleRate < 100 && rand.Float64()*100 >= s.sampleRate {
+		return
+	}
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	// The update will be released once converted to a row
+	u.Retain()
+	select {
+	case s.queue <- u:
+	default:
+		u.Release()
+		s.collect(false, 1)
+		log.WithFields(log.Fields{"event_id": u.ID, "sink": s.name}).Warn("analytics sink: queue full, update not mirrored")
+	}
+}
+
+// matches returns true if one of the topics of the update must be mirrored.
+func (s *analyticsSink) matches(u *Update) bool {
+	for _, topic := range u.Topics {
+		if s.matchTopic(topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run batches the queued updates, a batch is stored when it's full or when the flush interval elapses.
+func (s *analyticsSink) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	rows := make([]*analyticsRow, 0, s.batchSize)
+	for {
+		select {
+		case u := <-s.queue:
+			rows = append(rows, s.row(u))
+			u.Release()
+			if len(rows) < s.batchSize {
+				continue
+			}
+
+		case <-ticker.C:
+			if len(rows) == 0 {
+				continue
+			}
+
+		case <-s.done:
+			// The queued updates are stored before stopping
+			for drained := false; !drained; {
+				select {
+				case u := <-s.queue:
+					rows = append(rows, s.row(u))
+					u.Release()
+				default:
+					drained = true
+				}
+			}
+			for len(rows) > 0 {
+				n := len(rows)
+				if n > s.batchSize {
+					n = s.batchSize
+				}
+
+				s.flush(rows[:n])
+				rows = rows[n:]
+			}
+
+			return
+		}
+
+		s.flush(rows)
+		rows = rows[:0]
+	}
+}
+
+// row converts the update to the row stored in the destination.
+func (s *analyticsSink) row(u *Update) *analyticsRow {
+	t := u.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	r := &analyticsRow{
+		ID:        u.ID,
+		Type:      u.Type,
+		Topics:    append([]string(nil), u.Topics...),
+		Data:      u.Data,
+		Targets:   make([]string, 0, len(u.Targets)),
+		Publisher: u.Publisher,
+		Time:      t.UTC().Format(analyticsTimeLayout),
+		Instance:  s.instanceID,
+	}
+	for target := range u.Targets {
+		r.Targets = append(r.Targets, target)
+	}
+	sort.Strings(r.Targets)
+
+	return r
+}
+
+// flush stores the batch in the destination, the batch is dropped if it fails.
+func (s *analyticsSink) flush(rows []*analyticsRow) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	err := s.writer.write(ctx, rows)
+	s.collect(err == nil, len(rows))
+	if err != nil {
+		log.WithFields(log.Fields{"sink": s.name, "rows": len(rows)}).Error(fmt.Errorf("analytics sink: %w", err))
+	}
+}
+
+// collect collects the number of mirrored or dropped rows.
+func (s *analyticsSink) collect(stored bool, n int) {
+	if s.metrics != nil {
+		s.metrics.AnalyticsRows(s.name, stored, n)
+	}
+}
+
+// Close stops mirroring, the queued updates are stored before returning.
+func (s *analyticsSink) Close() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	<-s.stopped
+}
+
+// encodeAnalyticsRows encodes the rows as newline-delimited JSON.
+func encodeAnalyticsRows(rows []*analyticsRow) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range rows {
+		enc.Encode(r)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	defaultBigQueryEndpoint = "https://bigquery.googleapis.com"
+	bigQueryScope           = "https://www.googleapis.com/auth/bigquery.insertdata"
+)
+
+// bigQueryAnalyticsWriter streams the rows in a BigQuery table, using the insertAll API.
+// The ID of the update is used as the insert ID, so BigQuery deduplicates the rows on a best-effort basis.
+type bigQueryAnalyticsWriter struct {
+	insertURL   string
+	credentials *gcpCredentials
+	client      *http.Client
+}
+
+type bigQueryInsertRow struct {
+	InsertID string        `json:"insertId"`
+	JSON     *analyticsRow `json:"json"`
+}
+
+// newBigQueryAnalyticsWriter creates a writer from a DSN formatted as bigquery://project/dataset/table.
+// The credentials default to the service account key referenced by the GOOGLE_APPLICATION_CREDENTIALS environment variable, or to the metadata server.
+func newBigQueryAnalyticsWriter(u *url.URL, client *http.Client) (*bigQueryAnalyticsWriter, string, error) {
+	q := u.Query()
+
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "" || len(path) != 2 || path[0] == "" || path[1] == "" {
+		return nil, "", fmt.Errorf(`bigquery: must be formatted as "bigquery://project/dataset/table": %w`, ErrInvalidAnalyticsSinkDSN)
+	}
+	name := "bigquery:" + u.Host + "." + path[0] + "." + path[1]
+
+	endpoint := defaultBigQueryEndpoint
+	if p := q.Get("endpoint"); p != "" {
+		endpoint = strings.TrimSuffix(p, "/")
+	}
+
+	credentialsPath := q.Get("credentials")
+	if credentialsPath == "" {
+		credentialsPath = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	credentials, err := newGCPCredentials(credentialsPath, bigQueryScope, client)
+	if err != nil {
+		return nil, "", fmt.Errorf(`%s: invalid "credentials" parameter: %s: %w`, name, err, ErrInvalidAnalyticsSinkDSN)
+	}
+
+	return &bigQueryAnalyticsWriter{
+		insertURL:   fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll", endpoint, url.PathEscape(u.Host), url.PathEscape(path[0]), url.PathEscape(path[1])),
+		credentials: credentials,
+		client:      client,
+	}, name, nil
+}
+
+// write streams the rows, the whole batch is rejected if one of the rows is invalid.
+func (w *bigQueryAnalyticsWriter) write(ctx context.Context, rows []*analyticsRow) error {
+	insertRows := make([]bigQueryInsertRow, 0, len(rows))
+	for _, r := range rows {
+		insertRows = append(insertRows, bigQueryInsertRow{r.ID, r})
+	}
+
+	body, err := json.Marshal(struct {
+		Rows []bigQueryInsertRow `json:"rows"`
+	}{insertRows})
+	if err != nil {
+		return err
+	}
+
+	token, err := w.credentials.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.insertURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bigquery: insertAll: status code %d: %s", resp.StatusCode, data)
+	}
+
+	var result struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("bigquery: insertAll: %w", err)
+	}
+	if len(result.InsertErrors) > 0 && len(result.InsertErrors[0].Errors) > 0 {
+		e := result.InsertErrors[0]
+
+		return fmt.Errorf("bigquery: insertAll: %d rows rejected, row %d: %s: %s", len(result.InsertErrors), e.Index, e.Errors[0].Reason, e.Errors[0].Message)
+	}
+
+	return nil
+}
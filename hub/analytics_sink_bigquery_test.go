@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBigQueryAnalyticsWriterInvalid(t *testing.T) {
+	for _, dsn := range []string{"bigquery://project", "bigquery://project/dataset", "bigquery://project/dataset/table/extra", "bigquery:///dataset/table"} {
+		u, _ := url.Parse(dsn)
+		_, _, err := newBigQueryAnalyticsWriter(u, http.DefaultClient)
+		assert.EqualError(t, err, `bigquery: must be formatted as "bigquery://project/dataset/table": invalid analytics sink DSN`)
+	}
+
+	u, _ := url.Parse("bigquery://project/dataset/table?credentials=not-found.json")
+	_, _, err := newBigQueryAnalyticsWriter(u, http.DefaultClient)
+	assert.EqualError(t, err, `bigquery:project.dataset.table: invalid "credentials" parameter: open not-found.json: no such file or directory: invalid analytics sink DSN`)
+}
+
+func TestBigQueryAnalyticsWriterWrite(t *testing.T) {
+	var key *rsa.PrivateKey
+	insertErrors := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			token, err := jwt.Parse(r.Form.Get("assertion"), func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+			require.Nil(t, err)
+			assert.Equal(t, bigQueryScope, token.Claims.(jwt.MapClaims)["scope"])
+
+			fmt.Fprint(w, `{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`)
+			return
+		}
+
+		assert.Equal(t, "/bigquery/v2/projects/project/datasets/dataset/tables/updates/insertAll", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var body struct {
+			Rows []struct {
+				InsertID string       `json:"insertId"`
+				JSON     analyticsRow `json:"json"`
+			} `json:"rows"`
+		}
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Len(t, body.Rows, 2)
+		assert.Equal(t, "1", body.Rows[0].InsertID)
+		assert.Equal(t, "2", body.Rows[1].JSON.ID)
+
+		fmt.Fprintf(w, `{"kind":"bigquery#tableDataInsertAllResponse"%s}`, insertErrors)
+	}))
+	defer server.Close()
+
+	path, k := writeGCPServiceAccountKey(t, server.URL+"/token")
+	defer os.Remove(path)
+	key = k
+
+	u, _ := url.Parse("bigquery://project/dataset/updates?" + url.Values{"credentials": {path}, "endpoint": {server.URL}}.Encode())
+	w, name, err := newBigQueryAnalyticsWriter(u, server.Client())
+	require.Nil(t, err)
+	assert.Equal(t, "bigquery:project.dataset.updates", name)
+
+	rows := []*analyticsRow{{ID: "1"}, {ID: "2"}}
+	require.Nil(t, w.write(context.Background(), rows))
+
+	insertErrors = `,"insertErrors":[{"index":1,"errors":[{"reason":"invalid","message":"no such field: foo."}]}]`
+	assert.EqualError(t, w.write(context.Background(), rows), `bigquery: insertAll: 1 rows rejected, row 1: invalid: no such field: foo.`)
+}
@@ -0,0 +1,39 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// s3AnalyticsWriter stores every batch as a newline-delimited JSON object in an S3 bucket, or in any S3-compatible storage.
+// The objects are named after the time of the batch: prefix/2006/01/02/15/20060102T150405Z-uuid.ndjson.
+type s3AnalyticsWriter struct {
+	*s3Bucket
+}
+
+// newS3AnalyticsWriter creates a writer from a DSN such as s3://bucket/prefix?region=eu-west-3.
+// The region and the credentials default to the AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func newS3AnalyticsWriter(u *url.URL, client *http.Client) (*s3AnalyticsWriter, string, error) {
+	b, name, err := newS3Bucket(u, client, ErrInvalidAnalyticsSinkDSN)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &s3AnalyticsWriter{b}, name, nil
+}
+
+// key returns the name of the object storing a batch written at now.
+func (w *s3AnalyticsWriter) key(now time.Time) string {
+	now = now.UTC()
+
+	return w.objectKey(now.Format("2006/01/02/15/") + now.Format(boltPartitionLayout) + "-" + uuid.Must(uuid.NewV4()).String() + ".ndjson")
+}
+
+// write uploads the rows in a new object.
+func (w *s3AnalyticsWriter) write(ctx context.Context, rows []*analyticsRow) error {
+	return w.put(ctx, w.key(time.Now()), encodeAnalyticsRows(rows), "application/x-ndjson")
+}
@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewS3AnalyticsWriter(t *testing.T) {
+	os.Setenv("AWS_REGION", "eu-west-3")
+	defer os.Unsetenv("AWS_REGION")
+
+	u, _ := url.Parse("s3://analytics/mercure/updates/?access_key_id=id&secret_access_key=secret")
+	w, name, err := newS3AnalyticsWriter(u, http.DefaultClient)
+	require.Nil(t, err)
+	assert.Equal(t, "s3:analytics/mercure/updates/", name)
+	assert.Equal(t, "https://s3.eu-west-3.amazonaws.com", w.endpoint)
+	assert.Equal(t, "mercure/updates", w.prefix)
+	assert.Regexp(t, regexp.MustCompile(`^mercure/updates/2020/01/02/03/20200102T030405Z-[0-9a-f-]{36}\.ndjson$`), w.key(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	for dsn, expected := range map[string]string{
+		"s3:///prefix":                    `s3: must be formatted as "s3://bucket/prefix": invalid analytics sink DSN`,
+		"s3://analytics?region=":          `s3:analytics: missing "access_key_id" or "secret_access_key" parameter: invalid analytics sink DSN`,
+		"s3://analytics?access_key_id=id": `s3:analytics: missing "access_key_id" or "secret_access_key" parameter: invalid analytics sink DSN`,
+	} {
+		u, _ := url.Parse(dsn)
+		_, _, err := newS3AnalyticsWriter(u, http.DefaultClient)
+		assert.EqualError(t, err, expected)
+	}
+
+	os.Unsetenv("AWS_REGION")
+	u, _ = url.Parse("s3://analytics")
+	_, _, err = newS3AnalyticsWriter(u, http.DefaultClient)
+	assert.EqualError(t, err, `s3:analytics: missing "region" parameter: invalid analytics sink DSN`)
+}
+
+func TestS3AnalyticsWriterWrite(t *testing.T) {
+	var (
+		path, body, contentHash, authorization string
+		status                                 = http.StatusOK
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PUT", r.Method)
+		path = r.URL.Path
+		contentHash = r.Header.Get("X-Amz-Content-Sha256")
+		authorization = r.Header.Get("Authorization")
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse("s3://analytics/updates?region=us-east-1&access_key_id=id&secret_access_key=secret&endpoint=" + url.QueryEscape(server.URL))
+	w, _, err := newS3AnalyticsWriter(u, server.Client())
+	require.Nil(t, err)
+
+	require.Nil(t, w.write(context.Background(), []*analyticsRow{{ID: "1"}, {ID: "2"}}))
+	assert.Regexp(t, regexp.MustCompile(`^/analytics/updates/\d{4}/\d{2}/\d{2}/\d{2}/\d{8}T\d{6}Z-[0-9a-f-]{36}\.ndjson$`), path)
+	assert.Equal(t, string(encodeAnalyticsRows([]*analyticsRow{{ID: "1"}, {ID: "2"}})), body)
+	assert.Len(t, contentHash, 64)
+	assert.Contains(t, authorization, "/us-east-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date")
+
+	status = http.StatusForbidden
+	assert.Regexp(t, regexp.MustCompile(`^s3: PUT /analytics/updates/.+: status code 403: $`), w.write(context.Background(), []*analyticsRow{{ID: "3"}}).Error())
+}
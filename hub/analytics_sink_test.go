@@ -0,0 +1,199 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAnalyticsWriter stores the batches in memory, or fails if err is set.
+type recordingAnalyticsWriter struct {
+	sync.Mutex
+	batches [][]*analyticsRow
+	err     error
+}
+
+func (w *recordingAnalyticsWriter) write(ctx context.Context, rows []*analyticsRow) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.batches = append(w.batches, append([]*analyticsRow(nil), rows...))
+
+	return nil
+}
+
+func (w *recordingAnalyticsWriter) ids() [][]string {
+	w.Lock()
+	defer w.Unlock()
+
+	ids := make([][]string, 0, len(w.batches))
+	for _, batch := range w.batches {
+		b := make([]string, 0, len(batch))
+		for _, r := range batch {
+			b = append(b, r.ID)
+		}
+		ids = append(ids, b)
+	}
+
+	return ids
+}
+
+func newTestAnalyticsSink(t *testing.T, dsn string) (*analyticsSink, *recordingAnalyticsWriter) {
+	t.Helper()
+
+	s, err := newAnalyticsSink(dsn, "hub-test", NewMetrics())
+	require.Nil(t, err)
+
+	w := &recordingAnalyticsWriter{}
+	s.writer = w
+
+	return s, w
+}
+
+func TestNewAnalyticsSinkInvalid(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"%":                 `analytics_sinks: invalid analytics sink DSN`,
+		"kafka://localhost": `"kafka": no such analytics sink available: invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&sample_rate=0":     `clickhouse:localhost/default.updates: invalid "sample_rate" parameter "0", must be a percentage greater than 0: invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&targeted=maybe":    `clickhouse:localhost/default.updates: invalid "targeted" parameter "maybe": invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&batch_size=-1":     `clickhouse:localhost/default.updates: invalid "batch_size" parameter "-1": invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&queue_size=0":      `clickhouse:localhost/default.updates: invalid "queue_size" parameter "0": invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&flush_interval=0s": `clickhouse:localhost/default.updates: invalid "flush_interval" parameter "0s": invalid analytics sink DSN`,
+		"clickhouse://localhost?table=updates&timeout=invalid":   `clickhouse:localhost/default.updates: invalid "timeout" parameter "invalid": invalid analytics sink DSN`,
+	} {
+		_, err := newAnalyticsSink(dsn, "", nil)
+		assert.EqualError(t, err, expected)
+		assert.True(t, errors.Is(err, ErrInvalidAnalyticsSinkDSN))
+	}
+}
+
+func TestAnalyticsSinkFilter(t *testing.T) {
+	s, _ := newTestAnalyticsSink(t, "clickhouse://localhost?table=updates&topic=https://example.com/books/{id}&topic=https://example.com/reviews")
+
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "1"}})
+	s.publish(&Update{Topics: []string{"https://example.com/authors/1", "https://example.com/reviews"}, Event: Event{ID: "2"}})
+	s.publish(&Update{Topics: []string{"https://example.com/authors/1"}, Event: Event{ID: "3"}})
+	// Private updates aren't mirrored by default
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Targets: map[string]struct{}{"foo": {}}, Event: Event{ID: "4"}})
+
+	require.Len(t, s.queue, 2)
+	assert.Equal(t, "1", (<-s.queue).ID)
+	assert.Equal(t, "2", (<-s.queue).ID)
+
+	s, _ = newTestAnalyticsSink(t, "clickhouse://localhost?table=updates&targeted=1")
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Targets: map[string]struct{}{"foo": {}}, Event: Event{ID: "4"}})
+	assert.Len(t, s.queue, 1)
+}
+
+func TestAnalyticsSinkSample(t *testing.T) {
+	s, _ := newTestAnalyticsSink(t, "clickhouse://localhost?table=updates&sample_rate=10")
+
+	for i := 0; i < 1000; i++ {
+		s.publish(&Update{Topics: []string{"https://example.com/books/1"}})
+	}
+
+	assert.InDelta(t, 100, len(s.queue), 60)
+}
+
+func TestAnalyticsSinkBatches(t *testing.T) {
+	s, w := newTestAnalyticsSink(t, "clickhouse://localhost?table=updates&batch_size=2&flush_interval=50ms")
+	go s.run()
+
+	for _, id := range []string{"1", "2", "3"} {
+		s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: id}})
+	}
+
+	// The incomplete batch is stored when the flush interval elapses
+	require.Eventually(t, func() bool {
+		return len(w.ids()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}}, w.ids())
+
+	// The queued updates are stored when the sink is closed
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "4"}})
+	s.Close()
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}, {"4"}}, w.ids())
+	assert.Equal(t, 4.0, testutil.ToFloat64(s.metrics.analyticsRows.WithLabelValues(s.name, "stored")))
+
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "5"}})
+	assert.Len(t, s.queue, 0)
+}
+
+func TestAnalyticsSinkDropped(t *testing.T) {
+	s, w := newTestAnalyticsSink(t, "clickhouse://localhost?table=updates&queue_size=1")
+	w.err = errors.New("unavailable")
+
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "1"}})
+	s.publish(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "2"}})
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.analyticsRows.WithLabelValues(s.name, "dropped")))
+
+	go s.run()
+	s.Close()
+	assert.Equal(t, 2.0, testutil.ToFloat64(s.metrics.analyticsRows.WithLabelValues(s.name, "dropped")))
+}
+
+func TestAnalyticsSinkRow(t *testing.T) {
+	s, _ := newTestAnalyticsSink(t, "clickhouse://localhost?table=updates")
+
+	u := &Update{
+		Topics:    []string{"https://example.com/books/1", "https://example.com/books"},
+		Targets:   map[string]struct{}{"b": {}, "a": {}},
+		Event:     Event{ID: "1", Type: "update", Data: "data"},
+		Time:      time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CET", 3600)),
+		Publisher: "admin",
+	}
+	assert.Equal(t, &analyticsRow{
+		ID:        "1",
+		Type:      "update",
+		Topics:    []string{"https://example.com/books/1", "https://example.com/books"},
+		Data:      "data",
+		Targets:   []string{"a", "b"},
+		Publisher: "admin",
+		Time:      "2020-01-02T02:04:05.123456Z",
+		Instance:  "hub-test",
+	}, s.row(u))
+
+	assert.Equal(t, `{"id":"1","type":"","topics":["t"],"data":"","targets":[],"publisher":"","time":"","instance":""}`+"\n"+`{"id":"2","type":"","topics":null,"data":"","targets":null,"publisher":"","time":"","instance":""}`+"\n", string(encodeAnalyticsRows([]*analyticsRow{{ID: "1", Topics: []string{"t"}, Targets: []string{}}, {ID: "2"}})))
+}
+
+func TestHubAnalyticsSinks(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	v := viper.New()
+	v.Set("analytics_sinks", []string{"clickhouse://" + strings.TrimPrefix(server.URL, "http://") + "?table=updates"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	require.Len(t, hub.sinks, 1)
+
+	form := url.Values{"topic": {"http://example.com/books/1"}, "data": {"Hello"}, "id": {"1"}}
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The batch is stored when the hub stops
+	hub.Stop()
+
+	assert.Contains(t, <-bodies, `"id":"1"`)
+}
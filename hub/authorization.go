@@ -1,14 +1,17 @@
 package hub
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -17,11 +20,59 @@ import (
 type claims struct {
 	Mercure mercureClaim `json:"mercure"`
 	jwt.StandardClaims
+
+	// raw contains all the claims of the JWT, including the custom ones
+	raw json.RawMessage
+}
+
+// UnmarshalJSON decodes the claims, and keeps a copy of the raw JSON document to look up custom claims.
+func (c *claims) UnmarshalJSON(data []byte) error {
+	type plainClaims claims
+	if err := json.Unmarshal(data, (*plainClaims)(c)); err != nil {
+		return err
+	}
+	c.raw = append(json.RawMessage(nil), data...)
+
+	return nil
+}
+
+// claim returns the value of the given claim as a string, nested claims are separated by dots (e.g. "mercure.client_id").
+// The second return value is false if the claim doesn't exist or isn't a string or a number.
+func (c *claims) claim(path string) (string, bool) {
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(c.raw))
+	d.UseNumber()
+	if d.Decode(&value) != nil {
+		return "", false
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[name]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	}
+
+	return "", false
 }
 
 type mercureClaim struct {
 	Publish   []string `json:"publish"`
 	Subscribe []string `json:"subscribe"`
+	// Admin grants access to the administration endpoints, it's only taken into account in JWTs signed with the publisher key
+	Admin bool `json:"admin,omitempty"`
+	// Debug grants access to the debugging endpoints, it's only taken into account in JWTs signed with the publisher key
+	Debug bool `json:"debug,omitempty"`
 }
 
 type role int
@@ -49,9 +100,12 @@ func (h *Hub) getJWTKey(r role) []byte {
 		configKey = "publisher_jwt_key"
 	}
 
-	key := h.config.GetString(configKey)
-	if key == "" {
-		key = h.config.GetString("jwt_key")
+	key, err := getSecret(h.config, configKey)
+	if err == nil && key == "" {
+		key, err = getSecret(h.config, "jwt_key")
+	}
+	if err != nil {
+		log.Panic(err)
 	}
 	if key == "" {
 		log.Panicf("one of these configuration parameters must be defined: [%s jwt_key]", configKey)
@@ -122,7 +176,7 @@ func authorize(r *http.Request, jwtKey []byte, jwtSigningAlgorithm jwt.SigningMe
 	}
 
 	for _, allowedOrigin := range publishAllowedOrigins {
-		if origin == allowedOrigin {
+		if matchOrigin(allowedOrigin, origin) {
 			return validateJWT(cookie.Value, jwtKey, jwtSigningAlgorithm)
 		}
 	}
@@ -345,6 +345,20 @@ func TestAuthorizeCookieOriginHasPriorityRsa(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestAuthorizeCookieWildcardOrigin(t *testing.T) {
+	r, _ := http.NewRequest("POST", defaultHubURL, nil)
+	r.Header.Add("Origin", "https://tenant1.example.net")
+	r.AddCookie(&http.Cookie{Name: "mercureAuthorization", Value: validFullHeader})
+
+	claims, err := authorize(r, []byte("!ChangeMe!"), hmacSigningMethod, []string{"https://*.example.net"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, claims.Mercure.Publish)
+
+	r.Header.Set("Origin", "https://example.net")
+	_, err = authorize(r, []byte("!ChangeMe!"), hmacSigningMethod, []string{"https://*.example.net"})
+	assert.EqualError(t, err, `"https://example.net": origin not allowed to post updates`)
+}
+
 func TestAuthorizedNilClaim(t *testing.T) {
 	all, targets := authorizedTargets(nil, true)
 	assert.False(t, all)
@@ -391,6 +405,32 @@ func TestAuthorizedAllTargetsSubscriber(t *testing.T) {
 	assert.Empty(t, targets)
 }
 
+func TestClaimsCustomClaim(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      "alice",
+		"tenant":   map[string]interface{}{"id": 42, "name": "acme"},
+		"mercure":  map[string]interface{}{"subscribe": []string{"foo"}},
+		"empty":    "",
+		"verified": true,
+	})
+	tokenString, _ := token.SignedString([]byte("!ChangeMe!"))
+
+	c, err := validateJWT(tokenString, []byte("!ChangeMe!"), jwt.SigningMethodHS256)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo"}, c.Mercure.Subscribe)
+
+	for path, expected := range map[string]string{"sub": "alice", "tenant.id": "42", "tenant.name": "acme"} {
+		v, ok := c.claim(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, v)
+	}
+
+	for _, path := range []string{"missing", "tenant", "tenant.missing", "sub.foo", "empty", "verified"} {
+		_, ok := c.claim(path)
+		assert.False(t, ok, path)
+	}
+}
+
 func TestGetJWTKeyInvalid(t *testing.T) {
 	v := viper.New()
 	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
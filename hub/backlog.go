@@ -0,0 +1,68 @@
+package hub
+
+import "time"
+
+// readBacklog returns the given update followed by the updates already queued in the pipe, without blocking.
+// The second return value is false if the pipe has been closed while reading.
+func readBacklog(pipe *Pipe, first *Update) ([]*Update, bool) {
+	c := pipe.Read()
+	backlog := []*Update{first}
+	for n := len(c); n > 0; n-- {
+		update, ok := <-c
+		if !ok {
+			return backlog, false
+		}
+		backlog = append(backlog, update)
+	}
+
+	return backlog, true
+}
+
+// compactBacklog returns the updates of the backlog to deliver to the subscriber.
+// Expired updates are skipped, and so are latest-only updates superseded by a later update of the same canonical topic
+// and updates deleted by a later tombstone.
+func compactBacklog(backlog []*Update, s *Subscriber, now time.Time) []*Update {
+	deliverable := make([]*Update, 0, len(backlog))
+	latest := make(map[string]int)
+	// tombstones contain the index of the last tombstone deleting an update, by ID, and all the updates of a canonical topic
+	var idTombstones, topicTombstones map[string]int
+	for _, u := range backlog {
+		if u.Expired(now) || len(u.Topics) == 0 || !s.IsAuthorized(u) || !s.IsSubscribed(u) {
+			continue
+		}
+
+		switch u.Tombstone {
+		case "":
+		case tombstoneTopic:
+			if topicTombstones == nil {
+				topicTombstones = make(map[string]int)
+			}
+			topicTombstones[u.Topics[0]] = len(deliverable)
+		default:
+			if idTombstones == nil {
+				idTombstones = make(map[string]int)
+			}
+			idTombstones[u.Tombstone] = len(deliverable)
+		}
+
+		latest[u.Topics[0]] = len(deliverable)
+		deliverable = append(deliverable, u)
+	}
+
+	compacted := deliverable[:0]
+	for i, u := range deliverable {
+		if u.LatestOnly && latest[u.Topics[0]] != i {
+			continue
+		}
+		if j, ok := idTombstones[u.ID]; ok && j > i {
+			continue
+		}
+		if j, ok := topicTombstones[u.Topics[0]]; ok && j > i && u.Tombstone == "" {
+			continue
+		}
+
+		compacted = append(compacted, u)
+	}
+
+	return compacted
+}
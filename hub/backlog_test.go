@@ -0,0 +1,83 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBacklog(t *testing.T) {
+	pipe := NewPipe(5, time.Second)
+	first, second, third := &Update{Event: Event{ID: "1"}}, &Update{Event: Event{ID: "2"}}, &Update{Event: Event{ID: "3"}}
+	pipe.Write(first)
+	pipe.Write(second)
+	pipe.Write(third)
+
+	backlog, open := readBacklog(pipe, <-pipe.Read())
+	assert.True(t, open)
+	assert.Equal(t, []*Update{first, second, third}, backlog)
+
+	backlog, open = readBacklog(pipe, first)
+	assert.True(t, open)
+	assert.Equal(t, []*Update{first}, backlog)
+}
+
+func TestCompactBacklog(t *testing.T) {
+	now := time.Now()
+	topics := []string{"http://example.com/books/1", "http://example.com/books/2", "http://example.com/books/3"}
+	s := NewSubscriber(true, nil, topics, topics, nil, "")
+
+	update := func(id, topic string, latestOnly bool, expires time.Time) *Update {
+		return &Update{Topics: []string{topic}, Event: Event{ID: id}, LatestOnly: latestOnly, Expires: expires}
+	}
+
+	backlog := []*Update{
+		update("1", "http://example.com/books/1", true, time.Time{}),
+		update("2", "http://example.com/books/2", true, time.Time{}),
+		update("3", "http://example.com/books/1", false, time.Time{}),
+		update("4", "http://example.com/books/1", true, time.Time{}),
+		update("5", "http://example.com/books/2", false, now.Add(-time.Second)),
+		update("6", "http://example.com/books/3", false, now.Add(time.Minute)),
+		update("7", "http://example.com/authors/1", true, time.Time{}),
+		update("8", "http://example.com/books/1", true, time.Time{}),
+	}
+
+	var ids []string
+	for _, u := range compactBacklog(backlog, s, now) {
+		ids = append(ids, u.ID)
+	}
+
+	// 1 and 4 are superseded by 8, 3 isn't latest-only, 5 is expired and 2 is kept because of it, the subscriber isn't subscribed to 7
+	assert.Equal(t, []string{"2", "3", "6", "8"}, ids)
+	assert.Len(t, backlog, 8)
+}
+
+func TestCompactBacklogTombstones(t *testing.T) {
+	topics := []string{"http://example.com/books/1", "http://example.com/books/2"}
+	s := NewSubscriber(true, nil, topics, topics, nil, "")
+
+	update := func(id, topic, tombstone string) *Update {
+		return &Update{Topics: []string{topic}, Event: Event{ID: id}, Tombstone: tombstone}
+	}
+
+	backlog := []*Update{
+		update("1", "http://example.com/books/1", ""),
+		update("2", "http://example.com/books/2", ""),
+		update("3", "http://example.com/books/2", ""),
+		update("4", "http://example.com/books/1", "2"),
+		update("5", "http://example.com/books/1", "7"),
+		update("6", "http://example.com/books/1", ""),
+		update("7", "http://example.com/books/2", ""),
+		update("8", "http://example.com/books/2", tombstoneTopic),
+		update("9", "http://example.com/books/2", ""),
+	}
+
+	var ids []string
+	for _, u := range compactBacklog(backlog, s, time.Now()) {
+		ids = append(ids, u.ID)
+	}
+
+	// 2 is deleted by 4, 3 and 7 by 8, 5 is published before 7 so it doesn't delete it, 9 is published after 8
+	assert.Equal(t, []string{"1", "4", "5", "6", "8", "9"}, ids)
+}
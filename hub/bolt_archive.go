@@ -0,0 +1,247 @@
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultBoltArchiveMaxSegments = 10
+	// boltArchiveTimeout is the timeout of the requests uploading and downloading a segment
+	boltArchiveTimeout = 5 * time.Minute
+	// boltArchiveSuffix is the suffix of the names of the segments, the name of a partition followed by the gzip extension
+	boltArchiveSuffix = ".db.gz"
+)
+
+// boltArchive stores the expired partitions of a BoltTransport as gzipped segments in an object storage,
+// so the subscribers reconnecting with the ID of an update not in the partitions anymore can still replay the history.
+type boltArchive struct {
+	bucket *s3Bucket
+	name   string
+	// maxSegments is the number of most recent segments in which the ID of a subscriber is searched
+	maxSegments int
+	// uploads tracks the segments being uploaded
+	uploads sync.WaitGroup
+}
+
+// newBoltArchive creates an archive from a DSN such as s3://bucket/prefix?region=eu-west-3.
+func newBoltArchive(dsn string, maxSegments int) (*boltArchive, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", redactParseError(err), ErrInvalidTransportDSN)
+	}
+	if u.Scheme != "s3" {
+		return nil, fmt.Errorf(`%q: the scheme must be "s3": %w`, u.Scheme, ErrInvalidTransportDSN)
+	}
+
+	b, name, err := newS3Bucket(u, &http.Client{Timeout: boltArchiveTimeout}, ErrInvalidTransportDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltArchive{bucket: b, name: name, maxSegments: maxSegments}, nil
+}
+
+// upload uploads the file of an expired partition in the background, the file is removed once it's stored.
+// If the upload fails, the file is kept: it's uploaded again when the transport is reopened.
+func (a *boltArchive) upload(path string) {
+	a.uploads.Add(1)
+	go func() {
+		defer a.uploads.Done()
+
+		if err := a.store(path); err != nil {
+			log.Error(fmt.Errorf("bolt archive: %s: %w", path, err))
+			return
+		}
+
+		if err := os.Remove(path); err != nil {
+			log.Error(fmt.Errorf("bolt archive: %w", err))
+		}
+	}()
+}
+
+// store compresses the file and uploads it as a segment named after the partition.
+func (a *boltArchive) store(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, f); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	key := a.bucket.objectKey(strings.TrimSuffix(filepath.Base(path), ".db") + boltArchiveSuffix)
+
+	return a.bucket.put(context.Background(), key, buf.Bytes(), "application/gzip")
+}
+
+// segments returns the keys of the most recent segments, ordered from the oldest one.
+func (a *boltArchive) segments() ([]string, error) {
+	keys, err := a.bucket.list(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	// The names of the segments are the start time of their partition, so the lexical order is the chronological one
+	segments := keys[:0]
+	for _, key := range keys {
+		if strings.HasSuffix(key, boltArchiveSuffix) {
+			segments = append(segments, key)
+		}
+	}
+	if len(segments) > a.maxSegments {
+		segments = segments[len(segments)-a.maxSegments:]
+	}
+
+	return segments, nil
+}
+
+// download decompresses the segment in a temporary file, and opens it in read-only mode.
+// The database must be closed and the file removed by the caller.
+func (a *boltArchive) download(key string) (*boltPartition, error) {
+	body, err := a.bucket.get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	f, err := ioutil.TempFile("", "mercure-archive-")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, zr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{ReadOnly: true, Timeout: boltReadOnlyOpenTimeout})
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return &boltPartition{path: f.Name(), db: db}, nil
+}
+
+// close closes the databases of the downloaded segments and removes their files.
+func (a *boltArchive) close(segments []*boltPartition) {
+	for _, p := range segments {
+		p.db.Close()
+		os.Remove(p.path)
+	}
+}
+
+// containsID returns true if the partition contains the update having the ID.
+func (t *BoltTransport) containsID(p *boltPartition, id string) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	found := false
+	p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			return nil // No data
+		}
+
+		if start, covered := t.seekID(tx, b, id); covered {
+			found = start != nil
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if string(k[8:]) == id {
+				found = true
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return found
+}
+
+// partitionsContainID returns true if one of the partitions contains the update having the ID.
+func (t *BoltTransport) partitionsContainID(partitions []*boltPartition, id string) bool {
+	for _, p := range partitions {
+		if t.containsID(p, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchArchive sends the updates of the archive following the one of the cursor, if one of the most recent segments contains it.
+// The segments are searched from the most recent one. It returns true if the update has been found, and true if no more updates must be sent.
+func (t *BoltTransport) fetchArchive(cursor Cursor, pipe *Pipe) (bool, bool) {
+	keys, err := t.archive.segments()
+	if err != nil {
+		log.Error(fmt.Errorf("bolt archive: %w", err))
+		return false, false
+	}
+
+	var downloaded []*boltPartition
+	defer func() { t.archive.close(downloaded) }()
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		p, err := t.archive.download(keys[i])
+		if err != nil {
+			log.Error(fmt.Errorf("bolt archive: %w", err))
+			return false, false
+		}
+		downloaded = append(downloaded, p)
+
+		if !t.containsID(p, cursor.ID) {
+			continue
+		}
+
+		// Replay this segment from the update following the cursor, then the more recent ones
+		afterFromID := false
+		for j := len(downloaded) - 1; j >= 0; j-- {
+			stop, err := t.fetchPartition(downloaded[j], cursor, &afterFromID, 0, pipe)
+			if err != nil {
+				log.Error(fmt.Errorf("bolt archive: %w", err))
+				return true, true
+			}
+			if stop {
+				return true, true
+			}
+		}
+
+		return true, false
+	}
+
+	return false, false
+}
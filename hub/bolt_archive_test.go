@@ -0,0 +1,129 @@
+package hub
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltTransportArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-bolt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	server := newTestS3Server(t, "archives")
+	defer server.Close()
+
+	archiveURL := "s3://archives/mercure?region=us-east-1&access_key_id=id&secret_access_key=secret&endpoint=" + url.QueryEscape(server.URL)
+	q := url.Values{"rotate": {"1h"}, "retention": {"2h"}, "archive_url": {archiveURL}}
+	u, _ := url.Parse("bolt://" + filepath.Join(dir, "updates") + "?" + q.Encode())
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	for i, offset := range []time.Duration{0, time.Hour, 2 * time.Hour, 4 * time.Hour} {
+		require.Nil(t, transport.Write(&Update{Event: Event{ID: strconv.Itoa(i + 1)}, Time: start.Add(offset)}))
+	}
+	transport.archive.uploads.Wait()
+
+	// The first two partitions are out of the retention period, they have been uploaded then removed
+	files, _ := filepath.Glob(filepath.Join(dir, "updates", "*.db"))
+	assert.Len(t, files, 2)
+	var keys []string
+	for k := range server.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	assert.Equal(t, []string{
+		"mercure/" + start.Format(boltPartitionLayout) + ".db.gz",
+		"mercure/" + start.Add(time.Hour).Format(boltPartitionLayout) + ".db.gz",
+	}, keys)
+
+	assertHistory := func(transport *BoltTransport, cursor Cursor, ids ...string) {
+		pipe, err := transport.CreatePipe(cursor)
+		require.Nil(t, err)
+		defer pipe.Close()
+
+		for _, id := range ids {
+			select {
+			case u := <-pipe.Read():
+				assert.Equal(t, id, u.ID)
+			case <-time.After(time.Second):
+				t.Fatalf("update %q not received", id)
+			}
+		}
+
+		require.Nil(t, transport.Write(&Update{Event: Event{ID: "live"}, Time: start.Add(4 * time.Hour)}))
+		assert.Equal(t, "live", (<-pipe.Read()).ID)
+	}
+
+	assertHistory(transport, AfterIDCursor("1"), "2", "3", "4")
+	assertHistory(transport, AfterIDCursor("2"), "3", "4")
+	assertHistory(transport, AfterIDCursor("3"), "4")
+	assertHistory(transport, AfterIDCursor("unknown"))
+
+	// The ID is only searched in the most recent segments
+	transport.archive.maxSegments = 1
+	assertHistory(transport, AfterIDCursor("2"), "3", "4")
+	assertHistory(transport, AfterIDCursor("1"))
+
+	tmp, _ := filepath.Glob(filepath.Join(os.TempDir(), "mercure-archive-*"))
+	assert.Empty(t, tmp, "the downloaded segments are removed")
+
+	config := transport.transportConfig()
+	assert.Equal(t, "s3:archives/mercure", config.Options["archive"])
+	assert.Equal(t, 1, config.Options["archive_max_segments"])
+}
+
+func TestBoltTransportArchiveUploadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-bolt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	server := newTestS3Server(t, "archives")
+	defer server.Close()
+
+	// The bucket doesn't exist
+	archiveURL := "s3://missing?region=us-east-1&access_key_id=id&secret_access_key=secret&endpoint=" + url.QueryEscape(server.URL)
+	q := url.Values{"rotate": {"1h"}, "retention": {"1h"}, "archive_url": {archiveURL}}
+	u, _ := url.Parse("bolt://" + filepath.Join(dir, "updates") + "?" + q.Encode())
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "1"}, Time: start}))
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "2"}, Time: start.Add(2 * time.Hour)}))
+	require.Nil(t, transport.Close())
+
+	// The file is kept, to be uploaded again when the transport is reopened
+	files, _ := filepath.Glob(filepath.Join(dir, "updates", "*.db"))
+	assert.Len(t, files, 2)
+	assert.Empty(t, server.objects)
+}
+
+func TestNewBoltTransportArchiveErrors(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"bolt://updates?archive_url=s3%3A%2F%2Farchives":                                                       `the "archive_url" parameter requires the "rotate" parameter`,
+		"bolt://updates?rotate=1h&archive_dir=archives&archive_url=s3%3A%2F%2Farchives":                        `the "archive_dir" and "archive_url" parameters cannot be used together`,
+		"bolt://updates?rotate=1h&archive_url=s3%3A%2F%2Farchives%3Fregion%3Dus-east-1&archive_max_segments=0": `invalid "archive_max_segments" parameter "0"`,
+		"bolt://updates?rotate=1h&archive_url=gs%3A%2F%2Farchives":                                             `invalid "archive_url" parameter: "gs": the scheme must be "s3"`,
+		"bolt://updates?rotate=1h&archive_url=s3%3A%2F%2Farchives%3Faccess_key_id%3Did":                        `invalid "archive_url" parameter: s3:archives: missing "region" parameter`,
+	} {
+		u, _ := url.Parse(dsn)
+		_, err := NewBoltTransport(u, 5, time.Second)
+		require.NotNil(t, err, dsn)
+		assert.True(t, errors.Is(err, ErrInvalidTransportDSN))
+		assert.True(t, strings.Contains(err.Error(), expected), err.Error())
+	}
+}
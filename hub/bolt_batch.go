@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"time"
+)
+
+const defaultBoltBatchSize = 1000
+
+// boltWrite is an update to store, along with its encoded record.
+// When the batching is enabled, err receives the result of the transaction of its batch.
+type boltWrite struct {
+	update *Update
+	record []byte
+	err    chan error
+}
+
+// enqueue adds the update to the current batch and waits until the batch is stored.
+// The batch is stored when the batch interval has elapsed since its first update, or as soon as it contains batchSize updates.
+func (t *BoltTransport) enqueue(update *Update, record []byte) error {
+	w := &boltWrite{update: update, record: record, err: make(chan error, 1)}
+
+	t.batchMu.Lock()
+	t.batch = append(t.batch, w)
+	switch len(t.batch) {
+	case t.batchSize:
+		t.flushBatch()
+	case 1:
+		t.batchTimer = time.AfterFunc(t.batchInterval, func() {
+			t.batchMu.Lock()
+			t.flushBatch()
+		})
+		t.batchMu.Unlock()
+	default:
+		t.batchMu.Unlock()
+	}
+
+	return <-w.err
+}
+
+// flushBatch stores the pending updates in a single transaction, and sends the result to their writers.
+// It must be called with batchMu locked, and unlocks it once the transport is locked, so the batches are stored in order.
+func (t *BoltTransport) flushBatch() {
+	batch := t.batch
+	t.batch = nil
+	if t.batchTimer != nil {
+		// If the timer has already fired, it will find an empty batch, or store the next one a bit early
+		t.batchTimer.Stop()
+		t.batchTimer = nil
+	}
+
+	if len(batch) == 0 {
+		t.batchMu.Unlock()
+		return
+	}
+
+	t.Lock()
+	t.batchMu.Unlock()
+
+	var err error
+	select {
+	case <-t.done:
+		err = ErrClosedTransport
+	default:
+		err = t.store(batch)
+	}
+	t.Unlock()
+
+	for _, w := range batch {
+		w.err <- err
+	}
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltTransportBatchSize(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?batch_interval=1h&batch_size=3")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorLatest})
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 1; i <= 2; i++ {
+		go func(id string) {
+			defer wg.Done()
+			assert.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: id}}))
+		}(strconv.Itoa(i))
+	}
+
+	// The updates wait for the batch to be full
+	require.Eventually(t, func() bool {
+		transport.batchMu.Lock()
+		defer transport.batchMu.Unlock()
+
+		return len(transport.batch) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), transport.lastSeq.Load())
+	assert.Len(t, pipe.Read(), 0)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "3"}}))
+	wg.Wait()
+	assert.Equal(t, uint64(3), transport.lastSeq.Load())
+	assert.Len(t, pipe.Read(), 3)
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 3, tx.Bucket([]byte("updates")).Stats().KeyN)
+
+		return nil
+	})
+}
+
+func TestBoltTransportBatchInterval(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?batch_interval=10ms")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorLatest})
+	require.Nil(t, err)
+
+	start := time.Now()
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "1"}}))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(10*time.Millisecond))
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 2; i <= 11; i++ {
+		go func(id string) {
+			defer wg.Done()
+			assert.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: id}}))
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(11), transport.lastSeq.Load())
+
+	// The batched updates are replayed in the order they were stored
+	pipe, err = transport.CreatePipe(Cursor{Kind: CursorEarliest})
+	require.Nil(t, err)
+	ids := readIDs(t, transport, pipe, 11)
+	assert.Equal(t, "1", ids[0])
+	assert.Len(t, ids, 11)
+}
+
+func TestBoltTransportBatchClose(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?batch_interval=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	errs := make(chan error)
+	go func() {
+		errs <- transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "1"}})
+	}()
+	require.Eventually(t, func() bool {
+		transport.batchMu.Lock()
+		defer transport.batchMu.Unlock()
+
+		return len(transport.batch) == 1
+	}, time.Second, time.Millisecond)
+
+	// The pending updates are stored when the transport is closed
+	require.Nil(t, transport.Close())
+	assert.Nil(t, <-errs)
+	assert.Equal(t, uint64(1), transport.lastSeq.Load())
+
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{Topics: []string{"http://example.com/a"}}))
+}
@@ -0,0 +1,453 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultBoltCompactionInterval = time.Minute
+	// boltCompactionBatchSize is the maximum number of records copied per transaction by the compaction
+	boltCompactionBatchSize = 1000
+)
+
+// ErrBoltFileSizeExceeded is returned when an update isn't stored because the Bolt database exceeds its maximum file size.
+var ErrBoltFileSizeExceeded = errors.New("bolt: the database exceeds its maximum file size")
+
+// runCompaction periodically compacts the database where new updates are written when the ratio of its free pages exceeds the threshold,
+// and collects the size of its file.
+// Bolt never shrinks its files: the pages freed by the cleanup of the history are only reused by the next writes.
+// The older partitions aren't written anymore, they are never compacted.
+func (t *BoltTransport) runCompaction() {
+	ticker := time.NewTicker(t.compactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		t.Lock()
+		select {
+		case <-t.done:
+			t.Unlock()
+			return
+		default:
+		}
+		compact := t.compactionThreshold > 0 && t.freeRatio() >= t.compactionThreshold
+		t.Unlock()
+
+		if compact {
+			if err := t.compact(); err != nil {
+				log.Error(fmt.Errorf("bolt compaction: %w", err))
+				if errors.Is(err, ErrClosedTransport) {
+					return
+				}
+			}
+		}
+
+		t.Lock()
+		select {
+		case <-t.done:
+			t.Unlock()
+			return
+		default:
+		}
+		t.collectFileSize(t.maxFileSize > 0 && t.fileSize() > t.maxFileSize)
+		t.Unlock()
+	}
+}
+
+// checkFileSize returns ErrBoltFileSizeExceeded if the database where new updates are written exceeds the maximum file size.
+// The database is compacted first if it would be enough to go below the limit, unless a background compaction is already running.
+// The lock of the transport must be held: the writes are blocked until the compaction ends.
+func (t *BoltTransport) checkFileSize() error {
+	size := t.fileSize()
+	if size <= t.maxFileSize {
+		return nil
+	}
+
+	if t.compactionJournal == nil && size-int64(t.db.Stats().FreeAlloc) <= t.maxFileSize {
+		if err := t.compactLocked(); err != nil {
+			if errors.Is(err, ErrClosedTransport) {
+				return err
+			}
+			log.Error(fmt.Errorf("bolt compaction: %w", err))
+		}
+
+		if size = t.fileSize(); size <= t.maxFileSize {
+			t.collectFileSize(false)
+			return nil
+		}
+	}
+
+	t.collectFileSize(true)
+
+	return ErrBoltFileSizeExceeded
+}
+
+// fileSize returns the size of the database where new updates are written.
+func (t *BoltTransport) fileSize() int64 {
+	var size int64
+	t.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+
+		return nil
+	})
+
+	return size
+}
+
+// freeRatio returns the ratio of the database where new updates are written occupied by free pages.
+func (t *BoltTransport) freeRatio() float64 {
+	size := t.fileSize()
+	if size == 0 {
+		return 0
+	}
+
+	return float64(t.db.Stats().FreeAlloc) / float64(size)
+}
+
+// collectFileSize collects the size of the database where new updates are written.
+func (t *BoltTransport) collectFileSize(exceeded bool) {
+	if t.metrics != nil {
+		t.metrics.BoltFileSize(t.db.Path(), t.fileSize(), exceeded)
+	}
+}
+
+// compact replaces the database where new updates are written by a copy without its free pages.
+// The lock of the transport must not be held: the database is copied in batches while the updates are still written,
+// the lock is only taken to copy again the keys written meanwhile and to replace the file.
+func (t *BoltTransport) compact() error {
+	t.Lock()
+	select {
+	case <-t.done:
+		t.Unlock()
+		return ErrClosedTransport
+	default:
+	}
+	if t.compactionJournal != nil {
+		t.Unlock()
+		return nil
+	}
+	p := t.partitions[len(t.partitions)-1]
+	t.compactionJournal = &boltJournal{}
+	t.Unlock()
+
+	tmp := p.path + ".compact"
+	err := copyBoltDB(p.db, tmp, boltCompactionBatchSize)
+
+	t.Lock()
+	defer t.Unlock()
+
+	journal := t.compactionJournal
+	t.compactionJournal = nil
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	select {
+	case <-t.done:
+		os.Remove(tmp)
+		return ErrClosedTransport
+	default:
+	}
+	if p != t.partitions[len(t.partitions)-1] {
+		// The partition has been rotated during the copy, it isn't written anymore
+		os.Remove(tmp)
+		return nil
+	}
+
+	if err := journal.replay(p.db, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return t.swapCompacted(p, tmp)
+}
+
+// compactLocked is like compact, but the lock of the transport is held during the whole copy.
+func (t *BoltTransport) compactLocked() error {
+	p := t.partitions[len(t.partitions)-1]
+	tmp := p.path + ".compact"
+	if err := copyBoltDB(p.db, tmp, boltCompactionBatchSize); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return t.swapCompacted(p, tmp)
+}
+
+// swapCompacted replaces the file of the partition by the compacted copy tmp.
+// The lock of the transport must be held, the running replays of the partition are waited for before replacing the file.
+// If the copy can't replace the original file, the original one is reopened. If it can't be reopened either, the transport is closed.
+func (t *BoltTransport) swapCompacted(p *boltPartition, tmp string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	err := t.replaceByCompacted(p, tmp)
+	if err == nil {
+		if t.metrics != nil {
+			t.metrics.BoltCompaction(p.path)
+		}
+		log.WithFields(log.Fields{"path": p.path}).Info("Bolt database compacted")
+
+		return nil
+	}
+	os.Remove(tmp)
+
+	db, openErr := bolt.Open(p.path, 0600, t.options())
+	if openErr != nil {
+		t.shutdown()
+
+		return fmt.Errorf("%v, the database can't be reopened: %s: %w", err, openErr, ErrClosedTransport)
+	}
+	p.db = db
+	t.db = db
+
+	return err
+}
+
+// replaceByCompacted closes the database of the partition, replaces its file by the compacted copy tmp and opens it.
+// The original file is kept until the copy is opened, and restored if it can't be.
+func (t *BoltTransport) replaceByCompacted(p *boltPartition, tmp string) error {
+	if err := p.db.Close(); err != nil {
+		return err
+	}
+
+	original := p.path + ".orig"
+	if err := os.Rename(p.path, original); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		os.Rename(original, p.path)
+		return err
+	}
+
+	db, err := bolt.Open(p.path, 0600, t.options())
+	if err != nil {
+		os.Rename(original, p.path)
+		return err
+	}
+	os.Remove(original)
+	p.db = db
+	t.db = db
+
+	return nil
+}
+
+// boltJournal records the keys written while the database is copied by a compaction, to copy them again once the writes are blocked.
+// It must only be used while the lock of the transport is held.
+type boltJournal struct {
+	keys []boltJournalKey
+}
+
+type boltJournalKey struct {
+	bucket [][]byte
+	key    []byte
+}
+
+// record records that the key of the bucket at path has been written or removed. It does nothing if the journal is nil.
+func (j *boltJournal) record(key []byte, path ...[]byte) {
+	if j == nil {
+		return
+	}
+
+	j.keys = append(j.keys, boltJournalKey{path, append([]byte(nil), key...)})
+}
+
+// replay copies the current value of the recorded keys and the sequences of the buckets of the database to the copy stored at path,
+// in a single transaction.
+func (j *boltJournal) replay(src *bolt.DB, path string) error {
+	dst, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = src.View(func(stx *bolt.Tx) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			for _, k := range j.keys {
+				var v []byte
+				if sb := bucketAt(stx, k.bucket); sb != nil {
+					v = sb.Get(k.key)
+				}
+
+				if v == nil {
+					if db := bucketAt(dtx, k.bucket); db != nil {
+						if err := db.Delete(k.key); err != nil {
+							return err
+						}
+					}
+
+					continue
+				}
+
+				db, err := createBucketAt(dtx, k.bucket)
+				if err != nil {
+					return err
+				}
+				if err := db.Put(k.key, v); err != nil {
+					return err
+				}
+			}
+
+			// Only the sequences of the top-level buckets are modified by the writes
+			return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				db, err := dtx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+
+				return db.SetSequence(b.Sequence())
+			})
+		})
+	})
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// copyBoltDB copies all the buckets of the database to a new one stored at path, in transactions of at most batchSize records.
+// The database can be written during the copy: the records written after their bucket has been copied are missing from the copy,
+// the keys written meanwhile must be copied again with a boltJournal.
+func copyBoltDB(src *bolt.DB, path string, batchSize int) error {
+	// Leftover of an interrupted compaction
+	os.Remove(path)
+
+	dst, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	var buckets [][][]byte
+	err = src.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets = appendBucketPaths(buckets, [][]byte{append([]byte(nil), name...)}, b)
+
+			return nil
+		})
+	})
+
+	for _, bucket := range buckets {
+		if err != nil {
+			break
+		}
+		err = copyBucket(src, dst, bucket, batchSize)
+	}
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// appendBucketPaths appends the path of the bucket and the ones of its nested buckets to paths.
+func appendBucketPaths(paths [][][]byte, path [][]byte, b *bolt.Bucket) [][][]byte {
+	paths = append(paths, path)
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nested := append(append(make([][]byte, 0, len(path)+1), path...), append([]byte(nil), k...))
+			paths = appendBucketPaths(paths, nested, b.Bucket(k))
+		}
+
+		return nil
+	})
+
+	return paths
+}
+
+// copyBucket copies the records and the sequence of the bucket at path, in transactions of at most batchSize records.
+// The nested buckets are created but their records aren't copied.
+func copyBucket(src, dst *bolt.DB, path [][]byte, batchSize int) error {
+	var from []byte
+	for first := true; ; first = false {
+		done := true
+		err := src.View(func(stx *bolt.Tx) error {
+			sb := bucketAt(stx, path)
+			if sb == nil {
+				// Removed since the bucket has been listed
+				return nil
+			}
+
+			return dst.Update(func(dtx *bolt.Tx) error {
+				db, err := createBucketAt(dtx, path)
+				if err != nil {
+					return err
+				}
+				if first {
+					if err := db.SetSequence(sb.Sequence()); err != nil {
+						return err
+					}
+				}
+
+				// The keys are copied in order
+				db.FillPercent = 1
+
+				c := sb.Cursor()
+				k, v := c.First()
+				if from != nil {
+					k, v = c.Seek(from)
+				}
+				for n := 0; k != nil; k, v = c.Next() {
+					if n == batchSize {
+						from = append([]byte(nil), k...)
+						done = false
+
+						return nil
+					}
+					if v == nil {
+						continue
+					}
+
+					if err := db.Put(k, v); err != nil {
+						return err
+					}
+					n++
+				}
+
+				return nil
+			})
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// bucketAt returns the bucket at path, or nil if it doesn't exist.
+func bucketAt(tx *bolt.Tx, path [][]byte) *bolt.Bucket {
+	b := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+
+	return b
+}
+
+// createBucketAt returns the bucket at path, creating it and its parents if they don't exist.
+func createBucketAt(tx *bolt.Tx, path [][]byte) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists(path[0])
+	for _, name := range path[1:] {
+		if err != nil {
+			return nil, err
+		}
+		b, err = b.CreateBucketIfNotExists(name)
+	}
+
+	return b, err
+}
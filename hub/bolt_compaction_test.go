@@ -0,0 +1,291 @@
+package hub
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fillBoltTransport writes n updates, then removes all of them but the last 10 from the history.
+func fillBoltTransport(t *testing.T, transport *BoltTransport, n int) {
+	t.Helper()
+
+	data := strings.Repeat("a", 1024)
+	for i := 1; i <= n; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: strconv.Itoa(i), Data: data}}))
+	}
+
+	transport.Lock()
+	transport.size = 10
+	transport.cleanupFrequency = 1
+	transport.Unlock()
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: strconv.Itoa(n + 1), Data: data}}))
+}
+
+func TestBoltTransportCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?topic_index=1&compaction_threshold=0.5&compaction_interval=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	m := NewMetrics()
+	transport.setMetrics(m)
+
+	fillBoltTransport(t, transport, 200)
+
+	transport.Lock()
+	size := transport.fileSize()
+	assert.Greater(t, transport.freeRatio(), 0.5)
+	transport.Unlock()
+	require.Nil(t, transport.compact())
+	transport.Lock()
+	assert.Less(t, transport.fileSize(), size/2)
+	transport.Unlock()
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.boltCompactions.WithLabelValues(path)))
+
+	// The sequences are preserved
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, uint64(201), tx.Bucket([]byte("updates")).Sequence())
+		assert.Equal(t, uint64(1), tx.Bucket([]byte("updates_topics")).Sequence())
+
+		return nil
+	})
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorAfterID, ID: "198", Topics: []string{"http://example.com/a"}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"199", "200", "201"}, readIDs(t, transport, pipe, 3))
+}
+
+func TestBoltTransportCompactionConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?topic_index=1&id_index=1&compaction_interval=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	fillBoltTransport(t, transport, 50)
+
+	// Like compact, but the updates are written between the copy and the swap
+	transport.Lock()
+	transport.compactionJournal = &boltJournal{}
+	transport.Unlock()
+
+	p := transport.partitions[0]
+	tmp := path + ".compact"
+	require.Nil(t, copyBoltDB(p.db, tmp, 3))
+
+	for i := 52; i <= 60; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/b"}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "60"}}))
+
+	transport.Lock()
+	expected := dumpBoltDB(t, transport.db)
+	require.Nil(t, transport.compactionJournal.replay(p.db, tmp))
+	transport.compactionJournal = nil
+	require.Nil(t, transport.swapCompacted(p, tmp))
+	assert.Equal(t, expected, dumpBoltDB(t, transport.db))
+	transport.Unlock()
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorAfterID, ID: "58", Topics: []string{"http://example.com/b"}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"59", "60"}, readIDs(t, transport, pipe, 2))
+}
+
+// dumpBoltDB returns the records and the sequences of all the buckets of the database, by path.
+func dumpBoltDB(t *testing.T, db *bolt.DB) map[string]string {
+	t.Helper()
+
+	dump := make(map[string]string)
+	var walk func(path string, b *bolt.Bucket)
+	walk = func(path string, b *bolt.Bucket) {
+		dump[path] = strconv.FormatUint(b.Sequence(), 10)
+		b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				walk(path+"/"+string(k), b.Bucket(k))
+			} else {
+				dump[path+"/"+string(k)] = string(v)
+			}
+
+			return nil
+		})
+	}
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			walk(string(name), b)
+
+			return nil
+		})
+	}))
+
+	return dump
+}
+
+func TestBoltTransportCompactionFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?compaction_threshold=0.5&compaction_interval=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	fillBoltTransport(t, transport, 200)
+
+	// The original file can't be moved aside: it's kept and reopened
+	require.Nil(t, os.MkdirAll(filepath.Join(path+".orig", "dir"), 0700))
+
+	transport.Lock()
+	size := transport.fileSize()
+	transport.Unlock()
+	assert.Error(t, transport.compact())
+	transport.Lock()
+	assert.Equal(t, size, transport.fileSize())
+	transport.Unlock()
+
+	_, err = os.Stat(path + ".compact")
+	assert.True(t, os.IsNotExist(err))
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "next"}}))
+	pipe, err := transport.CreatePipe(AfterIDCursor("200"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"201", "next"}, readIDs(t, transport, pipe, 2))
+}
+
+func TestBoltTransportInterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	for _, dsn := range []string{filepath.Join(dir, "updates.db"), filepath.Join(dir, "partitions") + "?rotate=24h"} {
+		u, _ := url.Parse("bolt://" + dsn)
+		transport, err := NewBoltTransport(u, 5, time.Second)
+		require.Nil(t, err)
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "a"}}))
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "b"}}))
+		path := transport.db.Path()
+		require.Nil(t, transport.Close())
+
+		// The process stopped while the original file was moved aside
+		require.Nil(t, os.Rename(path, path+".orig"))
+
+		transport, err = NewBoltTransport(u, 5, time.Second)
+		require.Nil(t, err)
+		pipe, err := transport.CreatePipe(AfterIDCursor("a"))
+		require.Nil(t, err)
+		assert.Equal(t, []string{"b"}, readIDs(t, transport, pipe, 1))
+		require.Nil(t, transport.Close())
+
+		_, err = os.Stat(path + ".orig")
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestBoltTransportBackgroundCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?compaction_threshold=0.5&compaction_interval=10ms")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	m := NewMetrics()
+	transport.setMetrics(m)
+
+	fillBoltTransport(t, transport, 200)
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.boltCompactions.WithLabelValues(path)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	transport.Lock()
+	defer transport.Unlock()
+	assert.Less(t, transport.freeRatio(), 0.5)
+	assert.Equal(t, float64(transport.fileSize()), testutil.ToFloat64(m.boltFileSize.WithLabelValues(path)))
+}
+
+func TestBoltTransportMaxFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?max_file_size=262144&compaction_interval=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	m := NewMetrics()
+	transport.setMetrics(m)
+
+	data := strings.Repeat("a", 1024)
+	for i := 0; err == nil && i < 1000; i++ {
+		err = transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: strconv.Itoa(i), Data: data}})
+	}
+	assert.Equal(t, ErrBoltFileSizeExceeded, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.boltFileFull.WithLabelValues(path)))
+	assert.Equal(t, ErrBoltFileSizeExceeded, transport.Write(&Update{Topics: []string{"http://example.com/a"}}))
+	compactions := testutil.ToFloat64(m.boltCompactions.WithLabelValues(path))
+
+	// The database is compacted to store the updates again once the history is cleaned up
+	transport.Lock()
+	transport.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("updates"))
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && b.Stats().KeyN > 10; k, _ = c.First() {
+			require.Nil(t, b.Delete(k))
+		}
+
+		return nil
+	})
+	transport.Unlock()
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "next"}}))
+	assert.Equal(t, compactions+1, testutil.ToFloat64(m.boltCompactions.WithLabelValues(path)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.boltFileFull.WithLabelValues(path)))
+}
+
+func TestCopyBoltDB(t *testing.T) {
+	dir := t.TempDir()
+	src, err := bolt.Open(filepath.Join(dir, "src.db"), 0600, nil)
+	require.Nil(t, err)
+	defer src.Close()
+
+	require.Nil(t, src.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("a"))
+		require.Nil(t, err)
+		require.Nil(t, b.SetSequence(42))
+		require.Nil(t, b.Put([]byte("k"), []byte("v")))
+
+		nested, err := b.CreateBucket([]byte("nested"))
+		require.Nil(t, err)
+		require.Nil(t, nested.SetSequence(7))
+
+		return nested.Put([]byte("nk"), []byte("nv"))
+	}))
+
+	require.Nil(t, src.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("batches"))
+		require.Nil(t, err)
+		for i := 0; i < 5; i++ {
+			require.Nil(t, b.Put([]byte{byte(i)}, []byte{byte(i)}))
+		}
+
+		return nil
+	}))
+
+	require.Nil(t, copyBoltDB(src, filepath.Join(dir, "dst.db"), 2))
+
+	dst, err := bolt.Open(filepath.Join(dir, "dst.db"), 0600, nil)
+	require.Nil(t, err)
+	defer dst.Close()
+
+	dst.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("a"))
+		require.NotNil(t, b)
+		assert.Equal(t, uint64(42), b.Sequence())
+		assert.Equal(t, []byte("v"), b.Get([]byte("k")))
+		assert.Equal(t, uint64(7), b.Bucket([]byte("nested")).Sequence())
+		assert.Equal(t, []byte("nv"), b.Bucket([]byte("nested")).Get([]byte("nk")))
+		assert.Equal(t, 5, tx.Bucket([]byte("batches")).Stats().KeyN)
+
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltImportBatchSize is the number of imported updates stored in a single transaction.
+const boltImportBatchSize = 1000
+
+// Export writes the history stored in all the partitions in w, from the oldest update, one JSON document per line.
+// The corrupted records are skipped.
+func (t *BoltTransport) Export(w io.Writer) error {
+	t.Lock()
+	select {
+	case <-t.done:
+		t.Unlock()
+		return ErrClosedTransport
+	default:
+	}
+	partitions := append([]*boltPartition(nil), t.partitions...)
+	t.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, p := range partitions {
+		if err := t.exportPartition(p, enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportPartition writes the updates stored in the partition.
+func (t *BoltTransport) exportPartition(p *boltPartition, enc *json.Encoder) error {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			update, err := decodeRecordWith(v, t.aead)
+			if err != nil {
+				log.WithFields(log.Fields{"event_id": string(k[8:])}).Error(fmt.Errorf("bolt export: %w", err))
+				return nil
+			}
+
+			return enc.Encode(newHistoryRecord(update))
+		})
+	})
+}
+
+// Import stores the updates read from r, one JSON document per line as written by Export, after the updates already stored.
+// The time at which the updates were stored is preserved. The updates are stored by batches:
+// if an error occurs, the batches stored before are kept.
+func (t *BoltTransport) Import(r io.Reader) error {
+	if t.readOnly {
+		return ErrBoltReadOnly
+	}
+
+	dec := json.NewDecoder(r)
+	batch := make([]*boltWrite, 0, boltImportBatchSize)
+	for n := 1; ; n++ {
+		var record historyRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("bolt import: record %d: %w", n, err)
+		}
+
+		update, err := record.update()
+		if err != nil {
+			return fmt.Errorf("bolt import: record %d: %w", n, err)
+		}
+		if update.Time.IsZero() {
+			update.Time = time.Now()
+		}
+
+		data, err := encodeRecordAs(update, t.recordEncoding, t.aead)
+		if err != nil {
+			return fmt.Errorf("bolt import: record %d: %w", n, err)
+		}
+
+		batch = append(batch, &boltWrite{update: update, record: data})
+		if len(batch) == boltImportBatchSize {
+			if err := t.importBatch(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return t.importBatch(batch)
+}
+
+// importBatch stores the imported updates in a single transaction.
+func (t *BoltTransport) importBatch(batch []*boltWrite) error {
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.store(batch); err != nil {
+		return fmt.Errorf("bolt import: %w", err)
+	}
+
+	return nil
+}
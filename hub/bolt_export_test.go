@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltTransportExportImport(t *testing.T) {
+	dir := t.TempDir()
+	u, _ := url.Parse("bolt://" + filepath.Join(dir, "source.db") + "?compression=deflate")
+	source, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer source.Close()
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 1; i <= boltImportBatchSize+1; i++ {
+		require.Nil(t, source.Write(&Update{
+			Topics:  []string{"https://example.com/books/" + strconv.Itoa(i)},
+			Targets: map[string]struct{}{"b": {}, "a": {}},
+			Event:   Event{ID: strconv.Itoa(i), Data: "<p>" + strconv.Itoa(i) + "</p>"},
+			Time:    start.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	var export bytes.Buffer
+	require.Nil(t, source.Export(&export))
+	lines := strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+	require.Len(t, lines, boltImportBatchSize+1)
+	assert.Equal(t, `{"id":"1","topics":["https://example.com/books/1"],"data":"<p>1</p>","targets":["a","b"],"time":"2020-01-02T03:04:06Z"}`, lines[0])
+
+	u, _ = url.Parse("bolt://" + filepath.Join(dir, "destination.db") + "?topic_index=1")
+	destination, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer destination.Close()
+
+	require.Nil(t, destination.Import(&export))
+	assert.Equal(t, uint64(boltImportBatchSize+1), destination.lastSeq.Load())
+
+	var reexport bytes.Buffer
+	require.Nil(t, destination.Export(&reexport))
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", reexport.String())
+
+	// The imported updates are indexed
+	pipe, err := destination.CreatePipe(Cursor{Kind: CursorEarliest, Topics: []string{"https://example.com/books/42"}})
+	require.Nil(t, err)
+	u42 := <-pipe.Read()
+	assert.Equal(t, "42", u42.ID)
+	assert.Equal(t, start.Add(42*time.Second), u42.Time.UTC())
+}
+
+func TestBoltTransportExportCorrupted(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db"))
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	for _, id := range []string{"1", "2"} {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: id}}))
+	}
+	transport.db.Update(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket([]byte("updates")).Cursor().First()
+
+		return tx.Bucket([]byte("updates")).Put(k, []byte("corrupted"))
+	})
+
+	var export bytes.Buffer
+	require.Nil(t, transport.Export(&export))
+	assert.Equal(t, 1, strings.Count(export.String(), "\n"))
+	assert.Contains(t, export.String(), `"id":"2"`)
+
+	transport.Close()
+	assert.Equal(t, ErrClosedTransport, transport.Export(&export))
+}
+
+func TestBoltTransportImportInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path)
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	err = transport.Import(strings.NewReader(`{"id":"1","topics":["https://example.com/books/1"]}` + "\n" + `{"topics":["https://example.com/books/1"]}`))
+	assert.EqualError(t, err, `bolt import: record 2: missing "id"`)
+	// The batch containing the invalid record isn't stored
+	assert.Equal(t, uint64(0), transport.lastSeq.Load())
+
+	err = transport.Import(strings.NewReader(`{"id":"1","topics":["https://example.com/books/1"]}` + "\n" + `{"id":`))
+	assert.EqualError(t, err, `bolt import: record 2: unexpected EOF`)
+
+	require.Nil(t, transport.Import(strings.NewReader(`{"id":"1","topics":["https://example.com/books/1"]}`)))
+	assert.Equal(t, uint64(1), transport.lastSeq.Load())
+	transport.Close()
+
+	u, _ = url.Parse("bolt://" + path + "?readonly=1")
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	assert.Equal(t, ErrBoltReadOnly, transport.Import(strings.NewReader(`{"id":"1","topics":["https://example.com/books/1"]}`)))
+}
@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+)
+
+// BoltOptions configures a BoltTransport created with NewBoltTransportWithOptions, without building a DSN.
+// The fields match the DSN parameters of the same name (BucketName for bucket_name...), the ones having a default use it when they are zero.
+type BoltOptions struct {
+	// Path is the path of the database, or of the directory containing the databases when Rotate is set
+	Path string
+	// BucketName defaults to "updates"
+	BucketName string
+	// Size is the maximum number of updates stored in the history, zero to never remove old updates
+	Size uint64
+	// CleanupFrequency defaults to 0.3, a negative value disables the cleanup
+	CleanupFrequency float64
+	Rotate           time.Duration
+	Retention        time.Duration
+	// ArchiveDir and ArchiveURL require Rotate, and cannot be used together
+	ArchiveDir string
+	ArchiveURL string
+	// ArchiveMaxSegments defaults to 10
+	ArchiveMaxSegments int
+	ReadOnly           bool
+	TopicIndex         bool
+	IDIndex            bool
+	// Compression is empty (or "none") to disable the compression, or "deflate"
+	Compression string
+	// EncryptionKey is a base64-encoded AES key, the updates aren't encrypted if it's empty
+	EncryptionKey       string
+	CompactionThreshold float64
+	// CompactionInterval defaults to 1 minute
+	CompactionInterval time.Duration
+	MaxFileSize        int64
+	BatchInterval      time.Duration
+	// BatchSize defaults to 1000
+	BatchSize  int
+	NoSync     bool
+	NoGrowSync bool
+
+	BufferSize        int
+	BufferFullTimeout time.Duration
+}
+
+// NewBoltTransportWithOptions creates a new BoltTransport from typed options.
+// The returned errors wrap ErrInvalidTransportDSN, like the ones of NewBoltTransport.
+func NewBoltTransportWithOptions(o BoltOptions) (*BoltTransport, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	t, err := newBoltTransport(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.openDatabases(o.Path); err != nil {
+		return nil, fmt.Errorf(`%q: %s: %w`, o.Path, err, ErrInvalidTransportDSN)
+	}
+
+	return t, nil
+}
+
+// validate checks the values and the combinations of the options.
+func (o *BoltOptions) validate() error {
+	if o.Path == "" {
+		return fmt.Errorf(`missing path: %w`, ErrInvalidTransportDSN)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{{"Rotate", o.Rotate}, {"Retention", o.Retention}, {"CompactionInterval", o.CompactionInterval}, {"BatchInterval", o.BatchInterval}} {
+		if d.value < 0 {
+			return fmt.Errorf(`invalid %s option %s: %w`, d.name, d.value, ErrInvalidTransportDSN)
+		}
+	}
+	if o.CompactionThreshold < 0 || o.CompactionThreshold > 1 {
+		return fmt.Errorf(`invalid CompactionThreshold option %g: %w`, o.CompactionThreshold, ErrInvalidTransportDSN)
+	}
+	if o.MaxFileSize < 0 {
+		return fmt.Errorf(`invalid MaxFileSize option %d: %w`, o.MaxFileSize, ErrInvalidTransportDSN)
+	}
+	if o.BatchSize < 0 {
+		return fmt.Errorf(`invalid BatchSize option %d: %w`, o.BatchSize, ErrInvalidTransportDSN)
+	}
+	if o.ArchiveMaxSegments < 0 {
+		return fmt.Errorf(`invalid ArchiveMaxSegments option %d: %w`, o.ArchiveMaxSegments, ErrInvalidTransportDSN)
+	}
+
+	switch o.Compression {
+	case "", "none", "deflate":
+	default:
+		return fmt.Errorf(`invalid Compression option %q: %w`, o.Compression, ErrInvalidTransportDSN)
+	}
+
+	if o.ReadOnly {
+		// These features write to the database
+		for name, set := range map[string]bool{
+			"CompactionThreshold": o.CompactionThreshold != 0,
+			"MaxFileSize":         o.MaxFileSize != 0,
+			"BatchInterval":       o.BatchInterval != 0,
+			"NoSync":              o.NoSync,
+			"NoGrowSync":          o.NoGrowSync,
+		} {
+			if set {
+				return fmt.Errorf(`the %s option cannot be used with the ReadOnly option: %w`, name, ErrInvalidTransportDSN)
+			}
+		}
+	}
+
+	if o.Rotate == 0 && (o.ArchiveDir != "" || o.ArchiveURL != "") {
+		return fmt.Errorf(`the ArchiveDir and ArchiveURL options require the Rotate option: %w`, ErrInvalidTransportDSN)
+	}
+	if o.ArchiveDir != "" && o.ArchiveURL != "" {
+		return fmt.Errorf(`the ArchiveDir and ArchiveURL options cannot be used together: %w`, ErrInvalidTransportDSN)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package hub
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBoltTransportWithOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+
+	u, _ := url.Parse("bolt://" + path + "?size=100")
+	fromDSN, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	expected := describeTransport(fromDSN)
+	require.Nil(t, fromDSN.Close())
+
+	transport, err := NewBoltTransportWithOptions(BoltOptions{Path: path, Size: 100, BufferSize: 5, BufferFullTimeout: time.Second})
+	require.Nil(t, err)
+	defer transport.Close()
+	assert.Equal(t, expected, describeTransport(transport), "the defaults are the ones of the DSN")
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "1"}}))
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+}
+
+func TestNewBoltTransportWithOptionsCleanupFrequency(t *testing.T) {
+	dir := t.TempDir()
+
+	transport, err := NewBoltTransportWithOptions(BoltOptions{Path: filepath.Join(dir, "disabled.db"), CleanupFrequency: -1})
+	require.Nil(t, err)
+	defer transport.Close()
+	assert.Equal(t, 0.0, transport.cleanupFrequency)
+
+	u, _ := url.Parse("bolt://" + filepath.Join(dir, "dsn.db") + "?cleanup_frequency=0")
+	fromDSN, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer fromDSN.Close()
+	assert.Equal(t, 0.0, fromDSN.cleanupFrequency)
+}
+
+func TestNewBoltTransportWithInvalidOptions(t *testing.T) {
+	for expected, o := range map[string]BoltOptions{
+		`missing path: invalid transport DSN`:                                                                        {},
+		`invalid Retention option -1s: invalid transport DSN`:                                                        {Path: "test.db", Retention: -time.Second},
+		`invalid CompactionThreshold option 2: invalid transport DSN`:                                                {Path: "test.db", CompactionThreshold: 2},
+		`invalid BatchSize option -1: invalid transport DSN`:                                                         {Path: "test.db", BatchSize: -1},
+		`invalid Compression option "zip": invalid transport DSN`:                                                    {Path: "test.db", Compression: "zip"},
+		`the NoSync option cannot be used with the ReadOnly option: invalid transport DSN`:                           {Path: "test.db", ReadOnly: true, NoSync: true},
+		`the ArchiveDir and ArchiveURL options require the Rotate option: invalid transport DSN`:                     {Path: "test.db", ArchiveDir: "archives"},
+		`the ArchiveDir and ArchiveURL options cannot be used together: invalid transport DSN`:                       {Path: "updates", Rotate: time.Hour, ArchiveDir: "archives", ArchiveURL: "s3://bucket"},
+		`invalid bolt encryption key: must be a base64-encoded AES key of 16, 24 or 32 bytes: invalid transport DSN`: {Path: "test.db", EncryptionKey: "secret"},
+	} {
+		_, err := NewBoltTransportWithOptions(o)
+		assert.EqualError(t, err, expected)
+		assert.True(t, errors.Is(err, ErrInvalidTransportDSN))
+	}
+}
@@ -2,12 +2,18 @@ package hub
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,11 +23,26 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const defaultBoltBucketName = "updates"
+const (
+	defaultBoltBucketName = "updates"
+	// defaultBoltCleanupFrequency is the default value of the "cleanup_frequency" parameter
+	defaultBoltCleanupFrequency = 0.3
+	boltPartitionLayout         = "20060102T150405Z"
+	// boltEncryptionKeyEnv is the environment variable containing the encryption key, if the "encryption_key" parameter isn't set
+	boltEncryptionKeyEnv = "MERCURE_BOLT_ENCRYPTION_KEY"
+	// idIndexShared is appended to the key stored in the ID index when other updates have the same ID
+	idIndexShared byte = 1
+	// boltReadOnlyOpenTimeout is the delay after which opening a database locked by another process fails in the read-only mode
+	boltReadOnlyOpenTimeout = time.Second
+)
+
+// ErrBoltReadOnly is returned when an update is written to a Bolt transport opened with the "readonly" parameter.
+var ErrBoltReadOnly = errors.New("bolt: the transport is read-only")
 
 // BoltTransport implements the TransportInterface using the Bolt database.
 type BoltTransport struct {
 	sync.Mutex
+	// db is the database where new updates are written
 	db                *bolt.DB
 	bucketName        string
 	size              uint64
@@ -31,57 +52,511 @@ type BoltTransport struct {
 	lastSeq           atomic.Uint64
 	bufferSize        int
 	bufferFullTimeout time.Duration
+	pipeBufferFactory PipeBufferFactory
+	replayLimiter     *replayLimiter
+	maxHeldUpdates    int
+
+	// partitions are the databases containing the history, ordered from the oldest one, the last one is db
+	partitions []*boltPartition
+	// dir contains a database per time window of the duration rotate, or is empty if the rotation is disabled
+	dir        string
+	rotate     time.Duration
+	retention  time.Duration
+	archiveDir string
+	// archive stores the expired partitions in an object storage and replays them, nil if it's disabled
+	archive *boltArchive
+	// readOnly opens the databases in read-only mode, the transport then only replays their history
+	readOnly bool
+	// topicIndex enables the index of the keys of the updates by topic, to replay the history of a subscriber without scanning all the updates
+	topicIndex bool
+	// idIndex enables the index of the keys of the updates by ID, to resume the history of a subscriber without scanning the updates preceding its last one
+	idIndex bool
+	// compression is the name of the algorithm compressing the stored updates, empty if they aren't compressed
+	compression    string
+	recordEncoding byte
+	// aead encrypts the stored updates, nil if the encryption at rest is disabled
+	aead cipher.AEAD
+	// compactionThreshold is the ratio of free pages triggering the compaction of the database, zero if it's disabled
+	compactionThreshold float64
+	compactionInterval  time.Duration
+	// compactionJournal records the keys written while the database is copied by a compaction, nil if none is running
+	compactionJournal *boltJournal
+	// maxFileSize is the size in bytes above which the updates are rejected, zero if it's unlimited
+	maxFileSize int64
+	metrics     *Metrics
+	// batchInterval is the duration during which the updates are grouped in a single transaction, zero if the batching is disabled
+	batchInterval time.Duration
+	batchSize     int
+	// batchMu protects the pending batch, it must be locked before the transport when both are needed
+	batchMu    sync.Mutex
+	batch      []*boltWrite
+	batchTimer *time.Timer
+	// noSync skips the fsync after every transaction, the last updates can be lost if the system crashes
+	noSync bool
+	// noGrowSync skips the fsync when the database file grows
+	noGrowSync bool
+}
+
+// boltPartition is a database storing the updates written during a time window.
+// When the rotation is disabled, there is only one partition with a zero start time.
+type boltPartition struct {
+	// RWMutex is locked for writing while the database is replaced by a compacted copy
+	sync.RWMutex
+	start time.Time
+	path  string
+	db    *bolt.DB
 }
 
 // NewBoltTransport create a new BoltTransport.
 func NewBoltTransport(u *url.URL, bufferSize int, bufferFullTimeout time.Duration) (*BoltTransport, error) {
+	o, err := parseBoltOptions(u)
+	if err != nil {
+		return nil, err
+	}
+	o.BufferSize = bufferSize
+	o.BufferFullTimeout = bufferFullTimeout
+
+	t, err := newBoltTransport(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.openDatabases(o.Path); err != nil {
+		return nil, fmt.Errorf(`%q: %s: %w`, redactDSN(u), err, ErrInvalidTransportDSN)
+	}
+
+	return t, nil
+}
+
+// parseBoltOptions parses the DSN of a BoltTransport, the defaults are applied.
+func parseBoltOptions(u *url.URL) (BoltOptions, error) {
 	var err error
+	o := BoltOptions{BucketName: defaultBoltBucketName}
 	q := u.Query()
-	bucketName := defaultBoltBucketName
 	if q.Get("bucket_name") != "" {
-		bucketName = q.Get("bucket_name")
+		o.BucketName = q.Get("bucket_name")
 	}
 
-	size := uint64(0)
 	sizeParameter := q.Get("size")
 	if sizeParameter != "" {
-		size, err = strconv.ParseUint(sizeParameter, 10, 64)
+		o.Size, err = strconv.ParseUint(sizeParameter, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf(`%q: invalid "size" parameter %q: %s: %w`, u, sizeParameter, err, ErrInvalidTransportDSN)
+			return o, fmt.Errorf(`%q: invalid "size" parameter %q: %s: %w`, redactDSN(u), sizeParameter, err, ErrInvalidTransportDSN)
 		}
 	}
 
-	cleanupFrequency := 0.3
+	o.CleanupFrequency = defaultBoltCleanupFrequency
 	cleanupFrequencyParameter := q.Get("cleanup_frequency")
 	if cleanupFrequencyParameter != "" {
-		cleanupFrequency, err = strconv.ParseFloat(cleanupFrequencyParameter, 64)
+		o.CleanupFrequency, err = strconv.ParseFloat(cleanupFrequencyParameter, 64)
 		if err != nil {
-			return nil, fmt.Errorf(`%q: invalid "cleanup_frequency" parameter %q: %w`, u, cleanupFrequencyParameter, ErrInvalidTransportDSN)
+			return o, fmt.Errorf(`%q: invalid "cleanup_frequency" parameter %q: %w`, redactDSN(u), cleanupFrequencyParameter, ErrInvalidTransportDSN)
+		}
+		if o.CleanupFrequency == 0 {
+			o.CleanupFrequency = -1
 		}
 	}
 
-	path := u.Path // absolute path (bolt:///path.db)
-	if path == "" {
-		path = u.Host // relative path (bolt://path.db)
+	for _, p := range []struct {
+		name  string
+		value *time.Duration
+	}{{"rotate", &o.Rotate}, {"retention", &o.Retention}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.value, err = time.ParseDuration(v); err != nil || *p.value <= 0 {
+				return o, fmt.Errorf(`%q: invalid %q parameter %q: %w`, redactDSN(u), p.name, v, ErrInvalidTransportDSN)
+			}
+		}
 	}
-	if path == "" {
-		return nil, fmt.Errorf(`%q: missing path: %w`, u, ErrInvalidTransportDSN)
+	if topicIndexParameter := q.Get("topic_index"); topicIndexParameter != "" {
+		if o.TopicIndex, err = strconv.ParseBool(topicIndexParameter); err != nil {
+			return o, fmt.Errorf(`%q: invalid "topic_index" parameter %q: %w`, redactDSN(u), topicIndexParameter, ErrInvalidTransportDSN)
+		}
+	}
+	if p := q.Get("id_index"); p != "" {
+		if o.IDIndex, err = strconv.ParseBool(p); err != nil {
+			return o, fmt.Errorf(`%q: invalid "id_index" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
 	}
 
-	db, err := bolt.Open(path, 0600, nil)
-	if err != nil {
-		return nil, fmt.Errorf(`%q: %s: %w`, u, err, ErrInvalidTransportDSN)
+	if p := q.Get("readonly"); p != "" {
+		if o.ReadOnly, err = strconv.ParseBool(p); err != nil {
+			return o, fmt.Errorf(`%q: invalid "readonly" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+	if o.ReadOnly {
+		// These features write to the database
+		for _, name := range []string{"compaction_threshold", "max_file_size", "batch_interval", "no_sync", "no_grow_sync"} {
+			if q.Get(name) != "" {
+				return o, fmt.Errorf(`%q: the %q parameter cannot be used with the "readonly" parameter: %w`, redactDSN(u), name, ErrInvalidTransportDSN)
+			}
+		}
+	}
+
+	o.Compression = q.Get("compression")
+	switch o.Compression {
+	case "", "none", "deflate":
+	case "zstd", "snappy":
+		return o, fmt.Errorf(`%q: unsupported "compression" parameter %q, only "deflate" is available: %w`, redactDSN(u), o.Compression, ErrInvalidTransportDSN)
+	default:
+		return o, fmt.Errorf(`%q: invalid "compression" parameter %q: %w`, redactDSN(u), o.Compression, ErrInvalidTransportDSN)
+	}
+
+	o.EncryptionKey = q.Get("encryption_key")
+	if o.EncryptionKey == "" {
+		o.EncryptionKey = os.Getenv(boltEncryptionKeyEnv)
+	}
+
+	if p := q.Get("compaction_threshold"); p != "" {
+		if o.CompactionThreshold, err = strconv.ParseFloat(p, 64); err != nil || o.CompactionThreshold <= 0 || o.CompactionThreshold > 1 {
+			return o, fmt.Errorf(`%q: invalid "compaction_threshold" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
 	}
 
-	return &BoltTransport{
-		db:               db,
-		bucketName:       bucketName,
-		size:             size,
-		cleanupFrequency: cleanupFrequency,
+	o.CompactionInterval = defaultBoltCompactionInterval
+	if p := q.Get("compaction_interval"); p != "" {
+		if o.CompactionInterval, err = time.ParseDuration(p); err != nil || o.CompactionInterval <= 0 {
+			return o, fmt.Errorf(`%q: invalid "compaction_interval" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	if p := q.Get("max_file_size"); p != "" {
+		if o.MaxFileSize, err = strconv.ParseInt(p, 10, 64); err != nil || o.MaxFileSize < 0 {
+			return o, fmt.Errorf(`%q: invalid "max_file_size" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	if p := q.Get("batch_interval"); p != "" {
+		if o.BatchInterval, err = time.ParseDuration(p); err != nil || o.BatchInterval < 0 {
+			return o, fmt.Errorf(`%q: invalid "batch_interval" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	o.BatchSize = defaultBoltBatchSize
+	if p := q.Get("batch_size"); p != "" {
+		if o.BatchSize, err = strconv.Atoi(p); err != nil || o.BatchSize <= 0 {
+			return o, fmt.Errorf(`%q: invalid "batch_size" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *bool
+	}{{"no_sync", &o.NoSync}, {"no_grow_sync", &o.NoGrowSync}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.value, err = strconv.ParseBool(v); err != nil {
+				return o, fmt.Errorf(`%q: invalid %q parameter %q: %w`, redactDSN(u), p.name, v, ErrInvalidTransportDSN)
+			}
+		}
+	}
+
+	o.ArchiveDir = q.Get("archive_dir")
+	if o.Rotate == 0 && o.ArchiveDir != "" {
+		return o, fmt.Errorf(`%q: the "archive_dir" parameter requires the "rotate" parameter: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	if o.ArchiveURL = q.Get("archive_url"); o.ArchiveURL != "" {
+		if o.Rotate == 0 {
+			return o, fmt.Errorf(`%q: the "archive_url" parameter requires the "rotate" parameter: %w`, redactDSN(u), ErrInvalidTransportDSN)
+		}
+		if o.ArchiveDir != "" {
+			return o, fmt.Errorf(`%q: the "archive_dir" and "archive_url" parameters cannot be used together: %w`, redactDSN(u), ErrInvalidTransportDSN)
+		}
+
+		o.ArchiveMaxSegments = defaultBoltArchiveMaxSegments
+		if p := q.Get("archive_max_segments"); p != "" {
+			if o.ArchiveMaxSegments, err = strconv.Atoi(p); err != nil || o.ArchiveMaxSegments <= 0 {
+				return o, fmt.Errorf(`%q: invalid "archive_max_segments" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+			}
+		}
+	}
+
+	o.Path = u.Path // absolute path (bolt:///path.db)
+	if o.Path == "" {
+		o.Path = u.Host // relative path (bolt://path.db)
+	}
+	if o.Path == "" {
+		return o, fmt.Errorf(`%q: missing path: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	return o, nil
+}
+
+// newBoltTransport creates a BoltTransport from valid options, the databases aren't opened.
+// The zero values of the options having a default are replaced by it.
+func newBoltTransport(o BoltOptions) (*BoltTransport, error) {
+	t := &BoltTransport{
+		bucketName:       o.BucketName,
+		size:             o.Size,
+		cleanupFrequency: o.CleanupFrequency,
 		pipes:            make(map[*Pipe]struct{}), done: make(chan struct{}),
-		bufferSize:        bufferSize,
-		bufferFullTimeout: bufferFullTimeout,
-	}, nil
+		bufferSize:          o.BufferSize,
+		bufferFullTimeout:   o.BufferFullTimeout,
+		rotate:              o.Rotate,
+		retention:           o.Retention,
+		archiveDir:          o.ArchiveDir,
+		readOnly:            o.ReadOnly,
+		topicIndex:          o.TopicIndex,
+		idIndex:             o.IDIndex,
+		compression:         o.Compression,
+		recordEncoding:      recordEncodingJSON,
+		compactionThreshold: o.CompactionThreshold,
+		compactionInterval:  o.CompactionInterval,
+		maxFileSize:         o.MaxFileSize,
+		batchInterval:       o.BatchInterval,
+		batchSize:           o.BatchSize,
+		noSync:              o.NoSync,
+		noGrowSync:          o.NoGrowSync,
+	}
+	if t.bucketName == "" {
+		t.bucketName = defaultBoltBucketName
+	}
+	switch {
+	case t.cleanupFrequency == 0:
+		t.cleanupFrequency = defaultBoltCleanupFrequency
+	case t.cleanupFrequency < 0:
+		t.cleanupFrequency = 0
+	}
+	if t.compactionInterval == 0 {
+		t.compactionInterval = defaultBoltCompactionInterval
+	}
+	if t.batchSize == 0 {
+		t.batchSize = defaultBoltBatchSize
+	}
+	switch t.compression {
+	case "", "none":
+		t.compression = ""
+	case "deflate":
+		t.recordEncoding = recordEncodingJSONDeflate
+	}
+
+	if o.EncryptionKey != "" {
+		var err error
+		if t.aead, err = newRecordCipher(o.EncryptionKey); err != nil {
+			// The key must not be leaked in the logs
+			return nil, fmt.Errorf(`invalid bolt encryption key: must be a base64-encoded AES key of 16, 24 or 32 bytes: %w`, ErrInvalidTransportDSN)
+		}
+	}
+
+	if o.ArchiveURL != "" {
+		maxSegments := o.ArchiveMaxSegments
+		if maxSegments == 0 {
+			maxSegments = defaultBoltArchiveMaxSegments
+		}
+
+		var err error
+		if t.archive, err = newBoltArchive(o.ArchiveURL, maxSegments); err != nil {
+			// The credentials of the storage must not be leaked in the logs
+			return nil, fmt.Errorf(`invalid "archive_url" parameter: %w`, err)
+		}
+	}
+
+	return t, nil
+}
+
+// openDatabases opens the database at the path or, when the rotation is enabled, the partitions stored in the directory at the path,
+// and starts the compaction if it's enabled.
+func (t *BoltTransport) openDatabases(path string) error {
+	var err error
+	if t.rotate == 0 {
+		err = t.open(&boltPartition{path: path})
+	} else {
+		t.dir = path
+		err = t.openPartitions()
+	}
+	if err != nil {
+		t.closePartitions()
+		return err
+	}
+
+	if t.compactionThreshold > 0 || t.maxFileSize > 0 {
+		go t.runCompaction()
+	}
+
+	return nil
+}
+
+// open opens the database of the partition, and makes it the one where new updates are written.
+func (t *BoltTransport) open(p *boltPartition) error {
+	// The compaction has been interrupted before the copy replacing the original file was opened
+	if _, err := os.Stat(p.path + ".orig"); err == nil && !t.readOnly {
+		if err := os.Rename(p.path+".orig", p.path); err != nil {
+			return err
+		}
+	}
+
+	db, err := bolt.Open(p.path, 0600, t.options())
+	if errors.Is(err, bolt.ErrTimeout) {
+		return fmt.Errorf("%s: the database is locked by another process, open a copy of it in read-only mode: %w", p.path, err)
+	}
+	if err != nil {
+		return err
+	}
+	p.db = db
+
+	var lastSeq uint64
+	db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(t.bucketName)); b != nil {
+			lastSeq = b.Sequence()
+		}
+
+		return nil
+	})
+
+	if (!t.topicIndex || !t.idIndex) && !t.readOnly {
+		// The indexes would miss the updates stored while they are disabled
+		if err := db.Update(func(tx *bolt.Tx) error {
+			for _, index := range []struct {
+				enabled bool
+				name    []byte
+			}{{t.topicIndex, t.indexBucketName()}, {t.idIndex, t.idIndexBucketName()}} {
+				if index.enabled {
+					continue
+				}
+
+				if err := tx.DeleteBucket(index.name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	t.partitions = append(t.partitions, p)
+	t.db = db
+	t.lastSeq.Store(lastSeq)
+
+	return nil
+}
+
+// options returns the options used to open the databases, nil for the default ones.
+func (t *BoltTransport) options() *bolt.Options {
+	if t.readOnly {
+		// Bolt locks the file, a database used by another process can't be opened
+		return &bolt.Options{ReadOnly: true, Timeout: boltReadOnlyOpenTimeout}
+	}
+	if t.noSync || t.noGrowSync {
+		return &bolt.Options{NoSync: t.noSync, NoGrowSync: t.noGrowSync}
+	}
+
+	return nil
+}
+
+// closeDB closes the database of the partition, after flushing the unsynced writes to the disk.
+func (t *BoltTransport) closeDB(p *boltPartition) error {
+	if t.noSync {
+		if err := p.db.Sync(); err != nil {
+			log.Error(fmt.Errorf("bolt sync: %w", err))
+		}
+	}
+
+	return p.db.Close()
+}
+
+// openPartitions opens the existing partitions stored in the directory, and creates the one of the current time window if needed.
+func (t *BoltTransport) openPartitions() error {
+	if !t.readOnly {
+		if err := os.MkdirAll(t.dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	files, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	seen := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		// The original file of a partition whose compaction has been interrupted is restored when it's opened
+		name := strings.TrimSuffix(f.Name(), ".orig")
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	// The names of the partitions are their start time, so the lexical order is the chronological one
+	sort.Strings(names)
+
+	for _, name := range names {
+		start, err := time.Parse(boltPartitionLayout, strings.TrimSuffix(name, ".db"))
+		if err != nil || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+
+		if err := t.open(&boltPartition{start: start, path: filepath.Join(t.dir, name)}); err != nil {
+			return err
+		}
+	}
+
+	if t.readOnly {
+		if len(t.partitions) == 0 {
+			return fmt.Errorf("%s: no database found", t.dir)
+		}
+
+		return nil
+	}
+
+	return t.rotateIfNeeded(time.Now())
+}
+
+// rotateIfNeeded creates the partition of the time window of now if it doesn't exist yet, and expires the partitions out of the retention period.
+func (t *BoltTransport) rotateIfNeeded(now time.Time) error {
+	if n := len(t.partitions); n == 0 || !now.Before(t.partitions[n-1].start.Add(t.rotate)) {
+		start := now.UTC().Truncate(t.rotate)
+		if err := t.open(&boltPartition{start: start, path: filepath.Join(t.dir, start.Format(boltPartitionLayout)+".db")}); err != nil {
+			return err
+		}
+	}
+
+	if t.retention == 0 {
+		return nil
+	}
+
+	// A partition expires when the retention period has elapsed since the end of its time window
+	for len(t.partitions) > 1 && !t.partitions[1].start.After(now.Add(-t.retention)) {
+		p := t.partitions[0]
+		t.partitions = t.partitions[1:]
+
+		if err := t.expire(p); err != nil {
+			log.Error(fmt.Errorf("bolt rotation: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// expire closes the partition, then deletes its file, moves it to the archive directory or uploads it to the archive.
+func (t *BoltTransport) expire(p *boltPartition) error {
+	if err := t.closeDB(p); err != nil {
+		return err
+	}
+
+	if t.archive != nil {
+		t.archive.upload(p.path)
+		return nil
+	}
+
+	if t.archiveDir == "" {
+		return os.Remove(p.path)
+	}
+
+	if err := os.MkdirAll(t.archiveDir, 0700); err != nil {
+		return err
+	}
+
+	return os.Rename(p.path, filepath.Join(t.archiveDir, filepath.Base(p.path)))
+}
+
+// closePartitions closes the databases of all the partitions.
+func (t *BoltTransport) closePartitions() {
+	for _, p := range t.partitions {
+		t.closeDB(p)
+	}
 }
 
 // Write pushes updates in the Transport.
@@ -92,59 +567,288 @@ func (t *BoltTransport) Write(update *Update) error {
 	default:
 	}
 
-	updateJSON, err := json.Marshal(*update)
+	if t.readOnly {
+		return ErrBoltReadOnly
+	}
+
+	if update.Time.IsZero() {
+		update.Time = time.Now()
+	}
+
+	record, err := encodeRecordAs(update, t.recordEncoding, t.aead)
 	if err != nil {
 		return err
 	}
 
+	if t.batchInterval > 0 {
+		return t.enqueue(update, record)
+	}
+
 	// We cannot use RLock() because Bolt allows only one read-write transaction at a time
 	t.Lock()
 	defer t.Unlock()
 
-	if err := t.persist(update.ID, updateJSON); err != nil {
+	return t.store([]*boltWrite{{update: update, record: record}})
+}
+
+// store persists the updates in a single transaction, then sends them to the pipes.
+// The transport must be locked.
+func (t *BoltTransport) store(writes []*boltWrite) error {
+	if t.rotate > 0 {
+		if err := t.rotateIfNeeded(writes[len(writes)-1].update.Time); err != nil {
+			return err
+		}
+	}
+
+	if t.maxFileSize > 0 {
+		if err := t.checkFileSize(); err != nil {
+			return err
+		}
+	}
+
+	if err := t.db.Update(func(tx *bolt.Tx) error {
+		for _, w := range writes {
+			if err := t.persist(tx, w.update, w.record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		if t.metrics != nil {
+			t.metrics.BoltFailedTransaction(t.db.Path())
+		}
+
 		return err
 	}
+	if t.noSync && t.metrics != nil {
+		t.metrics.BoltUnsyncedWrites(t.db.Path(), len(writes))
+	}
 
-	for pipe := range t.pipes {
-		if !pipe.Write(update) {
-			delete(t.pipes, pipe)
+	for _, w := range writes {
+		for pipe := range t.pipes {
+			if !pipe.Write(w.update) {
+				delete(t.pipes, pipe)
+			}
 		}
 	}
 
 	return nil
 }
 
-// persist stores update in the database.
-func (t *BoltTransport) persist(updateID string, updateJSON []byte) error {
-	return t.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
-		if err != nil {
+// persist stores the record of the update in the database.
+func (t *BoltTransport) persist(tx *bolt.Tx, update *Update, record []byte) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
+	if err != nil {
+		return err
+	}
+
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	t.lastSeq.Store(seq)
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, seq)
+
+	// The sequence value is prepended to the update id to create an ordered list
+	key := bytes.Join([][]byte{prefix, []byte(update.ID)}, []byte{})
+
+	if err := t.cleanup(bucket, seq); err != nil {
+		return err
+	}
+
+	// The DB is append only
+	bucket.FillPercent = 1
+	if err := bucket.Put(key, record); err != nil {
+		return err
+	}
+	t.compactionJournal.record(key, []byte(t.bucketName))
+
+	if t.idIndex {
+		if err := t.indexID(tx, key, update.ID, seq); err != nil {
 			return err
 		}
+	}
 
-		seq, err := bucket.NextSequence()
-		if err != nil {
+	if !t.topicIndex {
+		return nil
+	}
+
+	return t.index(tx, key, update.Topics, seq)
+}
+
+// idIndexBucketName returns the name of the bucket containing the ID index: the keys of the updates, by ID.
+func (t *BoltTransport) idIndexBucketName() []byte {
+	return []byte(t.bucketName + "_ids")
+}
+
+// indexID maps the ID of the update having the sequence seq to its key.
+// If several updates have the same ID, the index contains the key of the first one, followed by idIndexShared.
+func (t *BoltTransport) indexID(tx *bolt.Tx, key []byte, id string, seq uint64) error {
+	if id == "" {
+		return nil
+	}
+
+	idx := tx.Bucket(t.idIndexBucketName())
+	if idx == nil {
+		var err error
+		if idx, err = tx.CreateBucket(t.idIndexBucketName()); err != nil {
+			return err
+		}
+
+		// The updates stored before the creation of the index aren't indexed
+		if err := idx.SetSequence(seq); err != nil {
 			return err
 		}
-		t.lastSeq.Store(seq)
-		prefix := make([]byte, 8)
-		binary.BigEndian.PutUint64(prefix, seq)
+	}
+
+	t.compactionJournal.record([]byte(id), t.idIndexBucketName())
+
+	// Like the scan of the bucket, the replay resumes after the first update having the ID
+	if k := idx.Get([]byte(id)); k != nil {
+		if len(k) > len(key) {
+			return nil
+		}
+
+		return idx.Put([]byte(id), append(append(make([]byte, 0, len(k)+1), k...), idIndexShared))
+	}
+
+	return idx.Put([]byte(id), key)
+}
+
+// unindexID removes the ID of the update having the key from the ID index, unless it maps to another update.
+// If the ID is shared by several updates, the index then maps it to the next one.
+func (t *BoltTransport) unindexID(b *bolt.Bucket, key []byte) error {
+	idx := b.Tx().Bucket(t.idIndexBucketName())
+	if idx == nil {
+		return nil
+	}
 
-		// The sequence value is prepended to the update id to create an ordered list
-		key := bytes.Join([][]byte{prefix, []byte(updateID)}, []byte{})
+	id := key[8:]
+	k := idx.Get(id)
+	if k == nil || !bytes.Equal(k[:len(key)], key) {
+		return nil
+	}
+	t.compactionJournal.record(id, t.idIndexBucketName())
+	if len(k) == len(key) {
+		return idx.Delete(id)
+	}
 
-		if err := t.cleanup(bucket, seq); err != nil {
+	c := b.Cursor()
+	c.Seek(key)
+	for next, _ := c.Next(); next != nil; next, _ = c.Next() {
+		if bytes.Equal(next[8:], id) {
+			// The next updates having the ID, if any, must still be looked for when this one is removed
+			return idx.Put(id, append(append(make([]byte, 0, len(next)+1), next...), idIndexShared))
+		}
+	}
+
+	return idx.Delete(id)
+}
+
+// seekID returns the key from which the updates stored after the one having the ID are read, using the ID index.
+// The key is nil if the update isn't stored in the bucket. It returns false if the index doesn't cover all the records of the bucket.
+func (t *BoltTransport) seekID(tx *bolt.Tx, b *bolt.Bucket, id string) ([]byte, bool) {
+	if !t.idIndex {
+		return nil, false
+	}
+
+	idx := tx.Bucket(t.idIndexBucketName())
+	if idx == nil {
+		return nil, false
+	}
+
+	if k, _ := b.Cursor().First(); k != nil && binary.BigEndian.Uint64(k[:8]) < idx.Sequence() {
+		return nil, false
+	}
+
+	key := idx.Get([]byte(id))
+	if key == nil {
+		return nil, true
+	}
+
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, binary.BigEndian.Uint64(key[:8])+1)
+
+	return start, true
+}
+
+// indexBucketName returns the name of the bucket containing the topic index: a bucket per topic, listing the keys of its updates.
+func (t *BoltTransport) indexBucketName() []byte {
+	return []byte(t.bucketName + "_topics")
+}
+
+// index adds the key of the update having the sequence seq to the buckets of its topics.
+func (t *BoltTransport) index(tx *bolt.Tx, key []byte, topics []string, seq uint64) error {
+	idx := tx.Bucket(t.indexBucketName())
+	if idx == nil {
+		var err error
+		if idx, err = tx.CreateBucket(t.indexBucketName()); err != nil {
 			return err
 		}
 
-		// The DB is append only
-		bucket.FillPercent = 1
-		return bucket.Put(key, updateJSON)
-	})
+		// The updates stored before the creation of the index aren't indexed
+		if err := idx.SetSequence(seq); err != nil {
+			return err
+		}
+	}
+
+	for _, topic := range topics {
+		if topic == "" {
+			continue
+		}
+
+		b, err := idx.CreateBucketIfNotExists([]byte(topic))
+		if err != nil {
+			return err
+		}
+
+		b.FillPercent = 1
+		if err := b.Put(key, []byte{}); err != nil {
+			return err
+		}
+		t.compactionJournal.record(key, t.indexBucketName(), []byte(topic))
+	}
+
+	return nil
+}
+
+// unindex removes the key of the update stored in the record from the buckets of its topics.
+func (t *BoltTransport) unindex(tx *bolt.Tx, key, record []byte) error {
+	if !t.topicIndex {
+		return nil
+	}
+
+	idx := tx.Bucket(t.indexBucketName())
+	if idx == nil {
+		return nil
+	}
+
+	update, err := decodeRecordWith(record, t.aead)
+	if err != nil {
+		// The key is left in the index, it is skipped during replays
+		return nil
+	}
+
+	for _, topic := range update.Topics {
+		if b := idx.Bucket([]byte(topic)); b != nil {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+			t.compactionJournal.record(key, t.indexBucketName(), []byte(topic))
+		}
+	}
+
+	return nil
 }
 
 // CreatePipe returns a pipe fetching updates from the given point in time.
-func (t *BoltTransport) CreatePipe(fromID string) (*Pipe, error) {
+func (t *BoltTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	if cursor.Kind > CursorAfterTime {
+		return nil, ErrUnsupportedCursor
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
@@ -154,53 +858,315 @@ func (t *BoltTransport) CreatePipe(fromID string) (*Pipe, error) {
 	default:
 	}
 
-	pipe := NewPipe(t.bufferSize, t.bufferFullTimeout)
+	pipe := t.pipeBufferFactory.newPipe(t.bufferSize, t.bufferFullTimeout)
 	t.pipes[pipe] = struct{}{}
-	if fromID == "" {
+	if cursor.Kind == CursorLatest {
 		return pipe, nil
 	}
 
+	partitions := append([]*boltPartition(nil), t.partitions...)
 	toSeq := t.lastSeq.Load()
-	go t.fetch(fromID, toSeq, pipe)
+	pipe.holdLive(t.maxHeldUpdates)
+	go t.fetch(cursor, partitions, toSeq, pipe)
 
 	return pipe, nil
 }
 
-func (t *BoltTransport) fetch(fromID string, toSeq uint64, pipe *Pipe) {
-	err := t.db.View(func(tx *bolt.Tx) error {
+// setReplayLimiter limits the number of simultaneous history replays.
+func (t *BoltTransport) setReplayLimiter(l *replayLimiter) {
+	t.replayLimiter = l
+}
+
+// setMetrics collects the size and the compactions of the database.
+func (t *BoltTransport) setMetrics(m *Metrics) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.metrics = m
+}
+
+// setStrictOrdering holds up to maxHeldUpdates live updates while the history is replayed, to deliver them after it.
+func (t *BoltTransport) setStrictOrdering(maxHeldUpdates int) {
+	t.maxHeldUpdates = maxHeldUpdates
+}
+
+// fetch sends the updates stored in the partitions from the point in time defined by the cursor.
+// In the last partition, only the updates until toSeq are sent, the next ones are sent directly to the pipe.
+func (t *BoltTransport) fetch(cursor Cursor, partitions []*boltPartition, toSeq uint64, pipe *Pipe) {
+	defer pipe.releaseLive()
+	if !t.replayLimiter.acquire(pipe) {
+		return
+	}
+	defer t.replayLimiter.release(pipe)
+
+	afterFromID := cursor.Kind != CursorAfterID
+	if !afterFromID && t.archive != nil && !t.partitionsContainID(partitions, cursor.ID) {
+		// The update has been stored in a partition that expired since
+		found, stop := t.fetchArchive(cursor, pipe)
+		if stop {
+			return
+		}
+		afterFromID = found
+	}
+
+	for i, p := range partitions {
+		last := i == len(partitions)-1
+		if last && toSeq == 0 {
+			return
+		}
+
+		// The updates of this partition have all been written before the cursor
+		if cursor.Kind == CursorAfterTime && !last && !partitions[i+1].start.After(cursor.Time) {
+			continue
+		}
+
+		limit := uint64(0)
+		if last {
+			limit = toSeq
+		}
+
+		stop, err := t.fetchPartition(p, cursor, &afterFromID, limit, pipe)
+		if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+			// The partition expired in the meantime
+			continue
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("bolt history: %w", err))
+			return
+		}
+		if stop {
+			return
+		}
+	}
+}
+
+// fetchPartition sends the updates stored in the partition, until the one having the sequence toSeq if it isn't zero.
+// It returns true if no more updates must be sent.
+func (t *BoltTransport) fetchPartition(p *boltPartition, cursor Cursor, afterFromID *bool, toSeq uint64, pipe *Pipe) (bool, error) {
+	p.RLock()
+	defer p.RUnlock()
+
+	stop := false
+	err := p.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(t.bucketName))
 		if b == nil {
 			return nil // No data
 		}
 
-		c := b.Cursor()
-		afterFromID := false
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if !afterFromID {
-				if string(k[8:]) == fromID {
-					afterFromID = true
+		// Seek directly to the update following the one of the cursor, instead of scanning the bucket to find it
+		var start []byte
+		if !*afterFromID {
+			var covered bool
+			if start, covered = t.seekID(tx, b, cursor.ID); covered {
+				if start == nil {
+					return nil // Not in this partition
+				}
+
+				*afterFromID = true
+			}
+		}
+
+		next := scanBucket(b, start)
+		if t.topicIndex && len(cursor.Topics) > 0 {
+			if n, ok := t.scanIndex(tx, b, cursor, afterFromID, start); ok {
+				next = n
+			}
+		}
+
+		for k, v := next(); k != nil; k, v = next() {
+			if !*afterFromID {
+				if string(k[8:]) == cursor.ID {
+					*afterFromID = true
 				}
 
 				continue
 			}
 
-			var update *Update
-			if err := json.Unmarshal(v, &update); err != nil {
-				return err
+			seq := binary.BigEndian.Uint64(k[:8])
+			if toSeq > 0 && seq > toSeq {
+				// Sent directly to the pipe, the update having the sequence toSeq isn't one of the topics
+				stop = true
+				return nil
+			}
+			last := toSeq > 0 && seq == toSeq
+
+			update, err := decodeRecordWith(v, t.aead)
+			if err != nil {
+				// Only the corrupted record is skipped
+				log.WithFields(log.Fields{"event_id": string(k[8:])}).Error(fmt.Errorf("bolt history: %w", err))
+				if last {
+					stop = true
+					return nil
+				}
+
+				continue
 			}
 
-			if !pipe.Write(update) || (toSeq > 0 && binary.BigEndian.Uint64(k[:8]) >= toSeq) {
+			// Updates stored before the time-based history was supported have no time, they are skipped
+			if cursor.Kind == CursorAfterTime && update.Time.Before(cursor.Time) {
+				continue
+			}
+
+			if !pipe.writeHistory(update) || last {
+				stop = true
 				return nil
 			}
 		}
 
 		return nil
 	})
-	if err != nil {
-		log.Error(fmt.Errorf("bolt history: %w", err))
+
+	return stop, err
+}
+
+// scanBucket returns an iterator over the records of the bucket from the start key, or over all of them if it is nil.
+// A nil key is returned when there are no more records.
+func scanBucket(b *bolt.Bucket, start []byte) func() ([]byte, []byte) {
+	c := b.Cursor()
+	k, v := c.First()
+	if start != nil {
+		k, v = c.Seek(start)
+	}
+
+	return func() ([]byte, []byte) {
+		rk, rv := k, v
+		if k != nil {
+			k, v = c.Next()
+		}
+
+		return rk, rv
 	}
 }
 
+// scanIndex returns an iterator over the records of the bucket having one of the topics of the cursor, using the topic index.
+// The records are read from the start key if it isn't nil. It returns false if the index doesn't cover all the records of the bucket.
+func (t *BoltTransport) scanIndex(tx *bolt.Tx, b *bolt.Bucket, cursor Cursor, afterFromID *bool, start []byte) (func() ([]byte, []byte), bool) {
+	idx := tx.Bucket(t.indexBucketName())
+	if idx == nil {
+		return nil, false
+	}
+
+	c := b.Cursor()
+	if k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k[:8]) < idx.Sequence() {
+		return nil, false
+	}
+
+	if start == nil {
+		start = make([]byte, 8)
+	}
+	if !*afterFromID {
+		// Only the keys are compared, the records aren't decoded
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if string(k[8:]) == cursor.ID {
+				*afterFromID = true
+				binary.BigEndian.PutUint64(start, binary.BigEndian.Uint64(k[:8])+1)
+
+				break
+			}
+		}
+
+		if !*afterFromID {
+			return func() ([]byte, []byte) { return nil, nil }, true
+		}
+	}
+
+	cursors := make([]*bolt.Cursor, 0, len(cursor.Topics))
+	keys := make([][]byte, 0, len(cursor.Topics))
+	for _, topic := range cursor.Topics {
+		tb := idx.Bucket([]byte(topic))
+		if tb == nil {
+			continue
+		}
+
+		tc := tb.Cursor()
+		if k, _ := tc.Seek(start); k != nil {
+			cursors = append(cursors, tc)
+			keys = append(keys, k)
+		}
+	}
+
+	// The keys start with the sequence, merging the buckets of the topics by key preserves the order of the updates
+	return func() ([]byte, []byte) {
+		for {
+			var next []byte
+			for _, k := range keys {
+				if k != nil && (next == nil || bytes.Compare(k, next) < 0) {
+					next = k
+				}
+			}
+			if next == nil {
+				return nil, nil
+			}
+
+			// An update having several of the topics is sent once
+			for i, k := range keys {
+				if bytes.Equal(k, next) {
+					keys[i], _ = cursors[i].Next()
+				}
+			}
+
+			// The record is missing if it was corrupted when it was removed from the history
+			if v := b.Get(next); v != nil {
+				return next, v
+			}
+		}
+	}, true
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *BoltTransport) transportConfig() *transportConfig {
+	t.Lock()
+	defer t.Unlock()
+
+	options := bufferOptions(t.bufferSize, t.bufferFullTimeout)
+	options["bucket_name"] = t.bucketName
+	options["size"] = t.size
+	options["cleanup_frequency"] = t.cleanupFrequency
+	options["topic_index"] = t.topicIndex
+	options["id_index"] = t.idIndex
+	if t.readOnly {
+		options["readonly"] = true
+	}
+	if t.compression != "" {
+		options["compression"] = t.compression
+	}
+	options["encrypted"] = t.aead != nil
+	if t.compactionThreshold > 0 {
+		options["compaction_threshold"] = t.compactionThreshold
+		options["compaction_interval"] = t.compactionInterval.String()
+	}
+	if t.maxFileSize > 0 {
+		options["max_file_size"] = t.maxFileSize
+	}
+	if t.batchInterval > 0 {
+		options["batch_interval"] = t.batchInterval.String()
+		options["batch_size"] = t.batchSize
+	}
+	if t.noSync {
+		options["no_sync"] = true
+	}
+	if t.noGrowSync {
+		options["no_grow_sync"] = true
+	}
+	if t.rotate == 0 {
+		options["path"] = t.db.Path()
+		if t.retention != 0 {
+			options["retention"] = t.retention.String()
+		}
+	} else {
+		options["path"] = t.dir
+		options["rotate"] = t.rotate.String()
+		options["retention"] = t.retention.String()
+		options["archive_dir"] = t.archiveDir
+		if t.archive != nil {
+			options["archive"] = t.archive.name
+			options["archive_max_segments"] = t.archive.maxSegments
+		}
+	}
+
+	return &transportConfig{Scheme: "bolt", Options: options}
+}
+
 // Close closes the Transport.
 func (t *BoltTransport) Close() error {
 	select {
@@ -209,36 +1175,79 @@ func (t *BoltTransport) Close() error {
 	default:
 	}
 
+	if t.batchInterval > 0 {
+		// The pending updates are stored before closing the database
+		t.batchMu.Lock()
+		t.flushBatch()
+	}
+
 	t.Lock()
 	defer t.Unlock()
+	t.shutdown()
+
+	return nil
+}
+
+// shutdown closes the pipes and the databases, the lock of the transport must be held.
+func (t *BoltTransport) shutdown() {
+	select {
+	case <-t.done:
+		// Closed by a failed compaction
+		return
+	default:
+	}
+
 	for pipe := range t.pipes {
-		close(pipe.Read())
+		pipe.closeUpdates()
 	}
 	close(t.done)
-	t.db.Close()
-
-	return nil
+	t.closePartitions()
+	if t.archive != nil {
+		t.archive.uploads.Wait()
+	}
 }
 
-// cleanup removes entries in the history above the size limit, triggered probabilistically.
+// cleanup removes entries in the history above the size limit or, when the rotation is disabled, older than the retention period.
+// It is triggered probabilistically.
 func (t *BoltTransport) cleanup(bucket *bolt.Bucket, lastID uint64) error {
-	if t.size == 0 ||
+	sizeExceeded := t.size != 0 && t.size < lastID
+	// When the rotation is enabled, the retention period applies to whole partitions
+	expires := t.retention != 0 && t.rotate == 0
+	if (!sizeExceeded && !expires) ||
 		t.cleanupFrequency == 0 ||
-		t.size >= lastID ||
 		(t.cleanupFrequency != 1 && rand.Float64() < t.cleanupFrequency) {
 		return nil
 	}
 
-	removeUntil := lastID - t.size
+	var removeUntil uint64
+	if sizeExceeded {
+		removeUntil = lastID - t.size
+	}
+	expiredBefore := time.Now().Add(-t.retention)
+
 	c := bucket.Cursor()
-	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+	for k, v := c.First(); k != nil; k, v = c.Next() {
 		if binary.BigEndian.Uint64(k[:8]) > removeUntil {
-			break
+			if !expires {
+				break
+			}
+
+			// The updates are stored in chronological order, corrupted records are skipped during replays anyway
+			if update, err := decodeRecordWith(v, t.aead); err == nil && !update.Time.Before(expiredBefore) {
+				break
+			}
 		}
 
+		if err := t.unindex(bucket.Tx(), k, v); err != nil {
+			return err
+		}
+		if err := t.unindexID(bucket, k); err != nil {
+			return err
+		}
 		if err := bucket.Delete(k); err != nil {
 			return err
 		}
+		t.compactionJournal.record(k, []byte(t.bucketName))
 	}
 
 	return nil
@@ -2,9 +2,14 @@ package hub
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -24,7 +29,7 @@ func TestBoltTransportHistory(t *testing.T) {
 		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}})
 	}
 
-	pipe, err := transport.CreatePipe("8")
+	pipe, err := transport.CreatePipe(AfterIDCursor("8"))
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 
@@ -40,6 +45,50 @@ func TestBoltTransportHistory(t *testing.T) {
 	}
 }
 
+func TestBoltTransportHistorySince(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}, Time: now.Add(time.Duration(i-10) * time.Minute)})
+	}
+
+	pipe, err := transport.CreatePipe(AfterTimeCursor(now.Add(-90 * time.Second)))
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	for i := 9; i <= 10; i++ {
+		u := <-pipe.Read()
+		assert.Equal(t, strconv.Itoa(i), u.ID)
+	}
+}
+
+func TestBoltTransportHistoryEarliest(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	for i := 1; i <= 3; i++ {
+		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}})
+	}
+
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	for i := 1; i <= 3; i++ {
+		u := <-pipe.Read()
+		assert.Equal(t, strconv.Itoa(i), u.ID)
+	}
+
+	_, err = transport.CreatePipe(Cursor{Kind: CursorKind(42)})
+	assert.Equal(t, ErrUnsupportedCursor, err)
+}
+
 func TestBoltTransportHistoryAndLive(t *testing.T) {
 	u, _ := url.Parse("bolt://test.db")
 	transport, _ := NewBoltTransport(u, 5, time.Second)
@@ -50,7 +99,7 @@ func TestBoltTransportHistoryAndLive(t *testing.T) {
 		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}})
 	}
 
-	pipe, err := transport.CreatePipe("8")
+	pipe, err := transport.CreatePipe(AfterIDCursor("8"))
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 
@@ -79,6 +128,37 @@ func TestBoltTransportHistoryAndLive(t *testing.T) {
 	wg.Wait()
 }
 
+func TestBoltTransportStrictOrdering(t *testing.T) {
+	path := "strict-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".db"
+	defer os.Remove(path)
+
+	u, _ := url.Parse("bolt://" + path)
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	transport.setStrictOrdering(10)
+
+	// Delay the replay until the live updates are written
+	limiter := newReplayLimiter(1, nil, nil)
+	transport.setReplayLimiter(limiter)
+	blocking := NewPipe(1, time.Second)
+	require.True(t, limiter.acquire(blocking))
+
+	for i := 1; i <= 10; i++ {
+		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}})
+	}
+
+	pipe, err := transport.CreatePipe(AfterIDCursor("8"))
+	require.Nil(t, err)
+
+	transport.Write(&Update{Event: Event{ID: "11"}})
+	transport.Write(&Update{Event: Event{ID: "12"}})
+	limiter.release(blocking)
+
+	for i := 9; i <= 12; i++ {
+		assert.Equal(t, strconv.Itoa(i), (<-pipe.Read()).ID)
+	}
+}
+
 func TestBoltTransportPurgeHistory(t *testing.T) {
 	u, _ := url.Parse("bolt://test.db?size=5&cleanup_frequency=1")
 	transport, _ := NewBoltTransport(u, 5, time.Second)
@@ -98,6 +178,289 @@ func TestBoltTransportPurgeHistory(t *testing.T) {
 	})
 }
 
+func TestBoltTransportPurgeExpiredHistory(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?retention=1h&cleanup_frequency=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	now := time.Now()
+	for i, offset := range []time.Duration{3 * time.Hour, 2 * time.Hour, 30 * time.Minute, 0} {
+		require.Nil(t, transport.Write(&Update{Event: Event{ID: strconv.Itoa(i + 1)}, Time: now.Add(-offset)}))
+	}
+
+	// The first two updates are out of the retention period
+	var ids []string
+	transport.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("updates")).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k[8:]))
+
+			return nil
+		})
+	})
+	assert.Equal(t, []string{"3", "4"}, ids)
+}
+
+// readIDs reads the history sent to the pipe, then checks that the live update is the next one.
+func readIDs(t *testing.T, transport Transport, pipe *Pipe, n int) []string {
+	t.Helper()
+
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, (<-pipe.Read()).ID)
+	}
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "live"}}))
+	assert.Equal(t, "live", (<-pipe.Read()).ID)
+
+	return ids
+}
+
+func TestBoltTransportCompression(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?compression=deflate")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	data := strings.Repeat("data", 100)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "1", Data: data}}))
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		_, v := tx.Bucket([]byte("updates")).Cursor().First()
+		assert.Equal(t, byte(recordEncodingJSONDeflate), v[1])
+		assert.Less(t, len(v), len(data))
+
+		return nil
+	})
+
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, data, (<-pipe.Read()).Data)
+}
+
+func TestBoltTransportEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	u, _ := url.Parse("bolt://" + path + "?" + url.Values{"encryption_key": {key}}.Encode())
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "1", Data: "secret data"}}))
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		_, v := tx.Bucket([]byte("updates")).Cursor().First()
+		assert.NotContains(t, string(v), "secret data")
+
+		return nil
+	})
+	transport.Close()
+
+	// The key can be set in an environment variable
+	os.Setenv(boltEncryptionKeyEnv, key)
+	defer os.Unsetenv(boltEncryptionKeyEnv)
+
+	u, _ = url.Parse("bolt://" + path)
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, "secret data", (<-pipe.Read()).Data)
+}
+
+func TestBoltTransportTopicIndex(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?topic_index=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	for i, topics := range [][]string{{"http://example.com/a"}, {"http://example.com/c"}, {"http://example.com/b"}, {"http://example.com/a", "http://example.com/b"}, {"http://example.com/c"}} {
+		require.Nil(t, transport.Write(&Update{Topics: topics, Event: Event{ID: strconv.Itoa(i + 1)}}))
+	}
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorEarliest, Topics: []string{"http://example.com/a", "http://example.com/b"}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "3", "4"}, readIDs(t, transport, pipe, 3))
+
+	// The ID of the cursor isn't one of the updates of the topics
+	pipe, err = transport.CreatePipe(Cursor{Kind: CursorAfterID, ID: "2", Topics: []string{"http://example.com/b"}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"3", "4"}, readIDs(t, transport, pipe, 2))
+
+	pipe, err = transport.CreatePipe(Cursor{Kind: CursorEarliest, Topics: []string{"http://example.com/unknown"}})
+	require.Nil(t, err)
+	assert.Empty(t, readIDs(t, transport, pipe, 0))
+}
+
+func TestBoltTransportTopicIndexPartial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path)
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "1"}}))
+	transport.Close()
+
+	u, _ = url.Parse("bolt://" + path + "?topic_index=1")
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "2"}}))
+
+	// The first update isn't indexed, the whole history is scanned
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorEarliest, Topics: []string{"http://example.com/a"}})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, readIDs(t, transport, pipe, 2))
+}
+
+func TestBoltTransportTopicIndexCleanup(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?topic_index=1&size=2&cleanup_frequency=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 2, tx.Bucket([]byte("updates_topics")).Bucket([]byte("http://example.com/a")).Stats().KeyN)
+
+		return nil
+	})
+}
+
+func TestBoltTransportIDIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?size=3&cleanup_frequency=1&id_index=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	// The IDs of the removed updates are removed from the index
+	transport.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket([]byte("updates_ids"))
+		require.NotNil(t, idx)
+		assert.Equal(t, 3, idx.Stats().KeyN)
+		assert.Nil(t, idx.Get([]byte("2")))
+		assert.Equal(t, uint64(3), binary.BigEndian.Uint64(idx.Get([]byte("3"))[:8]))
+
+		return nil
+	})
+
+	pipe, err := transport.CreatePipe(AfterIDCursor("3"))
+	require.Nil(t, err)
+	assert.Equal(t, "4", (<-pipe.Read()).ID)
+	assert.Equal(t, "5", (<-pipe.Read()).ID)
+	pipe.Close()
+
+	// Unknown IDs are found without scanning the bucket, only the live updates are sent
+	pipe, err = transport.CreatePipe(AfterIDCursor("2"))
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "6"}}))
+	assert.Equal(t, "6", (<-pipe.Read()).ID)
+	pipe.Close()
+
+	// The databases created before the index are scanned until the updates not indexed are removed
+	require.Nil(t, transport.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("updates_ids"))
+	}))
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "7"}}))
+
+	pipe, err = transport.CreatePipe(AfterIDCursor("5"))
+	require.Nil(t, err)
+	assert.Equal(t, "6", (<-pipe.Read()).ID)
+	assert.Equal(t, "7", (<-pipe.Read()).ID)
+	pipe.Close()
+	require.Nil(t, transport.Close())
+
+	// The index is used along with the topic index
+	u, _ = url.Parse("bolt://" + filepath.Join(t.TempDir(), "indexed.db") + "?topic_index=1&id_index=1")
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	for i := 8; i <= 10; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/" + strconv.Itoa(i%2)}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	pipe, err = transport.CreatePipe(Cursor{Kind: CursorAfterID, ID: "8", Topics: []string{"http://example.com/0"}})
+	require.Nil(t, err)
+	assert.Equal(t, "10", (<-pipe.Read()).ID)
+}
+
+func TestBoltTransportIDIndexDuplicates(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "updates.db") + "?size=4&cleanup_frequency=1&id_index=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	for _, id := range []string{"a", "dup", "b", "dup"} {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: id, Data: id}}))
+	}
+
+	// Like without the index, the replay resumes after the first update having the ID
+	pipe, err := transport.CreatePipe(AfterIDCursor("dup"))
+	require.Nil(t, err)
+	assert.Equal(t, "b", (<-pipe.Read()).ID)
+	assert.Equal(t, "dup", (<-pipe.Read()).ID)
+	pipe.Close()
+
+	// Once the first one is removed, the index maps the ID to the next one
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "c"}}))
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "d"}}))
+
+	pipe, err = transport.CreatePipe(AfterIDCursor("dup"))
+	require.Nil(t, err)
+	assert.Equal(t, "c", (<-pipe.Read()).ID)
+	assert.Equal(t, "d", (<-pipe.Read()).ID)
+	pipe.Close()
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, uint64(4), binary.BigEndian.Uint64(tx.Bucket([]byte("updates_ids")).Get([]byte("dup"))[:8]))
+
+		return nil
+	})
+
+	// The ID is removed from the index along with its last update
+	for _, id := range []string{"e", "f"} {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: id}}))
+	}
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("updates_ids")).Get([]byte("dup")))
+
+		return nil
+	})
+}
+
+func TestBoltTransportIDIndexDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?id_index=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "a"}}))
+	require.Nil(t, transport.Close())
+
+	// Disabling the option deletes the index, which would miss the updates stored meanwhile
+	u, _ = url.Parse("bolt://" + path)
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/a"}, Event: Event{ID: "b"}}))
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("updates_ids")))
+
+		return nil
+	})
+
+	pipe, err := transport.CreatePipe(AfterIDCursor("a"))
+	require.Nil(t, err)
+	assert.Equal(t, "b", (<-pipe.Read()).ID)
+}
+
 func TestNewBoltTransport(t *testing.T) {
 	u, _ := url.Parse("bolt://test.db?bucket_name=demo")
 	transport, err := NewBoltTransport(u, 5, time.Second)
@@ -131,7 +494,7 @@ func TestBoltTransportWriteIsNotDispatchedUntilListen(t *testing.T) {
 	defer os.Remove("test.db")
 	assert.Implements(t, (*Transport)(nil), transport)
 
-	pipe, err := transport.CreatePipe("")
+	pipe, err := transport.CreatePipe(LatestCursor())
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 
@@ -170,7 +533,7 @@ func TestBoltTransportWriteIsDispatched(t *testing.T) {
 	defer os.Remove("test.db")
 	assert.Implements(t, (*Transport)(nil), transport)
 
-	pipe, err := transport.CreatePipe("")
+	pipe, err := transport.CreatePipe(LatestCursor())
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 	defer pipe.Close()
@@ -214,13 +577,13 @@ func TestBoltTransportClosed(t *testing.T) {
 	defer os.Remove("test.db")
 	assert.Implements(t, (*Transport)(nil), transport)
 
-	pipe, _ := transport.CreatePipe("")
+	pipe, _ := transport.CreatePipe(LatestCursor())
 	require.NotNil(t, pipe)
 
 	err := transport.Close()
 	assert.Nil(t, err)
 
-	_, err = transport.CreatePipe("")
+	_, err = transport.CreatePipe(LatestCursor())
 	assert.Equal(t, err, ErrClosedTransport)
 
 	err = transport.Write(&Update{})
@@ -237,7 +600,7 @@ func TestBoltCleanClosedPipes(t *testing.T) {
 	defer transport.Close()
 	defer os.Remove("test.db")
 
-	pipe, _ := transport.CreatePipe("")
+	pipe, _ := transport.CreatePipe(LatestCursor())
 	require.NotNil(t, pipe)
 
 	assert.Len(t, transport.pipes, 1)
@@ -248,3 +611,265 @@ func TestBoltCleanClosedPipes(t *testing.T) {
 	transport.Write(&Update{})
 	assert.Len(t, transport.pipes, 0)
 }
+
+func TestNewBoltTransportRotationInvalidDSN(t *testing.T) {
+	u, _ := url.Parse("bolt://updates?rotate=invalid")
+	_, err := NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?rotate=invalid": invalid "rotate" parameter "invalid": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?rotate=1h&retention=-1h")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?rotate=1h&retention=-1h": invalid "retention" parameter "-1h": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?topic_index=invalid")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?topic_index=invalid": invalid "topic_index" parameter "invalid": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?id_index=invalid")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?id_index=invalid": invalid "id_index" parameter "invalid": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?compression=zstd")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?compression=zstd": unsupported "compression" parameter "zstd", only "deflate" is available: invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?compression=snappy")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?compression=snappy": unsupported "compression" parameter "snappy", only "deflate" is available: invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?compression=zip")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?compression=zip": invalid "compression" parameter "zip": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?encryption_key=invalid")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `invalid bolt encryption key: must be a base64-encoded AES key of 16, 24 or 32 bytes: invalid transport DSN`)
+
+	// The secrets aren't leaked
+	u, _ = url.Parse("bolt://updates?compression=zip&encryption_key=secret&rotate=1h&archive_url=" + url.QueryEscape("s3://bucket?region=eu-west-3&access_key_id=id&secret_access_key=secret"))
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?archive_url=s3%3A%2F%2Fbucket%3Faccess_key_id%3Did%26region%3Deu-west-3%26secret_access_key%3Dxxxxx&compression=zip&encryption_key=xxxxx&rotate=1h": invalid "compression" parameter "zip": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?compaction_threshold=2")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?compaction_threshold=2": invalid "compaction_threshold" parameter "2": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?compaction_interval=0s")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?compaction_interval=0s": invalid "compaction_interval" parameter "0s": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?max_file_size=1GB")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?max_file_size=1GB": invalid "max_file_size" parameter "1GB": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?batch_interval=-1s")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?batch_interval=-1s": invalid "batch_interval" parameter "-1s": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?batch_size=0")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?batch_size=0": invalid "batch_size" parameter "0": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?readonly=maybe")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?readonly=maybe": invalid "readonly" parameter "maybe": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?readonly=1&batch_interval=5ms")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?readonly=1&batch_interval=5ms": the "batch_interval" parameter cannot be used with the "readonly" parameter: invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?no_sync=maybe")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?no_sync=maybe": invalid "no_sync" parameter "maybe": invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?readonly=1&no_grow_sync=1")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?readonly=1&no_grow_sync=1": the "no_grow_sync" parameter cannot be used with the "readonly" parameter: invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://updates?archive_dir=archives")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://updates?archive_dir=archives": the "archive_dir" parameter requires the "rotate" parameter: invalid transport DSN`)
+}
+
+func TestBoltTransportNoSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?no_sync=1&no_grow_sync=1")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	assert.True(t, transport.db.NoSync)
+	assert.True(t, transport.db.NoGrowSync)
+
+	m := NewMetrics()
+	transport.setMetrics(m)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "2"}}))
+	assertCounterValue(t, 2, m.boltUnsynced, path)
+	require.Nil(t, transport.Close())
+
+	// The unsynced writes are flushed when the transport is closed
+	u, _ = url.Parse("bolt://" + path)
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	assert.False(t, transport.db.NoSync)
+	assert.Equal(t, uint64(2), transport.lastSeq.Load())
+
+	m = NewMetrics()
+	transport.setMetrics(m)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "3"}}))
+	assertCounterValue(t, 0, m.boltUnsynced, path)
+}
+
+func TestBoltTransportReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	u, _ := url.Parse("bolt://" + path + "?topic_index=1")
+	writer, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		require.Nil(t, writer.Write(&Update{Topics: []string{"http://example.com/" + strconv.Itoa(i%2)}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	// The database is locked by the writer
+	u, _ = url.Parse("bolt://" + path + "?readonly=1")
+	_, err = NewBoltTransport(u, 5, time.Second)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the database is locked by another process")
+	writer.Close()
+
+	// The index is kept even if it's disabled
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	assert.Equal(t, uint64(3), transport.lastSeq.Load())
+
+	assert.Equal(t, ErrBoltReadOnly, transport.Write(&Update{Topics: []string{"http://example.com/1"}}))
+
+	pipe, err := transport.CreatePipe(Cursor{Kind: CursorAfterID, ID: "1"})
+	require.Nil(t, err)
+	assert.Equal(t, "2", (<-pipe.Read()).ID)
+	assert.Equal(t, "3", (<-pipe.Read()).ID)
+	pipe.Close()
+
+	transport.db.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("updates_topics")))
+
+		return nil
+	})
+}
+
+func TestBoltTransportReadOnlyRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "updates")
+	u, _ := url.Parse("bolt://" + dir + "?readonly=1&rotate=1h")
+	_, err := NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://`+dir+`?readonly=1&rotate=1h": open `+dir+`: no such file or directory: invalid transport DSN`)
+
+	require.Nil(t, os.Mkdir(dir, 0700))
+	_, err = NewBoltTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"bolt://`+dir+`?readonly=1&rotate=1h": `+dir+`: no database found: invalid transport DSN`)
+
+	u, _ = url.Parse("bolt://" + dir + "?rotate=1h")
+	writer, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	start := time.Now().UTC().Truncate(time.Hour)
+	require.Nil(t, writer.Write(&Update{Event: Event{ID: "1"}, Time: start.Add(time.Hour)}))
+	require.Nil(t, writer.Write(&Update{Event: Event{ID: "2"}, Time: start.Add(2 * time.Hour)}))
+	writer.Close()
+	require.Nil(t, os.Remove(filepath.Join(dir, start.Format(boltPartitionLayout)+".db")))
+
+	// No partition is created for the current time window
+	u, _ = url.Parse("bolt://" + dir + "?readonly=1&rotate=1h")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.db"))
+	assert.Len(t, files, 2)
+	assert.Len(t, transport.partitions, 2)
+
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+	assert.Equal(t, "2", (<-pipe.Read()).ID)
+}
+
+func TestBoltTransportRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-bolt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	q := url.Values{"rotate": {"1h"}, "retention": {"2h"}, "archive_dir": {filepath.Join(dir, "archives")}}
+	u, _ := url.Parse("bolt://" + filepath.Join(dir, "updates") + "?" + q.Encode())
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	for i, offset := range []time.Duration{0, time.Hour, 2 * time.Hour, 4 * time.Hour} {
+		require.Nil(t, transport.Write(&Update{Event: Event{ID: strconv.Itoa(i + 1)}, Time: start.Add(offset)}))
+	}
+
+	// The first two partitions are out of the retention period
+	files, _ := filepath.Glob(filepath.Join(dir, "updates", "*.db"))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "updates", start.Add(2*time.Hour).Format(boltPartitionLayout)+".db"),
+		filepath.Join(dir, "updates", start.Add(4*time.Hour).Format(boltPartitionLayout)+".db"),
+	}, files)
+	archives, _ := filepath.Glob(filepath.Join(dir, "archives", "*.db"))
+	assert.Len(t, archives, 2)
+
+	assertHistory := func(transport *BoltTransport, cursor Cursor, ids ...string) {
+		pipe, err := transport.CreatePipe(cursor)
+		require.Nil(t, err)
+		defer pipe.Close()
+
+		for _, id := range ids {
+			select {
+			case u := <-pipe.Read():
+				assert.Equal(t, id, u.ID)
+			case <-time.After(time.Second):
+				t.Fatalf("update %q not received", id)
+			}
+		}
+	}
+
+	assertHistory(transport, EarliestCursor(), "3", "4")
+	assertHistory(transport, AfterIDCursor("3"), "4")
+	assertHistory(transport, AfterTimeCursor(start.Add(3*time.Hour)), "4")
+	require.Nil(t, transport.Close())
+
+	// The existing partitions are opened when the transport starts
+	transport, err = NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	assert.Len(t, transport.partitions, 2)
+	assert.Equal(t, uint64(1), transport.lastSeq.Load())
+	assertHistory(transport, EarliestCursor(), "3", "4")
+}
+
+func TestBoltTransportCorruptedRecord(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	for i := 1; i <= 3; i++ {
+		transport.Write(&Update{Event: Event{ID: strconv.Itoa(i)}})
+	}
+
+	// Simulate a partial write of the second record
+	require.Nil(t, transport.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("updates"))
+		c := b.Cursor()
+		k, _ := c.First()
+		k, v := c.Next()
+
+		return b.Put(k, v[:len(v)-3])
+	}))
+
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+
+	for _, id := range []string{"1", "3"} {
+		u := <-pipe.Read()
+		assert.Equal(t, id, u.ID)
+	}
+}
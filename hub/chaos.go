@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// chaos injects faults, to check in a staging environment that the clients recover from the failures they will face in production:
+// slow transport writes, updates never delivered to a subscriber, and connections closed abruptly (without disconnection event).
+type chaos struct {
+	// writeLatency is the maximum random delay added to the transport writes
+	writeLatency time.Duration
+	// dropRate is the percentage of the updates not delivered to a subscriber
+	dropRate float64
+	// disconnectRate is the percentage of the delivered updates after which the subscriber is disconnected
+	disconnectRate float64
+}
+
+// newChaos creates the fault injector defined by the "chaos_*" configuration parameters, returns nil if "chaos" isn't enabled.
+func newChaos(v *viper.Viper) (*chaos, error) {
+	if !v.GetBool("chaos") {
+		return nil, nil
+	}
+
+	c := &chaos{
+		writeLatency:   v.GetDuration("chaos_write_latency"),
+		dropRate:       v.GetFloat64("chaos_drop_rate"),
+		disconnectRate: v.GetFloat64("chaos_disconnect_rate"),
+	}
+	if c.writeLatency < 0 {
+		return nil, fmt.Errorf(`%w: the "chaos_write_latency" configuration parameter must be positive`, ErrInvalidConfig)
+	}
+	for name, rate := range map[string]float64{"chaos_drop_rate": c.dropRate, "chaos_disconnect_rate": c.disconnectRate} {
+		if rate < 0 || rate > 100 {
+			return nil, fmt.Errorf(`%w: the %q configuration parameter must be a percentage`, ErrInvalidConfig, name)
+		}
+	}
+
+	return c, nil
+}
+
+// delayWrite sleeps for a random duration up to the write latency.
+func (c *chaos) delayWrite() {
+	if c.writeLatency > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(c.writeLatency) + 1)))
+	}
+}
+
+// drop returns true if the update must not be delivered to the subscriber.
+func (c *chaos) drop(u *Update) bool {
+	if !happens(c.dropRate) {
+		return false
+	}
+
+	log.WithFields(log.Fields{"event_id": u.ID}).Debug("chaos: update dropped")
+
+	return true
+}
+
+// disconnect returns true if the subscriber must be disconnected after an update has been delivered.
+func (c *chaos) disconnect() bool {
+	return happens(c.disconnectRate)
+}
+
+// happens returns true with the given probability, expressed as a percentage.
+func happens(rate float64) bool {
+	return rate > 0 && rand.Float64()*100 < rate
+}
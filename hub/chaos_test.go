@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewChaos(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("chaos_drop_rate", 10)
+
+	c, err := newChaos(v)
+	assert.Nil(t, err)
+	assert.Nil(t, c, "the rates are ignored when the chaos mode is disabled")
+
+	v.Set("chaos", true)
+	v.Set("chaos_write_latency", "10ms")
+	c, err = newChaos(v)
+	require.Nil(t, err)
+	assert.Equal(t, &chaos{writeLatency: 10 * time.Millisecond, dropRate: 10}, c)
+
+	v.Set("chaos_disconnect_rate", 101)
+	_, err = newChaos(v)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: the "chaos_disconnect_rate" configuration parameter must be a percentage`)
+
+	v.Set("chaos_disconnect_rate", 0)
+	v.Set("chaos_write_latency", "-1s")
+	_, err = newChaos(v)
+	assert.EqualError(t, err, `invalid config: the "chaos_write_latency" configuration parameter must be positive`)
+}
+
+func TestChaosFaults(t *testing.T) {
+	u := &Update{Event: Event{ID: "a"}}
+
+	c := &chaos{}
+	assert.False(t, c.drop(u))
+	assert.False(t, c.disconnect())
+
+	start := time.Now()
+	c.delayWrite()
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Millisecond))
+
+	c = &chaos{writeLatency: time.Millisecond, dropRate: 100, disconnectRate: 100}
+	assert.True(t, c.drop(u))
+	assert.True(t, c.disconnect())
+	c.delayWrite()
+}
+
+func TestSubscribeChaosDisconnect(t *testing.T) {
+	v := viper.New()
+	v.Set("chaos", true)
+	v.Set("chaos_disconnect_rate", 100)
+	transport := NewLocalTransport(5, time.Second)
+	hub := createDummyWithTransportAndConfig(transport, v)
+	defer hub.Stop()
+
+	w := httptest.NewRecorder()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil)
+		hub.SubscribeHandler(w, req)
+	}()
+
+	waitForSubscribers(t, transport, 1)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/books/1"}, Event: Event{ID: "a", Data: "Hello"}}))
+
+	// The subscriber is disconnected without disconnection event once the update has been delivered
+	wg.Wait()
+	assert.Equal(t, ": instance hub-test\nid: a\ndata: Hello\n\n", w.Body.String())
+}
@@ -0,0 +1,178 @@
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// coalescingRule throttles the updates whose canonical topic matches the selector.
+type coalescingRule struct {
+	window  time.Duration
+	matches func(topic string) bool
+}
+
+// coalescingWindow is opened when an update of a throttled topic is dispatched.
+// The updates published while it's open replace each other, only the latest one is dispatched when it ends.
+type coalescingWindow struct {
+	rule    *coalescingRule
+	pending *Update
+	timer   *time.Timer
+}
+
+// coalescer coalesces the bursts of updates published to the throttled topics before they are dispatched and stored,
+// to protect the subscribers and the history from the publishers sending many redundant state updates.
+type coalescer struct {
+	sync.Mutex
+	rules    []*coalescingRule
+	windows  map[string]*coalescingWindow
+	dispatch func(*Update)
+	metrics  *Metrics
+	closed   bool
+}
+
+// newCoalescer parses the "publish_coalescing" configuration parameter, formatted as "window=selector"
+// where selector is a topic or an URI template. It returns nil if there are no rules.
+func newCoalescer(rules []string, dispatch func(*Update), m *Metrics) (*coalescer, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	c := &coalescer{
+		rules:    make([]*coalescingRule, 0, len(rules)),
+		windows:  make(map[string]*coalescingWindow),
+		dispatch: dispatch,
+		metrics:  m,
+	}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf(`%w: invalid "publish_coalescing" rule %q, must be formatted as "window=selector"`, ErrInvalidConfig, rule)
+		}
+
+		window, err := time.ParseDuration(parts[0])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf(`%w: invalid "publish_coalescing" rule %q, the window must be a positive duration`, ErrInvalidConfig, rule)
+		}
+
+		c.rules = append(c.rules, &coalescingRule{window, topicSelectorsMatcher([]string{parts[1]})})
+	}
+
+	return c, nil
+}
+
+// hold returns true if the update has been held to be dispatched at the end of the window opened for its topic.
+// Otherwise, the update must be dispatched immediately: if its topic is throttled, a window is opened.
+func (c *coalescer) hold(u *Update) bool {
+	rule := c.rule(u.Topics[0])
+	if rule == nil {
+		return false
+	}
+
+	key := coalescingKey(u)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	w, ok := c.windows[key]
+	if !ok {
+		w = &coalescingWindow{rule: rule}
+		w.timer = time.AfterFunc(rule.window, func() { c.end(key) })
+		c.windows[key] = w
+
+		return false
+	}
+
+	if w.pending != nil {
+		// Superseded by the newer update
+		w.pending.Release()
+		if c.metrics != nil {
+			c.metrics.UpdateCoalesced()
+		}
+	}
+	u.Retain()
+	w.pending = u
+
+	return true
+}
+
+// rule returns the first rule matching the topic, or nil if it isn't throttled.
+func (c *coalescer) rule(topic string) *coalescingRule {
+	for _, r := range c.rules {
+		if r.matches(topic) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// end dispatches the latest update held during the window and opens a new one, or closes the window if no update has been held.
+func (c *coalescer) end(key string) {
+	c.Lock()
+	w, ok := c.windows[key]
+	if !ok || c.closed {
+		c.Unlock()
+		return
+	}
+
+	u := w.pending
+	if u == nil {
+		delete(c.windows, key)
+		c.Unlock()
+		return
+	}
+	w.pending = nil
+	w.timer.Reset(w.rule.window)
+	c.Unlock()
+
+	c.dispatch(u)
+	u.Release()
+}
+
+// Close dispatches the updates held, the new updates are dispatched immediately.
+func (c *coalescer) Close() {
+	c.Lock()
+	c.closed = true
+	var pending []*Update
+	for key, w := range c.windows {
+		w.timer.Stop()
+		if w.pending != nil {
+			pending = append(pending, w.pending)
+		}
+		delete(c.windows, key)
+	}
+	c.Unlock()
+
+	for _, u := range pending {
+		c.dispatch(u)
+		u.Release()
+	}
+}
+
+// coalescingKey identifies the updates replacing each other: the ones having the same canonical topic, type and targets.
+func coalescingKey(u *Update) string {
+	targets := targetsMapToArray(u.Targets)
+	sort.Strings(targets)
+
+	return u.Topics[0] + "\n" + u.Type + "\n" + strings.Join(targets, "\n")
+}
+
+// dispatchCoalesced dispatches an update held by the coalescer.
+func (h *Hub) dispatchCoalesced(u *Update) {
+	if err := h.dispatch(u); err != nil {
+		log.WithFields(log.Fields{"event_id": u.ID, "update_topics": u.Topics}).Error(fmt.Errorf("coalesced update: %w", err))
+		return
+	}
+
+	log.WithFields(log.Fields{"instance_id": h.instanceID, "event_id": u.ID, "event_type": u.Type, "update_topics": u.Topics}).Info("Coalesced update published")
+	h.published(u)
+}
@@ -0,0 +1,156 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCoalescer(t *testing.T) {
+	c, err := newCoalescer(nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+
+	c, err = newCoalescer([]string{"1s=https://example.com/sensors/{id}", "500ms=https://example.com/status"}, nil, nil)
+	require.Nil(t, err)
+	require.Len(t, c.rules, 2)
+	assert.Equal(t, time.Second, c.rule("https://example.com/sensors/1").window)
+	assert.Equal(t, 500*time.Millisecond, c.rule("https://example.com/status").window)
+	assert.Nil(t, c.rule("https://example.com/books/1"))
+
+	_, err = newCoalescer([]string{"1s"}, nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: invalid "publish_coalescing" rule "1s", must be formatted as "window=selector"`)
+
+	_, err = newCoalescer([]string{"foo=https://example.com/status"}, nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = newCoalescer([]string{"0s=https://example.com/status"}, nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+// coalescedUpdates records the updates dispatched by a coalescer.
+type coalescedUpdates struct {
+	sync.Mutex
+	ids []string
+}
+
+func (c *coalescedUpdates) dispatch(u *Update) {
+	c.Lock()
+	defer c.Unlock()
+	c.ids = append(c.ids, u.ID)
+}
+
+func (c *coalescedUpdates) get() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.ids...)
+}
+
+func TestCoalescerHold(t *testing.T) {
+	d := &coalescedUpdates{}
+	m := NewMetrics()
+	c, err := newCoalescer([]string{"50ms=https://example.com/sensors/{id}"}, d.dispatch, m)
+	require.Nil(t, err)
+
+	newUpdate := func(id, topic string, targets ...string) *Update {
+		u := &Update{Topics: []string{topic}, Targets: make(map[string]struct{}), Event: Event{ID: id}}
+		for _, t := range targets {
+			u.Targets[t] = struct{}{}
+		}
+
+		return u
+	}
+
+	assert.False(t, c.hold(newUpdate("1", "https://example.com/sensors/1")), "the first update of a burst must be dispatched immediately")
+	assert.True(t, c.hold(newUpdate("2", "https://example.com/sensors/1")))
+	assert.True(t, c.hold(newUpdate("3", "https://example.com/sensors/1")))
+	assert.False(t, c.hold(newUpdate("4", "https://example.com/sensors/2")), "the windows are per topic")
+	assert.False(t, c.hold(newUpdate("5", "https://example.com/sensors/1", "foo")), "the windows are per targets")
+	assert.False(t, c.hold(newUpdate("6", "https://example.com/books/1")))
+	assert.False(t, c.hold(newUpdate("7", "https://example.com/books/1")))
+
+	require.Eventually(t, func() bool { return len(d.get()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"3"}, d.get())
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.updatesCoalesced))
+
+	// A new window has been opened by the dispatch of the held update
+	assert.True(t, c.hold(newUpdate("8", "https://example.com/sensors/1")))
+	require.Eventually(t, func() bool { return len(d.get()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"3", "8"}, d.get())
+
+	// The window is closed when no update has been held
+	require.Eventually(t, func() bool {
+		c.Lock()
+		defer c.Unlock()
+		return len(c.windows) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, c.hold(newUpdate("9", "https://example.com/sensors/1")))
+}
+
+func TestCoalescerClose(t *testing.T) {
+	d := &coalescedUpdates{}
+	c, err := newCoalescer([]string{"1h=https://example.com/status"}, d.dispatch, nil)
+	require.Nil(t, err)
+
+	u := &Update{Topics: []string{"https://example.com/status"}, Event: Event{ID: "1"}}
+	assert.False(t, c.hold(u))
+	u = &Update{Topics: []string{"https://example.com/status"}, Event: Event{ID: "2"}}
+	assert.True(t, c.hold(u))
+
+	c.Close()
+	assert.Equal(t, []string{"2"}, d.get())
+
+	assert.False(t, c.hold(u), "the updates must be dispatched immediately once closed")
+}
+
+func TestPublishCoalescing(t *testing.T) {
+	v := viper.New()
+	v.Set("publish_coalescing", []string{"1h=http://example.com/sensors/{id}"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	publish := func(id string) {
+		form := url.Values{}
+		form.Add("id", id)
+		form.Add("topic", "http://example.com/sensors/1")
+		form.Add("data", "temperature "+id)
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, id, w.Body.String())
+	}
+
+	publish("a")
+	publish("b")
+	publish("c")
+
+	u := <-pipe.Read()
+	assert.Equal(t, "a", u.ID)
+
+	// The held update is dispatched when the hub stops
+	hub.coalescer.Close()
+	u = <-pipe.Read()
+	assert.Equal(t, "c", u.ID)
+	assert.Equal(t, "temperature c", u.Data)
+	assert.Equal(t, 1.0, testutil.ToFloat64(hub.metrics.updatesCoalesced))
+
+	hub.Stop()
+}
@@ -25,16 +25,52 @@ func SetConfigDefaults(v *viper.Viper) {
 	v.SetDefault("write_timeout", time.Duration(0))
 	v.SetDefault("update_buffer_size", 5)
 	v.SetDefault("update_buffer_full_timeout", time.Second)
+	v.SetDefault("update_buffer_strategy", "block")
+	v.SetDefault("update_buffer_overflow_size", 1000)
+	v.SetDefault("update_buffer_spill_dir", "")
 	v.SetDefault("compress", false)
 	v.SetDefault("use_forwarded_headers", false)
 	v.SetDefault("demo", false)
 	v.SetDefault("dispatch_subscriptions", false)
 	v.SetDefault("subscriptions_include_ip", false)
+	v.SetDefault("subscriber_greeting", false)
 	v.SetDefault("metrics", false)
+	v.SetDefault("metrics_egress", false)
+	v.SetDefault("metrics_egress_idle_timeout", defaultEgressIdleTimeout)
+	v.SetDefault("dispatch_retries", 0)
+	v.SetDefault("dispatch_retry_delay", 100*time.Millisecond)
+	v.SetDefault("dispatch_retry_queue_size", 1000)
+	v.SetDefault("topic_idle_timeout", time.Duration(0))
+	v.SetDefault("target_resolver_prefixes", []string{"group:"})
+	v.SetDefault("target_resolver_cache_ttl", time.Minute)
+	v.SetDefault("sandbox", false)
+	v.SetDefault("cors_max_age", time.Duration(0))
+	v.SetDefault("vault_refresh_interval", 5*time.Minute)
+	v.SetDefault("diagnostics_recent_updates", 100)
+	v.SetDefault("mirror_sample_rate", 100.0)
+	v.SetDefault("mirror_queue_size", 1000)
+	v.SetDefault("max_concurrent_replays", 0)
+	v.SetDefault("strict_ordering", false)
+	v.SetDefault("strict_ordering_buffer_size", 1000)
+	v.SetDefault("memory_watermark", uint64(0))
+	v.SetDefault("memory_check_interval", defaultMemoryCheckInterval)
+	v.SetDefault("publish_max_decompressed_size", int64(defaultPublishMaxDecompressedSize))
+	v.SetDefault("sse_omit_id_without_history", false)
+	v.SetDefault("sse_fields", defaultEventFields)
+	v.SetDefault("shutdown_drain", time.Duration(0))
+	v.SetDefault("subscriber_authorization_interval", 5*time.Minute)
+	v.SetDefault("payload_validator_timeout", defaultPayloadValidatorTimeout)
+	v.SetDefault("chaos", false)
+	v.SetDefault("chaos_write_latency", time.Duration(0))
+	v.SetDefault("chaos_drop_rate", 0.0)
+	v.SetDefault("chaos_disconnect_rate", 0.0)
 }
 
 // ValidateConfig validates a Viper instance.
 func ValidateConfig(v *viper.Viper) error {
+	if err := validateSecrets(v); err != nil {
+		return err
+	}
 	if v.GetString("publisher_jwt_key") == "" && v.GetString("jwt_key") == "" {
 		return fmt.Errorf(`%w: one of "jwt_key" or "publisher_jwt_key" configuration parameter must be defined`, ErrInvalidConfig)
 	}
@@ -44,6 +80,54 @@ func ValidateConfig(v *viper.Viper) error {
 	if v.GetString("key_file") != "" && v.GetString("cert_file") == "" {
 		return fmt.Errorf(`%w: if the "key_file" configuration parameter is defined, "cert_file" must be defined too`, ErrInvalidConfig)
 	}
+	if dsn, _ := getSecret(v, "acme_dns_provider"); dsn != "" {
+		if len(v.GetStringSlice("acme_hosts")) == 0 {
+			return fmt.Errorf(`%w: if the "acme_dns_provider" configuration parameter is defined, "acme_hosts" must be defined too`, ErrInvalidConfig)
+		}
+		if _, err := newDNSProvider(dsn); err != nil {
+			return err
+		}
+	}
+	if _, err := newTargetResolver(v); err != nil {
+		return err
+	}
+	if _, err := newSubscriberAuthorizer(v); err != nil {
+		return err
+	}
+	if _, err := newMirror(v); err != nil {
+		return err
+	}
+	if _, err := newAnalyticsSinks(v.GetStringSlice("analytics_sinks"), "", nil); err != nil {
+		return err
+	}
+	if _, err := newCoalescer(v.GetStringSlice("publish_coalescing"), nil, nil); err != nil {
+		return err
+	}
+	if _, err := newTopicNamespaces(v.GetString("topic_namespace_claim"), v.GetStringSlice("topic_namespaces")); err != nil {
+		return err
+	}
+	if _, err := newChaos(v); err != nil {
+		return err
+	}
+	validators, err := newPayloadValidators(v.GetStringSlice("payload_validators"), v.GetDuration("payload_validator_timeout"))
+	if err != nil {
+		return err
+	}
+	if validators != nil {
+		validators.Close()
+	}
+	if _, err := newProjections(v.GetStringSlice("projections")); err != nil {
+		return err
+	}
+	if _, err := newShardRing(v.GetStringSlice("shard_nodes")); err != nil {
+		return err
+	}
+	if _, err := newEventTypeRules(v.GetStringSlice("event_types")); err != nil {
+		return err
+	}
+	if _, err := newEventFormat(v.GetStringSlice("sse_fields"), false); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -58,11 +142,13 @@ func SetFlags(fs *pflag.FlagSet, v *viper.Viper) {
 	fs.StringP("subscriber-jwt-key", "L", "", "subscriber JWT key")
 	fs.StringP("subscriber-jwt-algorithm", "B", "", "subscriber JWT algorithm")
 	fs.BoolP("allow-anonymous", "X", false, "allow subscribers with no valid JWT to connect")
-	fs.StringSliceP("cors-allowed-origins", "c", []string{}, "list of allowed CORS origins")
-	fs.StringSliceP("publish-allowed-origins", "p", []string{}, "list of origins allowed to publish")
+	fs.StringSliceP("cors-allowed-origins", "c", []string{}, `list of allowed CORS origins, subdomains can be matched using a wildcard (e.g. "https://*.example.com")`)
+	fs.Duration("cors-max-age", time.Duration(0), "duration during which the results of preflight requests can be cached by browsers (at most 10m)")
+	fs.StringSliceP("publish-allowed-origins", "p", []string{}, `list of origins allowed to publish, subdomains can be matched using a wildcard (e.g. "https://*.example.com")`)
 	fs.StringP("addr", "a", "", "the address to listen on")
 	fs.StringSliceP("acme-hosts", "o", []string{}, "list of hosts for which Let's Encrypt certificates must be issued")
 	fs.StringP("acme-cert-dir", "E", "", "the directory where to store Let's Encrypt certificates")
+	fs.String("acme-dns-provider", "", "DSN of the DNS provider used to obtain Let's Encrypt certificates with the dns-01 challenge")
 	fs.StringP("cert-file", "C", "", "a cert file (to use a custom certificate)")
 	fs.StringP("key-file", "J", "", "a key file (to use a custom certificate)")
 	fs.DurationP("heartbeat-interval", "i", 15*time.Second, "interval between heartbeats (0s to disable)")
@@ -70,13 +156,68 @@ func SetFlags(fs *pflag.FlagSet, v *viper.Viper) {
 	fs.DurationP("write-timeout", "W", time.Duration(0), "maximum duration before timing out writes of the response")
 	fs.IntP("update-buffer-size", "b", 5, "maximum number of updates to allow buffering before closing the connection")
 	fs.DurationP("update-buffer-full-timeout", "T", time.Second, "time to wait before closing the connection after the buffer is full")
+	fs.String("update-buffer-strategy", "block", "what to do when the buffer is full: block, ring, unbounded or disk")
+	fs.Int("update-buffer-overflow-size", 1000, "maximum number of updates stored by the ring and disk buffer strategies")
+	fs.String("update-buffer-spill-dir", "", "the directory where the disk buffer strategy stores updates (defaults to the temporary directory)")
 	fs.BoolP("compress", "Z", false, "enable or disable HTTP compression support")
 	fs.BoolP("use-forwarded-headers", "f", false, "enable headers forwarding")
 	fs.BoolP("demo", "D", false, "enable the demo mode")
 	fs.StringP("log-format", "l", "", "the log format (JSON, FLUENTD or TEXT)")
 	fs.BoolP("dispatch-subscriptions", "s", false, "dispatch updates when subscriptions are created or terminated")
 	fs.BoolP("subscriptions-include-ip", "I", false, "include the IP address of the subscriber in the subscription update")
+	fs.Bool("subscriber-greeting", false, `send a "mercure-greeting" event containing the version, the node ID, the authorized topic selectors and the heartbeat interval to the subscribers when they connect`)
 	fs.BoolP("metrics", "m", false, "enable metrics")
+	fs.Bool("metrics-egress", false, "count the bytes sent per JWT subject and expose them on the /metrics/egress endpoint, requires the metrics")
+	fs.Duration("metrics-egress-idle-timeout", defaultEgressIdleTimeout, "duration after which the egress counter of a subject that hasn't received any data is removed")
+	fs.Int("dispatch-retries", 0, "maximum number of retries when the transport fails to store an update (0 to disable)")
+	fs.Duration("dispatch-retry-delay", 100*time.Millisecond, "delay before the first retry, doubled after each failed attempt")
+	fs.Int("dispatch-retry-queue-size", 1000, "maximum number of updates waiting to be retried")
+	fs.Duration("topic-idle-timeout", time.Duration(0), "duration after which a topic without subscribers nor updates is expired (0s to disable)")
+	fs.String("target-resolver-url", "", "URL of the HTTP endpoint expanding symbolic targets")
+	fs.StringSlice("target-resolver-prefixes", []string{"group:"}, "prefixes of the targets to expand using the target resolver")
+	fs.Duration("target-resolver-cache-ttl", time.Minute, "duration to cache the targets returned by the target resolver")
+	fs.StringSlice("event-types", []string{}, `list of default event types for topics, formatted as "type=selector"`)
+	fs.StringSlice("topic-namespaces", []string{}, `list of topic prefixes reserved to some publishers, formatted as "owner=prefix" where owner is a value of the "topic_namespace_claim" claim`)
+	fs.String("topic-namespace-claim", "", `the JWT claim identifying the owner of the publisher (e.g. "team", nested claims are separated by dots), required by "topic_namespaces"`)
+	fs.StringSlice("publish-coalescing", []string{}, `list of throttled topics, formatted as "window=selector": the bursts of updates published to a same topic are coalesced, only the latest update of a window is dispatched`)
+	fs.StringSlice("topic-hierarchy", []string{}, `list of rules adding parent topics to published updates, formatted as "selector>parent"`)
+	fs.StringSlice("ops-topics", []string{}, `list of ops topics published by the hub itself, formatted as "name=interval" where name is "heartbeat" or "health"`)
+	fs.String("node-id", "", "identifier of this hub process in the logs, the metrics, the subscription events and the ops topics, defaults to the hostname followed by a random suffix")
+	fs.String("subscriber-id-claim", "", `the JWT claim used as a stable subscriber ID in the subscription updates (e.g. "sub"), nested claims are separated by dots`)
+	fs.StringSlice("conflated-topics", []string{}, "list of topic selectors for which subscribers only receive the most recent of the buffered updates")
+	fs.String("resume-hint-key", "", "key used to sign the resume hints sent to the subscribers when they are gracefully disconnected")
+	fs.String("vault-addr", "", `address of the HashiCorp Vault server storing the secrets referenced as "vault:path#field"`)
+	fs.String("vault-token", "", "token used to authenticate to Vault")
+	fs.String("vault-namespace", "", "Vault namespace (Vault Enterprise)")
+	fs.Duration("vault-refresh-interval", 5*time.Minute, "interval between two retrievals of the secrets stored in Vault")
+	fs.String("diagnostics-dir", "", "directory where a diagnostics bundle is written when a panic is recovered (disabled if empty)")
+	fs.Int("diagnostics-recent-updates", 100, "number of recently published updates included in the diagnostics bundles")
+	fs.String("mirror-url", "", "URL of a secondary hub, a staging hub for instance, to which a sample of the published updates is asynchronously mirrored")
+	fs.String("mirror-jwt", "", "JWT used to publish to the secondary hub")
+	fs.Float64("mirror-sample-rate", 100, "percentage of the published updates mirrored to the secondary hub")
+	fs.Int("mirror-queue-size", 1000, "maximum number of updates waiting to be mirrored, new updates aren't mirrored when the queue is full")
+	fs.StringSlice("analytics-sinks", []string{}, "list of DSNs of the analytics destinations (S3, BigQuery, ClickHouse) to which the published updates are asynchronously mirrored")
+	fs.Bool("sandbox", false, "restrict the process once started, using pledge and unveil on OpenBSD, Capsicum on FreeBSD, and Landlock and seccomp on Linux")
+	fs.StringSlice("payload-validators", []string{}, `list of WebAssembly modules validating or transforming published payloads, formatted as "module=selector"`)
+	fs.Duration("payload-validator-timeout", defaultPayloadValidatorTimeout, "maximum duration of a call to a payload validator, the publication fails when it's exceeded")
+	fs.StringSlice("public-stats-topics", []string{}, "list of topic selectors whose number of subscribers can be retrieved without authorization, to build \"N people watching\" widgets")
+	fs.StringSlice("shard-nodes", []string{}, `list of the nodes of the cluster formatted as "id=url", enables the endpoint returning the node owning a topic`)
+	fs.Bool("strict-ordering", false, "deliver the live updates received while the history is replayed after it, instead of interleaving them")
+	fs.Int("strict-ordering-buffer-size", 1000, "maximum number of live updates held while the history is replayed in the strict ordering mode, the subscriber is disconnected when it's exceeded")
+	fs.Int("max-concurrent-replays", 0, "maximum number of history replays running at the same time, the next ones are queued, 0 means unlimited")
+	fs.Uint64("memory-watermark", 0, "memory usage (in bytes) above which the load is shed: new subscriptions are rejected, slow subscribers are disconnected and history replays are paused, 0 to disable")
+	fs.Duration("memory-check-interval", defaultMemoryCheckInterval, "interval between checks of the memory usage against the watermark")
+	fs.Int64("publish-max-decompressed-size", defaultPublishMaxDecompressedSize, "maximum size (in bytes) of the compressed publish request bodies once decompressed")
+	fs.Bool("sse-omit-id-without-history", false, "don't send the ID of the events when the transport doesn't support the history, for clients failing to reconnect when their Last-Event-ID is ignored")
+	fs.StringSlice("sse-fields", defaultEventFields, `ordered list of the fields of the events, among "event", "retry", "id", "content-type" and "data", the fields not listed are never sent`)
+	fs.String("subscriber-authorization-url", "", "URL of an HTTP endpoint re-evaluating the authorization of the connected subscribers, it must return 401 or 403 if the subscriber must be disconnected")
+	fs.Duration("subscriber-authorization-interval", 5*time.Minute, "minimum duration between two re-evaluations of the authorization of a subscriber, checked when an update is delivered to it")
+	fs.Duration("shutdown-drain", 0, "duration during which the subscribers are disconnected when the hub is gracefully stopped, to spread the reconnections (0s to disconnect them immediately)")
+	fs.Bool("chaos", false, "enable the fault injection configured by the chaos-* flags, to test the resilience of the clients in a staging environment (never enable it in production)")
+	fs.Duration("chaos-write-latency", 0, "maximum random latency added to the transport writes in the chaos mode")
+	fs.Float64("chaos-drop-rate", 0, "percentage of the updates not delivered to a subscriber in the chaos mode")
+	fs.Float64("chaos-disconnect-rate", 0, "percentage of the delivered updates after which the subscriber is abruptly disconnected in the chaos mode")
+	fs.StringSlice("projections", []string{}, `list of named Go templates transforming the JSON payloads, selected by subscribers with the "projection" query parameter, formatted as "name=template"`)
 
 	fs.VisitAll(func(f *pflag.Flag) {
 		v.BindPFlag(strings.ReplaceAll(f.Name, "-", "_"), fs.Lookup(f.Name))
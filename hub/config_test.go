@@ -3,6 +3,7 @@ package hub
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -32,12 +33,53 @@ func TestMissingCertFile(t *testing.T) {
 	assert.EqualError(t, err, `invalid config: if the "key_file" configuration parameter is defined, "cert_file" must be defined too`)
 }
 
+func TestInvalidDNSProvider(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "abc")
+	v.Set("acme_dns_provider", "cloudflare://?api_token=secret")
+
+	err := ValidateConfig(v)
+	assert.EqualError(t, err, `invalid config: if the "acme_dns_provider" configuration parameter is defined, "acme_hosts" must be defined too`)
+
+	v.Set("acme_hosts", []string{"example.com"})
+	err = ValidateConfig(v)
+	assert.EqualError(t, err, `cloudflare: missing "zone_id" parameter: invalid DNS provider DSN`)
+}
+
+func TestInvalidProjections(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "abc")
+	v.Set("projections", []string{"light={{.temperature"})
+
+	err := ValidateConfig(v)
+	assert.EqualError(t, err, `invalid config: invalid "projections" rule "light={{.temperature": template: light:1: unclosed action`)
+}
+
+func TestInvalidEventTypes(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "abc")
+	v.Set("event_types", []string{"invalid"})
+
+	err := ValidateConfig(v)
+	assert.EqualError(t, err, `invalid config: invalid "event_types" rule "invalid", must be formatted as "type=selector"`)
+}
+
+func TestInvalidPayloadValidators(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "abc")
+	v.Set("payload_validators", []string{"invalid"})
+	v.Set("payload_validator_timeout", time.Second)
+
+	err := ValidateConfig(v)
+	assert.EqualError(t, err, `invalid config: invalid "payload_validators" rule "invalid", must be formatted as "module=selector"`)
+}
+
 func TestSetFlags(t *testing.T) {
 	v := viper.New()
 	fs := pflag.NewFlagSet("test", pflag.PanicOnError)
 	SetFlags(fs, v)
 
-	assert.Subset(t, v.AllKeys(), []string{"cert_file", "compress", "demo", "jwt_algorithm", "transport_url", "acme_hosts", "acme_cert_dir", "subscriber_jwt_key", "log_format", "jwt_key", "allow_anonymous", "debug", "read_timeout", "publisher_jwt_algorithm", "write_timeout", "key_file", "use_forwarded_headers", "subscriber_jwt_algorithm", "addr", "publisher_jwt_key", "heartbeat_interval", "cors_allowed_origins", "publish_allowed_origins", "dispatch_subscriptions", "subscriptions_include_ip", "metrics", "update_buffer_size", "update_buffer_full_timeout"})
+	assert.Subset(t, v.AllKeys(), []string{"cert_file", "compress", "demo", "jwt_algorithm", "transport_url", "acme_hosts", "acme_cert_dir", "subscriber_jwt_key", "log_format", "jwt_key", "allow_anonymous", "debug", "read_timeout", "publisher_jwt_algorithm", "write_timeout", "key_file", "use_forwarded_headers", "subscriber_jwt_algorithm", "addr", "publisher_jwt_key", "heartbeat_interval", "cors_allowed_origins", "publish_allowed_origins", "dispatch_subscriptions", "subscriptions_include_ip", "metrics", "metrics_egress", "metrics_egress_idle_timeout", "update_buffer_size", "update_buffer_full_timeout", "event_types", "dispatch_retries", "dispatch_retry_delay", "dispatch_retry_queue_size", "update_buffer_strategy", "update_buffer_overflow_size", "update_buffer_spill_dir", "topic_idle_timeout", "target_resolver_url", "target_resolver_prefixes", "target_resolver_cache_ttl", "topic_hierarchy", "payload_validators", "payload_validator_timeout", "acme_dns_provider", "sandbox", "ops_topics", "node_id", "conflated_topics", "subscriber_id_claim", "mirror_url", "mirror_jwt", "mirror_sample_rate", "mirror_queue_size", "resume_hint_key", "cors_max_age", "vault_addr", "vault_token", "vault_namespace", "vault_refresh_interval", "diagnostics_dir", "diagnostics_recent_updates", "projections", "public_stats_topics", "max_concurrent_replays", "strict_ordering", "strict_ordering_buffer_size", "shard_nodes", "memory_watermark", "memory_check_interval", "publish_max_decompressed_size", "sse_omit_id_without_history", "sse_fields", "shutdown_drain", "subscriber_authorization_url", "subscriber_authorization_interval", "analytics_sinks", "subscriber_greeting", "publish_coalescing", "topic_namespaces", "topic_namespace_claim", "chaos", "chaos_write_latency", "chaos_drop_rate", "chaos_disconnect_rate"})
 }
 
 func TestInitConfig(t *testing.T) {
@@ -56,3 +98,12 @@ func TestMetricsAreDisabledByDefault(t *testing.T) {
 
 	assert.False(t, v.GetBool("metrics"))
 }
+
+func TestInvalidEventFields(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "abc")
+	v.Set("sse_fields", []string{"id", "event"})
+
+	err := ValidateConfig(v)
+	assert.EqualError(t, err, `invalid config: the "sse_fields" configuration parameter must contain the "data" field`)
+}
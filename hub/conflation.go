@@ -0,0 +1,49 @@
+package hub
+
+import (
+	"strings"
+
+	"github.com/yosida95/uritemplate"
+)
+
+// newConflatedTopics parses the "conflated_topics" selectors, raw topics or URI templates.
+// It returns a subscriber used as a matcher, or nil if there are no selectors.
+func newConflatedTopics(selectors []string) *Subscriber {
+	if len(selectors) == 0 {
+		return nil
+	}
+
+	var rawTopics []string
+	var templateTopics []*uritemplate.Template
+	for _, selector := range selectors {
+		if strings.Contains(selector, "{") {
+			if tpl, err := uritemplate.New(selector); err == nil {
+				templateTopics = append(templateTopics, tpl)
+				continue
+			}
+		}
+
+		rawTopics = append(rawTopics, selector)
+	}
+
+	return NewSubscriber(true, nil, selectors, rawTopics, templateTopics, "")
+}
+
+// conflation returns the function selecting the updates that the pipe of a subscription can conflate, or nil if conflation is disabled.
+// All updates are conflated if the subscriber asked for it, otherwise only the updates of the "conflated_topics" and the latest-only updates are.
+func (h *Hub) conflation(all bool) func(*Update) bool {
+	if all {
+		return func(*Update) bool { return true }
+	}
+
+	if h.conflatedTopics == nil {
+		return nil
+	}
+
+	// The match cache of the subscriber isn't thread-safe, use a dedicated one for every pipe
+	c := NewSubscriber(true, nil, h.conflatedTopics.Topics, h.conflatedTopics.RawTopics, h.conflatedTopics.TemplateTopics, "")
+
+	return func(u *Update) bool {
+		return u.LatestOnly || c.IsSubscribed(u)
+	}
+}
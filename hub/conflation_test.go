@@ -0,0 +1,45 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConflatedTopics(t *testing.T) {
+	assert.Nil(t, newConflatedTopics(nil))
+
+	c := newConflatedTopics([]string{"https://example.com/stocks/{id}", "https://example.com/sensor"})
+	assert.Equal(t, []string{"https://example.com/sensor"}, c.RawTopics)
+	assert.Len(t, c.TemplateTopics, 1)
+}
+
+func TestConflation(t *testing.T) {
+	assert.Nil(t, createDummy().conflation(false))
+
+	books := &Update{Topics: []string{"https://example.com/books/1"}}
+	assert.True(t, createDummy().conflation(true)(books))
+
+	v := viper.New()
+	v.Set("conflated_topics", []string{"https://example.com/stocks/{id}"})
+	conflate := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v).conflation(false)
+
+	assert.True(t, conflate(&Update{Topics: []string{"https://example.com/stocks/ACME"}}))
+	assert.False(t, conflate(books))
+	assert.True(t, conflate(&Update{Topics: []string{"https://example.com/books/1"}, LatestOnly: true}))
+}
+
+func TestSubscribeInvalidConflate(t *testing.T) {
+	hub := createAnonymousDummy()
+
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&conflate=foo", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"conflate\" parameter.\n", w.Body.String())
+}
@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const defaultPublishMaxDecompressedSize = 10 << 20
+
+var (
+	// ErrUnsupportedContentEncoding is returned when no decoder is registered for the encoding of a request body.
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+	// ErrDecompressedBodyTooLarge is returned when a decompressed request body exceeds the configured size.
+	ErrDecompressedBodyTooLarge = errors.New("decompressed body too large")
+)
+
+// ContentDecoder decompresses a request body encoded with a given content coding.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	contentDecodersMu sync.RWMutex
+	contentDecoders   = map[string]ContentDecoder{
+		"gzip":    func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		"x-gzip":  func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		"deflate": zlib.NewReader,
+	}
+)
+
+// RegisterContentDecoder makes the publish endpoint accept request bodies encoded with the given content coding (e.g. "zstd" or "br").
+// The gzip and deflate codings are supported out of the box.
+func RegisterContentDecoder(encoding string, decoder ContentDecoder) {
+	contentDecodersMu.Lock()
+	defer contentDecodersMu.Unlock()
+
+	contentDecoders[strings.ToLower(encoding)] = decoder
+}
+
+// decodedBody is the decompressed body of a request, failing once more than max bytes are read.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+	max     int64
+	read    int64
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.read > b.max {
+		return 0, ErrDecompressedBodyTooLarge
+	}
+
+	// Read one more byte than allowed to detect the bodies exceeding the limit
+	if int64(len(p)) > b.max-b.read+1 {
+		p = p[:b.max-b.read+1]
+	}
+
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if b.read > b.max {
+		return n, ErrDecompressedBodyTooLarge
+	}
+
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// decodeBody replaces the body of the request by its decompressed version, according to the Content-Encoding header.
+// The codings are undone in the reverse order of the header, at most max decompressed bytes can be read.
+func decodeBody(r *http.Request, max int64) error {
+	header := r.Header.Get("Content-Encoding")
+	if header == "" {
+		return nil
+	}
+
+	body := &decodedBody{Reader: r.Body, closers: []io.Closer{r.Body}, max: max}
+	encodings := strings.Split(header, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "identity" || encoding == "" {
+			continue
+		}
+
+		contentDecodersMu.RLock()
+		decoder, ok := contentDecoders[encoding]
+		contentDecodersMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%q: %w", encoding, ErrUnsupportedContentEncoding)
+		}
+
+		rc, err := decoder(body.Reader)
+		if err != nil {
+			return fmt.Errorf("%q: %w", encoding, err)
+		}
+		body.Reader = rc
+		body.closers = append(body.closers, rc)
+	}
+
+	r.Body = body
+	r.Header.Del("Content-Encoding")
+
+	return nil
+}
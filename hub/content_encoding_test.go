@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBody(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.Nil(t, err)
+	require.Nil(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	r := httptest.NewRequest("POST", defaultHubURL, bytes.NewReader(gzipBody(t, "foo=bar")))
+	r.Header.Set("Content-Encoding", "gzip")
+	require.Nil(t, decodeBody(r, 100))
+	assert.Empty(t, r.Header.Get("Content-Encoding"))
+
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo=bar", string(body))
+	assert.Nil(t, r.Body.Close())
+
+	// The codings are undone in the reverse order
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(gzipBody(t, "foo=baz"))
+	zw.Close()
+
+	r = httptest.NewRequest("POST", defaultHubURL, &buf)
+	r.Header.Set("Content-Encoding", "gzip, identity, DEFLATE")
+	require.Nil(t, decodeBody(r, 100))
+	body, err = ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo=baz", string(body))
+
+	// Not compressed
+	r = httptest.NewRequest("POST", defaultHubURL, strings.NewReader("foo=bar"))
+	require.Nil(t, decodeBody(r, 1))
+	body, _ = ioutil.ReadAll(r.Body)
+	assert.Equal(t, "foo=bar", string(body))
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	r := httptest.NewRequest("POST", defaultHubURL, strings.NewReader("foo=bar"))
+	r.Header.Set("Content-Encoding", "compress")
+	assert.True(t, errors.Is(decodeBody(r, 100), ErrUnsupportedContentEncoding))
+
+	r = httptest.NewRequest("POST", defaultHubURL, strings.NewReader("foo=bar"))
+	r.Header.Set("Content-Encoding", "gzip")
+	assert.NotNil(t, decodeBody(r, 100))
+
+	// Exactly the limit is accepted
+	r = httptest.NewRequest("POST", defaultHubURL, bytes.NewReader(gzipBody(t, strings.Repeat("a", 100))))
+	r.Header.Set("Content-Encoding", "gzip")
+	require.Nil(t, decodeBody(r, 100))
+	body, err := ioutil.ReadAll(r.Body)
+	assert.Nil(t, err)
+	assert.Len(t, body, 100)
+
+	r = httptest.NewRequest("POST", defaultHubURL, bytes.NewReader(gzipBody(t, strings.Repeat("a", 101))))
+	r.Header.Set("Content-Encoding", "gzip")
+	require.Nil(t, decodeBody(r, 100))
+	_, err = ioutil.ReadAll(r.Body)
+	assert.Equal(t, ErrDecompressedBodyTooLarge, err)
+}
+
+func TestRegisterContentDecoder(t *testing.T) {
+	RegisterContentDecoder("X-Upper", func(r io.Reader) (io.ReadCloser, error) {
+		b, err := ioutil.ReadAll(r)
+		return ioutil.NopCloser(strings.NewReader(strings.ToLower(string(b)))), err
+	})
+	defer func() {
+		contentDecodersMu.Lock()
+		delete(contentDecoders, "x-upper")
+		contentDecodersMu.Unlock()
+	}()
+
+	r := httptest.NewRequest("POST", defaultHubURL, strings.NewReader("FOO=BAR"))
+	r.Header.Set("Content-Encoding", "x-upper")
+	require.Nil(t, decodeBody(r, 100))
+	body, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, "foo=bar", string(body))
+}
+
+func TestPublishCompressedBody(t *testing.T) {
+	hub := createDummy()
+	hub.config.Set("publish_max_decompressed_size", 1000)
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	publish := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", defaultHubURL, bytes.NewReader(body))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Content-Encoding", encoding)
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	form := url.Values{"id": {"id"}, "topic": {"http://example.com/books/1"}, "data": {"Hello!"}}
+	w := publish(gzipBody(t, form.Encode()), "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id", w.Body.String())
+	assert.Equal(t, "Hello!", (<-pipe.Read()).Data)
+
+	w = publish([]byte(form.Encode()), "br")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = publish([]byte(form.Encode()), "gzip")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	form.Set("data", strings.Repeat("a", 1000))
+	w = publish(gzipBody(t, form.Encode()), "gzip")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
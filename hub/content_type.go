@@ -0,0 +1,40 @@
+package hub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strings"
+)
+
+var (
+	// ErrInvalidContentType is returned when the content type declared for the data of an update isn't a valid media type.
+	ErrInvalidContentType = errors.New("invalid content type")
+	// ErrContentTypeMismatch is returned when the data of an update doesn't match its declared content type.
+	ErrContentTypeMismatch = errors.New("the data doesn't match the content type")
+)
+
+// normalizeContentType returns the canonical form of the media type declared for the data of an update, and checks that the data matches it:
+// the JSON media types (application/json and the ones having the +json suffix) require a JSON document,
+// and the media types having the "encoding=base64" parameter (e.g. "application/octet-stream; encoding=base64") require base64-encoded binary data.
+func normalizeContentType(contentType, data string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "", ErrInvalidContentType
+	}
+
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		if !json.Valid([]byte(data)) {
+			return "", ErrContentTypeMismatch
+		}
+	}
+
+	if strings.EqualFold(params["encoding"], "base64") {
+		if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+			return "", ErrContentTypeMismatch
+		}
+	}
+
+	return mime.FormatMediaType(mediaType, params), nil
+}
@@ -0,0 +1,36 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeContentType(t *testing.T) {
+	for contentType, data := range map[string]string{
+		"text/plain; charset=utf-8":                 "Hello",
+		"application/json":                          `{"title": "Dune"}`,
+		"application/ld+json":                       `[]`,
+		"application/octet-stream; encoding=base64": "SGVsbG8=",
+	} {
+		normalized, err := normalizeContentType(contentType, data)
+		assert.Nil(t, err)
+		assert.Equal(t, contentType, normalized)
+	}
+
+	normalized, err := normalizeContentType("Text/Plain;Charset=UTF-8", "Hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain; charset=UTF-8", normalized)
+
+	_, err = normalizeContentType("text", "Hello")
+	assert.Equal(t, ErrInvalidContentType, err)
+
+	_, err = normalizeContentType("application/json", "Hello")
+	assert.Equal(t, ErrContentTypeMismatch, err)
+
+	_, err = normalizeContentType("application/activity+json", "{")
+	assert.Equal(t, ErrContentTypeMismatch, err)
+
+	_, err = normalizeContentType("image/png; encoding=base64", "not base64!")
+	assert.Equal(t, ErrContentTypeMismatch, err)
+}
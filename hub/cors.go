@@ -0,0 +1,61 @@
+package hub
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// corsHandler handles the CORS requests according to the "cors_allowed_origins" and "cors_max_age" configuration parameters.
+func (h *Hub) corsHandler(next http.Handler) http.Handler {
+	origins := h.config.GetStringSlice("cors_allowed_origins")
+
+	options := []handlers.CORSOption{
+		handlers.AllowCredentials(),
+		// Setting the origins too preserves the "*" value of the Access-Control-Allow-Origin header when all origins are allowed
+		handlers.AllowedOrigins(origins),
+		handlers.AllowedOriginValidator(func(origin string) bool {
+			for _, pattern := range origins {
+				if pattern == "*" || matchOrigin(pattern, origin) {
+					return true
+				}
+			}
+
+			return false
+		}),
+		handlers.AllowedHeaders([]string{"authorization", "cache-control"}),
+	}
+	if maxAge := h.config.GetDuration("cors_max_age"); maxAge > 0 {
+		options = append(options, handlers.MaxAge(int(maxAge.Seconds())))
+	}
+
+	cors := handlers.CORS(options...)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the origin, even when it isn't allowed, it must not be shared between origins by caches
+		w.Header().Add("Vary", "Origin")
+		cors.ServeHTTP(w, r)
+	})
+}
+
+// matchOrigin checks if the origin matches the given pattern.
+// The pattern is an origin, or an origin whose host starts with a "*." wildcard matching any subdomain (e.g. "https://*.example.com").
+func matchOrigin(pattern, origin string) bool {
+	if pattern == origin {
+		return true
+	}
+
+	i := strings.Index(pattern, "://*.")
+	if i == -1 {
+		return false
+	}
+
+	prefix, suffix := pattern[:i+3], pattern[i+4:]
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) || len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+
+	// The wildcard only matches subdomains, not ports, paths nor credentials
+	return !strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], ":/@")
+}
@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, origin string
+		match           bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://*.example.com", "https://tenant.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "http://tenant.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://tenant.example.com.evil.com", false},
+		{"https://*.example.com", "https://tenant.example.com:8443", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://user@tenant.example.com", false},
+		{"https://*.example.com:8443", "https://tenant.example.com:8443", true},
+		{"*.example.com", "https://tenant.example.com", false},
+	} {
+		assert.Equal(t, tc.match, matchOrigin(tc.pattern, tc.origin), "%s %s", tc.pattern, tc.origin)
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	v := viper.New()
+	v.Set("cors_allowed_origins", []string{"https://example.com", "https://*.example.net"})
+	v.Set("cors_max_age", 5*time.Minute)
+	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	handler := h.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", defaultHubURL, nil)
+		req.Header.Add("Origin", origin)
+		req.Header.Add("Access-Control-Request-Headers", "authorization")
+		req.Header.Add("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := preflight("https://tenant.example.net")
+	assert.Equal(t, "https://tenant.example.net", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "300", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = preflight("https://example.com")
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = preflight("https://example.org")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	// Without max age
+	h.config.Set("cors_max_age", time.Duration(0))
+	handler = h.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = preflight("https://example.com")
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+}
@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupportedCursor is returned by CreatePipe when the transport doesn't support the kind of the given cursor.
+var ErrUnsupportedCursor = errors.New("hub: unsupported cursor")
+
+// CursorKind defines from which point in the history a pipe fetches updates.
+type CursorKind int
+
+const (
+	// CursorLatest doesn't fetch the history, only the updates published after the creation of the pipe are sent.
+	CursorLatest CursorKind = iota
+	// CursorEarliest fetches all the updates stored in the history.
+	CursorEarliest
+	// CursorAfterID fetches the updates stored after the one having the given ID.
+	CursorAfterID
+	// CursorAfterTime fetches the updates stored since the given time.
+	CursorAfterTime
+)
+
+// Cursor is the point in the history from which a pipe starts fetching updates.
+// The updates published after the creation of the pipe are always sent after the history.
+type Cursor struct {
+	Kind CursorKind
+	ID   string
+	Time time.Time
+	// Topics are the topics the subscriber is interested in, the transports may use them to only fetch the matching updates from the history.
+	// All the updates are fetched when it is empty, the subscribers filter the updates anyway.
+	Topics []string
+}
+
+// LatestCursor returns a cursor not fetching the history.
+func LatestCursor() Cursor {
+	return Cursor{Kind: CursorLatest}
+}
+
+// EarliestCursor returns a cursor fetching the full history.
+func EarliestCursor() Cursor {
+	return Cursor{Kind: CursorEarliest}
+}
+
+// AfterIDCursor returns a cursor fetching the updates stored after the one having the given ID.
+func AfterIDCursor(id string) Cursor {
+	return Cursor{Kind: CursorAfterID, ID: id}
+}
+
+// AfterTimeCursor returns a cursor fetching the updates stored since the given time.
+func AfterTimeCursor(t time.Time) Cursor {
+	return Cursor{Kind: CursorAfterTime, Time: t}
+}
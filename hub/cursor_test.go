@@ -0,0 +1,17 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursors(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, Cursor{}, LatestCursor())
+	assert.Equal(t, Cursor{Kind: CursorEarliest}, EarliestCursor())
+	assert.Equal(t, Cursor{Kind: CursorAfterID, ID: "foo"}, AfterIDCursor("foo"))
+	assert.Equal(t, Cursor{Kind: CursorAfterTime, Time: now}, AfterTimeCursor(now))
+}
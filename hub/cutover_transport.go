@@ -0,0 +1,222 @@
+package hub
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultCutoverRecentIDs = 10000
+
+// CutoverTransport implements the TransportInterface by writing the updates to both an old and a new transport,
+// to migrate the history to a new backend (e.g. from Bolt to MySQL) without downtime.
+// The history is read from the new transport when it contains the requested cursor, and from the old one otherwise:
+// once the new transport contains enough history, the hub can be switched to it.
+//
+// The new transport is known to contain the updates stored since the time from which the dual write started,
+// and the most recent updates written by this transport, which are remembered to serve the subscribers reconnecting with their IDs.
+type CutoverTransport struct {
+	sync.RWMutex
+	old   Transport
+	new   Transport
+	since time.Time
+	// ids contains the IDs of the most recent updates written to the new transport, ring is used to forget the oldest ones
+	ids  map[string]struct{}
+	ring []string
+	next int
+	done chan struct{}
+}
+
+// NewCutoverTransport creates a new CutoverTransport.
+// The new transport must contain all the updates stored since the given time, recentIDs is the number of update IDs remembered.
+func NewCutoverTransport(from, to Transport, since time.Time, recentIDs int) *CutoverTransport {
+	return &CutoverTransport{
+		old:   from,
+		new:   to,
+		since: since,
+		ids:   make(map[string]struct{}, recentIDs),
+		ring:  make([]string, recentIDs),
+		done:  make(chan struct{}),
+	}
+}
+
+// newCutoverTransportFromURL creates a CutoverTransport from a DSN such as cutover://?old=bolt%3A%2F%2Fupdates.db&new=mysql%3A%2F%2Fdb.example.com%2Fmercure,
+// the transports are created using newTransport.
+func newCutoverTransportFromURL(u *url.URL, newTransport func(dsn string) (Transport, error)) (*CutoverTransport, error) {
+	q := u.Query()
+
+	// Without the parameter, the new transport only contains the updates written since the hub started
+	since := time.Now()
+	if p := q.Get("since"); p != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, p); err != nil {
+			return nil, fmt.Errorf(`%q: invalid "since" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	recentIDs := defaultCutoverRecentIDs
+	if p := q.Get("recent_ids"); p != "" {
+		var err error
+		if recentIDs, err = strconv.Atoi(p); err != nil || recentIDs < 0 {
+			return nil, fmt.Errorf(`%q: invalid "recent_ids" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	if q.Get("old") == "" || q.Get("new") == "" {
+		return nil, fmt.Errorf(`%q: the "old" and "new" parameters must be provided: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	from, err := newTransport(q.Get("old"))
+	if err != nil {
+		return nil, fmt.Errorf(`%q: invalid "old" parameter: %w`, redactDSN(u), err)
+	}
+
+	to, err := newTransport(q.Get("new"))
+	if err != nil {
+		from.Close()
+		return nil, fmt.Errorf(`%q: invalid "new" parameter: %w`, redactDSN(u), err)
+	}
+
+	return NewCutoverTransport(from, to, since, recentIDs), nil
+}
+
+// Write pushes updates in the old Transport, then in the new one.
+// An error is returned if the update can't be stored in any of them, the subscribers of the other one would miss it.
+func (t *CutoverTransport) Write(update *Update) error {
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.old.Write(update); err != nil {
+		return fmt.Errorf("cutover: old transport: %w", err)
+	}
+	if err := t.new.Write(update); err != nil {
+		return fmt.Errorf("cutover: new transport: %w", err)
+	}
+
+	t.remember(update.ID)
+
+	return nil
+}
+
+// remember adds the ID to the IDs of the most recent updates written to the new transport.
+func (t *CutoverTransport) remember(id string) {
+	if len(t.ring) == 0 {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if evicted := t.ring[t.next]; evicted != "" {
+		delete(t.ids, evicted)
+	}
+	t.ring[t.next] = id
+	t.ids[id] = struct{}{}
+	t.next = (t.next + 1) % len(t.ring)
+}
+
+// CreatePipe returns a pipe fetching updates from the given point in time,
+// created by the new transport if it contains the cursor, by the old one otherwise.
+func (t *CutoverTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	select {
+	case <-t.done:
+		return nil, ErrClosedTransport
+	default:
+	}
+
+	return t.source(cursor).CreatePipe(cursor)
+}
+
+// source returns the transport containing the updates fetched using the cursor.
+func (t *CutoverTransport) source(cursor Cursor) Transport {
+	switch cursor.Kind {
+	case CursorLatest:
+		return t.new
+
+	case CursorAfterTime:
+		if !cursor.Time.Before(t.since) {
+			return t.new
+		}
+
+	case CursorAfterID:
+		t.RLock()
+		_, ok := t.ids[cursor.ID]
+		t.RUnlock()
+
+		if ok {
+			return t.new
+		}
+	}
+
+	return t.old
+}
+
+// setReplayLimiter limits the number of simultaneous history replays of both transports.
+func (t *CutoverTransport) setReplayLimiter(l *replayLimiter) {
+	for _, transport := range []Transport{t.old, t.new} {
+		if transport, ok := transport.(replayLimitedTransport); ok {
+			transport.setReplayLimiter(l)
+		}
+	}
+}
+
+// setMetrics collects the metrics of both transports if they collect their own.
+func (t *CutoverTransport) setMetrics(m *Metrics) {
+	for _, transport := range []Transport{t.old, t.new} {
+		if transport, ok := transport.(instrumentedTransport); ok {
+			transport.setMetrics(m)
+		}
+	}
+}
+
+// setStrictOrdering enables the strict ordering of both transports if they support it.
+func (t *CutoverTransport) setStrictOrdering(maxHeldUpdates int) {
+	for _, transport := range []Transport{t.old, t.new} {
+		if transport, ok := transport.(strictOrderingTransport); ok {
+			transport.setStrictOrdering(maxHeldUpdates)
+		}
+	}
+}
+
+// supportsHistory returns true if the old transport, which contains all the history, supports it.
+func (t *CutoverTransport) supportsHistory() bool {
+	if transport, ok := t.old.(historyTransport); ok {
+		return transport.supportsHistory()
+	}
+
+	return true
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *CutoverTransport) transportConfig() *transportConfig {
+	return &transportConfig{
+		Scheme:     "cutover",
+		Options:    map[string]interface{}{"since": t.since.UTC().Format(time.RFC3339), "recent_ids": len(t.ring)},
+		Transports: []*transportConfig{describeTransport(t.old), describeTransport(t.new)},
+	}
+}
+
+// Close closes the Transport and both transports it writes to.
+func (t *CutoverTransport) Close() error {
+	t.Lock()
+	select {
+	case <-t.done:
+		t.Unlock()
+		return nil
+	default:
+	}
+	close(t.done)
+	t.Unlock()
+
+	err := t.old.Close()
+	if nerr := t.new.Close(); nerr != nil && err == nil {
+		err = nerr
+	}
+
+	return err
+}
@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocalTransportWithHistory(t *testing.T) *LocalTransport {
+	u, _ := url.Parse("local://?size=100")
+	transport, err := NewLocalTransportWithHistory(u, 5, time.Second)
+	require.Nil(t, err)
+
+	return transport
+}
+
+func TestCutoverTransport(t *testing.T) {
+	old := newTestLocalTransportWithHistory(t)
+	require.Nil(t, old.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}, Time: time.Now().Add(-time.Hour)}))
+	require.Nil(t, old.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "2"}, Time: time.Now().Add(-time.Hour)}))
+
+	target := newTestLocalTransportWithHistory(t)
+	since := time.Now().Add(-time.Minute)
+	transport := NewCutoverTransport(old, target, since, 2)
+	defer transport.Close()
+
+	live, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	for _, id := range []string{"3", "4", "5"} {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: id}}))
+		assert.Equal(t, id, (<-live.Read()).ID)
+	}
+
+	assert.Same(t, target, transport.source(LatestCursor()))
+	assert.Same(t, old, transport.source(EarliestCursor()))
+	assert.Same(t, target, transport.source(AfterTimeCursor(since)))
+	assert.Same(t, old, transport.source(AfterTimeCursor(since.Add(-time.Second))))
+	assert.Same(t, target, transport.source(AfterIDCursor("5")))
+	assert.Same(t, target, transport.source(AfterIDCursor("4")))
+	assert.Same(t, old, transport.source(AfterIDCursor("3")), "the oldest IDs are forgotten")
+	assert.Same(t, old, transport.source(AfterIDCursor("1")))
+
+	// The history written before the dual write is read from the old transport
+	pipe, err := transport.CreatePipe(AfterIDCursor("1"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"2", "3", "4", "5"}, readIDs(t, transport, pipe, 4))
+
+	pipe, err = transport.CreatePipe(AfterIDCursor("4"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"5"}, readIDs(t, transport, pipe, 1))
+}
+
+func TestCutoverTransportWriteError(t *testing.T) {
+	old := NewLocalTransport(5, time.Second)
+	target := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 1}
+	transport := NewCutoverTransport(old, target, time.Now(), 10)
+	defer transport.Close()
+
+	err := transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}})
+	assert.True(t, errors.Is(err, errTransientTransport))
+	assert.EqualError(t, err, "cutover: new transport: "+errTransientTransport.Error())
+	assert.Same(t, old, transport.source(AfterIDCursor("1")))
+
+	require.Nil(t, transport.Close())
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{Topics: []string{"http://example.com/1"}}))
+	_, err = transport.CreatePipe(LatestCursor())
+	assert.Equal(t, ErrClosedTransport, err)
+}
+
+func TestNewCutoverTransportFromURL(t *testing.T) {
+	v := viper.New()
+	v.Set("transport_url", "cutover://?old=local%3A%2F%2F%3Fsize%3D10&new=null%3A%2F%2F&since=2020-01-02T15:04:05Z&recent_ids=5")
+	transport, err := NewTransport(v)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	cutover, ok := transport.(*CutoverTransport)
+	require.True(t, ok)
+	assert.Equal(t, &transportConfig{
+		Scheme:  "cutover",
+		Type:    "*hub.CutoverTransport",
+		Options: map[string]interface{}{"since": "2020-01-02T15:04:05Z", "recent_ids": 5},
+		Transports: []*transportConfig{
+			{Scheme: "local", Type: "*hub.LocalTransport", Options: map[string]interface{}{"buffer_size": 0, "buffer_full_timeout": "0s", "size": 10}},
+			{Scheme: "null", Type: "*hub.LocalTransport", Options: map[string]interface{}{"buffer_size": 0, "buffer_full_timeout": "0s"}},
+		},
+	}, describeTransport(cutover))
+	assert.True(t, cutover.supportsHistory())
+
+	for dsn, expected := range map[string]string{
+		"cutover://?old=null%3A%2F%2F":                                   `the "old" and "new" parameters must be provided: invalid transport DSN`,
+		"cutover://?old=null%3A%2F%2F&new=null%3A%2F%2F&since=yesterday": `invalid "since" parameter "yesterday": invalid transport DSN`,
+		"cutover://?old=null%3A%2F%2F&new=null%3A%2F%2F&recent_ids=-1":   `invalid "recent_ids" parameter "-1": invalid transport DSN`,
+		"cutover://?old=null%3A%2F%2F&new=foo%3A%2F%2F":                  `invalid "new" parameter: "foo://": no such transport available: invalid transport DSN`,
+	} {
+		v.Set("transport_url", dsn)
+		_, err := NewTransport(v)
+		require.NotNil(t, err)
+		assert.True(t, strings.HasSuffix(err.Error(), expected), err.Error())
+		assert.True(t, errors.Is(err, ErrInvalidTransportDSN))
+	}
+}
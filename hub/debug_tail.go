@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tailedUpdate is the representation of an update sent by the debug tail endpoint.
+type tailedUpdate struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type,omitempty"`
+	Retry   uint64   `json:"retry,omitempty"`
+	Topics  []string `json:"topics"`
+	Targets []string `json:"targets"`
+	Data    string   `json:"data"`
+	// ContentType is the media type of the data declared by the publisher
+	ContentType string `json:"content_type,omitempty"`
+	// Publisher is the subject of the JWT used to publish the update
+	Publisher string `json:"publisher,omitempty"`
+	Tombstone string `json:"tombstone,omitempty"`
+}
+
+func newTailedUpdate(u *Update) tailedUpdate {
+	targets := make([]string, 0, len(u.Targets))
+	for t := range u.Targets {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	return tailedUpdate{u.ID, u.Type, u.Retry, u.Topics, targets, u.Data, u.ContentType, u.Publisher, u.Tombstone}
+}
+
+// DebugTailHandler streams all the dispatched updates, regardless of their topics and targets, as server-sent events.
+// The data of every event is a JSON document containing the update and its metadata.
+// The optional "sample" query parameter (between 0 and 1) sets the proportion of updates to stream.
+// A JWT having the "debug" or the "admin" Mercure claim, signed with the publisher key, must be passed in the Authorization header.
+func (h *Hub) DebugTailHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		panic("http.ResponseWriter must be an instance of http.Flusher")
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), nil)
+	if err != nil || claims == nil || !(claims.Mercure.Debug || claims.Mercure.Admin) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	sample := 1.0
+	if p := r.URL.Query().Get("sample"); p != "" {
+		if sample, err = strconv.ParseFloat(p, 64); err != nil || sample < 0 || sample > 1 {
+			http.Error(w, "Invalid \"sample\" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pipe, err := h.transport.CreatePipe(LatestCursor())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Error(err)
+		return
+	}
+	defer pipe.Close()
+
+	sendHeaders(w, h.instanceID)
+	log.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "sample": sample}).Info("Debug tail started")
+
+	hearthbeatInterval := h.config.GetDuration("heartbeat_interval")
+	var cancel context.CancelFunc
+
+	for {
+		ctx := context.Background()
+		if hearthbeatInterval != time.Duration(0) {
+			ctx, cancel = context.WithTimeout(ctx, hearthbeatInterval)
+			defer cancel()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Fprint(w, ":\n")
+				f.Flush()
+			}
+		case update, ok := <-pipe.Read():
+			if !ok {
+				return
+			}
+
+			if sample >= 1 || rand.Float64() < sample {
+				data, _ := json.Marshal(newTailedUpdate(update))
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				f.Flush()
+				if cancel != nil {
+					cancel()
+				}
+			}
+			update.Release()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func createDebugJWT(h *Hub) string {
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Claims = &claims{Mercure: mercureClaim{Debug: true}}
+	tokenString, _ := token.SignedString(h.getJWTKey(publisherRole))
+
+	return tokenString
+}
+
+func TestDebugTailUnauthorized(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	w := httptest.NewRecorder()
+	hub.DebugTailHandler(w, httptest.NewRequest("GET", defaultHubURL+"/debug/updates", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", defaultHubURL+"/debug/updates", nil)
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}))
+	w = httptest.NewRecorder()
+	hub.DebugTailHandler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestDebugTailInvalidSample(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	req := httptest.NewRequest("GET", defaultHubURL+"/debug/updates?sample=2", nil)
+	req.Header.Add("Authorization", "Bearer "+createDebugJWT(hub))
+	w := httptest.NewRecorder()
+	hub.DebugTailHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"sample\" parameter\n", w.Body.String())
+}
+
+func TestDebugTail(t *testing.T) {
+	hub := createDummy()
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics:    []string{"http://example.com/books/1"},
+				Targets:   map[string]struct{}{"foo": {}, "bar": {}},
+				Event:     Event{Data: "Hello World", ID: "b", Type: "book"},
+				Publisher: "publisher-1",
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"/debug/updates?sample=1", nil).WithContext(ctx)
+	req.Header.Add("Authorization", "Bearer "+createDebugJWT(hub))
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\n" + `data: {"id":"b","type":"book","topics":["http://example.com/books/1"],"targets":["bar","foo"],"data":"Hello World","publisher":"publisher-1"}` + "\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.DebugTailHandler(w, req)
+	hub.Stop()
+}
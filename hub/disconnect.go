@@ -0,0 +1,265 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yosida95/uritemplate"
+)
+
+const (
+	// disconnectEventType is the type of the last event sent to the subscribers disconnected by an administrator
+	disconnectEventType     = "mercure-disconnect"
+	defaultDisconnectReason = "admin"
+	drainDisconnectReason   = "maintenance"
+	revokedDisconnectReason = "revoked"
+)
+
+// connections tracks the subscribers connected to this node, so they can be disconnected by an administrator.
+type connections struct {
+	sync.Mutex
+	subscribers map[*Subscriber]chan string
+	// pipes contains the pipes of all the subscribers not removed yet, including the ones asked to disconnect
+	pipes map[*Subscriber]*Pipe
+	// active is the number of subscribers not removed yet, including the ones asked to disconnect
+	active int
+}
+
+func newConnections() *connections {
+	return &connections{subscribers: make(map[*Subscriber]chan string), pipes: make(map[*Subscriber]*Pipe)}
+}
+
+// add registers the subscriber and its pipe, the returned channel receives the reason of the disconnection when it must be disconnected.
+func (c *connections) add(s *Subscriber, pipe *Pipe) chan string {
+	disconnect := make(chan string, 1)
+
+	c.Lock()
+	c.subscribers[s] = disconnect
+	if pipe != nil {
+		c.pipes[s] = pipe
+	}
+	c.active++
+	c.Unlock()
+
+	return disconnect
+}
+
+// remove unregisters the subscriber, it must be called once the connection is closed.
+func (c *connections) remove(s *Subscriber) {
+	c.Lock()
+	delete(c.subscribers, s)
+	delete(c.pipes, s)
+	c.active--
+	c.Unlock()
+}
+
+// list returns the subscribers not asked to disconnect yet.
+func (c *connections) list() []*Subscriber {
+	c.Lock()
+	defer c.Unlock()
+
+	subscribers := make([]*Subscriber, 0, len(c.subscribers))
+	for s := range c.subscribers {
+		subscribers = append(subscribers, s)
+	}
+
+	return subscribers
+}
+
+// disconnectSubscriber asks the subscriber to disconnect, it returns false if it has already been asked to.
+func (c *connections) disconnectSubscriber(s *Subscriber, reason string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	disconnect, ok := c.subscribers[s]
+	if !ok {
+		return false
+	}
+
+	disconnect <- reason
+	delete(c.subscribers, s)
+
+	return true
+}
+
+// activeCount returns the number of subscribers whose connection isn't closed yet.
+func (c *connections) activeCount() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.active
+}
+
+// disconnect asks the subscribers matching the given function to disconnect, and returns their number.
+func (c *connections) disconnect(match func(*Subscriber) bool, reason string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := 0
+	for s, disconnect := range c.subscribers {
+		if !match(s) {
+			continue
+		}
+
+		disconnect <- reason
+		delete(c.subscribers, s)
+		n++
+	}
+
+	return n
+}
+
+// count returns the number of subscribers that would receive the update.
+func (c *connections) count(u *Update) int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := 0
+	for s := range c.subscribers {
+		if !s.IsAuthorized(u) {
+			continue
+		}
+
+		for _, topic := range u.Topics {
+			if s.matchTopic(topic) {
+				n++
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+// countTopic returns the number of subscribers subscribed to the given topic, regardless of their authorizations.
+func (c *connections) countTopic(topic string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := 0
+	for s := range c.subscribers {
+		if s.matchTopic(topic) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// disconnectMatcher returns a function matching the subscribers having one of the given subjects, and subscribed to a topic matching one of the given selectors.
+// Selectors are raw topics or URI templates. An empty list matches everything.
+func disconnectMatcher(selectors, subjects []string) func(*Subscriber) bool {
+	matchesTopic := topicSelectorsMatcher(selectors)
+
+	return func(s *Subscriber) bool {
+		if len(subjects) > 0 && !contains(subjects, s.Subject) {
+			return false
+		}
+		if len(selectors) == 0 {
+			return true
+		}
+
+		for _, topic := range s.Topics {
+			if matchesTopic(topic) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// topicSelectorsMatcher returns a function matching the topics equal to one of the given selectors, or matching one of them if it's a URI template.
+func topicSelectorsMatcher(selectors []string) func(string) bool {
+	templates := make([]*uritemplate.Template, 0, len(selectors))
+	for _, selector := range selectors {
+		if strings.Contains(selector, "{") {
+			if tpl, err := uritemplate.New(selector); err == nil {
+				templates = append(templates, tpl)
+			}
+		}
+	}
+
+	return func(topic string) bool {
+		for _, selector := range selectors {
+			if topic == selector {
+				return true
+			}
+		}
+		for _, tpl := range templates {
+			if tpl.Match(topic) != nil {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// disconnectEvent returns the server-sent event notifying the subscriber of its disconnection.
+// It has no ID, to not change the last event ID used by the client when reconnecting.
+// It contains the ID of the last event delivered to the subscriber and the corresponding resume hint, if any, for clients not handling the Last-Event-ID properly.
+func disconnectEvent(reason, lastEventID, resume string) string {
+	data, _ := json.Marshal(struct {
+		Reason      string `json:"reason"`
+		LastEventID string `json:"last_event_id,omitempty"`
+		Resume      string `json:"resume,omitempty"`
+	}{reason, lastEventID, resume})
+
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", disconnectEventType, data)
+}
+
+// DisconnectHandler disconnects the subscribers connected to this node and matching the "topic" selectors and the "subject" parameters.
+// A terminal event containing the "reason" parameter is sent to them first.
+// A JWT having the "admin" Mercure claim, signed with the publisher key, must be passed in the Authorization header.
+func (h *Hub) DisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), nil)
+	if err != nil || claims == nil || !claims.Mercure.Admin {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	if r.ParseForm() != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	selectors, subjects := r.PostForm["topic"], r.PostForm["subject"]
+	if len(selectors) == 0 && len(subjects) == 0 {
+		http.Error(w, "Missing \"topic\" or \"subject\" parameter", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.PostForm.Get("reason")
+	if reason == "" {
+		reason = defaultDisconnectReason
+	}
+
+	n := h.connections.disconnect(disconnectMatcher(selectors, subjects), reason)
+	log.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "topics": selectors, "subjects": subjects, "reason": reason, "disconnected": n}).Info("Subscribers disconnected")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Disconnected int `json:"disconnected"`
+	}{n})
+}
@@ -0,0 +1,170 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func disconnectRequest(h *Hub, token string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", defaultHubURL+"/disconnect", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.DisconnectHandler(w, req)
+
+	return w
+}
+
+func TestDisconnectMatcher(t *testing.T) {
+	books := &Subscriber{Topics: []string{"https://example.com/books/{id}"}, Subject: "alice"}
+	book := &Subscriber{Topics: []string{"https://example.com/books/1"}, Subject: "bob"}
+	authors := &Subscriber{Topics: []string{"https://example.com/authors/1"}}
+
+	match := disconnectMatcher([]string{"https://example.com/books/{id}"}, nil)
+	assert.True(t, match(books))
+	assert.True(t, match(book))
+	assert.False(t, match(authors))
+
+	match = disconnectMatcher(nil, []string{"bob"})
+	assert.False(t, match(books))
+	assert.True(t, match(book))
+	assert.False(t, match(authors))
+
+	match = disconnectMatcher([]string{"https://example.com/books/1"}, []string{"alice", "bob"})
+	assert.False(t, match(books))
+	assert.True(t, match(book))
+}
+
+func TestTopicSelectorsMatcher(t *testing.T) {
+	match := topicSelectorsMatcher([]string{"https://example.com/books/{id}", "foo"})
+	assert.True(t, match("https://example.com/books/1"))
+	assert.True(t, match("foo"))
+	assert.False(t, match("bar"))
+
+	assert.False(t, topicSelectorsMatcher(nil)("foo"))
+}
+
+func TestDisconnectHandlerUnauthorized(t *testing.T) {
+	hub := createDummy()
+
+	assert.Equal(t, http.StatusUnauthorized, disconnectRequest(hub, "", url.Values{"subject": {"foo"}}).Code)
+	assert.Equal(t, http.StatusUnauthorized, disconnectRequest(hub, createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}), url.Values{"subject": {"foo"}}).Code)
+}
+
+func TestDisconnectHandlerMissingParameters(t *testing.T) {
+	hub := createDummy()
+
+	w := disconnectRequest(hub, createAdminJWT(hub), url.Values{"reason": {"foo"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Missing \"topic\" or \"subject\" parameter\n", w.Body.String())
+}
+
+func TestConnections(t *testing.T) {
+	c := newConnections()
+	s1, s2 := &Subscriber{}, &Subscriber{}
+	d1 := c.add(s1, nil)
+	c.add(s2, nil)
+	assert.Len(t, c.list(), 2)
+	assert.Equal(t, 2, c.activeCount())
+
+	assert.True(t, c.disconnectSubscriber(s1, "foo"))
+	assert.False(t, c.disconnectSubscriber(s1, "foo"))
+	assert.Equal(t, "foo", <-d1)
+	assert.Equal(t, []*Subscriber{s2}, c.list())
+
+	// Disconnected subscribers are active until their connection is closed
+	assert.Equal(t, 2, c.activeCount())
+	c.remove(s1)
+	assert.Equal(t, 1, c.activeCount())
+}
+
+func TestDisconnect(t *testing.T) {
+	hub := createAnonymousDummy()
+	defer hub.Stop()
+
+	subscribe := func(topic string) (*httptest.ResponseRecorder, chan struct{}) {
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic="+url.QueryEscape(topic), nil))
+		}()
+
+		return w, done
+	}
+
+	books, booksDone := subscribe("https://example.com/books/1")
+	_, authorsDone := subscribe("https://example.com/authors/1")
+
+	require.Eventually(t, func() bool {
+		hub.connections.Lock()
+		defer hub.connections.Unlock()
+
+		return len(hub.connections.subscribers) == 2
+	}, time.Second, time.Millisecond)
+
+	w := disconnectRequest(hub, createAdminJWT(hub), url.Values{"topic": {"https://example.com/books/{id}"}, "reason": {"tenant-revoked"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"disconnected": 1}`, w.Body.String())
+
+	select {
+	case <-booksDone:
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber hasn't been disconnected")
+	}
+	assert.Equal(t, ": instance hub-test\nevent: mercure-disconnect\ndata: {\"reason\":\"tenant-revoked\"}\n\n", books.Body.String())
+
+	select {
+	case <-authorsDone:
+		t.Fatal("the subscriber must not be disconnected")
+	default:
+	}
+
+	w = disconnectRequest(hub, createAdminJWT(hub), url.Values{"topic": {"https://example.com/authors/1"}})
+	assert.JSONEq(t, `{"disconnected": 1}`, w.Body.String())
+	<-authorsDone
+}
+
+func TestDisconnectResumeHint(t *testing.T) {
+	v := viper.New()
+	v.Set("resume_hint_key", "secret")
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic="+url.QueryEscape("https://example.com/books/1"), nil))
+	}()
+
+	require.Eventually(t, func() bool {
+		hub.connections.Lock()
+		defer hub.connections.Unlock()
+
+		return len(hub.connections.subscribers) == 1
+	}, time.Second, time.Millisecond)
+
+	hub.transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "d1"}})
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(hub.metrics.subscriberBytes) > 0
+	}, time.Second, time.Millisecond)
+
+	disconnectRequest(hub, createAdminJWT(hub), url.Values{"subject": {""}})
+	<-done
+
+	hint := signResumeHint([]byte("secret"), "a")
+	assert.Equal(t, ": instance hub-test\nid: a\ndata: d1\n\nevent: mercure-disconnect\ndata: {\"reason\":\"admin\",\"last_event_id\":\"a\",\"resume\":\""+hint+"\"}\n\n", w.Body.String())
+}
@@ -0,0 +1,25 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// droppedEventType is the type of the event notifying the subscribers that updates haven't been delivered to them.
+const droppedEventType = "mercure-dropped"
+
+// droppedUpdates describes updates dropped by the buffer of a pipe because the subscriber was too slow,
+// IDs are empty if the dropped updates had none.
+type droppedUpdates struct {
+	Count   int    `json:"count"`
+	FirstID string `json:"first_id"`
+	LastID  string `json:"last_id"`
+}
+
+// droppedEvent returns the event notifying the subscriber that updates have been dropped, so it can resynchronize its state.
+// It has no ID, so the last event ID of the client is preserved.
+func droppedEvent(d droppedUpdates) string {
+	data, _ := json.Marshal(d)
+
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", droppedEventType, data)
+}
@@ -0,0 +1,11 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDroppedEvent(t *testing.T) {
+	assert.Equal(t, "event: mercure-dropped\n"+`data: {"count":3,"first_id":"a","last_id":"c"}`+"\n\n", droppedEvent(droppedUpdates{Count: 3, FirstID: "a", LastID: "c"}))
+}
@@ -0,0 +1,112 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// defaultEgressIdleTimeout is the duration after which the counter of a subject that hasn't received any data is evicted.
+const defaultEgressIdleTimeout = time.Hour
+
+// egressMeter counts the bytes delivered to subscribers, per JWT subject.
+// Anonymous subscribers and tokens without a "sub" claim are accounted with an empty subject.
+// The counters of the subjects that haven't received any data for idleTimeout are evicted, to bound the memory usage.
+type egressMeter struct {
+	sync.RWMutex
+	counters     map[string]*egressCounter
+	idleTimeout  time.Duration
+	lastEviction *atomic.Int64
+}
+
+type egressCounter struct {
+	bytes *atomic.Uint64
+	// lastSeen is the Unix time in nanoseconds of the last delivery
+	lastSeen *atomic.Int64
+}
+
+func newEgressMeter(idleTimeout time.Duration) *egressMeter {
+	return &egressMeter{
+		counters:     make(map[string]*egressCounter),
+		idleTimeout:  idleTimeout,
+		lastEviction: atomic.NewInt64(time.Now().UnixNano()),
+	}
+}
+
+// add records that n bytes have been sent to a subscriber authenticated with the given subject.
+func (m *egressMeter) add(subject string, n uint64) {
+	now := time.Now().UnixNano()
+
+	m.RLock()
+	c, ok := m.counters[subject]
+	m.RUnlock()
+
+	if !ok {
+		m.Lock()
+		if c, ok = m.counters[subject]; !ok {
+			c = &egressCounter{bytes: atomic.NewUint64(0), lastSeen: atomic.NewInt64(now)}
+			m.counters[subject] = c
+		}
+		m.Unlock()
+	}
+
+	c.bytes.Add(n)
+	c.lastSeen.Store(now)
+
+	if last := m.lastEviction.Load(); now-last > int64(m.idleTimeout) && m.lastEviction.CAS(last, now) {
+		m.evict(now)
+	}
+}
+
+// evict removes the counters of the subjects idle for longer than idleTimeout.
+func (m *egressMeter) evict(now int64) {
+	m.Lock()
+	defer m.Unlock()
+
+	for subject, c := range m.counters {
+		if now-c.lastSeen.Load() > int64(m.idleTimeout) {
+			delete(m.counters, subject)
+		}
+	}
+}
+
+// snapshot returns the number of bytes sent per subject.
+func (m *egressMeter) snapshot() map[string]uint64 {
+	m.RLock()
+	defer m.RUnlock()
+
+	s := make(map[string]uint64, len(m.counters))
+	for subject, c := range m.counters {
+		s[subject] = c.bytes.Load()
+	}
+
+	return s
+}
+
+// ServeHTTP returns the number of bytes sent per subject as a JSON object.
+// The "subject" query parameter restricts the result to the given subjects.
+func (m *egressMeter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := m.snapshot()
+
+	if subjects, ok := r.URL.Query()["subject"]; ok {
+		filtered := make(map[string]uint64, len(subjects))
+		for _, subject := range subjects {
+			filtered[subject] = s[subject]
+		}
+		s = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// recordEgress collects metrics about the bytes sent to a subscriber.
+func (h *Hub) recordEgress(s *Subscriber, n int) {
+	h.metrics.SendBytes(n)
+	if h.egress != nil {
+		h.egress.add(s.Subject, uint64(n))
+	}
+}
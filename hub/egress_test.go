@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressMeter(t *testing.T) {
+	m := newEgressMeter(time.Hour)
+	m.add("alice", 10)
+	m.add("", 2)
+	m.add("alice", 3)
+
+	assert.Equal(t, map[string]uint64{"alice": 13, "": 2}, m.snapshot())
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/egress", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"alice": 13, "": 2}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/egress?subject=alice&subject=bob", nil))
+	assert.JSONEq(t, `{"alice": 13, "bob": 0}`, w.Body.String())
+}
+
+func TestEgressMeterEviction(t *testing.T) {
+	m := newEgressMeter(10 * time.Millisecond)
+	m.add("alice", 10)
+	m.add("bob", 5)
+
+	time.Sleep(20 * time.Millisecond)
+	m.add("bob", 1)
+
+	// The idle subjects are evicted
+	assert.Equal(t, map[string]uint64{"bob": 6}, m.snapshot())
+}
+
+func TestSubscribeRecordsEgress(t *testing.T) {
+	v := viper.New()
+	v.Set("metrics", true)
+	v.Set("metrics_egress", true)
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	s, _ := hub.transport.(*LocalTransport)
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Claims = &claims{Mercure: mercureClaim{Subscribe: []string{}}, StandardClaims: jwt.StandardClaims{Subject: "alice"}}
+	tokenString, err := token.SignedString(hub.getJWTKey(subscriberRole))
+	require.Nil(t, err)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/books/1"},
+				Event:  Event{Data: "Hello World", ID: "b"},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil).WithContext(ctx)
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: b\ndata: Hello World\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+
+	assert.Equal(t, map[string]uint64{"alice": uint64(len("id: b\ndata: Hello World\n\n"))}, hub.egress.snapshot())
+	assert.Equal(t, float64(len("id: b\ndata: Hello World\n\n")), testutil.ToFloat64(hub.metrics.subscriberBytes))
+
+	rec := httptest.NewRecorder()
+	hub.egress.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/egress?subject=alice", nil))
+
+	var egress map[string]uint64
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &egress))
+	assert.Equal(t, uint64(len("id: b\ndata: Hello World\n\n")), egress["alice"])
+}
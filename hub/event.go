@@ -3,8 +3,14 @@ package hub
 import (
 	"fmt"
 	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/yosida95/uritemplate"
 )
 
+// defaultEventFields is the order in which the fields of the events are serialized by default.
+var defaultEventFields = []string{"event", "retry", "id", "content-type", "data"} //nolint:gochecknoglobals
+
 // Event is the actual Server Sent Event that will be dispatched.
 type Event struct {
 	// The updates' data, encoded in the sever-sent event format: every line starts with the string "data: "
@@ -19,21 +25,137 @@ type Event struct {
 
 	// The reconnection time
 	Retry uint64
+
+	// The media type of the data declared by the publisher, sent in the "content-type" field (ignored by EventSource)
+	ContentType string
 }
 
 // String serializes the event in a "text/event-stream" representation.
 func (e *Event) String() string {
-	var b strings.Builder
+	var f *eventFormat
+
+	return f.format(e)
+}
+
+// eventFormat defines the fields of the serialized events and their order, for EventSource clients requiring a specific one.
+type eventFormat struct {
+	fields []string
+	// omitID is true if the "id" field must not be sent, because the transport doesn't support the history
+	omitID bool
+}
+
+// newEventFormat parses the "sse_fields" configuration parameter, the fields not listed are never sent.
+// If omitID is true, the "id" field isn't sent either.
+func newEventFormat(fields []string, omitID bool) (*eventFormat, error) {
+	if len(fields) == 0 {
+		fields = defaultEventFields
+	}
+
+	var hasData bool
+	seen := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "event", "retry", "id", "content-type":
+		case "data":
+			hasData = true
+		default:
+			return nil, fmt.Errorf(`%w: invalid "sse_fields" field %q, must be one of "event", "retry", "id", "content-type" or "data"`, ErrInvalidConfig, field)
+		}
+
+		if _, ok := seen[field]; ok {
+			return nil, fmt.Errorf(`%w: duplicated "sse_fields" field %q`, ErrInvalidConfig, field)
+		}
+		seen[field] = struct{}{}
+	}
+	if !hasData {
+		return nil, fmt.Errorf(`%w: the "sse_fields" configuration parameter must contain the "data" field`, ErrInvalidConfig)
+	}
+
+	return &eventFormat{fields, omitID}, nil
+}
 
-	if e.Type != "" {
-		fmt.Fprintf(&b, "event: %s\n", e.Type)
+// eventTypeRule sets the type of the updates published in the topics matching its selector, when the publisher doesn't set one.
+type eventTypeRule struct {
+	eventType string
+	selector  string
+	// template is the compiled selector, nil if it's a raw topic
+	template *uritemplate.Template
+}
+
+// newEventTypeRules parses the "event_types" configuration parameter, formatted as "type=selector"
+// where selector is a topic or an URI template.
+func newEventTypeRules(rules []string) ([]*eventTypeRule, error) {
+	parsed := make([]*eventTypeRule, 0, len(rules))
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(`%w: invalid "event_types" rule %q, must be formatted as "type=selector"`, ErrInvalidConfig, rule)
+		}
+
+		r := &eventTypeRule{eventType: parts[0], selector: parts[1]}
+		if strings.Contains(r.selector, "{") {
+			tpl, err := uritemplate.New(r.selector)
+			if err != nil {
+				return nil, fmt.Errorf(`%w: invalid "event_types" rule %q: %v`, ErrInvalidConfig, rule, err)
+			}
+			r.template = tpl
+		}
+
+		parsed = append(parsed, r)
+	}
+
+	return parsed, nil
+}
+
+// matches returns true if the given topic is the selector of the rule, or matches it if it's an URI template.
+func (r *eventTypeRule) matches(topic string) bool {
+	return topic == r.selector || (r.template != nil && r.template.Match(topic) != nil)
+}
+
+// omitEventID returns true if the "sse_omit_id_without_history" configuration parameter is enabled and the transport doesn't support the history:
+// the IDs are useless to resume, and some clients fail to reconnect when the hub ignores their Last-Event-ID.
+func omitEventID(v *viper.Viper, t Transport) bool {
+	if !v.GetBool("sse_omit_id_without_history") {
+		return false
 	}
-	if e.Retry != 0 {
-		fmt.Fprintf(&b, "retry: %d\n", e.Retry)
+
+	ht, ok := t.(historyTransport)
+
+	return ok && !ht.supportsHistory()
+}
+
+// format serializes the event in a "text/event-stream" representation, the default format is used if f is nil.
+func (f *eventFormat) format(e *Event) string {
+	fields, omitID := defaultEventFields, false
+	if f != nil {
+		fields, omitID = f.fields, f.omitID
 	}
 
-	r := strings.NewReplacer("\r\n", "\ndata: ", "\r", "\ndata: ", "\n", "\ndata: ")
-	fmt.Fprintf(&b, "id: %s\ndata: %s\n\n", e.ID, r.Replace(e.Data))
+	var b strings.Builder
+	for _, field := range fields {
+		switch field {
+		case "event":
+			if e.Type != "" {
+				fmt.Fprintf(&b, "event: %s\n", e.Type)
+			}
+		case "retry":
+			if e.Retry != 0 {
+				fmt.Fprintf(&b, "retry: %d\n", e.Retry)
+			}
+		case "id":
+			if !omitID {
+				fmt.Fprintf(&b, "id: %s\n", e.ID)
+			}
+		case "content-type":
+			if e.ContentType != "" {
+				fmt.Fprintf(&b, "content-type: %s\n", e.ContentType)
+			}
+		case "data":
+			r := strings.NewReplacer("\r\n", "\ndata: ", "\r", "\ndata: ", "\n", "\ndata: ")
+			fmt.Fprintf(&b, "data: %s\n", r.Replace(e.Data))
+		}
+	}
+	b.WriteByte('\n')
 
 	return b.String()
 }
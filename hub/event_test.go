@@ -1,25 +1,105 @@
 package hub
 
 import (
+	"errors"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEncodeFull(t *testing.T) {
-	e := &Event{"several\nlines\rwith\r\neol", "custom-id", "type", 5}
+	e := &Event{"several\nlines\rwith\r\neol", "custom-id", "type", 5, "text/plain"}
 
-	assert.Equal(t, "event: type\nretry: 5\nid: custom-id\ndata: several\ndata: lines\ndata: with\ndata: eol\n\n", e.String())
+	assert.Equal(t, "event: type\nretry: 5\nid: custom-id\ncontent-type: text/plain\ndata: several\ndata: lines\ndata: with\ndata: eol\n\n", e.String())
 }
 
 func TestEncodeNoType(t *testing.T) {
-	e := &Event{"data", "custom-id", "", 5}
+	e := &Event{"data", "custom-id", "", 5, ""}
 
 	assert.Equal(t, "retry: 5\nid: custom-id\ndata: data\n\n", e.String())
 }
 
 func TestEncodeNoRetry(t *testing.T) {
-	e := &Event{"data", "custom-id", "", 0}
+	e := &Event{"data", "custom-id", "", 0, ""}
 
 	assert.Equal(t, "id: custom-id\ndata: data\n\n", e.String())
 }
+
+func TestEventFormat(t *testing.T) {
+	e := &Event{"several\nlines", "custom-id", "type", 5, "text/plain"}
+
+	f, err := newEventFormat([]string{"id", "event", "data", "retry"}, false)
+	require.Nil(t, err)
+	assert.Equal(t, "id: custom-id\nevent: type\ndata: several\ndata: lines\nretry: 5\n\n", f.format(e))
+
+	f, err = newEventFormat([]string{"data", "id"}, false)
+	require.Nil(t, err)
+	assert.Equal(t, "data: several\ndata: lines\nid: custom-id\n\n", f.format(e))
+
+	f, err = newEventFormat(nil, true)
+	require.Nil(t, err)
+	assert.Equal(t, "event: type\nretry: 5\ncontent-type: text/plain\ndata: several\ndata: lines\n\n", f.format(e))
+}
+
+func TestInvalidEventFormat(t *testing.T) {
+	_, err := newEventFormat([]string{"id", "comment", "data"}, false)
+	assert.EqualError(t, err, `invalid config: invalid "sse_fields" field "comment", must be one of "event", "retry", "id", "content-type" or "data"`)
+
+	_, err = newEventFormat([]string{"data", "id", "data"}, false)
+	assert.EqualError(t, err, `invalid config: duplicated "sse_fields" field "data"`)
+
+	_, err = newEventFormat([]string{"event", "id"}, false)
+	assert.EqualError(t, err, `invalid config: the "sse_fields" configuration parameter must contain the "data" field`)
+}
+
+func TestEventTypeRules(t *testing.T) {
+	rules, err := newEventTypeRules([]string{"book.updated=http://example.com/books/{id}", "other=http://example.com/reviews/1"})
+	require.Nil(t, err)
+	require.Len(t, rules, 2)
+
+	assert.NotNil(t, rules[0].template)
+	assert.True(t, rules[0].matches("http://example.com/books/1"))
+	assert.False(t, rules[0].matches("http://example.com/reviews/1"))
+
+	assert.Nil(t, rules[1].template)
+	assert.True(t, rules[1].matches("http://example.com/reviews/1"))
+	assert.False(t, rules[1].matches("http://example.com/reviews/2"))
+}
+
+func TestInvalidEventTypeRules(t *testing.T) {
+	_, err := newEventTypeRules([]string{"invalid"})
+	assert.EqualError(t, err, `invalid config: invalid "event_types" rule "invalid", must be formatted as "type=selector"`)
+
+	_, err = newEventTypeRules([]string{"=http://example.com/books/1"})
+	assert.EqualError(t, err, `invalid config: invalid "event_types" rule "=http://example.com/books/1", must be formatted as "type=selector"`)
+
+	_, err = newEventTypeRules([]string{"book.updated=http://example.com/books/{id"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestOmitEventID(t *testing.T) {
+	v := viper.New()
+	local := NewLocalTransport(5, time.Second)
+	defer local.Close()
+	assert.False(t, omitEventID(v, local))
+
+	v.Set("sse_omit_id_without_history", true)
+	assert.True(t, omitEventID(v, local))
+
+	u, _ := url.Parse("local://?size=10")
+	withHistory, err := NewLocalTransportWithHistory(u, 5, time.Second)
+	require.Nil(t, err)
+	defer withHistory.Close()
+	assert.False(t, omitEventID(v, withHistory))
+
+	// The transports not telling whether they support the history are assumed to
+	u, _ = url.Parse("filelog://" + t.TempDir())
+	file, err := NewFileTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer file.Close()
+	assert.False(t, omitEventID(v, file))
+}
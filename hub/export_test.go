@@ -0,0 +1,6 @@
+package hub
+
+// Exposes the helpers creating the transports to the tests of the hub_test package.
+var (
+	CreateMySQLTransport = createMySQLTransport
+)
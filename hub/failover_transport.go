@@ -0,0 +1,317 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultFailoverProbeInterval = 10 * time.Second
+
+// FailoverTransport implements the TransportInterface by delegating to the first healthy transport of an ordered list.
+// When the active transport fails to store an update or to create a pipe, the next healthy one is used.
+// The failed transports are periodically probed by writing updates without topics, which are never delivered to the subscribers,
+// and the hub fails back to a preferred transport as soon as it recovers.
+//
+// Switching the active transport closes the pipes created by the previous one: the subscribers reconnect to the new one.
+// The updates published while a transport is failed aren't stored in it.
+type FailoverTransport struct {
+	sync.RWMutex
+	transports    []Transport
+	failed        []bool
+	active        int
+	probeInterval time.Duration
+	// pipes maps the pipes to the index of the transport that created them
+	pipes map[*Pipe]int
+	done  chan struct{}
+}
+
+// NewFailoverTransport creates a new FailoverTransport using the given transports, by order of preference.
+func NewFailoverTransport(transports []Transport, probeInterval time.Duration) *FailoverTransport {
+	t := &FailoverTransport{
+		transports:    transports,
+		failed:        make([]bool, len(transports)),
+		probeInterval: probeInterval,
+		pipes:         make(map[*Pipe]int),
+		done:          make(chan struct{}),
+	}
+	go t.probe()
+
+	return t
+}
+
+// newFailoverTransportFromURL creates a FailoverTransport from a DSN such as failover://?transport=mysql%3A%2F%2Fprimary%2Fmercure&transport=bolt%3A%2F%2Fupdates.db,
+// the transports are created using newTransport.
+func newFailoverTransportFromURL(u *url.URL, newTransport func(dsn string) (Transport, error)) (*FailoverTransport, error) {
+	q := u.Query()
+
+	probeInterval := defaultFailoverProbeInterval
+	if p := q.Get("probe_interval"); p != "" {
+		var err error
+		if probeInterval, err = time.ParseDuration(p); err != nil || probeInterval <= 0 {
+			return nil, fmt.Errorf(`%q: invalid "probe_interval" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	dsns := q["transport"]
+	if len(dsns) < 2 {
+		return nil, fmt.Errorf(`%q: at least two "transport" parameters must be provided: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	transports := make([]Transport, 0, len(dsns))
+	for _, dsn := range dsns {
+		transport, err := newTransport(dsn)
+		if err != nil {
+			for _, transport := range transports {
+				transport.Close()
+			}
+
+			return nil, fmt.Errorf(`%q: invalid "transport" parameter: %w`, redactDSN(u), err)
+		}
+
+		transports = append(transports, transport)
+	}
+
+	return NewFailoverTransport(transports, probeInterval), nil
+}
+
+// Write pushes updates in the active Transport, or in the next healthy one if it fails.
+func (t *FailoverTransport) Write(update *Update) error {
+	for {
+		select {
+		case <-t.done:
+			return ErrClosedTransport
+		default:
+		}
+
+		t.RLock()
+		i := t.active
+		t.RUnlock()
+
+		err := t.transports[i].Write(update)
+		if err == nil {
+			return nil
+		}
+		if !t.fail(i, err) {
+			return err
+		}
+	}
+}
+
+// CreatePipe returns a pipe fetching updates from the given point in time, created by the active transport.
+func (t *FailoverTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	for {
+		select {
+		case <-t.done:
+			return nil, ErrClosedTransport
+		default:
+		}
+
+		t.RLock()
+		i := t.active
+		t.RUnlock()
+
+		pipe, err := t.transports[i].CreatePipe(cursor)
+		if errors.Is(err, ErrUnsupportedCursor) {
+			return nil, err
+		}
+		if err != nil {
+			if !t.fail(i, err) {
+				return nil, err
+			}
+
+			continue
+		}
+
+		t.Lock()
+		if t.active == i {
+			t.pipes[pipe] = i
+			t.Unlock()
+
+			return pipe, nil
+		}
+		t.Unlock()
+
+		// The transport has been switched in the meantime, the pipe would not receive the new updates
+		pipe.closeUpdates()
+	}
+}
+
+// fail marks the transport as failed and, if it's the active one, switches to the next healthy transport.
+// It returns false if there is no healthy transport left.
+func (t *FailoverTransport) fail(i int, err error) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.active != i {
+		// Already switched by a concurrent call
+		return true
+	}
+
+	if !t.failed[i] {
+		t.failed[i] = true
+		log.WithFields(log.Fields{"transport": i}).Error(fmt.Errorf("failover: %w", err))
+	}
+
+	j := t.firstHealthy()
+	if j == -1 {
+		return false
+	}
+	t.switchTo(j)
+
+	return true
+}
+
+// firstHealthy returns the index of the preferred healthy transport, or -1 if all the transports failed.
+func (t *FailoverTransport) firstHealthy() int {
+	for i, failed := range t.failed {
+		if !failed {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// switchTo makes the transport the active one, and closes the pipes created by the previous one.
+func (t *FailoverTransport) switchTo(i int) {
+	if t.active == i {
+		return
+	}
+
+	log.WithFields(log.Fields{"from": t.active, "to": i}).Warn("Failover: switching the active transport")
+	for pipe, j := range t.pipes {
+		if j == t.active {
+			pipe.closeUpdates()
+			delete(t.pipes, pipe)
+		}
+	}
+	t.active = i
+}
+
+// probe periodically writes a probe update in the failed transports, and fails back to the preferred healthy one.
+func (t *FailoverTransport) probe() {
+	ticker := time.NewTicker(t.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		t.RLock()
+		failed := append([]bool(nil), t.failed...)
+		t.RUnlock()
+
+		recovered := make([]int, 0, len(failed))
+		for i, f := range failed {
+			if !f {
+				continue
+			}
+
+			// The update has no topics, it can't match any subscriber
+			probe := &Update{Event: Event{ID: "urn:uuid:" + uuid.Must(uuid.NewV4()).String()}}
+			if err := t.transports[i].Write(probe); err == nil {
+				recovered = append(recovered, i)
+			}
+		}
+
+		t.Lock()
+		for _, i := range recovered {
+			log.WithFields(log.Fields{"transport": i}).Info("Failover: transport recovered")
+			t.failed[i] = false
+		}
+		if j := t.firstHealthy(); j != -1 {
+			t.switchTo(j)
+		}
+
+		// Forget the pipes closed by the subscribers
+		for pipe := range t.pipes {
+			if pipe.IsClosed() {
+				delete(t.pipes, pipe)
+			}
+		}
+		t.Unlock()
+	}
+}
+
+// setReplayLimiter limits the number of simultaneous history replays of all the transports.
+func (t *FailoverTransport) setReplayLimiter(l *replayLimiter) {
+	for _, transport := range t.transports {
+		if transport, ok := transport.(replayLimitedTransport); ok {
+			transport.setReplayLimiter(l)
+		}
+	}
+}
+
+// setMetrics collects the metrics of all the transports collecting their own.
+func (t *FailoverTransport) setMetrics(m *Metrics) {
+	for _, transport := range t.transports {
+		if transport, ok := transport.(instrumentedTransport); ok {
+			transport.setMetrics(m)
+		}
+	}
+}
+
+// setStrictOrdering enables the strict ordering of all the transports supporting it.
+func (t *FailoverTransport) setStrictOrdering(maxHeldUpdates int) {
+	for _, transport := range t.transports {
+		if transport, ok := transport.(strictOrderingTransport); ok {
+			transport.setStrictOrdering(maxHeldUpdates)
+		}
+	}
+}
+
+// supportsHistory returns true if all the transports support the history.
+func (t *FailoverTransport) supportsHistory() bool {
+	for _, transport := range t.transports {
+		if transport, ok := transport.(historyTransport); ok && !transport.supportsHistory() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *FailoverTransport) transportConfig() *transportConfig {
+	t.RLock()
+	active := t.active
+	t.RUnlock()
+
+	c := &transportConfig{Scheme: "failover", Options: map[string]interface{}{"probe_interval": t.probeInterval.String(), "active": active}}
+	for _, transport := range t.transports {
+		c.Transports = append(c.Transports, describeTransport(transport))
+	}
+
+	return c
+}
+
+// Close closes the Transport and all the transports it delegates to.
+func (t *FailoverTransport) Close() error {
+	t.Lock()
+	select {
+	case <-t.done:
+		t.Unlock()
+		return nil
+	default:
+	}
+	close(t.done)
+	t.Unlock()
+
+	var err error
+	for _, transport := range t.transports {
+		if cerr := transport.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,155 @@
+package hub
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFailoverTransport(t *testing.T, transports ...Transport) *FailoverTransport {
+	transport := NewFailoverTransport(transports, 10*time.Millisecond)
+	t.Cleanup(func() { transport.Close() })
+
+	return transport
+}
+
+func TestFailoverTransportWrite(t *testing.T) {
+	primary := &flakyTransport{Transport: NewLocalTransport(5, time.Second)}
+	secondary := NewLocalTransport(5, time.Second)
+	transport := newTestFailoverTransport(t, primary, secondary)
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+
+	primary.Lock()
+	primary.failures = 1 << 30
+	primary.Unlock()
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/2"}, Event: Event{ID: "2"}}))
+
+	// The pipes of the failed transport are closed, the subscribers must reconnect
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+
+	pipe, err = transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/3"}, Event: Event{ID: "3"}}))
+	assert.Equal(t, "3", (<-pipe.Read()).ID)
+
+	transport.RLock()
+	assert.Equal(t, 1, transport.active)
+	assert.Equal(t, []bool{true, false}, transport.failed)
+	transport.RUnlock()
+}
+
+func TestFailoverTransportFailBack(t *testing.T) {
+	primary := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 1}
+	secondary := NewLocalTransport(5, time.Second)
+	transport := newTestFailoverTransport(t, primary, secondary)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	// The next probe succeeds
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+
+	transport.RLock()
+	assert.Equal(t, 0, transport.active)
+	assert.Equal(t, []bool{false, false}, transport.failed)
+	transport.RUnlock()
+
+	pipe, err = transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/2"}, Event: Event{ID: "2"}}))
+	assert.Equal(t, "2", (<-pipe.Read()).ID)
+}
+
+func TestFailoverTransportAllFailed(t *testing.T) {
+	transport := newTestFailoverTransport(t,
+		&flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 1 << 30},
+		&flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 1 << 30},
+	)
+
+	assert.Equal(t, errTransientTransport, transport.Write(&Update{Topics: []string{"http://example.com/1"}}))
+	assert.Equal(t, errTransientTransport, transport.Write(&Update{Topics: []string{"http://example.com/2"}}))
+}
+
+func TestFailoverTransportCreatePipe(t *testing.T) {
+	secondary := NewLocalTransport(5, time.Second)
+	transport := newTestFailoverTransport(t, &createPipeErrorTransport{}, secondary)
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, secondary.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+
+	// The cursor isn't supported by the transport, it isn't a failure
+	_, err = transport.CreatePipe(AfterIDCursor("1"))
+	assert.Equal(t, ErrUnsupportedCursor, err)
+}
+
+func TestFailoverTransportSupportsHistory(t *testing.T) {
+	u, _ := url.Parse("local://?size=10")
+	withHistory, err := NewLocalTransportWithHistory(u, 5, time.Second)
+	require.Nil(t, err)
+
+	assert.True(t, newTestFailoverTransport(t, withHistory, &createPipeErrorTransport{}).supportsHistory())
+	assert.False(t, newTestFailoverTransport(t, withHistory, NewLocalTransport(5, time.Second)).supportsHistory())
+}
+
+func TestFailoverTransportClosed(t *testing.T) {
+	check := checkGoroutines(t)
+
+	primary := NewLocalTransport(5, time.Second)
+	transport := NewFailoverTransport([]Transport{primary, NewLocalTransport(5, time.Second)}, 10*time.Millisecond)
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Close())
+	require.Nil(t, transport.Close())
+
+	_, err = transport.CreatePipe(LatestCursor())
+	assert.Equal(t, ErrClosedTransport, err)
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{Topics: []string{"http://example.com/1"}}))
+
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+	assert.Equal(t, ErrClosedTransport, primary.Write(&Update{}))
+
+	check()
+}
+
+func TestNewFailoverTransportFromURL(t *testing.T) {
+	q := url.Values{"transport": {"local://?size=10", "null://"}, "probe_interval": {"1s"}}
+	u, _ := url.Parse("failover://?" + q.Encode())
+	transport, err := newTransport(u.String(), 5, time.Second, nil)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	require.IsType(t, &FailoverTransport{}, transport)
+	f := transport.(*FailoverTransport)
+	assert.Equal(t, time.Second, f.probeInterval)
+	require.Len(t, f.transports, 2)
+	assert.Equal(t, 10, f.transports[0].(*LocalTransport).historySize)
+	assert.Equal(t, 0, f.transports[1].(*LocalTransport).historySize)
+
+	_, err = newTransport("failover://?transport=null%3A%2F%2F", 5, time.Second, nil)
+	assert.EqualError(t, err, `"failover:?transport=null%3A%2F%2F": at least two "transport" parameters must be provided: invalid transport DSN`)
+
+	_, err = newTransport("failover://?transport=null%3A%2F%2F&transport=nothing%3A", 5, time.Second, nil)
+	assert.EqualError(t, err, `"failover:?transport=null%3A%2F%2F&transport=nothing%3A": invalid "transport" parameter: "nothing:": no such transport available: invalid transport DSN`)
+
+	_, err = newTransport("failover://?transport=null%3A%2F%2F&transport=null%3A%2F%2F&probe_interval=0s", 5, time.Second, nil)
+	assert.EqualError(t, err, `"failover:?transport=null%3A%2F%2F&transport=null%3A%2F%2F&probe_interval=0s": invalid "probe_interval" parameter "0s": invalid transport DSN`)
+}
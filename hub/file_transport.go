@@ -0,0 +1,385 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFileRotate = 24 * time.Hour
+	fileLogLayout     = "20060102T150405Z"
+	fileLogExtension  = ".log"
+)
+
+// FileTransport implements the TransportInterface by appending the updates, encoded in JSON, to log files.
+// A new file is created for every time window, the history is replayed by scanning the files.
+type FileTransport struct {
+	sync.Mutex
+	dir               string
+	rotate            time.Duration
+	retention         time.Duration
+	pipes             map[*Pipe]struct{}
+	done              chan struct{}
+	bufferSize        int
+	bufferFullTimeout time.Duration
+	pipeBufferFactory PipeBufferFactory
+	replayLimiter     *replayLimiter
+	maxHeldUpdates    int
+
+	// logs are the files containing the history, ordered from the oldest one, the last one is file
+	logs []*fileLog
+	file *os.File
+	// size is the number of bytes written in file
+	size int64
+}
+
+// fileLog is a log file storing the updates written during a time window.
+type fileLog struct {
+	start time.Time
+	path  string
+}
+
+// NewFileTransport creates a new FileTransport.
+func NewFileTransport(u *url.URL, bufferSize int, bufferFullTimeout time.Duration) (*FileTransport, error) {
+	q := u.Query()
+
+	rotate := defaultFileRotate
+	var retention time.Duration
+	for _, p := range []struct {
+		name  string
+		value *time.Duration
+	}{{"rotate", &rotate}, {"retention", &retention}} {
+		if v := q.Get(p.name); v != "" {
+			var err error
+			if *p.value, err = time.ParseDuration(v); err != nil || *p.value <= 0 {
+				return nil, fmt.Errorf(`%q: invalid %q parameter %q: %w`, redactDSN(u), p.name, v, ErrInvalidTransportDSN)
+			}
+		}
+	}
+
+	dir := u.Path // absolute path (filelog:///var/log/mercure)
+	if dir == "" {
+		dir = u.Host // relative path (filelog://mercure)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf(`%q: missing path: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	t := &FileTransport{
+		dir:               dir,
+		rotate:            rotate,
+		retention:         retention,
+		pipes:             make(map[*Pipe]struct{}),
+		done:              make(chan struct{}),
+		bufferSize:        bufferSize,
+		bufferFullTimeout: bufferFullTimeout,
+	}
+
+	if err := t.openLogs(); err != nil {
+		if t.file != nil {
+			t.file.Close()
+		}
+
+		return nil, fmt.Errorf(`%q: %s: %w`, redactDSN(u), err, ErrInvalidTransportDSN)
+	}
+
+	return t, nil
+}
+
+// openLogs lists the existing log files stored in the directory, and opens the one of the current time window.
+func (t *FileTransport) openLogs() error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	// The names of the files are their start time, so the lexical order is the chronological one
+	sort.Strings(names)
+
+	for _, name := range names {
+		start, err := time.Parse(fileLogLayout, strings.TrimSuffix(name, fileLogExtension))
+		if err != nil || !strings.HasSuffix(name, fileLogExtension) {
+			continue
+		}
+
+		t.logs = append(t.logs, &fileLog{start: start, path: filepath.Join(t.dir, name)})
+	}
+
+	if n := len(t.logs); n > 0 {
+		if err := t.open(t.logs[n-1]); err != nil {
+			return err
+		}
+	}
+
+	return t.rotateIfNeeded(time.Now())
+}
+
+// open opens the log file, and makes it the one where new updates are appended.
+func (t *FileTransport) open(l *fileLog) error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file = f
+	t.size = fi.Size()
+
+	return nil
+}
+
+// rotateIfNeeded creates the log file of the time window of now if it doesn't exist yet, and deletes the files out of the retention period.
+func (t *FileTransport) rotateIfNeeded(now time.Time) error {
+	if n := len(t.logs); n == 0 || !now.Before(t.logs[n-1].start.Add(t.rotate)) {
+		start := now.UTC().Truncate(t.rotate)
+		l := &fileLog{start: start, path: filepath.Join(t.dir, start.Format(fileLogLayout)+fileLogExtension)}
+		if err := t.open(l); err != nil {
+			return err
+		}
+		t.logs = append(t.logs, l)
+	}
+
+	if t.retention == 0 {
+		return nil
+	}
+
+	// A file expires when the retention period has elapsed since the end of its time window
+	for len(t.logs) > 1 && !t.logs[1].start.After(now.Add(-t.retention)) {
+		l := t.logs[0]
+		t.logs = t.logs[1:]
+
+		if err := os.Remove(l.path); err != nil {
+			log.Error(fmt.Errorf("file rotation: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// Write pushes updates in the Transport.
+func (t *FileTransport) Write(update *Update) error {
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	if update.Time.IsZero() {
+		update.Time = time.Now()
+	}
+
+	line, err := json.Marshal(*update)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	t.Lock()
+	defer t.Unlock()
+
+	// The file is closed with the transport
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	if err := t.rotateIfNeeded(update.Time); err != nil {
+		return err
+	}
+
+	n, err := t.file.Write(line)
+	t.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	for pipe := range t.pipes {
+		if !pipe.Write(update) {
+			delete(t.pipes, pipe)
+		}
+	}
+
+	return nil
+}
+
+// CreatePipe returns a pipe fetching updates from the given point in time.
+func (t *FileTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	if cursor.Kind > CursorAfterTime {
+		return nil, ErrUnsupportedCursor
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return nil, ErrClosedTransport
+	default:
+	}
+
+	pipe := t.pipeBufferFactory.newPipe(t.bufferSize, t.bufferFullTimeout)
+	t.pipes[pipe] = struct{}{}
+	if cursor.Kind == CursorLatest {
+		return pipe, nil
+	}
+
+	logs := append([]*fileLog(nil), t.logs...)
+	pipe.holdLive(t.maxHeldUpdates)
+	go t.fetch(cursor, logs, t.size, pipe)
+
+	return pipe, nil
+}
+
+// setReplayLimiter limits the number of simultaneous history replays.
+func (t *FileTransport) setReplayLimiter(l *replayLimiter) {
+	t.replayLimiter = l
+}
+
+// setStrictOrdering holds up to maxHeldUpdates live updates while the history is replayed, to deliver them after it.
+func (t *FileTransport) setStrictOrdering(maxHeldUpdates int) {
+	t.maxHeldUpdates = maxHeldUpdates
+}
+
+// fetch sends the updates stored in the log files from the point in time defined by the cursor.
+// In the last file, only the first size bytes are read, the next updates are sent directly to the pipe.
+func (t *FileTransport) fetch(cursor Cursor, logs []*fileLog, size int64, pipe *Pipe) {
+	defer pipe.releaseLive()
+	if !t.replayLimiter.acquire(pipe) {
+		return
+	}
+	defer t.replayLimiter.release(pipe)
+
+	afterFromID := cursor.Kind != CursorAfterID
+	for i, l := range logs {
+		last := i == len(logs)-1
+
+		// The updates of this file have all been written before the cursor
+		if cursor.Kind == CursorAfterTime && !last && !logs[i+1].start.After(cursor.Time) {
+			continue
+		}
+
+		limit := int64(-1)
+		if last {
+			limit = size
+		}
+
+		stop, err := t.fetchLog(l, cursor, &afterFromID, limit, pipe)
+		if errors.Is(err, os.ErrNotExist) {
+			// The file expired in the meantime
+			continue
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("file history: %w", err))
+			return
+		}
+		if stop {
+			return
+		}
+	}
+}
+
+// fetchLog sends the updates stored in the file, reading at most limit bytes if it isn't negative.
+// It returns true if no more updates must be sent.
+func (t *FileTransport) fetchLog(l *fileLog, cursor Cursor, afterFromID *bool, limit int64, pipe *Pipe) (bool, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without a trailing newline is being written, or has been truncated by a crash
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		var update *Update
+		if err := json.Unmarshal(line, &update); err != nil || update == nil {
+			// Only the corrupted line is skipped
+			log.WithFields(log.Fields{"path": l.path}).Error(fmt.Errorf("file history: %w: %v", ErrCorruptedRecord, err))
+			continue
+		}
+
+		if !*afterFromID {
+			*afterFromID = update.ID == cursor.ID
+			continue
+		}
+
+		if cursor.Kind == CursorAfterTime && update.Time.Before(cursor.Time) {
+			continue
+		}
+
+		if !pipe.writeHistory(update) {
+			return true, nil
+		}
+	}
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *FileTransport) transportConfig() *transportConfig {
+	options := bufferOptions(t.bufferSize, t.bufferFullTimeout)
+	options["path"] = t.dir
+	options["rotate"] = t.rotate.String()
+	options["retention"] = t.retention.String()
+
+	return &transportConfig{Scheme: "filelog", Options: options}
+}
+
+// Close closes the Transport.
+func (t *FileTransport) Close() error {
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+
+	for pipe := range t.pipes {
+		pipe.closeUpdates()
+	}
+	close(t.done)
+
+	return t.file.Close()
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createFileTransport(t *testing.T, query string) (*FileTransport, string) {
+	dir, err := ioutil.TempDir("", "mercure-file")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	u, _ := url.Parse("filelog://" + dir + "?" + query)
+	transport, err := NewFileTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	return transport, dir
+}
+
+func assertFileHistory(t *testing.T, transport *FileTransport, cursor Cursor, ids ...string) {
+	t.Helper()
+
+	pipe, err := transport.CreatePipe(cursor)
+	require.Nil(t, err)
+	defer pipe.Close()
+
+	for _, id := range ids {
+		select {
+		case u := <-pipe.Read():
+			assert.Equal(t, id, u.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("update %q not received", id)
+		}
+	}
+}
+
+func TestNewFileTransportInvalidDSN(t *testing.T) {
+	u, _ := url.Parse("filelog://updates?rotate=invalid")
+	_, err := NewFileTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"filelog://updates?rotate=invalid": invalid "rotate" parameter "invalid": invalid transport DSN`)
+
+	u, _ = url.Parse("filelog://updates?retention=-1h")
+	_, err = NewFileTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"filelog://updates?retention=-1h": invalid "retention" parameter "-1h": invalid transport DSN`)
+
+	u, _ = url.Parse("filelog://")
+	_, err = NewFileTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"filelog:": missing path: invalid transport DSN`)
+}
+
+func TestFileTransportHistory(t *testing.T) {
+	transport, dir := createFileTransport(t, "")
+	defer transport.Close()
+
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/foo"}, Event: Event{ID: strconv.Itoa(i), Data: "data " + strconv.Itoa(i)}}))
+	}
+
+	assertFileHistory(t, transport, EarliestCursor(), "1", "2", "3", "4", "5")
+	assertFileHistory(t, transport, AfterIDCursor("3"), "4", "5")
+
+	pipe, err := transport.CreatePipe(AfterIDCursor("4"))
+	require.Nil(t, err)
+	assert.Equal(t, "5", (<-pipe.Read()).ID)
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "6"}}))
+	assert.Equal(t, "6", (<-pipe.Read()).ID)
+
+	// The updates are stored as JSON lines
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.Len(t, files, 1)
+	content, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 6)
+	assert.Contains(t, lines[0], `"data 1"`)
+}
+
+func TestFileTransportRotation(t *testing.T) {
+	transport, dir := createFileTransport(t, "rotate=1h&retention=2h")
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	for i, offset := range []time.Duration{0, time.Hour, 2 * time.Hour, 4 * time.Hour} {
+		require.Nil(t, transport.Write(&Update{Event: Event{ID: strconv.Itoa(i + 1)}, Time: start.Add(offset)}))
+	}
+
+	// The first two files are out of the retention period
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	assert.Equal(t, []string{
+		filepath.Join(dir, start.Add(2*time.Hour).Format(fileLogLayout)+".log"),
+		filepath.Join(dir, start.Add(4*time.Hour).Format(fileLogLayout)+".log"),
+	}, files)
+
+	assertFileHistory(t, transport, EarliestCursor(), "3", "4")
+	assertFileHistory(t, transport, AfterIDCursor("3"), "4")
+	assertFileHistory(t, transport, AfterTimeCursor(start.Add(3*time.Hour)), "4")
+	require.Nil(t, transport.Close())
+
+	// The existing files are used when the transport starts
+	u, _ := url.Parse("filelog://" + dir + "?rotate=1h&retention=2h")
+	transport, err := NewFileTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	assert.Len(t, transport.logs, 2)
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "5"}, Time: start.Add(4 * time.Hour)}))
+	assertFileHistory(t, transport, EarliestCursor(), "3", "4", "5")
+}
+
+func TestFileTransportCorruptedLine(t *testing.T) {
+	transport, dir := createFileTransport(t, "")
+	defer transport.Close()
+
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "1"}}))
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.Len(t, files, 1)
+
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0600)
+	require.Nil(t, err)
+	_, err = f.WriteString("{corrupted\n")
+	require.Nil(t, err)
+	f.Close()
+	transport.size += int64(len("{corrupted\n"))
+
+	require.Nil(t, transport.Write(&Update{Event: Event{ID: "2"}}))
+
+	// Only the corrupted line is skipped
+	assertFileHistory(t, transport, EarliestCursor(), "1", "2")
+}
+
+func TestFileTransportClosed(t *testing.T) {
+	transport, _ := createFileTransport(t, "")
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Close())
+	assert.Nil(t, transport.Close())
+
+	_, err = transport.CreatePipe(LatestCursor())
+	assert.Equal(t, ErrClosedTransport, err)
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{}))
+
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+}
@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpCredentials obtains the OAuth 2.0 access tokens of a service account, using its JSON key,
+// or using the metadata server of the instance when running on GKE, Cloud Run or Compute Engine.
+// Tokens are cached until they expire.
+type gcpCredentials struct {
+	sync.Mutex
+	client *http.Client
+	// scope is the OAuth 2.0 scope requested with the service account key
+	scope string
+
+	// Service account key, the metadata server is used if privateKey is nil
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURL    string
+
+	metadataURL string
+
+	token   string
+	expires time.Time
+}
+
+// newGCPCredentials loads the JSON key of a service account, or uses the metadata server if path is empty.
+// The scope is the one requested with the service account key.
+func newGCPCredentials(path, scope string, client *http.Client) (*gcpCredentials, error) {
+	c := &gcpCredentials{client: client, scope: scope, metadataURL: gcpMetadataTokenURL}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("%s: unsupported credentials type %q", path, key.Type)
+	}
+
+	if c.privateKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.clientEmail = key.ClientEmail
+	c.tokenURL = key.TokenURI
+
+	return c, nil
+}
+
+// accessToken returns a valid access token, a new one is requested if the cached one expires in less than a minute.
+func (c *gcpCredentials) accessToken(ctx context.Context) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	if c.privateKey == nil {
+		if req, err = http.NewRequestWithContext(ctx, "GET", c.metadataURL, nil); err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+	} else {
+		// The JWT bearer flow, a signed assertion is exchanged for an access token
+		now := time.Now()
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   c.clientEmail,
+			"scope": c.scope,
+			"aud":   c.tokenURL,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}).SignedString(c.privateKey)
+		if err != nil {
+			return "", err
+		}
+
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		if req, err = http.NewRequestWithContext(ctx, "POST", c.tokenURL, strings.NewReader(form.Encode())); err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcp token: status code %d: %s", resp.StatusCode, data)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("gcp token: %w", err)
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return c.token, nil
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// writeGCPServiceAccountKey writes the JSON key of a service account using the given token endpoint.
+func writeGCPServiceAccountKey(t *testing.T, tokenURL string) (string, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	data, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "mercure@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":    tokenURL,
+	})
+
+	f, err := ioutil.TempFile("", "gcp-key-*.json")
+	require.Nil(t, err)
+	f.Write(data)
+	f.Close()
+
+	return f.Name(), key
+}
+
+func TestNewGCPCredentialsInvalid(t *testing.T) {
+	_, err := newGCPCredentials("not-found.json", bigQueryScope, http.DefaultClient)
+	assert.Error(t, err)
+
+	f, _ := ioutil.TempFile("", "gcp-key-*.json")
+	defer os.Remove(f.Name())
+	f.WriteString(`{"type":"authorized_user"}`)
+	f.Close()
+
+	_, err = newGCPCredentials(f.Name(), bigQueryScope, http.DefaultClient)
+	assert.EqualError(t, err, f.Name()+`: unsupported credentials type "authorized_user"`)
+}
+
+func TestGCPCredentialsServiceAccount(t *testing.T) {
+	var calls atomic.Int32
+	var key *rsa.PrivateKey
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Inc()
+		r.ParseForm()
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+
+		token, err := jwt.Parse(r.Form.Get("assertion"), func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+		require.Nil(t, err)
+		claims := token.Claims.(jwt.MapClaims)
+		assert.Equal(t, "mercure@project.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, bigQueryScope, claims["scope"])
+
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	path, k := writeGCPServiceAccountKey(t, server.URL)
+	defer os.Remove(path)
+	key = k
+
+	c, err := newGCPCredentials(path, bigQueryScope, server.Client())
+	require.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		token, err := c.accessToken(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "token", token)
+	}
+
+	// The token is cached
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGCPCredentialsMetadata(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Inc()
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+
+		// A token expiring soon isn't cached
+		fmt.Fprint(w, `{"access_token":"token","expires_in":30,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	c, err := newGCPCredentials("", bigQueryScope, server.Client())
+	require.Nil(t, err)
+	c.metadataURL = server.URL
+
+	for i := 0; i < 2; i++ {
+		token, err := c.accessToken(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "token", token)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGCPCredentialsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c, _ := newGCPCredentials("", bigQueryScope, server.Client())
+	c.metadataURL = server.URL
+
+	_, err := c.accessToken(context.Background())
+	assert.EqualError(t, err, "gcp token: status code 403: denied\n")
+}
@@ -0,0 +1,201 @@
+package hub
+
+import (
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultWatchdogInterval is the interval between two snapshots of the goroutines in debug mode
+	defaultWatchdogInterval = time.Minute
+	// watchdogGrowthSnapshots is the number of consecutive snapshots during which the number of goroutines
+	// must grow, while the number of subscribers doesn't, to be reported as a potential leak
+	watchdogGrowthSnapshots = 5
+)
+
+// goroutineSubsystems matches the functions identifying the subsystem a goroutine belongs to.
+var goroutineSubsystems = []struct {
+	name     string
+	function *regexp.Regexp
+}{
+	{"subscribers", regexp.MustCompile(`hub\.\(\*Hub\)\.SubscribeHandler\(`)},
+	{"pipes", regexp.MustCompile(`hub\.\(\*Pipe\)\.pump\(`)},
+	{"fetchers", regexp.MustCompile(`hub\.\(\*\w+Transport\)\.fetch\(`)},
+}
+
+// goroutineHeaderRegexp matches the first line of the stack of a goroutine, e.g. "goroutine 42 [chan send, 3 minutes]:".
+var goroutineHeaderRegexp = regexp.MustCompile(`^goroutine (\d+) \[([^,\]]+)(?:, (\d+) minutes)?[^\]]*\]:`)
+
+// goroutine is a running goroutine, as reported by runtime.Stack.
+type goroutine struct {
+	id    string
+	state string
+	// waiting is the duration since the goroutine is blocked, reported with a precision of one minute
+	waiting time.Duration
+	// stack doesn't include the function that created the goroutine
+	stack string
+}
+
+// blockedOnChannel returns true if the goroutine is waiting for a channel operation.
+func (g goroutine) blockedOnChannel() bool {
+	switch g.state {
+	case "chan send", "chan receive", "chan send (nil chan)", "chan receive (nil chan)", "select", "select (no cases)":
+		return true
+	}
+
+	return false
+}
+
+// runningGoroutines returns the goroutines currently running in the process.
+func runningGoroutines() []goroutine {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var goroutines []goroutine
+	for _, s := range strings.Split(string(buf), "\n\n") {
+		m := goroutineHeaderRegexp.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+
+		g := goroutine{id: m[1], state: m[2], stack: s}
+		if m[3] != "" {
+			minutes, _ := strconv.Atoi(m[3])
+			g.waiting = time.Duration(minutes) * time.Minute
+		}
+		if i := strings.Index(s, "\ncreated by "); i != -1 {
+			g.stack = s[:i]
+		}
+
+		goroutines = append(goroutines, g)
+	}
+
+	return goroutines
+}
+
+// goroutineSnapshot counts the running goroutines, per subsystem.
+type goroutineSnapshot struct {
+	total      int
+	subsystems map[string]int
+	// blocked counts, per subsystem, the goroutines waiting for a channel operation for at least a minute
+	blocked map[string]int
+}
+
+func takeGoroutineSnapshot(goroutines []goroutine) goroutineSnapshot {
+	s := goroutineSnapshot{total: len(goroutines), subsystems: make(map[string]int), blocked: make(map[string]int)}
+	for _, g := range goroutines {
+		for _, subsystem := range goroutineSubsystems {
+			if !subsystem.function.MatchString(g.stack) {
+				continue
+			}
+
+			s.subsystems[subsystem.name]++
+			if g.blockedOnChannel() && g.waiting >= time.Minute {
+				s.blocked[subsystem.name]++
+			}
+
+			break
+		}
+	}
+
+	return s
+}
+
+func (s goroutineSnapshot) fields() log.Fields {
+	fields := log.Fields{"goroutines": s.total}
+	for _, subsystem := range goroutineSubsystems {
+		fields[subsystem.name] = s.subsystems[subsystem.name]
+	}
+
+	return fields
+}
+
+// goroutineWatchdog periodically snapshots the goroutines in debug mode, and logs the anomalies revealing leaks:
+// pipes and fetchers outliving their subscribers, pipes and fetchers blocked on a channel, and a number of goroutines growing
+// while the number of subscribers doesn't.
+type goroutineWatchdog struct {
+	previous goroutineSnapshot
+	// growth is the number of consecutive snapshots during which the number of goroutines grew
+	growth int
+	done   chan struct{}
+}
+
+func newGoroutineWatchdog(interval time.Duration) *goroutineWatchdog {
+	w := &goroutineWatchdog{done: make(chan struct{})}
+	go w.run(interval)
+
+	return w
+}
+
+func (w *goroutineWatchdog) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.check(takeGoroutineSnapshot(runningGoroutines()))
+		}
+	}
+}
+
+// check logs the anomalies of the snapshot, and returns them.
+func (w *goroutineWatchdog) check(s goroutineSnapshot) []string {
+	var anomalies []string
+
+	subscribers := s.subsystems["subscribers"]
+	for _, name := range []string{"pipes", "fetchers"} {
+		if s.subsystems[name] > subscribers {
+			anomalies = append(anomalies, "more "+name+" than subscribers")
+		}
+		if s.blocked[name] > 0 {
+			anomalies = append(anomalies, name+" blocked on a channel for more than a minute")
+		}
+	}
+
+	if s.total > w.previous.total && subscribers <= w.previous.subsystems["subscribers"] {
+		w.growth++
+	} else {
+		w.growth = 0
+	}
+	if w.growth >= watchdogGrowthSnapshots {
+		anomalies = append(anomalies, "number of goroutines growing while the number of subscribers doesn't")
+		w.growth = 0
+	}
+	w.previous = s
+
+	fields := s.fields()
+	if len(anomalies) == 0 {
+		log.WithFields(fields).Debug("Goroutines snapshot")
+		return nil
+	}
+
+	for _, a := range anomalies {
+		log.WithFields(fields).Warnf("Potential goroutine leak: %s", a)
+	}
+
+	return anomalies
+}
+
+// Close stops the watchdog.
+func (w *goroutineWatchdog) Close() {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+}
@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkGoroutines records the running goroutines, the returned function fails the test if goroutines started since then are still running.
+// It must be called once the transport is closed and the fake servers are stopped.
+func checkGoroutines(t *testing.T) func() {
+	before := make(map[string]struct{})
+	for _, g := range runningGoroutines() {
+		before[g.id] = struct{}{}
+	}
+
+	return func() {
+		t.Helper()
+
+		var leaked []string
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			leaked = leaked[:0]
+			for _, g := range runningGoroutines() {
+				if _, ok := before[g.id]; !ok {
+					leaked = append(leaked, g.stack)
+				}
+			}
+
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if len(leaked) != 0 {
+			t.Errorf("%d leaked goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	}
+}
+
+func TestRunningGoroutines(t *testing.T) {
+	pipe := NewPipeWithBuffer(0, time.Second, NewListPipeBuffer())
+	defer pipe.Close()
+	require.True(t, pipe.Write(&Update{}))
+
+	var pump *goroutine
+	require.Eventually(t, func() bool {
+		for _, g := range runningGoroutines() {
+			if strings.Contains(g.stack, "(*Pipe).pump(") {
+				pump = &g
+				return g.blockedOnChannel()
+			}
+		}
+
+		return false
+	}, time.Second, time.Millisecond)
+
+	assert.NotContains(t, pump.stack, "created by")
+	assert.Equal(t, 1, takeGoroutineSnapshot([]goroutine{*pump}).subsystems["pipes"])
+}
+
+func TestGoroutineSnapshot(t *testing.T) {
+	s := takeGoroutineSnapshot([]goroutine{
+		{id: "1", state: "select", waiting: 10 * time.Minute, stack: "goroutine 1 [select, 10 minutes]:\ngithub.com/dunglas/mercure/hub.(*Hub).SubscribeHandler(0xc000123456)"},
+		{id: "2", state: "chan send", waiting: 2 * time.Minute, stack: "goroutine 2 [chan send, 2 minutes]:\ngithub.com/dunglas/mercure/hub.(*Pipe).pump(0xc000123456)"},
+		{id: "3", state: "chan send", stack: "goroutine 3 [chan send]:\ngithub.com/dunglas/mercure/hub.(*BoltTransport).fetch(0xc000123456)"},
+		{id: "4", state: "IO wait", stack: "goroutine 4 [IO wait]:\nnet.(*conn).Read(0xc000123456)"},
+	})
+
+	assert.Equal(t, 4, s.total)
+	assert.Equal(t, map[string]int{"subscribers": 1, "pipes": 1, "fetchers": 1}, s.subsystems)
+	assert.Equal(t, map[string]int{"subscribers": 1, "pipes": 1}, s.blocked)
+}
+
+func TestGoroutineWatchdogCheck(t *testing.T) {
+	w := &goroutineWatchdog{done: make(chan struct{})}
+
+	assert.Empty(t, w.check(goroutineSnapshot{total: 10, subsystems: map[string]int{"subscribers": 2, "pipes": 2, "fetchers": 1}}))
+	assert.Equal(t, []string{"more pipes than subscribers", "fetchers blocked on a channel for more than a minute"},
+		w.check(goroutineSnapshot{total: 10, subsystems: map[string]int{"subscribers": 2, "pipes": 3, "fetchers": 1}, blocked: map[string]int{"fetchers": 1}}))
+
+	// The number of goroutines grows while the number of subscribers doesn't
+	for i := 1; i < watchdogGrowthSnapshots; i++ {
+		assert.Empty(t, w.check(goroutineSnapshot{total: 10 + i, subsystems: map[string]int{"subscribers": 2}}))
+	}
+	assert.Equal(t, []string{"number of goroutines growing while the number of subscribers doesn't"},
+		w.check(goroutineSnapshot{total: 20, subsystems: map[string]int{"subscribers": 2}}))
+
+	// Growing with the subscribers is expected
+	for i := 1; i <= watchdogGrowthSnapshots; i++ {
+		assert.Empty(t, w.check(goroutineSnapshot{total: 20 + i, subsystems: map[string]int{"subscribers": 2 + i}}))
+	}
+
+	w.Close()
+	w.Close()
+}
+
+func TestGoroutineWatchdogDebug(t *testing.T) {
+	hub := createDummy()
+	assert.Nil(t, hub.watchdog)
+	hub.Stop()
+
+	check := checkGoroutines(t)
+	v := viper.New()
+	v.Set("debug", true)
+	hub = createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	require.NotNil(t, hub.watchdog)
+	hub.Stop()
+	check()
+}
@@ -0,0 +1,39 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// greetingEventType is the type of the first event sent to the subscribers when subscriber_greeting is enabled.
+const greetingEventType = "mercure-greeting"
+
+// Version is the version of the hub, set at build time with -ldflags "-X github.com/dunglas/mercure/hub.Version=v1.2.3".
+var Version = "dev" //nolint:gochecknoglobals
+
+// greetingEvent returns the event describing the hub and the subscription, so clients can configure themselves.
+// It has no ID, so the last event ID of the client is preserved.
+func (h *Hub) greetingEvent(s *Subscriber, heartbeatInterval time.Duration) string {
+	topics := make([]string, 0, len(s.Targets))
+	if s.AllTargets {
+		topics = append(topics, "*")
+	}
+	for t := range s.Targets {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+
+	data, _ := json.Marshal(struct {
+		Version  string `json:"version"`
+		NodeID   string `json:"node_id,omitempty"`
+		Instance string `json:"instance"`
+		// Topics are the topic selectors the subscriber is authorized to receive private updates for
+		Topics []string `json:"topics"`
+		// HeartbeatInterval is in milliseconds, 0 if the heartbeats are disabled
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}{Version, h.config.GetString("node_id"), h.instanceID, topics, heartbeatInterval.Milliseconds()})
+
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", greetingEventType, data)
+}
@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGreetingEvent(t *testing.T) {
+	hub := createDummy()
+	hub.config.Set("node_id", "node-1")
+
+	s := NewSubscriber(false, map[string]struct{}{"https://example.com/users/1": {}, "https://example.com/books/{id}": {}}, []string{"https://example.com/books/1"}, nil, nil, "")
+	assert.Equal(t, "event: mercure-greeting\n"+`data: {"version":"dev","node_id":"node-1","instance":"`+hub.instanceID+`","topics":["https://example.com/books/{id}","https://example.com/users/1"],"heartbeat_interval":15000}`+"\n\n", hub.greetingEvent(s, 15*time.Second))
+
+	hub.config.Set("node_id", "")
+	s = NewSubscriber(true, nil, []string{"https://example.com/books/1"}, nil, nil, "")
+	assert.Equal(t, "event: mercure-greeting\n"+`data: {"version":"dev","instance":"`+hub.instanceID+`","topics":["*"],"heartbeat_interval":0}`+"\n\n", hub.greetingEvent(s, 0))
+
+	s = NewSubscriber(false, map[string]struct{}{}, []string{"https://example.com/books/1"}, nil, nil, "")
+	assert.Contains(t, hub.greetingEvent(s, 0), `"topics":[]`)
+}
+
+func TestSubscribeGreeting(t *testing.T) {
+	hub := createDummy()
+	hub.config.Set("subscriber_greeting", true)
+	hub.config.Set("heartbeat_interval", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil).WithContext(ctx)
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, subscriberRole, []string{"http://example.com/books/{id}"}))
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nevent: mercure-greeting\n" + `data: {"version":"dev","node_id":"hub-test","instance":"hub-test","topics":["http://example.com/books/{id}"],"heartbeat_interval":60000}` + "\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
@@ -0,0 +1,208 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrHistoryExportUnsupported is returned when the history of the configured transport can't be exported or imported.
+var ErrHistoryExportUnsupported = errors.New("the transport doesn't support exporting and importing its history")
+
+// historyExporter is implemented by the transports able to stream their history as NDJSON.
+type historyExporter interface {
+	Export(w io.Writer) error
+}
+
+// historyImporter is implemented by the transports able to store a history streamed as NDJSON.
+type historyImporter interface {
+	Import(r io.Reader) error
+}
+
+// historyRecord is the representation of an update in the exported history, one JSON document per line.
+// Unlike the records stored by the transports, it never changes with the internal representation of the updates.
+type historyRecord struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type,omitempty"`
+	Retry       uint64     `json:"retry,omitempty"`
+	Topics      []string   `json:"topics"`
+	Data        string     `json:"data"`
+	ContentType string     `json:"content_type,omitempty"`
+	Targets     []string   `json:"targets,omitempty"`
+	Time        time.Time  `json:"time"`
+	Expires     *time.Time `json:"expires,omitempty"`
+	LatestOnly  bool       `json:"latest_only,omitempty"`
+	Tombstone   string     `json:"tombstone,omitempty"`
+	Publisher   string     `json:"publisher,omitempty"`
+}
+
+func newHistoryRecord(u *Update) *historyRecord {
+	r := &historyRecord{
+		ID:          u.ID,
+		Type:        u.Type,
+		Retry:       u.Retry,
+		Topics:      u.Topics,
+		Data:        u.Data,
+		ContentType: u.ContentType,
+		Time:        u.Time.UTC(),
+		LatestOnly:  u.LatestOnly,
+		Tombstone:   u.Tombstone,
+		Publisher:   u.Publisher,
+	}
+	for t := range u.Targets {
+		r.Targets = append(r.Targets, t)
+	}
+	sort.Strings(r.Targets)
+	if !u.Expires.IsZero() {
+		expires := u.Expires.UTC()
+		r.Expires = &expires
+	}
+
+	return r
+}
+
+// update returns the update described by the record.
+func (r *historyRecord) update() (*Update, error) {
+	if r.ID == "" {
+		return nil, errors.New(`missing "id"`)
+	}
+	if len(r.Topics) == 0 {
+		return nil, errors.New(`missing "topics"`)
+	}
+
+	u := &Update{
+		Targets:    make(map[string]struct{}, len(r.Targets)),
+		Topics:     r.Topics,
+		Event:      Event{Data: r.Data, ID: r.ID, Type: r.Type, Retry: r.Retry, ContentType: r.ContentType},
+		Time:       r.Time,
+		LatestOnly: r.LatestOnly,
+		Tombstone:  r.Tombstone,
+		Publisher:  r.Publisher,
+	}
+	for _, t := range r.Targets {
+		u.Targets[t] = struct{}{}
+	}
+	if r.Expires != nil {
+		u.Expires = *r.Expires
+	}
+
+	return u, nil
+}
+
+// ExportHistory opens the configured transport and writes its history in w, as NDJSON.
+// The hub using the transport must be stopped, the database of the Bolt transport is locked while it's in use.
+func ExportHistory(v *viper.Viper, w io.Writer) error {
+	t, err := NewTransport(v)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	e, ok := t.(historyExporter)
+	if !ok {
+		return fmt.Errorf("%T: %w", t, ErrHistoryExportUnsupported)
+	}
+
+	return e.Export(w)
+}
+
+// ImportHistory opens the configured transport and stores the history read from r, as written by ExportHistory.
+func ImportHistory(v *viper.Viper, r io.Reader) error {
+	t, err := NewTransport(v)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	i, ok := t.(historyImporter)
+	if !ok {
+		return fmt.Errorf("%T: %w", t, ErrHistoryExportUnsupported)
+	}
+
+	return i.Import(r)
+}
+
+// MigrateHistory copies the history of the transport of the "from" DSN to the transport of the "to" DSN, from the oldest update.
+// The IDs, the order and the storage time of the updates are preserved, they are stored after the updates already stored by the destination.
+// The source must support exporting its history. It returns the number of copied updates.
+// The hubs using the transports must be stopped.
+func MigrateHistory(v *viper.Viper, from, to string) (int, error) {
+	source, err := newTransportWithConfig(v, from)
+	if err != nil {
+		return 0, fmt.Errorf("from: %w", err)
+	}
+	defer source.Close()
+
+	e, ok := source.(historyExporter)
+	if !ok {
+		return 0, fmt.Errorf("from: %T: %w", source, ErrHistoryExportUnsupported)
+	}
+
+	destination, err := newTransportWithConfig(v, to)
+	if err != nil {
+		return 0, fmt.Errorf("to: %w", err)
+	}
+	defer destination.Close()
+
+	return migrateHistory(e, destination)
+}
+
+// migrateHistory streams the history exported by the source to the destination.
+// The history is imported if the destination supports it, otherwise the updates are written one by one.
+func migrateHistory(source historyExporter, destination Transport) (int, error) {
+	pr, pw := io.Pipe()
+	counter := &recordCounter{w: pw}
+	exported := make(chan struct{})
+	go func() {
+		defer close(exported)
+		pw.CloseWithError(source.Export(counter))
+	}()
+	defer pr.Close()
+
+	if i, ok := destination.(historyImporter); ok {
+		err := i.Import(pr)
+
+		// Stop the export if the import failed, then wait for it before reading the counter
+		pr.Close()
+		<-exported
+
+		return counter.records, err
+	}
+
+	dec := json.NewDecoder(pr)
+	for n := 0; ; n++ {
+		var record historyRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("record %d: %w", n+1, err)
+		}
+
+		update, err := record.update()
+		if err != nil {
+			return n, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := destination.Write(update); err != nil {
+			return n, fmt.Errorf("record %d: %w", n+1, err)
+		}
+	}
+}
+
+// recordCounter counts the records written as NDJSON, the encoded records never contain a line feed.
+type recordCounter struct {
+	w       io.Writer
+	records int
+}
+
+func (c *recordCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.records += bytes.Count(p[:n], []byte{'\n'})
+
+	return n, err
+}
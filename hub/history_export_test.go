@@ -0,0 +1,126 @@
+package hub
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryRecord(t *testing.T) {
+	u := &Update{
+		Targets:    map[string]struct{}{"b": {}, "a": {}},
+		Topics:     []string{"https://example.com/books/1"},
+		Event:      Event{ID: "1", Type: "update", Data: "data", Retry: 10, ContentType: "text/plain"},
+		Time:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		Expires:    time.Date(2020, 1, 3, 3, 4, 5, 0, time.UTC),
+		LatestOnly: true,
+		Tombstone:  "0",
+		Publisher:  "admin",
+	}
+
+	r := newHistoryRecord(u)
+	assert.Equal(t, []string{"a", "b"}, r.Targets)
+	assert.Equal(t, time.UTC, r.Time.Location())
+
+	imported, err := r.update()
+	require.Nil(t, err)
+	assert.Equal(t, u.Targets, imported.Targets)
+	assert.Equal(t, u.Event, imported.Event)
+	assert.True(t, u.Time.Equal(imported.Time))
+	assert.True(t, u.Expires.Equal(imported.Expires))
+	assert.Equal(t, "0", imported.Tombstone)
+	assert.Equal(t, "admin", imported.Publisher)
+	assert.True(t, imported.LatestOnly)
+
+	_, err = (&historyRecord{ID: "1"}).update()
+	assert.EqualError(t, err, `missing "topics"`)
+}
+
+func TestExportImportHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	v := viper.New()
+	v.Set("transport_url", "bolt://"+filepath.Join(dir, "source.db"))
+	transport, err := NewTransport(v)
+	require.Nil(t, err)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "1"}}))
+	transport.Close()
+
+	var export bytes.Buffer
+	require.Nil(t, ExportHistory(v, &export))
+	assert.Contains(t, export.String(), `"id":"1"`)
+
+	v.Set("transport_url", "bolt://"+filepath.Join(dir, "destination.db"))
+	require.Nil(t, ImportHistory(v, &export))
+
+	var reexport bytes.Buffer
+	require.Nil(t, ExportHistory(v, &reexport))
+	assert.Contains(t, reexport.String(), `"id":"1"`)
+
+	v.Set("transport_url", "")
+	err = ExportHistory(v, &export)
+	assert.EqualError(t, err, "*hub.LocalTransport: the transport doesn't support exporting and importing its history")
+	assert.True(t, errors.Is(ImportHistory(v, &export), ErrHistoryExportUnsupported))
+}
+
+func TestMigrateHistory(t *testing.T) {
+	dir := t.TempDir()
+	source := "bolt://" + filepath.Join(dir, "source.db")
+
+	v := viper.New()
+	v.Set("transport_url", source)
+	transport, err := NewTransport(v)
+	require.Nil(t, err)
+	for _, id := range []string{"b", "a", "c"} {
+		require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: id, Data: "data " + id}}))
+	}
+	transport.Close()
+
+	n, err := MigrateHistory(v, source, "bolt://"+filepath.Join(dir, "destination.db"))
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	v.Set("transport_url", "bolt://"+filepath.Join(dir, "destination.db"))
+	var export bytes.Buffer
+	require.Nil(t, ExportHistory(v, &export))
+	assert.Equal(t, 3, strings.Count(export.String(), "\n"))
+
+	_, err = MigrateHistory(v, "null://", source)
+	assert.EqualError(t, err, "from: *hub.LocalTransport: the transport doesn't support exporting and importing its history")
+	_, err = MigrateHistory(v, source, "foo://")
+	assert.True(t, errors.Is(err, ErrInvalidTransportDSN))
+}
+
+func TestMigrateHistoryWrite(t *testing.T) {
+	u, _ := url.Parse("bolt://" + filepath.Join(t.TempDir(), "source.db"))
+	source, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer source.Close()
+
+	stored := time.Now().Add(-time.Hour)
+	for _, id := range []string{"b", "a", "c"} {
+		require.Nil(t, source.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: id}, Time: stored}))
+	}
+
+	// The local transport doesn't support importing the history, the updates are written in order
+	destination := newTestLocalTransportWithHistory(t)
+	n, err := migrateHistory(source, destination)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	pipe, err := destination.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	first := <-pipe.Read()
+	assert.Equal(t, "b", first.ID)
+	assert.True(t, stored.Equal(first.Time), "the storage time is preserved")
+	assert.Equal(t, "a", (<-pipe.Read()).ID)
+	assert.Equal(t, "c", (<-pipe.Read()).ID)
+}
@@ -29,10 +29,96 @@ type Hub struct {
 	server       *http.Server
 	uriTemplates uriTemplates
 	metrics      *Metrics
+	retrier      *retrier
+	topicTracker *topicTracker
+	resolver     TargetResolver
+
+	// egress counts the bytes sent per JWT subject, nil if the "metrics_egress" option is disabled
+	egress *egressMeter
+
+	// eventTypes contains the rules setting the default type of the published updates
+	eventTypes []*eventTypeRule
+
+	// topicHierarchy contains the rules adding parent topics to published updates
+	topicHierarchy []*topicHierarchyRule
+
+	maintenance *maintenance
+	validators  *payloadValidators
+	ops         *opsPublisher
+
+	// conflatedTopics matches the topics whose buffered updates are conflated, nil if there are none
+	conflatedTopics *Subscriber
+
+	connections *connections
+	mirror      *mirror
+
+	// recentUpdates contains the last published updates, included in the diagnostics bundles, nil if they are disabled
+	recentUpdates *recentUpdates
+
+	projections projections
+
+	// shards assigns the topics to the nodes of the cluster, nil if the sharding is disabled
+	shards *shardRing
+
+	// memory sheds the load when the memory usage is above the watermark, nil if there is no watermark
+	memory *memoryGuard
+
+	// watchdog logs the goroutine leaks in debug mode, nil otherwise
+	watchdog *goroutineWatchdog
+
+	// eventFormat defines how the events are serialized, nil for the default format
+	eventFormat *eventFormat
+
+	// instanceID identifies this hub process, to debug the delivery issues in a cluster
+	instanceID string
+
+	// authorizer re-evaluates the authorization of the connected subscribers, nil if disabled
+	authorizer *subscriberAuthorizer
+
+	// sinks mirror the published updates to analytics destinations
+	sinks []*analyticsSink
+
+	// coalescer throttles the updates of the topics matching the "publish_coalescing" rules, nil if there are none
+	coalescer *coalescer
+
+	// namespaces restrict the topics the publishers may use, nil if there are no reserved namespaces
+	namespaces *topicNamespaces
+
+	// chaos injects faults to test the resilience of the clients, nil if the chaos mode is disabled
+	chaos *chaos
 }
 
 // Stop stops disconnect all connected clients.
 func (h *Hub) Stop() error {
+	if h.coalescer != nil {
+		// Dispatch the held updates while the transport is still open
+		h.coalescer.Close()
+	}
+	if h.retrier != nil {
+		h.retrier.Close()
+	}
+	if h.topicTracker != nil {
+		h.topicTracker.Close()
+	}
+	if h.validators != nil {
+		h.validators.Close()
+	}
+	if h.ops != nil {
+		h.ops.Close()
+	}
+	if h.mirror != nil {
+		h.mirror.Close()
+	}
+	for _, s := range h.sinks {
+		s.Close()
+	}
+	if h.memory != nil {
+		h.memory.Close()
+	}
+	if h.watchdog != nil {
+		h.watchdog.Close()
+	}
+
 	return h.transport.Close()
 }
 
@@ -47,18 +133,113 @@ func NewHub(v *viper.Viper) (*Hub, error) {
 		return nil, err
 	}
 
-	return NewHubWithTransport(v, t), nil
+	h, err := NewHubWithTransport(v, t)
+	if err != nil {
+		// The transport has been created for this hub only
+		t.Close()
+
+		return nil, err
+	}
+
+	return h, nil
 }
 
 // NewHubWithTransport creates a hub.
-func NewHubWithTransport(v *viper.Viper, t Transport) *Hub {
-	return &Hub{
-		v,
-		t,
-		nil,
-		uriTemplates{m: make(map[string]*templateCache)},
-		NewMetrics(),
+func NewHubWithTransport(v *viper.Viper, t Transport) (*Hub, error) {
+	h := &Hub{
+		config:          v,
+		transport:       t,
+		uriTemplates:    uriTemplates{m: make(map[string]*templateCache)},
+		metrics:         NewMetrics(),
+		topicHierarchy:  parseTopicHierarchy(v.GetStringSlice("topic_hierarchy")),
+		maintenance:     newMaintenance(),
+		conflatedTopics: newConflatedTopics(v.GetStringSlice("conflated_topics")),
+		connections:     newConnections(),
+		instanceID:      newInstanceID(v.GetString("node_id")),
+	}
+	h.metrics.instanceID = h.instanceID
+	h.metrics.pendingUpdates = h.connections.pendingUpdates
+
+	var err error
+	if h.resolver, err = newTargetResolver(v); err != nil {
+		return nil, err
+	}
+	if h.authorizer, err = newSubscriberAuthorizer(v); err != nil {
+		return nil, err
 	}
+	if h.projections, err = newProjections(v.GetStringSlice("projections")); err != nil {
+		return nil, err
+	}
+	if h.eventTypes, err = newEventTypeRules(v.GetStringSlice("event_types")); err != nil {
+		return nil, err
+	}
+	if h.eventFormat, err = newEventFormat(v.GetStringSlice("sse_fields"), omitEventID(v, t)); err != nil {
+		return nil, err
+	}
+	if h.shards, err = newShardRing(v.GetStringSlice("shard_nodes")); err != nil {
+		return nil, err
+	}
+	if h.mirror, err = newMirror(v); err != nil {
+		return nil, err
+	}
+	if h.sinks, err = newAnalyticsSinks(v.GetStringSlice("analytics_sinks"), h.instanceID, h.metrics); err != nil {
+		return nil, err
+	}
+	if h.coalescer, err = newCoalescer(v.GetStringSlice("publish_coalescing"), h.dispatchCoalesced, h.metrics); err != nil {
+		return nil, err
+	}
+	if h.namespaces, err = newTopicNamespaces(v.GetString("topic_namespace_claim"), v.GetStringSlice("topic_namespaces")); err != nil {
+		return nil, err
+	}
+	if h.chaos, err = newChaos(v); err != nil {
+		return nil, err
+	}
+	// Compiled last because it's the only component holding resources to release
+	if h.validators, err = newPayloadValidators(v.GetStringSlice("payload_validators"), v.GetDuration("payload_validator_timeout")); err != nil {
+		return nil, err
+	}
+
+	if v.GetBool("metrics_egress") {
+		h.egress = newEgressMeter(v.GetDuration("metrics_egress_idle_timeout"))
+	}
+	if retries := v.GetInt("dispatch_retries"); retries > 0 {
+		h.retrier = newRetrier(t, h.metrics, retries, v.GetDuration("dispatch_retry_delay"), v.GetInt("dispatch_retry_queue_size"))
+	}
+	h.memory = newMemoryGuard(v.GetUint64("memory_watermark"), v.GetDuration("memory_check_interval"), h.metrics)
+	if t, ok := t.(replayLimitedTransport); ok {
+		t.setReplayLimiter(newReplayLimiter(v.GetInt("max_concurrent_replays"), h.memory, h.metrics))
+	}
+	if t, ok := t.(instrumentedTransport); ok {
+		t.setMetrics(h.metrics)
+	}
+	if t, ok := t.(strictOrderingTransport); ok && v.GetBool("strict_ordering") {
+		t.setStrictOrdering(v.GetInt("strict_ordering_buffer_size"))
+	}
+	if timeout := v.GetDuration("topic_idle_timeout"); timeout > 0 {
+		h.topicTracker = newTopicTracker(timeout, h.expireTopic)
+	}
+	h.ops = newOpsPublisher(v.GetStringSlice("ops_topics"), h.instanceID, h.maintenance)
+
+	if v.GetBool("debug") {
+		h.watchdog = newGoroutineWatchdog(defaultWatchdogInterval)
+	}
+
+	if v.GetString("diagnostics_dir") != "" {
+		h.recentUpdates = newRecentUpdates(v.GetInt("diagnostics_recent_updates"))
+	}
+
+	if h.mirror != nil {
+		go h.mirror.run()
+	}
+	for _, s := range h.sinks {
+		go s.run()
+	}
+
+	if h.chaos != nil {
+		log.Println("The chaos mode is enabled, faults are injected: never enable it in production")
+	}
+
+	return h, nil
 }
 
 // Start is an helper method to start the Mercure Hub.
@@ -1,6 +1,8 @@
 package hub
 
 import (
+	"errors"
+	"net/url"
 	"os"
 	"os/exec"
 	"testing"
@@ -31,6 +33,22 @@ func TestNewHubWithConfig(t *testing.T) {
 	h.Stop()
 }
 
+func TestNewHubStrictOrdering(t *testing.T) {
+	u, _ := url.Parse("bolt://strict-ordering.db")
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer os.Remove("strict-ordering.db")
+	defer transport.Close()
+
+	createDummyWithTransportAndConfig(transport, viper.New())
+	assert.Equal(t, 0, transport.maxHeldUpdates)
+
+	v := viper.New()
+	v.Set("strict_ordering", true)
+	createDummyWithTransportAndConfig(transport, v)
+	assert.Equal(t, 1000, transport.maxHeldUpdates)
+}
+
 func TestNewHubValidationError(t *testing.T) {
 	h, err := NewHub(viper.New())
 	assert.Nil(t, h)
@@ -48,6 +66,60 @@ func TestNewHubTransportValidationError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+type closeRecordingTransport struct {
+	Transport
+	closed bool
+}
+
+func (t *closeRecordingTransport) Close() error {
+	t.closed = true
+
+	return t.Transport.Close()
+}
+
+func TestNewHubClosesTransportOnError(t *testing.T) {
+	dir, paths := writeWasmModules(t, wasmValidateJSONObject)
+	defer os.RemoveAll(dir)
+
+	var transport *closeRecordingTransport
+	RegisterTransport("closerecording", func(u *url.URL) (Transport, error) {
+		// The module is removed once the configuration has been validated: the hub can't be created
+		if err := os.Remove(paths[0]); err != nil {
+			return nil, err
+		}
+		transport = &closeRecordingTransport{Transport: NewLocalTransport(5, time.Second)}
+
+		return transport, nil
+	})
+	t.Cleanup(func() {
+		transportFactoriesMu.Lock()
+		delete(transportFactories, "closerecording")
+		transportFactoriesMu.Unlock()
+	})
+
+	v := viper.New()
+	v.Set("publisher_jwt_key", "foo")
+	v.Set("jwt_key", "bar")
+	v.Set("transport_url", "closerecording://")
+	v.Set("payload_validators", []string{paths[0] + "=*"})
+	v.Set("payload_validator_timeout", time.Second)
+
+	h, err := NewHub(v)
+	assert.Nil(t, h)
+	require.Error(t, err)
+	require.NotNil(t, transport)
+	assert.True(t, transport.closed)
+}
+
+func TestNewHubWithTransportConfigError(t *testing.T) {
+	v := viper.New()
+	v.Set("shard_nodes", []string{"invalid"})
+
+	h, err := NewHubWithTransport(v, NewLocalTransport(5, time.Second))
+	assert.Nil(t, h)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
 func TestStartCrash(t *testing.T) {
 	if os.Getenv("BE_START_CRASH") == "1" {
 		Start()
@@ -68,8 +140,14 @@ func createDummy() *Hub {
 	v.SetDefault("heartbeat_interval", time.Duration(0))
 	v.SetDefault("publisher_jwt_key", "publisher")
 	v.SetDefault("subscriber_jwt_key", "subscriber")
+	v.SetDefault("node_id", "hub-test")
 
-	return NewHubWithTransport(v, NewLocalTransport(5, time.Second))
+	h, err := NewHubWithTransport(v, NewLocalTransport(5, time.Second))
+	if err != nil {
+		panic(err)
+	}
+
+	return h
 }
 
 func createAnonymousDummy() *Hub {
@@ -81,10 +159,16 @@ func createDummyWithTransportAndConfig(t Transport, v *viper.Viper) *Hub {
 	v.SetDefault("heartbeat_interval", time.Duration(0))
 	v.SetDefault("publisher_jwt_key", "publisher")
 	v.SetDefault("subscriber_jwt_key", "subscriber")
+	v.SetDefault("node_id", "hub-test")
 	v.SetDefault("allow_anonymous", true)
 	v.SetDefault("addr", testAddr)
 
-	return NewHubWithTransport(v, t)
+	h, err := NewHubWithTransport(v, t)
+	if err != nil {
+		panic(err)
+	}
+
+	return h
 }
 
 func createDummyAuthorizedJWT(h *Hub, r role, targets []string) string {
@@ -93,10 +177,10 @@ func createDummyAuthorizedJWT(h *Hub, r role, targets []string) string {
 
 	switch r {
 	case publisherRole:
-		token.Claims = &claims{mercureClaim{Publish: targets}, jwt.StandardClaims{}}
+		token.Claims = &claims{Mercure: mercureClaim{Publish: targets}}
 
 	case subscriberRole:
-		token.Claims = &claims{mercureClaim{Subscribe: targets}, jwt.StandardClaims{}}
+		token.Claims = &claims{Mercure: mercureClaim{Subscribe: targets}}
 	}
 
 	tokenString, _ := token.SignedString(key)
@@ -0,0 +1,17 @@
+package hub
+
+import (
+	"os"
+)
+
+// newInstanceID returns the identifier of this hub process: the node ID if it is configured, otherwise the hostname.
+// It is stable across restarts, and is included in the logs, the metrics, the subscription events and the first comment sent to the subscribers.
+func newInstanceID(nodeID string) string {
+	if nodeID != "" {
+		return nodeID
+	}
+
+	hostname, _ := os.Hostname()
+
+	return hostname
+}
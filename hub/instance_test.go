@@ -0,0 +1,16 @@
+package hub
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInstanceID(t *testing.T) {
+	assert.Equal(t, "node-1", newInstanceID("node-1"))
+
+	// The ID is stable across restarts, not to create new metrics series
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, newInstanceID(""))
+}
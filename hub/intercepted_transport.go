@@ -0,0 +1,78 @@
+package hub
+
+// WriteFunc writes an update to a transport.
+type WriteFunc func(update *Update) error
+
+// WriteInterceptor is called for every update written to an InterceptedTransport, to audit, rewrite or copy it to a second store for instance.
+// It must call next to write the update to the wrapped transport (or to the next interceptor), it can return an error without calling it to reject the update.
+type WriteInterceptor func(update *Update, next WriteFunc) error
+
+// InterceptedTransport implements the TransportInterface by passing the written updates through a chain of interceptors before writing them to a transport.
+// The pipes are created by the wrapped transport.
+type InterceptedTransport struct {
+	transport Transport
+	write     WriteFunc
+}
+
+// WrapTransport returns a transport passing the written updates through the interceptors, in order, before writing them to t.
+func WrapTransport(t Transport, interceptors ...WriteInterceptor) *InterceptedTransport {
+	write := t.Write
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], write
+		write = func(update *Update) error {
+			return interceptor(update, next)
+		}
+	}
+
+	return &InterceptedTransport{transport: t, write: write}
+}
+
+// Write passes the update through the interceptors.
+func (t *InterceptedTransport) Write(update *Update) error {
+	return t.write(update)
+}
+
+// CreatePipe creates a pipe of the wrapped transport.
+func (t *InterceptedTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	return t.transport.CreatePipe(cursor)
+}
+
+// setReplayLimiter limits the number of simultaneous history replays of the wrapped transport.
+func (t *InterceptedTransport) setReplayLimiter(l *replayLimiter) {
+	if transport, ok := t.transport.(replayLimitedTransport); ok {
+		transport.setReplayLimiter(l)
+	}
+}
+
+// setMetrics collects the metrics of the wrapped transport if it collects its own.
+func (t *InterceptedTransport) setMetrics(m *Metrics) {
+	if transport, ok := t.transport.(instrumentedTransport); ok {
+		transport.setMetrics(m)
+	}
+}
+
+// setStrictOrdering enables the strict ordering of the wrapped transport if it supports it.
+func (t *InterceptedTransport) setStrictOrdering(maxHeldUpdates int) {
+	if transport, ok := t.transport.(strictOrderingTransport); ok {
+		transport.setStrictOrdering(maxHeldUpdates)
+	}
+}
+
+// supportsHistory returns true if the wrapped transport supports the history.
+func (t *InterceptedTransport) supportsHistory() bool {
+	if transport, ok := t.transport.(historyTransport); ok {
+		return transport.supportsHistory()
+	}
+
+	return true
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *InterceptedTransport) transportConfig() *transportConfig {
+	return &transportConfig{Transports: []*transportConfig{describeTransport(t.transport)}}
+}
+
+// Close closes the wrapped transport.
+func (t *InterceptedTransport) Close() error {
+	return t.transport.Close()
+}
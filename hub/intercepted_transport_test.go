@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptedTransport(t *testing.T) {
+	var calls []string
+	audit := func(update *Update, next WriteFunc) error {
+		calls = append(calls, "audit "+update.Data)
+		err := next(update)
+		calls = append(calls, "audited")
+
+		return err
+	}
+	rewrite := func(update *Update, next WriteFunc) error {
+		calls = append(calls, "rewrite")
+		update.Data = "rewritten " + update.Data
+
+		return next(update)
+	}
+
+	shadow := newTestLocalTransportWithHistory(t)
+	shadowWrite := func(update *Update, next WriteFunc) error {
+		if err := next(update); err != nil {
+			return err
+		}
+
+		return shadow.Write(update)
+	}
+
+	errRejected := errors.New("rejected")
+	reject := func(update *Update, next WriteFunc) error {
+		if update.ID == "rejected" {
+			return errRejected
+		}
+
+		return next(update)
+	}
+
+	transport := WrapTransport(newTestLocalTransportWithHistory(t), audit, rewrite, shadowWrite, reject)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1", Data: "foo"}}))
+	assert.Equal(t, []string{"audit foo", "rewrite", "audited"}, calls)
+	assert.Equal(t, "rewritten foo", (<-pipe.Read()).Data)
+
+	shadowPipe, err := shadow.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, "1", (<-shadowPipe.Read()).ID)
+
+	assert.Equal(t, errRejected, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "rejected"}}))
+}
+
+func TestInterceptedTransportWithoutInterceptors(t *testing.T) {
+	u, _ := url.Parse("local://?size=10")
+	local, err := NewLocalTransportWithHistory(u, 5, time.Second)
+	require.Nil(t, err)
+
+	transport := WrapTransport(local)
+	defer transport.Close()
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+	pipe, err := transport.CreatePipe(EarliestCursor())
+	require.Nil(t, err)
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+
+	assert.True(t, transport.supportsHistory())
+	assert.Equal(t, &transportConfig{
+		Type:       "*hub.InterceptedTransport",
+		Transports: []*transportConfig{{Scheme: "local", Type: "*hub.LocalTransport", Options: map[string]interface{}{"buffer_size": 5, "buffer_full_timeout": "1s", "size": 10}}},
+	}, describeTransport(transport))
+
+	require.Nil(t, transport.Close())
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{Topics: []string{"http://example.com/1"}}))
+}
@@ -10,6 +10,7 @@ import (
 
 func (h *Hub) createLogFields(r *http.Request, u *Update, s *Subscriber) log.Fields {
 	fields := log.Fields{
+		"instance_id":    h.instanceID,
 		"remote_addr":    r.RemoteAddr,
 		"event_id":       u.ID,
 		"event_type":     u.Type,
@@ -17,6 +18,9 @@ func (h *Hub) createLogFields(r *http.Request, u *Update, s *Subscriber) log.Fie
 		"update_topics":  u.Topics,
 		"update_targets": targetsMapToArray(u.Targets),
 	}
+	if u.Publisher != "" {
+		fields["update_publisher"] = u.Publisher
+	}
 	if h.config.GetBool("debug") {
 		fields["update_data"] = u.Data
 	}
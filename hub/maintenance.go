@@ -0,0 +1,199 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMaintenanceRetryAfter = time.Minute
+
+// maintenance stores the state of the maintenance mode.
+// When enabled, new updates are rejected. If a drain duration is set, new subscriptions are rejected too,
+// and existing subscribers are disconnected at a random time during this duration.
+type maintenance struct {
+	sync.RWMutex
+	enabled    bool
+	retryAfter time.Duration
+	drain      time.Duration
+	// draining is closed when subscribers must start to be disconnected
+	draining chan struct{}
+}
+
+func newMaintenance() *maintenance {
+	return &maintenance{draining: make(chan struct{})}
+}
+
+type maintenanceState struct {
+	Enabled    bool   `json:"enabled"`
+	RetryAfter string `json:"retry_after,omitempty"`
+	Drain      string `json:"drain,omitempty"`
+}
+
+func (m *maintenance) enable(retryAfter, drain time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.enabled = true
+	m.retryAfter = retryAfter
+	m.drain = drain
+
+	if drain > 0 {
+		select {
+		case <-m.draining:
+		default:
+			close(m.draining)
+		}
+	}
+}
+
+func (m *maintenance) disable() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.enabled = false
+	m.retryAfter = 0
+	m.drain = 0
+
+	select {
+	case <-m.draining:
+		m.draining = make(chan struct{})
+	default:
+	}
+}
+
+func (m *maintenance) state() maintenanceState {
+	m.RLock()
+	defer m.RUnlock()
+
+	if !m.enabled {
+		return maintenanceState{}
+	}
+
+	s := maintenanceState{Enabled: true, RetryAfter: m.retryAfter.String()}
+	if m.drain > 0 {
+		s.Drain = m.drain.String()
+	}
+
+	return s
+}
+
+// rejects returns true and the delay to send in the Retry-After header if new requests must be rejected.
+// Updates are rejected as soon as the maintenance mode is enabled, subscriptions only while draining.
+func (m *maintenance) rejects(subscription bool) (bool, time.Duration) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if !m.enabled || (subscription && m.drain == 0) {
+		return false, 0
+	}
+
+	return true, m.retryAfter
+}
+
+// drainChan returns a channel closed when subscribers must start to be disconnected.
+func (m *maintenance) drainChan() <-chan struct{} {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.draining
+}
+
+// drainDelay returns how long a subscriber can stay connected, or false if draining has been canceled.
+func (m *maintenance) drainDelay() (time.Duration, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.drain <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(rand.Int63n(int64(m.drain))), true
+}
+
+// isDraining returns true if subscribers must be disconnected.
+func (m *maintenance) isDraining() bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.drain > 0
+}
+
+// rejectForMaintenance sends a 503 response if the request must be rejected because of the maintenance mode.
+func (h *Hub) rejectForMaintenance(w http.ResponseWriter, subscription bool) bool {
+	reject, retryAfter := h.maintenance.rejects(subscription)
+	if !reject {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	http.Error(w, "Maintenance in progress", http.StatusServiceUnavailable)
+
+	return true
+}
+
+// MaintenanceHandler enables (PUT) and disables (DELETE) the maintenance mode, and returns its state.
+// A JWT having the "admin" Mercure claim, signed with the publisher key, must be passed in the Authorization header.
+func (h *Hub) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), nil)
+	if err != nil || claims == nil || !claims.Mercure.Admin {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		if r.ParseForm() != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		retryAfter := defaultMaintenanceRetryAfter
+		if p := r.Form.Get("retry_after"); p != "" {
+			if retryAfter, err = time.ParseDuration(p); err != nil || retryAfter < 0 {
+				http.Error(w, "Invalid \"retry_after\" parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var drain time.Duration
+		if p := r.Form.Get("drain"); p != "" {
+			if drain, err = time.ParseDuration(p); err != nil || drain < 0 {
+				http.Error(w, "Invalid \"drain\" parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		h.maintenance.enable(retryAfter, drain)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "retry_after": retryAfter, "drain": drain}).Info("Maintenance mode enabled")
+
+	case "DELETE":
+		h.maintenance.disable()
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info("Maintenance mode disabled")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.maintenance.state())
+}
+
+// readyHandler returns a 503 status code when the hub is in maintenance mode, to remove it from load balancers.
+func (h *Hub) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if s := h.maintenance.state(); s.Enabled {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createAdminJWT(h *Hub) string {
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Claims = &claims{Mercure: mercureClaim{Admin: true}}
+	tokenString, _ := token.SignedString(h.getJWTKey(publisherRole))
+
+	return tokenString
+}
+
+func maintenanceRequest(h *Hub, method, token string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, defaultHubURL+"/maintenance", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.MaintenanceHandler(w, req)
+
+	return w
+}
+
+func TestMaintenanceHandlerUnauthorized(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	w := maintenanceRequest(hub, "PUT", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = maintenanceRequest(hub, "PUT", createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.False(t, hub.maintenance.state().Enabled)
+}
+
+func TestMaintenanceHandlerInvalidParameters(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	w := maintenanceRequest(hub, "PUT", createAdminJWT(hub), url.Values{"retry_after": {"foo"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"retry_after\" parameter\n", w.Body.String())
+
+	w = maintenanceRequest(hub, "PUT", createAdminJWT(hub), url.Values{"drain": {"-1s"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"drain\" parameter\n", w.Body.String())
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	w := maintenanceRequest(hub, "GET", createAdminJWT(hub), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": false}`, w.Body.String())
+
+	w = maintenanceRequest(hub, "PUT", createAdminJWT(hub), url.Values{"retry_after": {"30s"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": true, "retry_after": "30s"}`, w.Body.String())
+
+	form := url.Values{"topic": {"http://example.com/books/1"}, "data": {"Hello!"}}
+	publish := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w = publish()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	hub.readyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Subscriptions are still accepted when not draining
+	assert.False(t, hub.rejectForMaintenance(httptest.NewRecorder(), true))
+
+	w = maintenanceRequest(hub, "DELETE", createAdminJWT(hub), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": false}`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, publish().Code)
+
+	w = httptest.NewRecorder()
+	hub.readyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestMaintenanceDrain(t *testing.T) {
+	hub := createAnonymousDummy()
+	defer hub.Stop()
+	s, _ := hub.transport.(*LocalTransport)
+
+	sw := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil)
+		hub.SubscribeHandler(sw, req)
+	}()
+
+	require.Eventually(t, func() bool {
+		s.RLock()
+		defer s.RUnlock()
+
+		return len(s.pipes) == 1
+	}, time.Second, time.Millisecond)
+
+	w := maintenanceRequest(hub, "PUT", createAdminJWT(hub), url.Values{"drain": {"10ms"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": true, "retry_after": "1m0s", "drain": "10ms"}`, w.Body.String())
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber hasn't been disconnected")
+	}
+	assert.Equal(t, ": instance hub-test\nevent: mercure-disconnect\ndata: {\"reason\":\"maintenance\"}\n\n", sw.Body.String())
+
+	// New subscriptions are rejected while draining
+	w = httptest.NewRecorder()
+	hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	hub.maintenance.disable()
+	assert.False(t, hub.maintenance.isDraining())
+	select {
+	case <-hub.maintenance.drainChan():
+		t.Fatal("the drain channel must be reset")
+	default:
+	}
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMemoryCheckInterval = time.Second
+	defaultMemoryRetryAfter    = 10 * time.Second
+)
+
+// alwaysRelieved is returned by a nil memoryGuard, the memory is never considered under pressure.
+var alwaysRelieved = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+
+	return c
+}()
+
+// memoryGuard monitors the memory used by the process. Above the watermark, the load is shed deterministically
+// instead of letting the OOM killer take down every connection at once: new subscriptions are rejected,
+// the pipes of the subscribers not keeping up are closed instead of buffering more updates, and the history replays are paused.
+// A nil memoryGuard never considers the memory under pressure.
+type memoryGuard struct {
+	sync.RWMutex
+	watermark uint64
+	usage     func() uint64
+	metrics   *Metrics
+	pressure  bool
+	// relieved is closed when the memory usage is below the watermark
+	relieved chan struct{}
+	done     chan struct{}
+}
+
+// newMemoryGuard returns a guard checking the memory usage at the given interval, or nil if the watermark is 0.
+func newMemoryGuard(watermark uint64, interval time.Duration, metrics *Metrics) *memoryGuard {
+	if watermark == 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = defaultMemoryCheckInterval
+	}
+
+	g := &memoryGuard{
+		watermark: watermark,
+		usage:     processMemoryUsage,
+		metrics:   metrics,
+		relieved:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	close(g.relieved)
+	go g.run(interval)
+
+	return g
+}
+
+// processMemoryUsage returns the memory obtained from the OS by the Go runtime and not released yet.
+func processMemoryUsage() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return m.Sys - m.HeapReleased
+}
+
+func (g *memoryGuard) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.check()
+		}
+	}
+}
+
+// check compares the memory usage with the watermark, and updates the state of the guard accordingly.
+func (g *memoryGuard) check() {
+	usage := g.usage()
+
+	g.Lock()
+	defer g.Unlock()
+
+	pressure := usage > g.watermark
+	if pressure == g.pressure {
+		return
+	}
+	g.pressure = pressure
+
+	if pressure {
+		g.relieved = make(chan struct{})
+		log.WithFields(log.Fields{"usage": usage, "watermark": g.watermark}).Warn("Memory usage above the watermark, shedding load")
+	} else {
+		close(g.relieved)
+		log.WithFields(log.Fields{"usage": usage, "watermark": g.watermark}).Info("Memory usage back below the watermark")
+	}
+
+	if g.metrics != nil {
+		g.metrics.MemoryPressure(pressure)
+	}
+}
+
+// underPressure returns true if the memory usage is above the watermark.
+func (g *memoryGuard) underPressure() bool {
+	if g == nil {
+		return false
+	}
+
+	g.RLock()
+	defer g.RUnlock()
+
+	return g.pressure
+}
+
+// relievedChan returns a channel closed when the memory usage is below the watermark.
+func (g *memoryGuard) relievedChan() <-chan struct{} {
+	if g == nil {
+		return alwaysRelieved
+	}
+
+	g.RLock()
+	defer g.RUnlock()
+
+	return g.relieved
+}
+
+// Close stops monitoring the memory usage.
+func (g *memoryGuard) Close() {
+	select {
+	case <-g.done:
+	default:
+		close(g.done)
+	}
+}
+
+// rejectForMemoryPressure rejects the new subscriptions while the memory usage is above the watermark.
+func (h *Hub) rejectForMemoryPressure(w http.ResponseWriter) bool {
+	if !h.memory.underPressure() {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(defaultMemoryRetryAfter.Seconds())))
+	http.Error(w, "Memory usage too high", http.StatusServiceUnavailable)
+
+	return true
+}
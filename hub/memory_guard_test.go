@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMemoryGuard creates a guard whose memory usage is controlled by the test through check.
+func newTestMemoryGuard(t *testing.T, metrics *Metrics) (*memoryGuard, func(usage uint64)) {
+	g := newMemoryGuard(100, time.Hour, metrics)
+	t.Cleanup(g.Close)
+
+	var usage uint64
+	g.usage = func() uint64 { return usage }
+
+	return g, func(u uint64) {
+		usage = u
+		g.check()
+	}
+}
+
+func TestNilMemoryGuard(t *testing.T) {
+	g := newMemoryGuard(0, time.Second, nil)
+	assert.Nil(t, g)
+
+	assert.False(t, g.underPressure())
+	select {
+	case <-g.relievedChan():
+	default:
+		t.Fatal("a nil guard must never be under pressure")
+	}
+}
+
+func TestMemoryGuardWatermark(t *testing.T) {
+	m := NewMetrics()
+	g, check := newTestMemoryGuard(t, m)
+
+	check(100)
+	assert.False(t, g.underPressure())
+
+	check(101)
+	assert.True(t, g.underPressure())
+	assert.Equal(t, 1.0, gaugeValue(t, m.memoryPressure))
+
+	relieved := g.relievedChan()
+	select {
+	case <-relieved:
+		t.Fatal("the memory must be under pressure")
+	default:
+	}
+
+	check(50)
+	assert.False(t, g.underPressure())
+	assert.Equal(t, 0.0, gaugeValue(t, m.memoryPressure))
+
+	select {
+	case <-relieved:
+	default:
+		t.Fatal("the memory must be relieved")
+	}
+}
+
+func TestSubscribeRejectedUnderMemoryPressure(t *testing.T) {
+	hub := createAnonymousDummy()
+	g, check := newTestMemoryGuard(t, nil)
+	hub.memory = g
+
+	check(200)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+
+	check(50)
+	pipe, err := hub.createPipe("", 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, g, pipe.memory)
+}
@@ -1,6 +1,10 @@
 package hub
 
 import (
+	"net/http"
+	"regexp"
+	"time"
+
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -11,8 +15,41 @@ type Metrics struct {
 	subscribersTotal *prometheus.CounterVec
 	subscribers      *prometheus.GaugeVec
 	updatesTotal     *prometheus.CounterVec
+	updatesRetried   *prometheus.CounterVec
+	updatesDropped   *prometheus.CounterVec
+	topicsExpired    prometheus.Counter
+	subscriberBytes  prometheus.Counter
+	panics           prometheus.Counter
+	publishDuration  prometheus.Histogram
+	replays          prometheus.Gauge
+	replaysQueued    prometheus.Gauge
+	memoryPressure   prometheus.Gauge
+	boltFileSize     *prometheus.GaugeVec
+	boltFileFull     *prometheus.GaugeVec
+	boltCompactions  *prometheus.CounterVec
+	boltUnsynced     *prometheus.CounterVec
+	boltFailedTxs    *prometheus.CounterVec
+	analyticsRows    *prometheus.CounterVec
+	pipesDropped     prometheus.Counter
+	updatesCoalesced prometheus.Counter
+	transportWrites  prometheus.Histogram
+	transportErrors  prometheus.Counter
+	historyFetches   prometheus.Histogram
+	pipes            prometheus.Gauge
+	// pendingUpdates returns the total and the largest number of updates waiting in the pipes of the subscribers, nil if the hub doesn't set it
+	pendingUpdates func() (total, largest int)
+	// instanceID is added as a label to the metrics of the hub if not empty
+	instanceID string
+}
+
+// instrumentedTransport is implemented by the transports collecting their own metrics.
+type instrumentedTransport interface {
+	setMetrics(m *Metrics)
 }
 
+// traceparentRegexp matches the W3C Trace Context header, the trace ID is the second field.
+var traceparentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}`)
+
 // NewMetrics creates a Prometheus metrics collector.
 func NewMetrics() *Metrics {
 	return &Metrics{
@@ -37,24 +74,210 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"topic"},
 		),
+		updatesRetried: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_updates_retried_total",
+				Help: "Total number of retried transport writes",
+			},
+			[]string{"topic"},
+		),
+		updatesDropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_updates_dropped_total",
+				Help: "Total number of updates dropped after failed transport writes",
+			},
+			[]string{"topic"},
+		),
+		topicsExpired: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_topics_expired_total",
+				Help: "Total number of idle topics expired",
+			},
+		),
+		subscriberBytes: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_subscriber_bytes_total",
+				Help: "Total number of bytes sent to subscribers",
+			},
+		),
+		panics: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_panics_total",
+				Help: "Total number of panics recovered in the HTTP handlers",
+			},
+		),
+		publishDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mercure_publish_duration_seconds",
+				Help:    "Duration of the handling of successful publications, with the trace ID as exemplar",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		replays: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mercure_history_replays",
+				Help: "The current number of running history replays",
+			},
+		),
+		replaysQueued: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mercure_history_replays_queued",
+				Help: "The current number of history replays waiting for a slot",
+			},
+		),
+		memoryPressure: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mercure_memory_pressure",
+				Help: "1 if the memory usage is above the watermark and the load is shed, 0 otherwise",
+			},
+		),
+		boltFileSize: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_bolt_file_size_bytes",
+				Help: "The size of the Bolt database where new updates are written",
+			},
+			[]string{"path"},
+		),
+		boltFileFull: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_bolt_max_file_size_exceeded",
+				Help: "1 if the Bolt database exceeds its maximum file size and the updates are rejected, 0 otherwise",
+			},
+			[]string{"path"},
+		),
+		boltCompactions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_bolt_compactions_total",
+				Help: "Total number of compactions of the Bolt databases",
+			},
+			[]string{"path"},
+		),
+		boltUnsynced: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_bolt_unsynced_writes_total",
+				Help: "Total number of updates stored in a Bolt database without being synced to the disk",
+			},
+			[]string{"path"},
+		),
+		boltFailedTxs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_bolt_failed_transactions_total",
+				Help: "Total number of Bolt write transactions rolled back because of an error",
+			},
+			[]string{"path"},
+		),
+		analyticsRows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_analytics_rows_total",
+				Help: "Total number of updates mirrored to the analytics sinks, by status (stored or dropped)",
+			},
+			[]string{"sink", "status"},
+		),
+		pipesDropped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_pipes_dropped_updates_total",
+				Help: "Total number of updates not delivered to subscribers because they didn't consume them fast enough",
+			},
+		),
+		updatesCoalesced: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_updates_coalesced_total",
+				Help: "Total number of published updates superseded by a newer update of the same throttled topic and never dispatched",
+			},
+		),
+		transportWrites: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mercure_transport_write_duration_seconds",
+				Help:    "Duration of the writes of the updates to the transport",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		transportErrors: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_transport_write_errors_total",
+				Help: "Total number of updates the transport failed to store and dispatch",
+			},
+		),
+		historyFetches: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mercure_history_fetch_duration_seconds",
+				Help:    "Duration of the fetches of the history by the transport, once the replay has a slot",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		pipes: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mercure_pipes",
+				Help: "The current number of pipes created by the transport for the subscribers",
+			},
+		),
 	}
 }
 
 // Register configures the Prometheus registry with all collected metrics.
 func (m *Metrics) Register(r *mux.Router) {
 	registry := prometheus.NewRegistry()
+	var registerer prometheus.Registerer = registry
+	if m.instanceID != "" {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"instance_id": m.instanceID}, registry)
+	}
 
 	// Metrics about the Hub
-	registry.MustRegister(m.subscribers)
-	registry.MustRegister(m.subscribersTotal)
-	registry.MustRegister(m.updatesTotal)
+	registerer.MustRegister(m.subscribers)
+	registerer.MustRegister(m.subscribersTotal)
+	registerer.MustRegister(m.updatesTotal)
+	registerer.MustRegister(m.updatesRetried)
+	registerer.MustRegister(m.updatesDropped)
+	registerer.MustRegister(m.topicsExpired)
+	registerer.MustRegister(m.subscriberBytes)
+	registerer.MustRegister(m.panics)
+	registerer.MustRegister(m.publishDuration)
+	registerer.MustRegister(m.replays)
+	registerer.MustRegister(m.replaysQueued)
+	registerer.MustRegister(m.memoryPressure)
+	registerer.MustRegister(m.boltFileSize)
+	registerer.MustRegister(m.boltFileFull)
+	registerer.MustRegister(m.boltCompactions)
+	registerer.MustRegister(m.boltUnsynced)
+	registerer.MustRegister(m.boltFailedTxs)
+	registerer.MustRegister(m.analyticsRows)
+	registerer.MustRegister(m.pipesDropped)
+	registerer.MustRegister(m.updatesCoalesced)
+	registerer.MustRegister(m.transportWrites)
+	registerer.MustRegister(m.transportErrors)
+	registerer.MustRegister(m.historyFetches)
+	registerer.MustRegister(m.pipes)
+	if m.pendingUpdates != nil {
+		// Computed when the metrics are scraped, a metric per subscriber would have an unbounded cardinality
+		registerer.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "mercure_pipes_pending_updates",
+				Help: "The current number of updates waiting in the pipes of the subscribers",
+			},
+			func() float64 {
+				total, _ := m.pendingUpdates()
+				return float64(total)
+			},
+		))
+		registerer.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "mercure_pipes_max_pending_updates",
+				Help: "The current largest number of updates waiting in the pipe of a subscriber",
+			},
+			func() float64 {
+				_, largest := m.pendingUpdates()
+				return float64(largest)
+			},
+		))
+	}
 
 	// Go-specific metrics about the process (GC stats, goroutines, etc.).
+	// Prometheus already identifies the process with the "instance" label, the instance ID is only added to the metrics of the hub
 	registry.MustRegister(prometheus.NewGoCollector())
 	// Go-unrelated process metrics (memory usage, file descriptors, etc.).
 	registry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 
-	r.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})).Methods("GET")
+	r.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})).Methods("GET")
 }
 
 // NewSubscriber collects metrics about new subscriber events.
@@ -78,3 +301,139 @@ func (m *Metrics) NewUpdate(u *Update) {
 		m.updatesTotal.WithLabelValues(t).Inc()
 	}
 }
+
+// RetryUpdate collects metrics about retried transport writes.
+func (m *Metrics) RetryUpdate(u *Update) {
+	for _, t := range u.Topics {
+		m.updatesRetried.WithLabelValues(t).Inc()
+	}
+}
+
+// DropUpdate collects metrics about updates dropped because the transport failed to store them.
+func (m *Metrics) DropUpdate(u *Update) {
+	for _, t := range u.Topics {
+		m.updatesDropped.WithLabelValues(t).Inc()
+	}
+}
+
+// SendBytes collects metrics about the bytes sent to a subscriber.
+func (m *Metrics) SendBytes(n int) {
+	m.subscriberBytes.Add(float64(n))
+}
+
+// Publish collects the duration of a publication, the trace ID of the request (if any) is attached as an exemplar
+// to allow going from a latency bucket to the matching trace.
+func (m *Metrics) Publish(r *http.Request, d time.Duration) {
+	if traceID := requestTraceID(r); traceID != "" {
+		m.publishDuration.(prometheus.ExemplarObserver).ObserveWithExemplar(d.Seconds(), prometheus.Labels{"trace_id": traceID})
+		return
+	}
+
+	m.publishDuration.Observe(d.Seconds())
+}
+
+// requestTraceID extracts the trace ID from the traceparent header, as defined by W3C Trace Context.
+func requestTraceID(r *http.Request) string {
+	m := traceparentRegexp.FindStringSubmatch(r.Header.Get("traceparent"))
+	if m == nil || m[1] == "00000000000000000000000000000000" {
+		return ""
+	}
+
+	return m[1]
+}
+
+// Replays collects the number of running and queued history replays.
+func (m *Metrics) Replays(active, queued int) {
+	m.replays.Set(float64(active))
+	m.replaysQueued.Set(float64(queued))
+}
+
+// MemoryPressure collects whether the memory usage is above the watermark.
+func (m *Metrics) MemoryPressure(pressure bool) {
+	if pressure {
+		m.memoryPressure.Set(1)
+		return
+	}
+
+	m.memoryPressure.Set(0)
+}
+
+// BoltFileSize collects the size of the Bolt database where new updates are written, and whether it exceeds its maximum size.
+func (m *Metrics) BoltFileSize(path string, size int64, exceeded bool) {
+	m.boltFileSize.WithLabelValues(path).Set(float64(size))
+	if exceeded {
+		m.boltFileFull.WithLabelValues(path).Set(1)
+		return
+	}
+
+	m.boltFileFull.WithLabelValues(path).Set(0)
+}
+
+// BoltCompaction collects metrics about the compactions of the Bolt databases.
+func (m *Metrics) BoltCompaction(path string) {
+	m.boltCompactions.WithLabelValues(path).Inc()
+}
+
+// BoltUnsyncedWrites collects the number of updates stored without being synced to the disk.
+func (m *Metrics) BoltUnsyncedWrites(path string, n int) {
+	m.boltUnsynced.WithLabelValues(path).Add(float64(n))
+}
+
+// BoltFailedTransaction collects the number of write transactions rolled back because of an error.
+func (m *Metrics) BoltFailedTransaction(path string) {
+	m.boltFailedTxs.WithLabelValues(path).Inc()
+}
+
+// AnalyticsRows collects the number of updates stored in an analytics sink, or dropped.
+func (m *Metrics) AnalyticsRows(sink string, stored bool, n int) {
+	status := "dropped"
+	if stored {
+		status = "stored"
+	}
+
+	m.analyticsRows.WithLabelValues(sink, status).Add(float64(n))
+}
+
+// PipeCreated collects metrics about the pipe created for a new subscriber.
+func (m *Metrics) PipeCreated() {
+	m.pipes.Inc()
+}
+
+// PipeClosed collects the number of updates dropped by the pipe of a disconnected subscriber.
+func (m *Metrics) PipeClosed(s PipeStats) {
+	m.pipes.Dec()
+	m.pipesDropped.Add(float64(s.Dropped))
+}
+
+// TransportWrite collects metrics about the write of an update to the transport.
+func (m *Metrics) TransportWrite(d time.Duration, err error) {
+	m.transportWrites.Observe(d.Seconds())
+	if err != nil {
+		m.transportErrors.Inc()
+	}
+}
+
+// HistoryFetched collects the duration of the fetch of the history by the transport.
+func (m *Metrics) HistoryFetched(d time.Duration) {
+	m.historyFetches.Observe(d.Seconds())
+}
+
+// UpdateCoalesced collects the number of updates superseded by a newer update of the same throttled topic.
+func (m *Metrics) UpdateCoalesced() {
+	m.updatesCoalesced.Inc()
+}
+
+// Panic collects metrics about the panics recovered in the HTTP handlers.
+func (m *Metrics) Panic() {
+	m.panics.Inc()
+}
+
+// TopicExpired removes the metrics associated with an idle topic.
+func (m *Metrics) TopicExpired(topic string) {
+	m.subscribersTotal.DeleteLabelValues(topic)
+	m.subscribers.DeleteLabelValues(topic)
+	m.updatesTotal.DeleteLabelValues(topic)
+	m.updatesRetried.DeleteLabelValues(topic)
+	m.updatesDropped.DeleteLabelValues(topic)
+	m.topicsExpired.Inc()
+}
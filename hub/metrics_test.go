@@ -1,11 +1,17 @@
 package hub
 
 import (
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNumberOfRunningSubscribers(t *testing.T) {
@@ -30,6 +36,99 @@ func TestNumberOfRunningSubscribers(t *testing.T) {
 	assertGaugeLabelValue(t, 0.0, m.subscribers, "topic2")
 }
 
+func TestMetricsInstanceID(t *testing.T) {
+	m := NewMetrics()
+	m.instanceID = "hub-1"
+	r := mux.NewRouter()
+	m.Register(r)
+	m.NewUpdate(&Update{Topics: []string{"topic1"}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `mercure_updates_total{instance_id="hub-1",topic="topic1"} 1`)
+
+	// Prometheus identifies the process, the label is only added to the metrics of the hub
+	assert.Regexp(t, `(?m)^go_goroutines \d+$`, w.Body.String())
+	assert.NotContains(t, w.Body.String(), `go_goroutines{instance_id`)
+}
+
+func TestBoltFileSize(t *testing.T) {
+	m := NewMetrics()
+
+	m.BoltFileSize("updates.db", 1024, false)
+	assertGaugeLabelValue(t, 1024, m.boltFileSize, "updates.db")
+	assertGaugeLabelValue(t, 0, m.boltFileFull, "updates.db")
+
+	m.BoltFileSize("updates.db", 2048, true)
+	assertGaugeLabelValue(t, 2048, m.boltFileSize, "updates.db")
+	assertGaugeLabelValue(t, 1, m.boltFileFull, "updates.db")
+
+	m.BoltCompaction("updates.db")
+	assertCounterValue(t, 1, m.boltCompactions, "updates.db")
+
+	m.BoltUnsyncedWrites("updates.db", 3)
+	assertCounterValue(t, 3, m.boltUnsynced, "updates.db")
+
+	m.BoltFailedTransaction("updates.db")
+	assertCounterValue(t, 1, m.boltFailedTxs, "updates.db")
+}
+
+func TestAnalyticsRows(t *testing.T) {
+	m := NewMetrics()
+
+	m.AnalyticsRows("s3:analytics", true, 10)
+	m.AnalyticsRows("s3:analytics", false, 2)
+	m.AnalyticsRows("s3:analytics", true, 5)
+
+	assert.Equal(t, 15.0, testutil.ToFloat64(m.analyticsRows.WithLabelValues("s3:analytics", "stored")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.analyticsRows.WithLabelValues("s3:analytics", "dropped")))
+}
+
+func TestPipeClosed(t *testing.T) {
+	m := NewMetrics()
+
+	m.PipeCreated()
+	m.PipeCreated()
+	m.PipeCreated()
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.pipes))
+
+	m.PipeClosed(PipeStats{Written: 10})
+	m.PipeClosed(PipeStats{Written: 3, Dropped: 2})
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.pipesDropped))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.pipes))
+}
+
+func TestTransportWrite(t *testing.T) {
+	m := NewMetrics()
+
+	m.TransportWrite(time.Millisecond, nil)
+	m.TransportWrite(2*time.Millisecond, ErrClosedTransport)
+	m.HistoryFetched(time.Second)
+
+	assert.Equal(t, uint64(2), histogramSampleCount(t, m.transportWrites))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.transportErrors))
+	assert.Equal(t, uint64(1), histogramSampleCount(t, m.historyFetches))
+}
+
+func TestHubTransportWrite(t *testing.T) {
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), viper.New())
+
+	require.Nil(t, hub.dispatch(&Update{Topics: []string{"http://example.com/1"}}))
+	hub.Stop()
+	assert.Equal(t, ErrClosedTransport, hub.dispatch(&Update{Topics: []string{"http://example.com/1"}}))
+
+	assert.Equal(t, uint64(2), histogramSampleCount(t, hub.metrics.transportWrites))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hub.metrics.transportErrors))
+}
+
+func histogramSampleCount(t *testing.T, h prometheus.Histogram) uint64 {
+	var metricOut dto.Metric
+	require.Nil(t, h.Write(&metricOut))
+
+	return metricOut.Histogram.GetSampleCount()
+}
+
 func TestTotalNumberOfHandledSubscribers(t *testing.T) {
 	m := NewMetrics()
 
@@ -102,3 +201,50 @@ func assertCounterValue(t *testing.T, v float64, c *prometheus.CounterVec, l str
 
 	assert.Equal(t, v, *metricOut.Counter.Value)
 }
+
+func TestSubscriberBytes(t *testing.T) {
+	m := NewMetrics()
+
+	m.SendBytes(10)
+	m.SendBytes(5)
+
+	assert.Equal(t, 15.0, testutil.ToFloat64(m.subscriberBytes))
+}
+
+func TestPublishDuration(t *testing.T) {
+	m := NewMetrics()
+
+	m.Publish(httptest.NewRequest("POST", defaultHubURL, nil), 10*time.Millisecond)
+
+	r := httptest.NewRequest("POST", defaultHubURL, nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	m.Publish(r, 20*time.Millisecond)
+
+	var metricOut dto.Metric
+	if err := m.publishDuration.Write(&metricOut); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2), metricOut.Histogram.GetSampleCount())
+
+	var exemplars []string
+	for _, b := range metricOut.Histogram.Bucket {
+		if e := b.GetExemplar(); e != nil {
+			exemplars = append(exemplars, e.Label[0].GetName()+"="+e.Label[0].GetValue())
+		}
+	}
+	assert.Equal(t, []string{"trace_id=4bf92f3577b34da6a3ce929d0e0e4736"}, exemplars)
+}
+
+func TestRequestTraceID(t *testing.T) {
+	r := httptest.NewRequest("POST", defaultHubURL, nil)
+	assert.Equal(t, "", requestTraceID(r))
+
+	r.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	assert.Equal(t, "", requestTraceID(r))
+
+	r.Header.Set("traceparent", "invalid")
+	assert.Equal(t, "", requestTraceID(r))
+
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestTraceID(r))
+}
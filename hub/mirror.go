@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultMirrorTimeout = 5 * time.Second
+
+// mirror asynchronously publishes a sample of the published updates to a secondary hub, a staging hub for instance.
+// Failures of the secondary hub never affect the publishers: updates are dropped when the queue is full or when the mirrored publication fails.
+type mirror struct {
+	hubURL     *url.URL
+	client     *http.Client
+	jwt        string
+	sampleRate float64
+	queue      chan *Update
+	done       chan struct{}
+}
+
+// newMirror creates the mirror defined by the "mirror_*" configuration parameters, returns nil if "mirror_url" isn't set.
+// The mirror starts publishing once run is called.
+func newMirror(v *viper.Viper) (*mirror, error) {
+	rawURL, err := getSecret(v, "mirror_url")
+	if err != nil || rawURL == "" {
+		return nil, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(`%w: invalid "mirror_url" configuration parameter %q`, ErrInvalidConfig, rawURL)
+	}
+
+	jwt, err := getSecret(v, "mirror_jwt")
+	if err != nil {
+		return nil, err
+	}
+
+	sampleRate := v.GetFloat64("mirror_sample_rate")
+	if sampleRate <= 0 || sampleRate > 100 {
+		return nil, fmt.Errorf(`%w: the "mirror_sample_rate" configuration parameter must be a percentage greater than 0`, ErrInvalidConfig)
+	}
+
+	queueSize := v.GetInt("mirror_queue_size")
+	if queueSize <= 0 {
+		return nil, fmt.Errorf(`%w: the "mirror_queue_size" configuration parameter must be greater than 0`, ErrInvalidConfig)
+	}
+
+	m := &mirror{
+		hubURL:     u,
+		client:     &http.Client{Timeout: defaultMirrorTimeout},
+		jwt:        jwt,
+		sampleRate: sampleRate,
+		queue:      make(chan *Update, queueSize),
+		done:       make(chan struct{}),
+	}
+
+	return m, nil
+}
+
+// publish queues the update if it's part of the sample, it never blocks.
+func (m *mirror) publish(u *Update) {
+	if m.sampleRate < 100 && rand.Float64()*100 >= m.sampleRate {
+		return
+	}
+
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+
+	// The update will be released once mirrored
+	u.Retain()
+	select {
+	case m.queue <- u:
+	default:
+		u.Release()
+		log.WithFields(log.Fields{"event_id": u.ID}).Warn("mirror: queue full, update not mirrored")
+	}
+}
+
+func (m *mirror) run() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case u := <-m.queue:
+			if err := m.send(u); err != nil {
+				log.WithFields(log.Fields{"event_id": u.ID}).Warn(fmt.Errorf("mirror: %w", err))
+			}
+			u.Release()
+		}
+	}
+}
+
+// send publishes the update to the secondary hub.
+func (m *mirror) send(u *Update) error {
+	req, err := newPublishRequest(m.hubURL, m.jwt, u)
+	if err != nil || req == nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Close stops mirroring, queued updates are dropped.
+func (m *mirror) Close() {
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+}
@@ -0,0 +1,129 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMirror(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+
+	m, err := newMirror(v)
+	assert.Nil(t, m)
+	assert.Nil(t, err)
+
+	v.Set("mirror_url", "ftp://example.com")
+	_, err = newMirror(v)
+	assert.EqualError(t, err, `invalid config: invalid "mirror_url" configuration parameter "ftp://example.com"`)
+
+	v.Set("mirror_url", "https://staging.example.com/.well-known/mercure")
+	v.Set("mirror_sample_rate", 0)
+	_, err = newMirror(v)
+	assert.EqualError(t, err, `invalid config: the "mirror_sample_rate" configuration parameter must be a percentage greater than 0`)
+
+	v.Set("mirror_sample_rate", 150)
+	_, err = newMirror(v)
+	assert.EqualError(t, err, `invalid config: the "mirror_sample_rate" configuration parameter must be a percentage greater than 0`)
+
+	v.Set("mirror_sample_rate", 10)
+	v.Set("mirror_queue_size", 0)
+	_, err = newMirror(v)
+	assert.EqualError(t, err, `invalid config: the "mirror_queue_size" configuration parameter must be greater than 0`)
+
+	v.Set("mirror_queue_size", 10)
+	m, err = newMirror(v)
+	require.Nil(t, err)
+	assert.Equal(t, "https://staging.example.com/.well-known/mercure", m.hubURL.String())
+	assert.Equal(t, 10.0, m.sampleRate)
+	assert.Equal(t, 10, cap(m.queue))
+
+	v.Set("jwt_key", "foo")
+	v.Set("mirror_queue_size", -1)
+	assert.Error(t, ValidateConfig(v))
+}
+
+func TestMirrorPublish(t *testing.T) {
+	received := make(chan url.Values, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer staging", r.Header.Get("Authorization"))
+		r.ParseForm()
+		received <- r.PostForm
+	}))
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("mirror_url", ts.URL+defaultHubURL)
+	v.Set("mirror_jwt", "staging")
+	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer h.Stop()
+	require.NotNil(t, h.mirror)
+
+	form := url.Values{"topic": {"http://example.com/books/1"}, "data": {"Hello"}, "id": {"a"}, "latest_only": {"true"}}
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(h, publisherRole, []string{}))
+	w := httptest.NewRecorder()
+	h.PublishHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case f := <-received:
+		assert.Equal(t, []string{"http://example.com/books/1"}, f["topic"])
+		assert.Equal(t, "Hello", f.Get("data"))
+		assert.Equal(t, "a", f.Get("id"))
+		assert.Equal(t, "true", f.Get("latest_only"))
+	case <-time.After(time.Second):
+		t.Fatal("update not mirrored")
+	}
+
+	// Dry runs aren't mirrored
+	form.Set("dry_run", "true")
+	req = httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(h, publisherRole, []string{}))
+	h.PublishHandler(httptest.NewRecorder(), req)
+
+	select {
+	case <-received:
+		t.Fatal("dry run mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorQueueFull(t *testing.T) {
+	m := &mirror{sampleRate: 100, queue: make(chan *Update, 1), done: make(chan struct{})}
+
+	u1, u2 := AcquireUpdate(), AcquireUpdate()
+	m.publish(u1)
+	m.publish(u2)
+
+	assert.Len(t, m.queue, 1)
+	assert.Same(t, u1, <-m.queue)
+
+	m.Close()
+	m.publish(u1)
+	assert.Len(t, m.queue, 0)
+}
+
+func TestMirrorSendError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	m := &mirror{hubURL: u, client: http.DefaultClient}
+	assert.EqualError(t, m.send(&Update{Topics: []string{"foo"}}), "unexpected status code 401")
+
+	// Expired updates aren't sent
+	assert.Nil(t, m.send(&Update{Topics: []string{"foo"}, Expires: time.Now().Add(-time.Second)}))
+}
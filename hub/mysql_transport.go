@@ -0,0 +1,391 @@
+package hub
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMySQLTableName    = "updates"
+	defaultMySQLPollInterval = 100 * time.Millisecond
+)
+
+var mySQLTableNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// MySQLTransport implements the TransportInterface using a MySQL (or MariaDB) database.
+// Updates are stored in an auto-increment table, and every hub instance polls this table to dispatch updates written by other instances.
+type MySQLTransport struct {
+	sync.Mutex
+	db                *sql.DB
+	tableName         string
+	size              uint64
+	cleanupFrequency  float64
+	pollInterval      time.Duration
+	pipes             map[*Pipe]struct{}
+	done              chan struct{}
+	poll              chan struct{}
+	lastID            uint64
+	bufferSize        int
+	bufferFullTimeout time.Duration
+	pipeBufferFactory PipeBufferFactory
+	replayLimiter     *replayLimiter
+	maxHeldUpdates    int
+}
+
+// NewMySQLTransport create a new MySQLTransport.
+func NewMySQLTransport(u *url.URL, bufferSize int, bufferFullTimeout time.Duration) (*MySQLTransport, error) {
+	var err error
+	q := u.Query()
+	tableName := defaultMySQLTableName
+	if q.Get("table_name") != "" {
+		tableName = q.Get("table_name")
+		if !mySQLTableNameRegexp.MatchString(tableName) {
+			return nil, fmt.Errorf(`%q: invalid "table_name" parameter %q: %w`, redactDSN(u), tableName, ErrInvalidTransportDSN)
+		}
+	}
+
+	size := uint64(0)
+	sizeParameter := q.Get("size")
+	if sizeParameter != "" {
+		size, err = strconv.ParseUint(sizeParameter, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`%q: invalid "size" parameter %q: %s: %w`, redactDSN(u), sizeParameter, err, ErrInvalidTransportDSN)
+		}
+	}
+
+	cleanupFrequency := 0.3
+	cleanupFrequencyParameter := q.Get("cleanup_frequency")
+	if cleanupFrequencyParameter != "" {
+		cleanupFrequency, err = strconv.ParseFloat(cleanupFrequencyParameter, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`%q: invalid "cleanup_frequency" parameter %q: %w`, redactDSN(u), cleanupFrequencyParameter, ErrInvalidTransportDSN)
+		}
+	}
+
+	pollInterval := defaultMySQLPollInterval
+	pollIntervalParameter := q.Get("poll_interval")
+	if pollIntervalParameter != "" {
+		pollInterval, err = time.ParseDuration(pollIntervalParameter)
+		if err != nil || pollInterval <= 0 {
+			return nil, fmt.Errorf(`%q: invalid "poll_interval" parameter %q: %w`, redactDSN(u), pollIntervalParameter, ErrInvalidTransportDSN)
+		}
+	}
+
+	config := mysql.NewConfig()
+	config.Net = "tcp"
+	config.Addr = u.Host
+	config.DBName = strings.TrimPrefix(u.Path, "/")
+	if config.DBName == "" {
+		return nil, fmt.Errorf(`%q: missing database name: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+	if u.User != nil {
+		config.User = u.User.Username()
+		config.Passwd, _ = u.User.Password()
+	}
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf(`%q: %s: %w`, redactDSN(u), err, ErrInvalidTransportDSN)
+	}
+
+	t := &MySQLTransport{
+		db:                db,
+		tableName:         tableName,
+		size:              size,
+		cleanupFrequency:  cleanupFrequency,
+		pollInterval:      pollInterval,
+		pipes:             make(map[*Pipe]struct{}),
+		done:              make(chan struct{}),
+		poll:              make(chan struct{}, 1),
+		bufferSize:        bufferSize,
+		bufferFullTimeout: bufferFullTimeout,
+	}
+
+	if err := t.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf(`%q: %s: %w`, redactDSN(u), err, ErrInvalidTransportDSN)
+	}
+
+	go t.listen()
+
+	return t, nil
+}
+
+// init creates the table if it doesn't exist and retrieves the last stored ID.
+func (t *MySQLTransport) init() error {
+	if _, err := t.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY, "+
+		"event_id VARCHAR(255) NOT NULL, "+
+		"data LONGBLOB NOT NULL, "+
+		"created_at DATETIME(6) NOT NULL, "+
+		"KEY event_id (event_id), "+
+		"KEY created_at (created_at))", t.tableName)); err != nil {
+		return err
+	}
+
+	var lastID sql.NullInt64
+	if err := t.db.QueryRow(fmt.Sprintf("SELECT MAX(id) FROM `%s`", t.tableName)).Scan(&lastID); err != nil {
+		return err
+	}
+	t.lastID = uint64(lastID.Int64)
+
+	return nil
+}
+
+// Write pushes updates in the Transport.
+func (t *MySQLTransport) Write(update *Update) error {
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	if update.Time.IsZero() {
+		update.Time = time.Now()
+	}
+
+	record, err := encodeRecord(update)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.db.Exec(fmt.Sprintf("INSERT INTO `%s` (event_id, data, created_at) VALUES (?, ?, ?)", t.tableName), update.ID, record, update.Time.UTC())
+	if err != nil {
+		return err
+	}
+
+	if id, err := res.LastInsertId(); err == nil {
+		if err := t.cleanup(uint64(id)); err != nil {
+			log.Error(fmt.Errorf("mysql cleanup: %w", err))
+		}
+	}
+
+	// Dispatch immediately instead of waiting for the next tick
+	select {
+	case t.poll <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// listen polls the database to dispatch new updates, including the ones written by other hub instances.
+func (t *MySQLTransport) listen() {
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		case <-t.poll:
+		}
+
+		if err := t.dispatchNewUpdates(); err != nil {
+			log.Error(fmt.Errorf("mysql poll: %w", err))
+		}
+	}
+}
+
+// dispatchNewUpdates sends the updates stored since the last poll to the pipes.
+// Rows committed out of order by concurrent writers may be missed: use a single writer if strict delivery is required.
+func (t *MySQLTransport) dispatchNewUpdates() error {
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+
+	rows, err := t.db.Query(fmt.Sprintf("SELECT id, data FROM `%s` WHERE id > ? ORDER BY id", t.tableName), t.lastID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   uint64
+			data []byte
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+		t.lastID = id
+
+		update, err := decodeRecord(data)
+		if err != nil {
+			// Only the corrupted record is skipped
+			log.WithFields(log.Fields{"id": id}).Error(fmt.Errorf("mysql poll: %w", err))
+			continue
+		}
+
+		for pipe := range t.pipes {
+			if !pipe.Write(update) {
+				delete(t.pipes, pipe)
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// CreatePipe returns a pipe fetching updates from the given point in time.
+func (t *MySQLTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	if cursor.Kind > CursorAfterTime {
+		return nil, ErrUnsupportedCursor
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return nil, ErrClosedTransport
+	default:
+	}
+
+	pipe := t.pipeBufferFactory.newPipe(t.bufferSize, t.bufferFullTimeout)
+	t.pipes[pipe] = struct{}{}
+	if cursor.Kind == CursorLatest {
+		return pipe, nil
+	}
+
+	pipe.holdLive(t.maxHeldUpdates)
+	go t.fetch(cursor, t.lastID, pipe)
+
+	return pipe, nil
+}
+
+// setReplayLimiter limits the number of simultaneous history replays.
+func (t *MySQLTransport) setReplayLimiter(l *replayLimiter) {
+	t.replayLimiter = l
+}
+
+// setStrictOrdering holds up to maxHeldUpdates live updates while the history is replayed, to deliver them after it.
+func (t *MySQLTransport) setStrictOrdering(maxHeldUpdates int) {
+	t.maxHeldUpdates = maxHeldUpdates
+}
+
+func (t *MySQLTransport) fetch(cursor Cursor, toID uint64, pipe *Pipe) {
+	defer pipe.releaseLive()
+	if !t.replayLimiter.acquire(pipe) {
+		return
+	}
+	defer t.replayLimiter.release(pipe)
+
+	if err := t.doFetch(cursor, toID, pipe); err != nil {
+		log.Error(fmt.Errorf("mysql history: %w", err))
+	}
+}
+
+func (t *MySQLTransport) doFetch(cursor Cursor, toID uint64, pipe *Pipe) error {
+	switch cursor.Kind {
+	case CursorEarliest:
+		return t.sendRows(pipe, "id <= ?", toID)
+
+	case CursorAfterTime:
+		return t.sendRows(pipe, "created_at >= ? AND id <= ?", cursor.Time.UTC(), toID)
+	}
+
+	var fromRowID uint64
+	err := t.db.QueryRow(fmt.Sprintf("SELECT id FROM `%s` WHERE event_id = ? ORDER BY id DESC LIMIT 1", t.tableName), cursor.ID).Scan(&fromRowID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // No data
+	}
+	if err != nil {
+		return err
+	}
+
+	return t.sendRows(pipe, "id > ? AND id <= ?", fromRowID, toID)
+}
+
+// sendRows sends the updates stored in the rows matching the given condition to the pipe.
+func (t *MySQLTransport) sendRows(pipe *Pipe, condition string, args ...interface{}) error {
+	rows, err := t.db.Query(fmt.Sprintf("SELECT id, data FROM `%s` WHERE %s ORDER BY id", t.tableName, condition), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   uint64
+			data []byte
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return err
+		}
+
+		update, err := decodeRecord(data)
+		if err != nil {
+			// Only the corrupted record is skipped
+			log.WithFields(log.Fields{"id": id}).Error(fmt.Errorf("mysql history: %w", err))
+			continue
+		}
+
+		if !pipe.writeHistory(update) {
+			return nil
+		}
+	}
+
+	return rows.Err()
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *MySQLTransport) transportConfig() *transportConfig {
+	options := bufferOptions(t.bufferSize, t.bufferFullTimeout)
+	options["table_name"] = t.tableName
+	options["size"] = t.size
+	options["cleanup_frequency"] = t.cleanupFrequency
+	options["poll_interval"] = t.pollInterval.String()
+
+	return &transportConfig{Scheme: "mysql", Options: options}
+}
+
+// Close closes the Transport.
+func (t *MySQLTransport) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	for pipe := range t.pipes {
+		pipe.closeUpdates()
+	}
+	close(t.done)
+	t.db.Close()
+
+	return nil
+}
+
+// cleanup removes entries in the history above the size limit, triggered probabilistically.
+func (t *MySQLTransport) cleanup(lastID uint64) error {
+	if t.size == 0 ||
+		t.cleanupFrequency == 0 ||
+		t.size >= lastID ||
+		(t.cleanupFrequency != 1 && rand.Float64() < t.cleanupFrequency) {
+		return nil
+	}
+
+	_, err := t.db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE id <= ?", t.tableName), lastID-t.size)
+
+	return err
+}
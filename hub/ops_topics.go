@@ -0,0 +1,176 @@
+package hub
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+const opsTopicPrefix = defaultHubURL + "/ops/"
+
+// opsHeartbeat is published on the "heartbeat" ops topic, it lets clients detect stale connections and the node they are connected to.
+type opsHeartbeat struct {
+	Node string    `json:"node"`
+	Time time.Time `json:"time"`
+}
+
+// opsHealth is published on the "health" ops topic.
+type opsHealth struct {
+	opsHeartbeat
+	Status      string `json:"status"`
+	Uptime      int64  `json:"uptime"`
+	Subscribers int64  `json:"subscribers"`
+}
+
+// opsPublisher publishes the synthetic topics describing the hub node itself.
+// These updates are sent directly to the subscribers connected to this node, they never go through the transport and aren't stored in the history.
+type opsPublisher struct {
+	sync.RWMutex
+	node        string
+	start       time.Time
+	maintenance *maintenance
+	connected   atomic.Int64
+	subscribers map[chan *Update]struct{}
+	done        chan struct{}
+}
+
+// newOpsPublisher parses the "ops_topics" rules, formatted as "name=interval", and starts publishing.
+// Returns nil if there are no valid rules.
+func newOpsPublisher(rules []string, node string, m *maintenance) *opsPublisher {
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+
+	p := &opsPublisher{
+		node:        node,
+		start:       time.Now(),
+		maintenance: m,
+		subscribers: make(map[chan *Update]struct{}),
+		done:        make(chan struct{}),
+	}
+
+	started := false
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		var interval time.Duration
+		if len(parts) == 2 {
+			interval, _ = time.ParseDuration(parts[1])
+		}
+		if interval <= 0 || (parts[0] != "heartbeat" && parts[0] != "health") {
+			log.WithFields(log.Fields{"rule": rule}).Error(`Invalid "ops_topics" rule, must be formatted as "name=interval" where name is "heartbeat" or "health"`)
+			continue
+		}
+
+		go p.run(parts[0], interval)
+		started = true
+	}
+
+	if !started {
+		return nil
+	}
+
+	return p
+}
+
+// run publishes the given topic at the given interval until Close is called.
+func (p *opsPublisher) run(name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.broadcast(p.newUpdate(name, now))
+		}
+	}
+}
+
+// newUpdate creates the update of the given ops topic.
+func (p *opsPublisher) newUpdate(name string, now time.Time) *Update {
+	heartbeat := opsHeartbeat{p.node, now.UTC()}
+
+	var payload interface{} = heartbeat
+	if name == "health" {
+		status := "ok"
+		switch {
+		case p.maintenance.isDraining():
+			status = "draining"
+		case p.maintenance.state().Enabled:
+			status = "maintenance"
+		}
+
+		payload = opsHealth{heartbeat, status, int64(now.Sub(p.start).Seconds()), p.connected.Load()}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Update{
+		Topics: []string{opsTopicPrefix + name},
+		Event:  Event{Data: string(data), ID: uuid.Must(uuid.NewV4()).String()},
+	}
+}
+
+// broadcast sends the update to the subscribers, the update is dropped for the ones that didn't consume the previous one yet.
+func (p *opsPublisher) broadcast(u *Update) {
+	p.RLock()
+	defer p.RUnlock()
+
+	for c := range p.subscribers {
+		select {
+		case c <- u:
+		default:
+		}
+	}
+}
+
+// subscribe registers a subscriber, the returned channel is nil if it isn't subscribed to any ops topic.
+func (p *opsPublisher) subscribe(s *Subscriber) chan *Update {
+	p.connected.Inc()
+
+	for _, name := range []string{"heartbeat", "health"} {
+		if s.IsSubscribed(&Update{Topics: []string{opsTopicPrefix + name}}) {
+			c := make(chan *Update, 1)
+
+			p.Lock()
+			p.subscribers[c] = struct{}{}
+			p.Unlock()
+
+			return c
+		}
+	}
+
+	return nil
+}
+
+// unsubscribe removes a subscriber registered by subscribe.
+func (p *opsPublisher) unsubscribe(c chan *Update) {
+	p.connected.Dec()
+
+	if c == nil {
+		return
+	}
+
+	p.Lock()
+	delete(p.subscribers, c)
+	p.Unlock()
+}
+
+// Close stops publishing.
+func (p *opsPublisher) Close() {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+}
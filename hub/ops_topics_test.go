@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOpsPublisherInvalidRules(t *testing.T) {
+	assert.Nil(t, newOpsPublisher(nil, "node", newMaintenance()))
+	assert.Nil(t, newOpsPublisher([]string{"heartbeat", "unknown=1s", "heartbeat=invalid", "health=-1s"}, "node", newMaintenance()))
+
+	p := newOpsPublisher([]string{"heartbeat=1h"}, "", newMaintenance())
+	require.NotNil(t, p)
+	defer p.Close()
+
+	assert.NotEmpty(t, p.node)
+}
+
+func TestOpsPublisherSubscribe(t *testing.T) {
+	p := newOpsPublisher([]string{"heartbeat=1h"}, "node", newMaintenance())
+	require.NotNil(t, p)
+	defer p.Close()
+
+	notInterested := NewSubscriber(true, nil, []string{"http://example.com/books/1"}, []string{"http://example.com/books/1"}, nil, "")
+	assert.Nil(t, p.subscribe(notInterested))
+
+	interested := NewSubscriber(true, nil, []string{opsTopicPrefix + "heartbeat"}, []string{opsTopicPrefix + "heartbeat"}, nil, "")
+	c := p.subscribe(interested)
+	require.NotNil(t, c)
+	assert.Equal(t, int64(2), p.connected.Load())
+
+	// Updates are dropped if the previous one hasn't been consumed yet
+	p.broadcast(p.newUpdate("heartbeat", time.Now()))
+	p.broadcast(p.newUpdate("heartbeat", time.Now()))
+	assert.Len(t, c, 1)
+
+	p.unsubscribe(c)
+	p.unsubscribe(nil)
+	assert.Equal(t, int64(0), p.connected.Load())
+	assert.Empty(t, p.subscribers)
+}
+
+func TestOpsPublisherHealth(t *testing.T) {
+	m := newMaintenance()
+	p := newOpsPublisher([]string{"health=1h"}, "node", m)
+	require.NotNil(t, p)
+	defer p.Close()
+
+	p.connected.Store(3)
+	now := p.start.Add(90 * time.Second)
+
+	var health opsHealth
+	u := p.newUpdate("health", now)
+	assert.Equal(t, []string{opsTopicPrefix + "health"}, u.Topics)
+	require.Nil(t, json.Unmarshal([]byte(u.Data), &health))
+	assert.Equal(t, opsHealth{opsHeartbeat{"node", now.UTC()}, "ok", 90, 3}, health)
+
+	m.enable(time.Minute, 0)
+	require.Nil(t, json.Unmarshal([]byte(p.newUpdate("health", now).Data), &health))
+	assert.Equal(t, "maintenance", health.Status)
+
+	m.enable(time.Minute, time.Minute)
+	require.Nil(t, json.Unmarshal([]byte(p.newUpdate("health", now).Data), &health))
+	assert.Equal(t, "draining", health.Status)
+}
+
+func TestSubscribeOpsTopic(t *testing.T) {
+	v := viper.New()
+	v.Set("allow_anonymous", true)
+	v.Set("ops_topics", []string{"heartbeat=10ms"})
+	v.Set("node_id", "node-1")
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	server := httptest.NewServer(http.HandlerFunc(hub.SubscribeHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + defaultHubURL + "?topic=" + url.QueryEscape(opsTopicPrefix+"heartbeat"))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var heartbeat opsHeartbeat
+		require.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &heartbeat))
+		assert.Equal(t, "node-1", heartbeat.Node)
+		assert.WithinDuration(t, time.Now(), heartbeat.Time, time.Second)
+
+		return
+	}
+
+	t.Fatal("no heartbeat received")
+}
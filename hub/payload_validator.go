@@ -0,0 +1,252 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yosida95/uritemplate"
+)
+
+var (
+	// ErrPayloadRejected is returned when a payload validator rejects the data of an update.
+	ErrPayloadRejected = errors.New("payload rejected")
+	// ErrInvalidValidatorModule is returned when a WebAssembly module doesn't export the functions required to be used as a payload validator.
+	ErrInvalidValidatorModule = errors.New("invalid payload validator module")
+)
+
+// defaultPayloadValidatorTimeout is the maximum duration of a call to a payload validator.
+const defaultPayloadValidatorTimeout = time.Second
+
+// payloadValidator runs a WebAssembly module validating or transforming the data published in the topics matching its selector.
+//
+// The module must export its memory as "memory", an "alloc(size i32) i32" function returning a pointer to a buffer of the given size,
+// a "free(ptr i32, size i32)" function releasing a buffer returned by alloc or transform,
+// and either a "validate(ptr i32, len i32) i32" function returning 0 if the payload is valid,
+// or a "transform(ptr i32, len i32) i64" function returning the pointer (high 32 bits) and the length (low 32 bits) of the new payload, or 0 to reject it.
+type payloadValidator struct {
+	sync.Mutex
+	name             string
+	selector         string
+	selectorTemplate *uritemplate.Template
+	timeout          time.Duration
+	runtime          wazero.Runtime
+	compiled         wazero.CompiledModule
+
+	// module is nil when the instance has been closed because a call timed out
+	module    api.Module
+	alloc     api.Function
+	free      api.Function
+	validate  api.Function
+	transform api.Function
+}
+
+// matches returns true if one of the given topics matches the selector of the validator.
+func (v *payloadValidator) matches(topics []string) bool {
+	for _, topic := range topics {
+		if topic == v.selector || (v.selectorTemplate != nil && v.selectorTemplate.Match(topic) != nil) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// instantiate creates a new instance of the module and looks up its exported functions.
+func (v *payloadValidator) instantiate(ctx context.Context) error {
+	// Modules are anonymous, several rules can use the same file
+	module, err := v.runtime.InstantiateModule(ctx, v.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return fmt.Errorf("%s: %v: %w", v.name, err, ErrInvalidValidatorModule)
+	}
+
+	alloc, free := module.ExportedFunction("alloc"), module.ExportedFunction("free")
+	validate, transform := module.ExportedFunction("validate"), module.ExportedFunction("transform")
+	if module.Memory() == nil || alloc == nil || free == nil || (validate == nil && transform == nil) {
+		module.Close(ctx)
+		return fmt.Errorf(`%s: the module must export "memory", "alloc", "free" and "validate" or "transform": %w`, v.name, ErrInvalidValidatorModule)
+	}
+
+	v.module, v.alloc, v.free, v.validate, v.transform = module, alloc, free, validate, transform
+
+	return nil
+}
+
+// run passes the data to the module and returns the data to publish.
+func (v *payloadValidator) run(ctx context.Context, data string) (string, error) {
+	// Instances of WebAssembly modules aren't safe for concurrent use
+	v.Lock()
+	defer v.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	if v.module == nil {
+		if err := v.instantiate(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := v.call(ctx, data)
+	if err != nil && ctx.Err() != nil {
+		// The runtime closed the instance when the context was done, the next call will create a new one
+		v.module = nil
+
+		return "", fmt.Errorf("%s: %w", v.name, ctx.Err())
+	}
+
+	return data, err
+}
+
+// call copies the data in a buffer allocated by the module, runs the validation or the transformation, and releases the buffers.
+func (v *payloadValidator) call(ctx context.Context, data string) (string, error) {
+	size := uint64(len(data))
+	res, err := v.alloc.Call(ctx, size)
+	if err != nil {
+		return "", err
+	}
+
+	ptr := uint32(res[0])
+	if !v.module.Memory().Write(ptr, []byte(data)) {
+		return "", fmt.Errorf("%s: alloc returned an out of range pointer: %w", v.name, ErrInvalidValidatorModule)
+	}
+
+	if v.validate != nil {
+		res, err := v.validate.Call(ctx, uint64(ptr), size)
+		if err != nil {
+			return "", err
+		}
+		if _, err := v.free.Call(ctx, uint64(ptr), size); err != nil {
+			return "", err
+		}
+		if uint32(res[0]) != 0 {
+			return "", ErrPayloadRejected
+		}
+
+		return data, nil
+	}
+
+	res, err = v.transform.Call(ctx, uint64(ptr), size)
+	if err != nil {
+		return "", err
+	}
+
+	var transformed []byte
+	outPtr, outSize := uint32(res[0]>>32), uint32(res[0])
+	if res[0] != 0 {
+		b, ok := v.module.Memory().Read(outPtr, outSize)
+		if !ok {
+			return "", fmt.Errorf("%s: transform returned an out of range payload: %w", v.name, ErrInvalidValidatorModule)
+		}
+
+		// The slice references the memory of the module, it must be copied before the buffers are released
+		transformed = append([]byte(nil), b...)
+	}
+
+	if _, err := v.free.Call(ctx, uint64(ptr), size); err != nil {
+		return "", err
+	}
+	if res[0] == 0 {
+		return "", ErrPayloadRejected
+	}
+	if outPtr != ptr {
+		// The payload has been transformed in a new buffer
+		if _, err := v.free.Call(ctx, uint64(outPtr), uint64(outSize)); err != nil {
+			return "", err
+		}
+	}
+
+	return string(transformed), nil
+}
+
+// payloadValidators applies the "payload_validators" rules to published updates.
+type payloadValidators struct {
+	runtime    wazero.Runtime
+	validators []*payloadValidator
+}
+
+// newPayloadValidators loads the WebAssembly modules referenced by the "payload_validators" rules, formatted as "module=selector".
+// The selector is a raw topic or an URI template. Calls to the modules taking longer than timeout are aborted. Returns nil if there are no rules.
+func newPayloadValidators(rules []string, timeout time.Duration) (*payloadValidators, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf(`%w: "payload_validator_timeout" must be a positive duration`, ErrInvalidConfig)
+	}
+
+	ctx := context.Background()
+	// Allows to abort the calls to the modules exceeding the timeout
+	pv := &payloadValidators{runtime: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			pv.Close()
+			return nil, fmt.Errorf("%w: invalid \"payload_validators\" rule %q, must be formatted as \"module=selector\"", ErrInvalidConfig, rule)
+		}
+
+		binary, err := ioutil.ReadFile(parts[0])
+		if err != nil {
+			pv.Close()
+			return nil, fmt.Errorf("payload validator: %w", err)
+		}
+
+		v, err := pv.load(ctx, parts[0], binary)
+		if err != nil {
+			pv.Close()
+			return nil, err
+		}
+
+		v.timeout = timeout
+		v.selector = parts[1]
+		if strings.Contains(v.selector, "{") {
+			v.selectorTemplate, _ = uritemplate.New(v.selector) // Returns nil in case of error, will be considered as a raw string
+		}
+
+		pv.validators = append(pv.validators, v)
+	}
+
+	return pv, nil
+}
+
+// load compiles and instantiates a module.
+func (pv *payloadValidators) load(ctx context.Context, name string, binary []byte) (*payloadValidator, error) {
+	compiled, err := pv.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %w", name, err, ErrInvalidValidatorModule)
+	}
+
+	v := &payloadValidator{name: name, runtime: pv.runtime, compiled: compiled}
+	if err := v.instantiate(ctx); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// apply runs the validators matching the given topics in order, and returns the data to publish.
+func (pv *payloadValidators) apply(ctx context.Context, topics []string, data string) (string, error) {
+	var err error
+	for _, v := range pv.validators {
+		if !v.matches(topics) {
+			continue
+		}
+
+		if data, err = v.run(ctx, data); err != nil {
+			return "", err
+		}
+	}
+
+	return data, nil
+}
+
+// Close releases the WebAssembly runtime.
+func (pv *payloadValidators) Close() error {
+	return pv.runtime.Close(context.Background())
+}
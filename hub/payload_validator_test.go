@@ -0,0 +1,253 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wasmSection encodes a section of a WebAssembly module, content must be smaller than 128 bytes.
+func wasmSection(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+// wasmValidatorModule assembles a module exporting "memory", "alloc" (always returning 1024), "free" (adding the released size to the i32 stored at address 0)
+// and a function named export. If transform is true, the function returns an i64.
+func wasmValidatorModule(export string, transform bool, body ...byte) []byte {
+	resultType := byte(0x7f) // i32
+	if transform {
+		resultType = 0x7e // i64
+	}
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, wasmSection(1, 0x03,
+		0x60, 0x01, 0x7f, 0x01, 0x7f, // (i32) -> i32
+		0x60, 0x02, 0x7f, 0x7f, 0x01, resultType, // (i32, i32) -> i32 or i64
+		0x60, 0x02, 0x7f, 0x7f, 0x00, // (i32, i32) -> ()
+	)...)
+	module = append(module, wasmSection(3, 0x03, 0x00, 0x02, 0x01)...)
+	module = append(module, wasmSection(5, 0x01, 0x00, 0x01)...) // 1 page of memory
+
+	exports := []byte{0x04}
+	for i, name := range []string{"memory", "alloc", "free", export} {
+		kind, index := byte(0x00), byte(i-1)
+		if i == 0 {
+			kind, index = 0x02, 0x00
+		}
+		exports = append(exports, byte(len(name)))
+		exports = append(exports, name...)
+		exports = append(exports, kind, index)
+	}
+	module = append(module, wasmSection(7, exports...)...)
+
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	free := []byte{0x00,
+		0x41, 0x00, // i32.const 0
+		0x41, 0x00, // i32.const 0
+		0x28, 0x02, 0x00, // i32.load
+		0x20, 0x01, // local.get 1
+		0x6a,             // i32.add
+		0x36, 0x02, 0x00, // i32.store
+		0x0b,
+	}
+	body = append([]byte{0x00}, append(body, 0x0b)...)
+	code := append([]byte{0x03, byte(len(alloc))}, alloc...)
+	code = append(code, byte(len(free)))
+	code = append(code, free...)
+	code = append(code, byte(len(body)))
+	code = append(code, body...)
+
+	return append(module, wasmSection(10, code...)...)
+}
+
+var (
+	// Rejects payloads not starting with "{"
+	wasmValidateJSONObject = wasmValidatorModule("validate", false,
+		0x20, 0x00, // local.get 0
+		0x2d, 0x00, 0x00, // i32.load8_u
+		0x41, 0xfb, 0x00, // i32.const '{'
+		0x47, // i32.ne
+	)
+
+	// Removes the last byte of the payload
+	wasmTransformTrim = wasmValidatorModule("transform", true,
+		0x20, 0x00, // local.get 0
+		0xad,       // i64.extend_i32_u
+		0x42, 0x20, // i64.const 32
+		0x86,       // i64.shl
+		0x20, 0x01, // local.get 1
+		0x41, 0x01, // i32.const 1
+		0x6b, // i32.sub
+		0xad, // i64.extend_i32_u
+		0x84, // i64.or
+	)
+
+	// Always traps
+	wasmValidateTrap = wasmValidatorModule("validate", false, 0x00)
+
+	// Never returns if the payload starts with "l"
+	wasmValidateLoop = wasmValidatorModule("validate", false,
+		0x20, 0x00, // local.get 0
+		0x2d, 0x00, 0x00, // i32.load8_u
+		0x41, 0xec, 0x00, // i32.const 'l'
+		0x46,       // i32.eq
+		0x04, 0x40, // if
+		0x03, 0x40, // loop
+		0x0c, 0x00, // br 0
+		0x0b,       // end
+		0x0b,       // end
+		0x41, 0x00, // i32.const 0
+	)
+)
+
+// writeWasmModules writes the given modules in a temporary directory and returns their paths.
+func writeWasmModules(t *testing.T, modules ...[]byte) (string, []string) {
+	dir, err := ioutil.TempDir("", "mercure-wasm")
+	require.Nil(t, err)
+
+	paths := make([]string, len(modules))
+	for i, module := range modules {
+		paths[i] = filepath.Join(dir, string(rune('a'+i))+".wasm")
+		require.Nil(t, ioutil.WriteFile(paths[i], module, 0644))
+	}
+
+	return dir, paths
+}
+
+func TestNewPayloadValidatorsInvalid(t *testing.T) {
+	dir, paths := writeWasmModules(t, []byte("invalid"), wasmValidatorModule("other", false, 0x41, 0x00))
+	defer os.RemoveAll(dir)
+
+	pv, err := newPayloadValidators(nil, time.Second)
+	assert.Nil(t, pv)
+	assert.Nil(t, err)
+
+	_, err = newPayloadValidators([]string{"invalid"}, time.Second)
+	assert.EqualError(t, err, `invalid config: invalid "payload_validators" rule "invalid", must be formatted as "module=selector"`)
+
+	_, err = newPayloadValidators([]string{paths[1] + "=foo"}, 0)
+	assert.EqualError(t, err, `invalid config: "payload_validator_timeout" must be a positive duration`)
+
+	_, err = newPayloadValidators([]string{filepath.Join(dir, "missing.wasm") + "=foo"}, time.Second)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = newPayloadValidators([]string{paths[0] + "=foo"}, time.Second)
+	assert.True(t, errors.Is(err, ErrInvalidValidatorModule))
+
+	_, err = newPayloadValidators([]string{paths[1] + "=foo"}, time.Second)
+	assert.True(t, errors.Is(err, ErrInvalidValidatorModule))
+}
+
+func TestPayloadValidators(t *testing.T) {
+	dir, paths := writeWasmModules(t, wasmValidateJSONObject, wasmTransformTrim, wasmValidateTrap)
+	defer os.RemoveAll(dir)
+
+	pv, err := newPayloadValidators([]string{
+		paths[1] + "=https://example.com/books/{id}",
+		paths[0] + "=https://example.com/books/{id}",
+		paths[0] + "=https://example.com/authors/1",
+		paths[2] + "=https://example.com/trap",
+	}, time.Second)
+	require.Nil(t, err)
+	defer pv.Close()
+
+	ctx := context.Background()
+
+	data, err := pv.apply(ctx, []string{"https://example.com/reviews/1"}, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", data)
+
+	data, err = pv.apply(ctx, []string{"https://example.com/authors/1"}, `{"name": "Kévin"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "Kévin"}`, data)
+
+	_, err = pv.apply(ctx, []string{"https://example.com/authors/1"}, "foo")
+	assert.Equal(t, ErrPayloadRejected, err)
+
+	// Validators are applied in order, the trailing byte is removed before the validation
+	data, err = pv.apply(ctx, []string{"foo", "https://example.com/books/1"}, `{"title": "Dune"}x`)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"title": "Dune"}`, data)
+
+	_, err = pv.apply(ctx, []string{"https://example.com/books/1"}, `x{"title": "Dune"}`)
+	assert.Equal(t, ErrPayloadRejected, err)
+
+	_, err = pv.apply(ctx, []string{"https://example.com/trap"}, "foo")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrPayloadRejected, err)
+
+	// The buffers allocated for the payloads have been released
+	freed, _ := pv.validators[0].module.Memory().ReadUint32Le(0)
+	assert.Equal(t, uint32(2*len(`{"title": "Dune"}x`)), freed)
+	freed, _ = pv.validators[1].module.Memory().ReadUint32Le(0)
+	assert.Equal(t, uint32(2*len(`{"title": "Dune"}`)), freed)
+	freed, _ = pv.validators[2].module.Memory().ReadUint32Le(0)
+	assert.Equal(t, uint32(len(`{"name": "Kévin"}`)+len("foo")), freed)
+}
+
+func TestPayloadValidatorTimeout(t *testing.T) {
+	dir, paths := writeWasmModules(t, wasmValidateLoop)
+	defer os.RemoveAll(dir)
+
+	pv, err := newPayloadValidators([]string{paths[0] + "=foo"}, 50*time.Millisecond)
+	require.Nil(t, err)
+	defer pv.Close()
+
+	ctx := context.Background()
+
+	_, err = pv.apply(ctx, []string{"foo"}, "loop")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// A new instance of the module is created
+	data, err := pv.apply(ctx, []string{"foo"}, "bar")
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", data)
+}
+
+func TestPublishWithPayloadValidators(t *testing.T) {
+	dir, paths := writeWasmModules(t, wasmValidateJSONObject, wasmValidateTrap)
+	defer os.RemoveAll(dir)
+
+	v := viper.New()
+	v.Set("payload_validators", []string{paths[0] + "=https://example.com/books/{id}", paths[1] + "=https://example.com/trap"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	for _, c := range []struct {
+		topic      string
+		data       string
+		statusCode int
+	}{
+		{"https://example.com/books/1", "foo", http.StatusUnprocessableEntity},
+		{"https://example.com/trap", "foo", http.StatusInternalServerError},
+		{"https://example.com/books/1", `{"title": "Dune"}`, http.StatusOK},
+	} {
+		form := url.Values{"topic": {c.topic}, "data": {c.data}}
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+		assert.Equal(t, c.statusCode, w.Result().StatusCode)
+	}
+
+	// Only the valid update has been dispatched
+	u := <-pipe.Read()
+	assert.Equal(t, `{"title": "Dune"}`, u.Data)
+}
@@ -2,9 +2,11 @@ package hub
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
 )
 
 // ErrClosedPipe is returned by the Pipe's Write and Read methods after a call to Close.
@@ -15,34 +17,429 @@ type Pipe struct {
 	updates           chan *Update
 	done              chan struct{}
 	bufferFullTimeout time.Duration
+
+	// buffer stores the updates that don't fit in the channel, if nil writes block until bufferFullTimeout
+	buffer  PipeBuffer
+	mu      sync.Mutex
+	sendMu  sync.Mutex
+	closing chan struct{}
+	closed  bool
+	pumping bool
+
+	// overflowed is true if the pipe has been closed because the reader was too slow
+	overflowed bool
+
+	// held stores the live updates written while the history is replayed, in the strict ordering mode
+	held           []*Update
+	holding        bool
+	maxHeldUpdates int
+
+	// memory makes the pipe close as soon as the reader falls behind while the memory usage is above the watermark
+	memory *memoryGuard
+
+	// skipped describes the updates dropped by the buffer and matching skippedFilter since the subscriber has been notified
+	skipped       droppedUpdates
+	skippedFilter func(*Update) bool
+
+	// written and dropped count the updates accepted and rejected by the pipe, lastWrite is the time in nanoseconds of the last accepted one
+	written   atomic.Uint64
+	dropped   atomic.Uint64
+	lastWrite atomic.Int64
+}
+
+// PipeStats describes the occupancy of a pipe and the updates written to it, to diagnose slow subscribers.
+type PipeStats struct {
+	// Queued is the number of updates waiting in the channel returned by Read, Capacity is the size of this channel
+	Queued   int `json:"queued"`
+	Capacity int `json:"capacity"`
+	// Buffered is the number of updates stored in the PipeBuffer because the channel is full
+	Buffered int `json:"buffered"`
+	// Held is the number of live updates held while the history is replayed in the strict ordering mode
+	Held    int    `json:"held"`
+	Written uint64 `json:"written"`
+	// Dropped is the number of updates that couldn't be written, because the reader was too slow or the pipe was closed
+	Dropped    uint64     `json:"dropped"`
+	LastWrite  *time.Time `json:"last_write,omitempty"`
+	Closed     bool       `json:"closed"`
+	Overflowed bool       `json:"overflowed"`
+}
+
+// Pending returns the number of updates written to the pipe but not read yet.
+func (s PipeStats) Pending() int {
+	return s.Queued + s.Buffered + s.Held
 }
 
 // NewPipe creates pipes.
 func NewPipe(bufferSize int, bufferFullTimeout time.Duration) *Pipe {
-	return &Pipe{
-		make(chan *Update, bufferSize),
-		make(chan struct{}),
-		bufferFullTimeout,
+	return NewPipeWithBuffer(bufferSize, bufferFullTimeout, nil)
+}
+
+// NewPipeWithBuffer creates a pipe storing the updates that don't fit in its channel in the given PipeBuffer.
+// If buffer is nil, writes block until bufferFullTimeout when the channel is full, then the pipe is closed.
+func NewPipeWithBuffer(bufferSize int, bufferFullTimeout time.Duration, buffer PipeBuffer) *Pipe {
+	p := &Pipe{
+		updates:           make(chan *Update, bufferSize),
+		done:              make(chan struct{}),
+		bufferFullTimeout: bufferFullTimeout,
+		buffer:            buffer,
+		closing:           make(chan struct{}),
+	}
+	if b, ok := buffer.(droppingPipeBuffer); ok {
+		b.onDrop(p.droppedLocked)
 	}
+
+	return p
 }
 
 // Write pushes updates in the pipe. Returns true is the update is pushed, false otherwise.
+// While the history is replayed in the strict ordering mode, the update is held until the end of the replay.
 func (p *Pipe) Write(update *Update) bool {
+	p.mu.Lock()
+	if !p.holding {
+		p.mu.Unlock()
+
+		return p.write(update)
+	}
+	defer p.mu.Unlock()
+
+	if p.closed || p.IsClosed() {
+		p.dropped.Inc()
+		return false
+	}
+
+	if len(p.held) >= p.maxHeldUpdates {
+		p.dropped.Inc()
+		p.markClosedLocked()
+		p.overflowed = true
+		p.sendMu.Lock()
+		close(p.updates)
+		p.sendMu.Unlock()
+		log.Info("Too many live updates held during the replay of the history, pipe closed.")
+
+		return false
+	}
+
+	update.Retain()
+	p.held = append(p.held, update)
+
+	return true
+}
+
+// accepted records that an update has been written.
+func (p *Pipe) accepted() bool {
+	p.written.Inc()
+	p.lastWrite.Store(time.Now().UnixNano())
+
+	return true
+}
+
+// rejected records that an update couldn't be written.
+func (p *Pipe) rejected() bool {
+	p.dropped.Inc()
+
+	return false
+}
+
+// droppedLocked records an update dropped by the buffer to make room for a newer one, the pipe must be locked.
+func (p *Pipe) droppedLocked(update *Update) {
+	p.dropped.Inc()
+	if p.skippedFilter == nil || !p.skippedFilter(update) {
+		return
+	}
+
+	if p.skipped.Count == 0 {
+		p.skipped.FirstID = update.ID
+	}
+	p.skipped.LastID = update.ID
+	p.skipped.Count++
+}
+
+// trackDropped makes the pipe record the updates matching the filter dropped by its buffer, they are returned by takeDropped.
+func (p *Pipe) trackDropped(filter func(*Update) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.skippedFilter = filter
+}
+
+// takeDropped returns the updates dropped by the buffer since the last call, ok is false if none has been dropped.
+func (p *Pipe) takeDropped() (d droppedUpdates, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, p.skipped = p.skipped, droppedUpdates{}
+
+	return d, d.Count > 0
+}
+
+// writeHistory pushes an update of the history in the pipe, it's never held.
+func (p *Pipe) writeHistory(update *Update) bool {
+	return p.write(update)
+}
+
+// holdLive makes the pipe hold up to maxHeldUpdates live updates until releaseLive is called,
+// so they are delivered after the history even if the reader is slower than the replay. It does nothing if maxHeldUpdates isn't positive.
+func (p *Pipe) holdLive(maxHeldUpdates int) {
+	if maxHeldUpdates <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.holding = true
+	p.maxHeldUpdates = maxHeldUpdates
+}
+
+// releaseLive delivers the held live updates, then stops holding them.
+// The updates written in the meantime are held too, until none are left.
+func (p *Pipe) releaseLive() {
+	for {
+		p.mu.Lock()
+		held := p.held
+		p.held = nil
+		if len(held) == 0 {
+			p.holding = false
+			p.mu.Unlock()
+
+			return
+		}
+		p.mu.Unlock()
+
+		for _, u := range held {
+			p.write(u)
+			u.Release()
+		}
+	}
+}
+
+func (p *Pipe) write(update *Update) bool {
 	select {
 	case <-p.done:
-		return false
+		return p.rejected()
+	default:
+	}
+
+	// The reader is responsible for releasing the update
+	update.Retain()
+
+	p.mu.Lock()
+	buffered := p.buffer != nil
+	memory := p.memory
+	p.mu.Unlock()
+	if buffered {
+		return p.writeBuffered(update)
+	}
+
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	select {
+	case <-p.closing:
+		update.Release()
+		return p.rejected()
 	default:
 	}
 
+	// Under memory pressure, the reader isn't given any time to catch up
+	if memory.underPressure() {
+		select {
+		case p.updates <- update:
+			return p.accepted()
+		default:
+		}
+
+		update.Release()
+		if p.markOverflowed() {
+			close(p.updates)
+		}
+		log.Info("Messages blocked under memory pressure, pipe closed.")
+		return p.rejected()
+	}
+
 	// The updates channel is buffered, if the buffer is full and it blocks for too long we close it
 	select {
 	case p.updates <- update:
-		return true
+		return p.accepted()
+	case <-p.closing:
+		update.Release()
+		return p.rejected()
 	case <-time.After(p.bufferFullTimeout):
-		close(p.updates)
+		update.Release()
+		if p.markOverflowed() {
+			close(p.updates)
+		}
 		log.Info("Messages blocked, pipe closed.")
+		return p.rejected()
+	}
+}
+
+// writeBuffered pushes the update in the channel if possible, or stores it in the buffer.
+// The buffer is then drained in the channel by a dedicated goroutine, preserving the order of updates.
+func (p *Pipe) writeBuffered(update *Update) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		update.Release()
+		return p.rejected()
+	}
+
+	if !p.pumping {
+		select {
+		case p.updates <- update:
+			return p.accepted()
+		default:
+		}
+	}
+
+	// Under memory pressure, the buffer doesn't grow anymore
+	if p.memory.underPressure() || !p.buffer.Push(update) {
+		update.Release()
+		p.markClosedLocked()
+		p.overflowed = true
+		p.sendMu.Lock()
+		close(p.updates)
+		p.sendMu.Unlock()
+		log.Info("Pipe buffer full, pipe closed.")
+		return p.rejected()
+	}
+
+	if !p.pumping {
+		p.pumping = true
+		go p.pump()
+	}
+
+	return p.accepted()
+}
+
+// pump moves the buffered updates to the channel.
+func (p *Pipe) pump() {
+	for {
+		p.mu.Lock()
+		var update *Update
+		if !p.closed {
+			update = p.buffer.Pop()
+		}
+		if update == nil {
+			p.pumping = false
+			if b, ok := p.buffer.(failingPipeBuffer); ok && b.failed() && p.markClosedLocked() {
+				// The reader would miss the lost updates
+				p.overflowed = true
+				p.sendMu.Lock()
+				close(p.updates)
+				p.sendMu.Unlock()
+				log.Info("Pipe buffer failed, pipe closed.")
+			}
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		p.sendMu.Lock()
+		select {
+		case <-p.closing:
+			p.sendMu.Unlock()
+			update.Release()
+			return
+		default:
+		}
+
+		select {
+		case p.updates <- update:
+			p.sendMu.Unlock()
+		case <-p.done:
+			p.sendMu.Unlock()
+			update.Release()
+			return
+		case <-p.closing:
+			p.sendMu.Unlock()
+			update.Release()
+			return
+		}
+	}
+}
+
+// closeUpdates closes the channel returned by Read, it's safe to call it several times.
+func (p *Pipe) closeUpdates() {
+	if !p.markClosed() {
+		return
+	}
+
+	p.sendMu.Lock()
+	close(p.updates)
+	p.sendMu.Unlock()
+}
+
+// markClosed prevents further writes, it returns false if the pipe was already marked as closed.
+func (p *Pipe) markClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.markClosedLocked()
+}
+
+// markOverflowed marks the pipe as closed because the reader was too slow, it returns false if the pipe was already marked as closed.
+func (p *Pipe) markOverflowed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.markClosedLocked() {
+		return false
+	}
+	p.overflowed = true
+
+	return true
+}
+
+func (p *Pipe) markClosedLocked() bool {
+	if p.closed {
 		return false
 	}
+	p.closed = true
+	close(p.closing)
+
+	if p.buffer != nil {
+		p.buffer.Close()
+	}
+
+	for _, u := range p.held {
+		u.Release()
+	}
+	p.held = nil
+
+	return true
+}
+
+// Conflate makes the pipe keep only the most recent of the buffered updates of a same topic, for the updates selected by the conflate function.
+// The buffer of the pipe is replaced by a ConflatingPipeBuffer storing at most size updates, the updates already buffered are moved to it.
+func (p *Pipe) Conflate(size int, conflate func(*Update) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	b := NewConflatingPipeBuffer(size, conflate)
+	if p.buffer != nil {
+		for u := p.buffer.Pop(); u != nil; u = p.buffer.Pop() {
+			if !b.Push(u) {
+				u.Release()
+			}
+		}
+		p.buffer.Close()
+	}
+	p.buffer = b
+}
+
+// setMemoryGuard makes the pipe stop buffering updates while the memory usage is above the watermark of the guard:
+// the pipe is closed as soon as the reader falls behind.
+func (p *Pipe) setMemoryGuard(g *memoryGuard) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.memory = g
 }
 
 // Read returns a channel containing updates.
@@ -61,11 +458,45 @@ func (p *Pipe) IsClosed() bool {
 	return false
 }
 
+// Overflowed returns true if the pipe has been closed because the reader didn't consume the updates fast enough.
+func (p *Pipe) Overflowed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.overflowed
+}
+
+// Stats returns the occupancy of the pipe and the number of updates written to it.
+func (p *Pipe) Stats() PipeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := PipeStats{
+		Queued:     len(p.updates),
+		Capacity:   cap(p.updates),
+		Held:       len(p.held),
+		Written:    p.written.Load(),
+		Dropped:    p.dropped.Load(),
+		Closed:     p.closed || p.IsClosed(),
+		Overflowed: p.overflowed,
+	}
+	if p.buffer != nil && !p.closed {
+		s.Buffered = p.buffer.Len()
+	}
+	if n := p.lastWrite.Load(); n != 0 {
+		t := time.Unix(0, n)
+		s.LastWrite = &t
+	}
+
+	return s
+}
+
 // Close closes the pipe.
 func (p *Pipe) Close() {
 	select {
 	case <-p.done:
 		// Already closed. Don't close again.
+		return
 	default:
 	}
 
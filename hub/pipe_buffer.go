@@ -0,0 +1,242 @@
+package hub
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+)
+
+// PipeBuffer stores the updates that don't fit in the channel of a Pipe, when the reader is too slow.
+// Implementations don't need to be thread-safe: the Pipe serializes the calls.
+type PipeBuffer interface {
+	// Push stores the update, it returns false if the update cannot be stored.
+	// In this case, the pipe is closed.
+	Push(update *Update) bool
+
+	// Pop removes and returns the oldest stored update, or nil if the buffer is empty.
+	Pop() *Update
+
+	// Len returns the number of stored updates.
+	Len() int
+
+	// Close releases the resources held by the buffer.
+	Close()
+}
+
+// droppingPipeBuffer is implemented by the buffers dropping the oldest updates when they are full, instead of closing the pipe.
+type droppingPipeBuffer interface {
+	// onDrop sets the function called with every dropped update, before it's released
+	onDrop(f func(*Update))
+}
+
+// failingPipeBuffer is implemented by the buffers losing their updates in case of error, Pop then returns nil and the pipe is closed.
+type failingPipeBuffer interface {
+	// failed returns true if the stored updates have been lost
+	failed() bool
+}
+
+// PipeBufferFactory creates a PipeBuffer for every new Pipe.
+type PipeBufferFactory func() PipeBuffer
+
+// NewPipeBufferFactory returns the factory corresponding to the given strategy.
+// The "block" strategy returns a nil factory: writes to full pipes block until the timeout, then the pipe is closed.
+// The dir parameter is only used by the "disk" strategy.
+func NewPipeBufferFactory(strategy string, size int, dir string) (PipeBufferFactory, error) {
+	switch strategy {
+	case "", "block":
+		return nil, nil
+
+	case "ring":
+		if size <= 0 {
+			return nil, fmt.Errorf(`%w: the "ring" buffer strategy requires a positive "update_buffer_overflow_size"`, ErrInvalidConfig)
+		}
+
+		return func() PipeBuffer { return NewRingPipeBuffer(size) }, nil
+
+	case "unbounded":
+		return func() PipeBuffer { return NewListPipeBuffer() }, nil
+
+	case "disk":
+		if size <= 0 {
+			return nil, fmt.Errorf(`%w: the "disk" buffer strategy requires a positive "update_buffer_overflow_size"`, ErrInvalidConfig)
+		}
+
+		return func() PipeBuffer { return NewDiskPipeBuffer(dir, size) }, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q: no such buffer strategy", ErrInvalidConfig, strategy)
+}
+
+// RingPipeBuffer keeps the most recent updates, the oldest one is dropped when it's full.
+type RingPipeBuffer struct {
+	updates []*Update
+	start   int
+	len     int
+	dropped func(*Update)
+}
+
+// NewRingPipeBuffer creates a RingPipeBuffer storing at most size updates.
+func NewRingPipeBuffer(size int) *RingPipeBuffer {
+	return &RingPipeBuffer{updates: make([]*Update, size)}
+}
+
+// Push stores the update, dropping the oldest one if the buffer is full.
+func (b *RingPipeBuffer) Push(update *Update) bool {
+	if b.len == len(b.updates) {
+		u := b.Pop()
+		if b.dropped != nil {
+			b.dropped(u)
+		}
+		u.Release()
+	}
+
+	b.updates[(b.start+b.len)%len(b.updates)] = update
+	b.len++
+
+	return true
+}
+
+// Pop removes and returns the oldest stored update.
+func (b *RingPipeBuffer) Pop() *Update {
+	if b.len == 0 {
+		return nil
+	}
+
+	u := b.updates[b.start]
+	b.updates[b.start] = nil
+	b.start = (b.start + 1) % len(b.updates)
+	b.len--
+
+	return u
+}
+
+// Len returns the number of stored updates.
+func (b *RingPipeBuffer) Len() int {
+	return b.len
+}
+
+func (b *RingPipeBuffer) onDrop(f func(*Update)) {
+	b.dropped = f
+}
+
+// Close drops the stored updates.
+func (b *RingPipeBuffer) Close() {
+	for b.len > 0 {
+		b.Pop().Release()
+	}
+}
+
+// ListPipeBuffer is an unbounded buffer backed by a linked list.
+// Updates are never dropped, but memory usage can grow without limit if the reader is too slow.
+type ListPipeBuffer struct {
+	list *list.List
+}
+
+// NewListPipeBuffer creates a ListPipeBuffer.
+func NewListPipeBuffer() *ListPipeBuffer {
+	return &ListPipeBuffer{list.New()}
+}
+
+// Push stores the update.
+func (b *ListPipeBuffer) Push(update *Update) bool {
+	b.list.PushBack(update)
+
+	return true
+}
+
+// Pop removes and returns the oldest stored update.
+func (b *ListPipeBuffer) Pop() *Update {
+	e := b.list.Front()
+	if e == nil {
+		return nil
+	}
+
+	return b.list.Remove(e).(*Update)
+}
+
+// Len returns the number of stored updates.
+func (b *ListPipeBuffer) Len() int {
+	return b.list.Len()
+}
+
+// Close drops the stored updates.
+func (b *ListPipeBuffer) Close() {
+	for u := b.Pop(); u != nil; u = b.Pop() {
+		u.Release()
+	}
+}
+
+// ConflatingPipeBuffer keeps only the most recent of the stored updates of a same topic, for the updates that can be conflated.
+// A newer update replaces the stored one in place, other updates are stored as is.
+type ConflatingPipeBuffer struct {
+	list     *list.List
+	latest   map[string]*list.Element
+	conflate func(*Update) bool
+	size     int
+}
+
+// NewConflatingPipeBuffer creates a ConflatingPipeBuffer storing at most size updates (unlimited if size is 0), the conflate function selects the updates that can be conflated.
+func NewConflatingPipeBuffer(size int, conflate func(*Update) bool) *ConflatingPipeBuffer {
+	return &ConflatingPipeBuffer{list.New(), make(map[string]*list.Element), conflate, size}
+}
+
+// Push replaces the stored update of the same topic if the update can be conflated, or stores it.
+// It returns false if a new update must be stored and the buffer is full.
+func (b *ConflatingPipeBuffer) Push(update *Update) bool {
+	conflatable := len(update.Topics) > 0 && b.conflate(update)
+	if conflatable {
+		if e, ok := b.latest[update.Topics[0]]; ok {
+			e.Value.(*Update).Release()
+			e.Value = update
+
+			return true
+		}
+	}
+
+	if b.size > 0 && b.list.Len() >= b.size {
+		return false
+	}
+
+	e := b.list.PushBack(update)
+	if conflatable {
+		b.latest[update.Topics[0]] = e
+	}
+
+	return true
+}
+
+// Pop removes and returns the oldest stored update.
+func (b *ConflatingPipeBuffer) Pop() *Update {
+	e := b.list.Front()
+	if e == nil {
+		return nil
+	}
+
+	u := b.list.Remove(e).(*Update)
+	if len(u.Topics) > 0 && b.latest[u.Topics[0]] == e {
+		delete(b.latest, u.Topics[0])
+	}
+
+	return u
+}
+
+// Len returns the number of stored updates.
+func (b *ConflatingPipeBuffer) Len() int {
+	return b.list.Len()
+}
+
+// Close drops the stored updates.
+func (b *ConflatingPipeBuffer) Close() {
+	for u := b.Pop(); u != nil; u = b.Pop() {
+		u.Release()
+	}
+}
+
+// newPipe creates a pipe using a buffer created by the factory, or a blocking pipe if the factory is nil.
+func (f PipeBufferFactory) newPipe(bufferSize int, bufferFullTimeout time.Duration) *Pipe {
+	if f == nil {
+		return NewPipe(bufferSize, bufferFullTimeout)
+	}
+
+	return NewPipeWithBuffer(bufferSize, bufferFullTimeout, f())
+}
@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DiskPipeBuffer spills the updates to a temporary file, allowing slow subscribers to catch up without losing updates.
+// The file is created when the first update is stored, and removed when the buffer is closed.
+type DiskPipeBuffer struct {
+	dir         string
+	size        int
+	file        *os.File
+	readOffset  int64
+	writeOffset int64
+	len         int
+	// err is the I/O error that closed the buffer, the updates it stored are lost
+	err error
+}
+
+// NewDiskPipeBuffer creates a DiskPipeBuffer storing at most size updates in a file created in dir.
+// If dir is empty, the default directory for temporary files is used.
+func NewDiskPipeBuffer(dir string, size int) *DiskPipeBuffer {
+	return &DiskPipeBuffer{dir: dir, size: size}
+}
+
+// Push writes the update at the end of the file, it returns false if the buffer is full or in case of I/O error.
+func (b *DiskPipeBuffer) Push(update *Update) bool {
+	if b.err != nil || b.len >= b.size {
+		return false
+	}
+
+	if err := b.push(update); err != nil {
+		b.fail(err)
+		return false
+	}
+
+	// The update has been copied to the disk
+	update.Release()
+	b.len++
+
+	return true
+}
+
+func (b *DiskPipeBuffer) push(update *Update) error {
+	if b.file == nil {
+		f, err := ioutil.TempFile(b.dir, "mercure-pipe-")
+		if err != nil {
+			return err
+		}
+		b.file = f
+	}
+
+	updateJSON, err := json.Marshal(*update)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, 4+len(updateJSON))
+	binary.BigEndian.PutUint32(record, uint32(len(updateJSON)))
+	copy(record[4:], updateJSON)
+
+	// A partially written record is overwritten by the next one
+	if _, err := b.file.WriteAt(record, b.writeOffset); err != nil {
+		return err
+	}
+	b.writeOffset += int64(len(record))
+
+	return nil
+}
+
+// Pop reads the oldest update from the file.
+// In case of I/O error, the buffer is closed and nil is returned: the next updates would be out of order.
+func (b *DiskPipeBuffer) Pop() *Update {
+	if b.len == 0 {
+		return nil
+	}
+
+	update, err := b.pop()
+	if err != nil {
+		b.fail(err)
+		return nil
+	}
+
+	b.len--
+	if b.len == 0 {
+		// Reclaim the disk space as soon as the subscriber caught up
+		b.readOffset, b.writeOffset = 0, 0
+		if err := b.file.Truncate(0); err != nil {
+			log.Error(fmt.Errorf("disk pipe buffer: %w", err))
+		}
+	}
+
+	return update
+}
+
+func (b *DiskPipeBuffer) pop() (*Update, error) {
+	header := make([]byte, 4)
+	if _, err := b.file.ReadAt(header, b.readOffset); err != nil {
+		return nil, err
+	}
+
+	updateJSON := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := b.file.ReadAt(updateJSON, b.readOffset+4); err != nil {
+		return nil, err
+	}
+	b.readOffset += int64(4 + len(updateJSON))
+
+	var update *Update
+	if err := json.Unmarshal(updateJSON, &update); err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
+
+// fail closes the buffer after an I/O error, the pipe is then closed.
+func (b *DiskPipeBuffer) fail(err error) {
+	log.Error(fmt.Errorf("disk pipe buffer: %w", err))
+	b.err = err
+	b.Close()
+}
+
+// failed returns true if the buffer has been closed after an I/O error.
+func (b *DiskPipeBuffer) failed() bool {
+	return b.err != nil
+}
+
+// Len returns the number of stored updates.
+func (b *DiskPipeBuffer) Len() int {
+	return b.len
+}
+
+// Close removes the file.
+func (b *DiskPipeBuffer) Close() {
+	b.len = 0
+	if b.file == nil {
+		return
+	}
+
+	b.file.Close()
+	os.Remove(b.file.Name())
+	b.file = nil
+}
@@ -0,0 +1,132 @@
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskPipeBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b := NewDiskPipeBuffer(dir, 3)
+	assert.Nil(t, b.Pop())
+	assert.Nil(t, b.file)
+
+	for i := 1; i <= 3; i++ {
+		assert.True(t, b.Push(&Update{Topics: []string{"http://example.com/" + strconv.Itoa(i)}, Event: Event{ID: strconv.Itoa(i), Data: "line1\nline2"}}))
+	}
+	assert.False(t, b.Push(&Update{}))
+	assert.Equal(t, 3, b.Len())
+
+	u := b.Pop()
+	require.NotNil(t, u)
+	assert.Equal(t, "1", u.ID)
+	assert.Equal(t, "line1\nline2", u.Data)
+	assert.Equal(t, []string{"http://example.com/1"}, u.Topics)
+
+	assert.True(t, b.Push(&Update{Event: Event{ID: "4"}}))
+	for i := 2; i <= 4; i++ {
+		assert.Equal(t, strconv.Itoa(i), b.Pop().ID)
+	}
+	assert.Nil(t, b.Pop())
+
+	// The file is truncated when the buffer is empty
+	stat, err := b.file.Stat()
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), stat.Size())
+
+	name := b.file.Name()
+	b.Close()
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiskPipeBufferInvalidDir(t *testing.T) {
+	b := NewDiskPipeBuffer("/not-existing-dir", 3)
+	assert.False(t, b.Push(&Update{}))
+	b.Close()
+}
+
+func TestDiskPipeBufferReadError(t *testing.T) {
+	for name, corrupt := range map[string]func(f *os.File) error{
+		"truncated": func(f *os.File) error { return f.Truncate(2) },
+		"invalid":   func(f *os.File) error { _, err := f.WriteAt([]byte("["), 4); return err },
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := NewDiskPipeBuffer(t.TempDir(), 3)
+			require.True(t, b.Push(&Update{Event: Event{ID: "1"}}))
+			require.True(t, b.Push(&Update{Event: Event{ID: "2"}}))
+			path := b.file.Name()
+			require.Nil(t, corrupt(b.file))
+
+			// The buffer is closed: the next updates would be out of order
+			assert.Nil(t, b.Pop())
+			assert.True(t, b.failed())
+			assert.Equal(t, 0, b.Len())
+			assert.False(t, b.Push(&Update{Event: Event{ID: "3"}}))
+			assert.Nil(t, b.file)
+
+			_, err := os.Stat(path)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestDiskPipeBufferWriteError(t *testing.T) {
+	b := NewDiskPipeBuffer(t.TempDir(), 3)
+	require.True(t, b.Push(&Update{Event: Event{ID: "1"}}))
+	path := b.file.Name()
+	b.file.Close()
+
+	assert.False(t, b.Push(&Update{Event: Event{ID: "2"}}))
+	assert.True(t, b.failed())
+	assert.Equal(t, 0, b.Len())
+	assert.Nil(t, b.Pop())
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBufferedPipeClosedOnDiskError(t *testing.T) {
+	b := NewDiskPipeBuffer(t.TempDir(), 100)
+	pipe := NewPipeWithBuffer(1, time.Hour, b)
+	defer pipe.Close()
+
+	for i := 1; i <= 3; i++ {
+		require.True(t, pipe.Write(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	pipe.mu.Lock()
+	require.Nil(t, b.file.Truncate(0))
+	pipe.mu.Unlock()
+
+	var read int
+	for range pipe.Read() {
+		read++
+	}
+	assert.Less(t, read, 3)
+	assert.True(t, pipe.Overflowed())
+}
+
+func TestBufferedPipeSpillsToDisk(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, NewDiskPipeBuffer("", 100))
+	defer pipe.Close()
+
+	for i := 1; i <= 100; i++ {
+		require.True(t, pipe.Write(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	for i := 1; i <= 100; i++ {
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, strconv.Itoa(i), u.ID)
+	}
+}
@@ -0,0 +1,239 @@
+package hub
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPipeBufferFactory(t *testing.T) {
+	f, err := NewPipeBufferFactory("block", 0, "")
+	assert.Nil(t, err)
+	assert.Nil(t, f)
+
+	f, err = NewPipeBufferFactory("ring", 10, "")
+	assert.Nil(t, err)
+	assert.IsType(t, &RingPipeBuffer{}, f())
+
+	f, err = NewPipeBufferFactory("unbounded", 0, "")
+	assert.Nil(t, err)
+	assert.IsType(t, &ListPipeBuffer{}, f())
+
+	f, err = NewPipeBufferFactory("disk", 10, "")
+	assert.Nil(t, err)
+	assert.IsType(t, &DiskPipeBuffer{}, f())
+
+	_, err = NewPipeBufferFactory("disk", 0, "")
+	assert.EqualError(t, err, `invalid config: the "disk" buffer strategy requires a positive "update_buffer_overflow_size"`)
+
+	_, err = NewPipeBufferFactory("ring", 0, "")
+	assert.EqualError(t, err, `invalid config: the "ring" buffer strategy requires a positive "update_buffer_overflow_size"`)
+
+	_, err = NewPipeBufferFactory("invalid", 10, "")
+	assert.EqualError(t, err, `invalid config: "invalid": no such buffer strategy`)
+}
+
+func TestRingPipeBuffer(t *testing.T) {
+	b := NewRingPipeBuffer(3)
+	assert.Nil(t, b.Pop())
+
+	for i := 1; i <= 5; i++ {
+		assert.True(t, b.Push(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	assert.Equal(t, 3, b.Len())
+
+	for i := 3; i <= 5; i++ {
+		assert.Equal(t, strconv.Itoa(i), b.Pop().ID)
+	}
+	assert.Nil(t, b.Pop())
+
+	b.Push(&Update{})
+	b.Close()
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestListPipeBuffer(t *testing.T) {
+	b := NewListPipeBuffer()
+	assert.Nil(t, b.Pop())
+
+	for i := 1; i <= 5; i++ {
+		assert.True(t, b.Push(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	assert.Equal(t, 5, b.Len())
+	assert.Equal(t, "1", b.Pop().ID)
+
+	b.Close()
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestConflatingPipeBuffer(t *testing.T) {
+	b := NewConflatingPipeBuffer(3, func(u *Update) bool { return u.Topics[0] == "a" })
+	assert.Nil(t, b.Pop())
+
+	push := func(id, topic string) bool {
+		return b.Push(&Update{Topics: []string{topic}, Event: Event{ID: id}})
+	}
+
+	assert.True(t, push("1", "a"))
+	assert.True(t, push("2", "b"))
+	assert.True(t, push("3", "a"))
+	assert.True(t, push("4", "b"))
+	assert.True(t, push("5", "a"))
+	assert.Equal(t, 3, b.Len())
+	assert.False(t, push("6", "b"))
+
+	// The conflated update keeps the position of the first one
+	for _, id := range []string{"5", "2", "4"} {
+		assert.Equal(t, id, b.Pop().ID)
+	}
+	assert.Nil(t, b.Pop())
+
+	assert.True(t, push("7", "a"))
+	assert.Equal(t, "7", b.Pop().ID)
+
+	push("8", "a")
+	b.Close()
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestPipeConflate(t *testing.T) {
+	pipe := NewPipe(1, time.Hour)
+	defer pipe.Close()
+	pipe.Conflate(0, func(u *Update) bool { return u.Topics[0] == "a" })
+
+	// Block the pump until all updates are written
+	pipe.sendMu.Lock()
+	require.True(t, pipe.Write(&Update{Topics: []string{"b"}, Event: Event{ID: "1"}}))
+	require.True(t, pipe.Write(&Update{Topics: []string{"b"}, Event: Event{ID: "2"}}))
+	for i := 3; i <= 5; i++ {
+		require.True(t, pipe.Write(&Update{Topics: []string{"a"}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	pipe.sendMu.Unlock()
+
+	for _, id := range []string{"1", "2", "5"} {
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, id, u.ID)
+	}
+}
+
+func TestBufferedPipeDoesNotBlock(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, NewListPipeBuffer())
+	defer pipe.Close()
+
+	for i := 1; i <= 100; i++ {
+		require.True(t, pipe.Write(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+
+	for i := 1; i <= 100; i++ {
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, strconv.Itoa(i), u.ID)
+	}
+}
+
+func TestBufferedPipeDropsOldest(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, NewRingPipeBuffer(2))
+	defer pipe.Close()
+	_, ok := pipe.takeDropped()
+	assert.False(t, ok)
+
+	// Block the pump until all updates are written
+	pipe.sendMu.Lock()
+	for i := 1; i <= 5; i++ {
+		require.True(t, pipe.Write(&Update{Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	pipe.sendMu.Unlock()
+
+	for _, id := range []string{"1", "4", "5"} {
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, id, u.ID)
+	}
+	assert.Equal(t, uint64(2), pipe.Stats().Dropped)
+	_, ok = pipe.takeDropped()
+	assert.False(t, ok, "the dropped updates are only tracked for the subscribers")
+}
+
+func TestBufferedPipeTracksDropped(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, NewRingPipeBuffer(1))
+	defer pipe.Close()
+	pipe.trackDropped(func(u *Update) bool { return u.Topics[0] == "http://example.com/1" })
+
+	pipe.sendMu.Lock()
+	for i := 1; i <= 5; i++ {
+		require.True(t, pipe.Write(&Update{Topics: []string{"http://example.com/" + strconv.Itoa(i%2)}, Event: Event{ID: strconv.Itoa(i)}}))
+	}
+	pipe.sendMu.Unlock()
+
+	d, ok := pipe.takeDropped()
+	assert.True(t, ok)
+	assert.Equal(t, droppedUpdates{Count: 1, FirstID: "3", LastID: "3"}, d)
+	_, ok = pipe.takeDropped()
+	assert.False(t, ok)
+
+	for _, id := range []string{"1", "5"} {
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, id, u.ID)
+	}
+}
+
+// fullPipeBuffer never accepts updates.
+type fullPipeBuffer struct{ ListPipeBuffer }
+
+func (*fullPipeBuffer) Push(*Update) bool {
+	return false
+}
+
+func TestBufferedPipeFull(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, &fullPipeBuffer{*NewListPipeBuffer()})
+	defer pipe.Close()
+
+	assert.True(t, pipe.Write(&Update{Event: Event{ID: "1"}}))
+	assert.False(t, pipe.Write(&Update{Event: Event{ID: "2"}}))
+	assert.False(t, pipe.Write(&Update{Event: Event{ID: "3"}}))
+
+	u, ok := <-pipe.Read()
+	assert.True(t, ok)
+	assert.Equal(t, "1", u.ID)
+
+	_, ok = <-pipe.Read()
+	assert.False(t, ok)
+}
+
+func TestBufferedPipeCloseUpdates(t *testing.T) {
+	pipe := NewPipeWithBuffer(1, time.Hour, NewListPipeBuffer())
+	defer pipe.Close()
+
+	for i := 1; i <= 5; i++ {
+		require.True(t, pipe.Write(&Update{}))
+	}
+
+	pipe.closeUpdates()
+	pipe.closeUpdates()
+	assert.False(t, pipe.Write(&Update{}))
+}
+
+func TestTransportPipeBufferStrategy(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("transport_url", "null://")
+	v.Set("update_buffer_strategy", "unbounded")
+
+	transport, err := NewTransport(v)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+	assert.IsType(t, &ListPipeBuffer{}, pipe.buffer)
+
+	v.Set("update_buffer_strategy", "invalid")
+	_, err = NewTransport(v)
+	assert.EqualError(t, err, `invalid config: "invalid": no such buffer strategy`)
+}
@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pipeInfo describes the pipe of a subscriber connected to this node.
+type pipeInfo struct {
+	Subject string   `json:"subject,omitempty"`
+	Topics  []string `json:"topics"`
+	PipeStats
+}
+
+// pipeInfos returns the statistics of the pipes of the connected subscribers, the ones having the most pending updates first.
+func (c *connections) pipeInfos() []*pipeInfo {
+	c.Lock()
+	infos := make([]*pipeInfo, 0, len(c.pipes))
+	for s, p := range c.pipes {
+		infos = append(infos, &pipeInfo{Subject: s.Subject, Topics: s.Topics, PipeStats: p.Stats()})
+	}
+	c.Unlock()
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Pending() != infos[j].Pending() {
+			return infos[i].Pending() > infos[j].Pending()
+		}
+
+		return infos[i].Dropped > infos[j].Dropped
+	})
+
+	return infos
+}
+
+// pendingUpdates returns the total number of updates waiting in the pipes, and the largest number waiting in a single pipe.
+func (c *connections) pendingUpdates() (total, largest int) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, p := range c.pipes {
+		n := p.Stats().Pending()
+		total += n
+		if n > largest {
+			largest = n
+		}
+	}
+
+	return total, largest
+}
+
+// PipesHandler returns the occupancy of the pipes of the subscribers connected to this node, and the number of updates written to them and dropped,
+// to find the subscribers not consuming their updates fast enough.
+// A JWT having the "admin" Mercure claim, signed with the publisher key, must be passed in the Authorization header.
+func (h *Hub) PipesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), nil)
+	if err != nil || claims == nil || !claims.Mercure.Admin {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Instance string      `json:"instance"`
+		Pipes    []*pipeInfo `json:"pipes"`
+	}{h.instanceID, h.connections.pipeInfos()})
+}
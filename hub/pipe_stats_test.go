@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionsPipeInfos(t *testing.T) {
+	c := newConnections()
+
+	slow, fast := NewPipe(5, time.Second), NewPipe(5, time.Second)
+	c.add(&Subscriber{Subject: "slow", Topics: []string{"https://example.com/books/1"}}, slow)
+	c.add(&Subscriber{Subject: "fast", Topics: []string{"https://example.com/books/2"}}, fast)
+	c.add(&Subscriber{Subject: "no-pipe"}, nil)
+
+	slow.Write(&Update{})
+	slow.Write(&Update{})
+	fast.Write(&Update{})
+
+	infos := c.pipeInfos()
+	require.Len(t, infos, 2)
+	assert.Equal(t, "slow", infos[0].Subject)
+	assert.Equal(t, 2, infos[0].Queued)
+	assert.Equal(t, "fast", infos[1].Subject)
+
+	total, largest := c.pendingUpdates()
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 2, largest)
+}
+
+func TestPipesHandler(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	pipe := NewPipe(5, time.Second)
+	s := &Subscriber{Subject: "foo", Topics: []string{"https://example.com/books/1"}}
+	hub.connections.add(s, pipe)
+	pipe.Write(&Update{})
+
+	req := httptest.NewRequest("GET", defaultHubURL+"/admin/pipes", nil)
+	w := httptest.NewRecorder()
+	hub.PipesHandler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}))
+	w = httptest.NewRecorder()
+	hub.PipesHandler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("GET", defaultHubURL+"/admin/pipes", nil)
+	req.Header.Add("Authorization", "Bearer "+createAdminJWT(hub))
+	w = httptest.NewRecorder()
+	hub.PipesHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body struct {
+		Instance string `json:"instance"`
+		Pipes    []map[string]interface{}
+	}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, hub.instanceID, body.Instance)
+	require.Len(t, body.Pipes, 1)
+	assert.Equal(t, "foo", body.Pipes[0]["subject"])
+	assert.Equal(t, []interface{}{"https://example.com/books/1"}, body.Pipes[0]["topics"])
+	assert.Equal(t, 1.0, body.Pipes[0]["queued"])
+	assert.Equal(t, 5.0, body.Pipes[0]["capacity"])
+	assert.Equal(t, 1.0, body.Pipes[0]["written"])
+	assert.Equal(t, 0.0, body.Pipes[0]["dropped"])
+	assert.Contains(t, body.Pipes[0], "last_write")
+
+	hub.connections.remove(s)
+	w = httptest.NewRecorder()
+	hub.PipesHandler(w, req)
+	assert.JSONEq(t, `{"instance":"`+hub.instanceID+`","pipes":[]}`, w.Body.String())
+}
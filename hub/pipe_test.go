@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPipeReadWrite(t *testing.T) {
@@ -42,3 +43,109 @@ func TestPipeWriteClosed(t *testing.T) {
 
 	assert.False(t, pipe.Write(u))
 }
+
+func TestPipeOverflowed(t *testing.T) {
+	pipe := NewPipe(1, time.Millisecond)
+
+	assert.True(t, pipe.Write(&Update{}))
+	assert.False(t, pipe.Write(&Update{}))
+	assert.True(t, pipe.Overflowed())
+
+	pipe = NewPipe(1, time.Millisecond)
+	pipe.closeUpdates()
+	assert.False(t, pipe.Overflowed())
+}
+
+func TestPipeHoldLive(t *testing.T) {
+	pipe := NewPipe(5, time.Second)
+	pipe.holdLive(2)
+
+	assert.True(t, pipe.Write(&Update{Event: Event{ID: "live1"}}))
+	assert.True(t, pipe.writeHistory(&Update{Event: Event{ID: "history"}}))
+	assert.True(t, pipe.Write(&Update{Event: Event{ID: "live2"}}))
+	pipe.releaseLive()
+	assert.True(t, pipe.Write(&Update{Event: Event{ID: "live3"}}))
+
+	for _, id := range []string{"history", "live1", "live2", "live3"} {
+		assert.Equal(t, id, (<-pipe.Read()).ID)
+	}
+}
+
+func TestPipeHoldLiveOverflowed(t *testing.T) {
+	pipe := NewPipe(5, time.Second)
+	pipe.holdLive(1)
+
+	assert.True(t, pipe.Write(&Update{}))
+	assert.False(t, pipe.Write(&Update{}))
+	assert.True(t, pipe.Overflowed())
+
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+	pipe.releaseLive()
+}
+
+func TestPipeHoldLiveDisabled(t *testing.T) {
+	pipe := NewPipe(5, time.Second)
+	pipe.holdLive(0)
+
+	assert.True(t, pipe.Write(&Update{Event: Event{ID: "live"}}))
+	assert.True(t, pipe.writeHistory(&Update{Event: Event{ID: "history"}}))
+	assert.Equal(t, "live", (<-pipe.Read()).ID)
+}
+
+func TestPipeUnderMemoryPressure(t *testing.T) {
+	g, check := newTestMemoryGuard(t, nil)
+	check(200)
+
+	pipe := NewPipe(1, time.Hour)
+	pipe.setMemoryGuard(g)
+	assert.True(t, pipe.Write(&Update{}))
+	assert.False(t, pipe.Write(&Update{}))
+	assert.True(t, pipe.Overflowed())
+
+	// The buffer doesn't grow anymore
+	pipe = NewPipeWithBuffer(1, time.Hour, NewRingPipeBuffer(10))
+	pipe.setMemoryGuard(g)
+	assert.True(t, pipe.Write(&Update{}))
+	assert.False(t, pipe.Write(&Update{}))
+	assert.True(t, pipe.Overflowed())
+}
+
+func TestPipeStats(t *testing.T) {
+	pipe := NewPipe(2, time.Millisecond)
+	s := pipe.Stats()
+	assert.Equal(t, PipeStats{Capacity: 2}, s)
+	assert.Nil(t, s.LastWrite)
+
+	assert.True(t, pipe.Write(&Update{}))
+	s = pipe.Stats()
+	assert.Equal(t, 1, s.Queued)
+	assert.Equal(t, uint64(1), s.Written)
+	assert.WithinDuration(t, time.Now(), *s.LastWrite, time.Second)
+
+	assert.True(t, pipe.Write(&Update{}))
+	assert.False(t, pipe.Write(&Update{}))
+	s = pipe.Stats()
+	assert.Equal(t, uint64(2), s.Written)
+	assert.Equal(t, uint64(1), s.Dropped)
+	assert.True(t, s.Closed)
+	assert.True(t, s.Overflowed)
+	assert.Equal(t, 2, s.Pending())
+
+	pipe = NewPipeWithBuffer(1, time.Second, NewRingPipeBuffer(2))
+	for i := 0; i < 3; i++ {
+		assert.True(t, pipe.Write(&Update{}))
+	}
+	// The update moved by the pump is in neither the buffer nor the channel
+	require.Eventually(t, func() bool {
+		return pipe.Stats().Buffered == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, pipe.Stats().Queued)
+
+	pipe = NewPipe(5, time.Second)
+	pipe.holdLive(5)
+	assert.True(t, pipe.Write(&Update{}))
+	s = pipe.Stats()
+	assert.Equal(t, 1, s.Held)
+	assert.Equal(t, uint64(0), s.Written)
+}
@@ -0,0 +1,84 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// projection is a Go template transforming the JSON payloads of the updates, for subscribers needing only some fields of them (IoT, mobile...).
+type projection struct {
+	name     string
+	template *template.Template
+}
+
+// projections are the projections that subscribers can select using the "projection" query parameter, indexed by name.
+type projections map[string]*projection
+
+// newProjections parses the "projections" configuration parameter, formatted as "name=template".
+// The template is executed with the decoded JSON payload as data, the "json" function encodes a value as JSON.
+func newProjections(rules []string) (projections, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	p := make(projections, len(rules))
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(`%w: invalid "projections" rule %q, must be formatted as "name=template"`, ErrInvalidConfig, rule)
+		}
+
+		tpl, err := template.New(parts[0]).Option("missingkey=zero").Funcs(template.FuncMap{"json": projectionJSON}).Parse(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf(`%w: invalid "projections" rule %q: %v`, ErrInvalidConfig, rule, err)
+		}
+
+		p[parts[0]] = &projection{parts[0], tpl}
+	}
+
+	return p, nil
+}
+
+// apply returns the projected payload.
+func (p *projection) apply(data string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := p.template.Execute(&b, v); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// serialize serializes the update using the given format, with its payload projected if the projection isn't nil.
+// If the payload cannot be projected (it isn't JSON for instance), it is sent unchanged.
+func (p *projection) serialize(u *Update, f *eventFormat) *serializedUpdate {
+	if p == nil {
+		return newSerializedUpdate(u, f)
+	}
+
+	data, err := p.apply(u.Data)
+	if err != nil {
+		log.WithFields(log.Fields{"event_id": u.ID, "projection": p.name}).Warn(fmt.Errorf("projection: %w", err))
+		return newSerializedUpdate(u, f)
+	}
+
+	e := u.Event
+	e.Data = data
+
+	return &serializedUpdate{u, f.format(&e)}
+}
+
+func projectionJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+
+	return string(b), err
+}
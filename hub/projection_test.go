@@ -0,0 +1,64 @@
+package hub
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjections(t *testing.T) {
+	p, err := newProjections(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, p)
+
+	p, err = newProjections([]string{"light={{json .id}}", "name={{.name}}"})
+	require.Nil(t, err)
+	assert.Len(t, p, 2)
+	assert.Equal(t, "light", p["light"].name)
+
+	_, err = newProjections([]string{"light"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: invalid "projections" rule "light", must be formatted as "name=template"`)
+
+	_, err = newProjections([]string{"={{.id}}"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = newProjections([]string{"light={{.id"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestProjectionApply(t *testing.T) {
+	p, err := newProjections([]string{`light={"id":{{json .id}},"tags":{{json .tags}}}`, "missing={{.missing}}"})
+	require.Nil(t, err)
+
+	data, err := p["light"].apply(`{"id":1,"name":"foo","tags":["a","b"]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1,"tags":["a","b"]}`, data)
+
+	data, err = p["missing"].apply(`{"id":1}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "<no value>", data)
+
+	_, err = p["light"].apply("not JSON")
+	assert.Error(t, err)
+}
+
+func TestProjectionSerialize(t *testing.T) {
+	u := &Update{Event: Event{Data: `{"id":1,"name":"foo"}`, ID: "a", Type: "t"}}
+
+	var nilProjection *projection
+	assert.Equal(t, "event: t\nid: a\ndata: {\"id\":1,\"name\":\"foo\"}\n\n", nilProjection.serialize(u, nil).event)
+
+	p, err := newProjections([]string{"name={{.name}}\n{{.id}}"})
+	require.Nil(t, err)
+
+	s := p["name"].serialize(u, nil)
+	assert.Equal(t, "event: t\nid: a\ndata: foo\ndata: 1\n\n", s.event)
+	assert.Same(t, u, s.Update)
+	assert.Equal(t, `{"id":1,"name":"foo"}`, u.Data, "the update must not be modified")
+
+	u.Data = "not JSON"
+	assert.Equal(t, "event: t\nid: a\ndata: not JSON\n\n", p["name"].serialize(u, nil).event)
+}
@@ -0,0 +1,31 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PublicStatsHandler returns the number of subscribers to the topic passed in the "topic" query parameter, without authorization.
+// Only the topics matching the "public_stats_topics" selectors are allowed, to build "N people watching" widgets without exposing the subscriptions.
+// The count only includes the subscribers connected to this node.
+func (h *Hub) PublicStatsHandler(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "Missing \"topic\" parameter", http.StatusBadRequest)
+		return
+	}
+
+	if !topicSelectorsMatcher(h.config.GetStringSlice("public_stats_topics"))(topic) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// The widgets are usually embedded in other websites
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Topic       string `json:"topic"`
+		Subscribers int    `json:"subscribers"`
+	}{topic, h.connections.countTopic(topic)})
+}
@@ -0,0 +1,45 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/yosida95/uritemplate"
+)
+
+func publicStatsRequest(h *Hub, topic string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.PublicStatsHandler(w, httptest.NewRequest("GET", defaultHubURL+"/stats/public?topic="+url.QueryEscape(topic), nil))
+
+	return w
+}
+
+func TestPublicStats(t *testing.T) {
+	v := viper.New()
+	v.Set("public_stats_topics", []string{"https://example.com/books/{id}", "https://example.com/live"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	tpl := uritemplate.MustNew("https://example.com/books/{id}")
+	hub.connections.add(NewSubscriber(false, nil, []string{"https://example.com/books/{id}"}, nil, []*uritemplate.Template{tpl}, ""), nil)
+	hub.connections.add(NewSubscriber(false, nil, []string{"https://example.com/books/1"}, []string{"https://example.com/books/1"}, nil, ""), nil)
+	hub.connections.add(NewSubscriber(false, nil, []string{"https://example.com/secret"}, []string{"https://example.com/secret"}, nil, ""), nil)
+
+	w := publicStatsRequest(hub, "https://example.com/books/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, `{"topic":"https://example.com/books/1","subscribers":2}`+"\n", w.Body.String())
+
+	w = publicStatsRequest(hub, "https://example.com/live")
+	assert.Equal(t, `{"topic":"https://example.com/live","subscribers":0}`+"\n", w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, publicStatsRequest(hub, "https://example.com/secret").Code)
+
+	w = publicStatsRequest(hub, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Missing \"topic\" parameter\n", w.Body.String())
+}
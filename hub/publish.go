@@ -1,11 +1,13 @@
 package hub
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gofrs/uuid"
 	log "github.com/sirupsen/logrus"
@@ -13,16 +15,45 @@ import (
 
 var ErrTargetNotAuthorized = errors.New("target not authorized")
 
+// targetsNotAuthorizedError lists the targets the publisher isn't allowed to use.
+type targetsNotAuthorizedError []string
+
+func (e targetsNotAuthorizedError) Error() string {
+	return fmt.Sprintf("%q: %s", []string(e), ErrTargetNotAuthorized)
+}
+
+func (e targetsNotAuthorizedError) Unwrap() error {
+	return ErrTargetNotAuthorized
+}
+
 func (h *Hub) dispatch(u *Update) error {
 	if u.ID == "" {
 		u.ID = uuid.Must(uuid.NewV4()).String()
 	}
 
-	return h.transport.Write(u)
+	if h.chaos != nil {
+		h.chaos.delayWrite()
+	}
+
+	start := time.Now()
+	var err error
+	if h.retrier != nil {
+		err = h.retrier.Write(u)
+	} else {
+		err = h.transport.Write(u)
+	}
+	h.metrics.TransportWrite(time.Since(start), err)
+
+	return err
 }
 
 // PublishHandler allows publisher to broadcast updates to all subscribers.
 func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if h.rejectForMaintenance(w, false) {
+		return
+	}
+
 	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), h.config.GetStringSlice("publish_allowed_origins"))
 	if err != nil || claims == nil || claims.Mercure.Publish == nil {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
@@ -30,7 +61,23 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.ParseForm() != nil {
+	if err := decodeBody(r, h.config.GetInt64("publish_max_decompressed_size")); err != nil {
+		if errors.Is(err, ErrUnsupportedContentEncoding) {
+			http.Error(w, "Unsupported \"Content-Encoding\"", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		if errors.Is(err, ErrDecompressedBodyTooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
@@ -41,18 +88,85 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.namespaces != nil {
+		if err := h.namespaces.authorize(claims, topics); err != nil {
+			// Tell the publisher which topic it isn't allowed to use
+			http.Error(w, err.Error(), http.StatusForbidden)
+			log.WithFields(log.Fields{"remote_addr": r.RemoteAddr, "publisher": claims.Subject}).Info(err)
+			return
+		}
+	}
+
+	// A tombstone deletes a previous update, or all the previous updates of the canonical topic
+	tombstone := r.PostForm.Get("tombstone")
 	data := r.PostForm.Get("data")
+	if data == "" && tombstone != "" {
+		data = tombstoneData(tombstone, topics[0])
+	}
 	if data == "" {
 		http.Error(w, "Missing \"data\" parameter", http.StatusBadRequest)
 		return
 	}
 
-	targets, err := getAuthorizedTargets(claims, r.PostForm["target"])
-	if err != nil {
+	if h.validators != nil {
+		if data, err = h.validators.apply(r.Context(), topics, data); err != nil {
+			if errors.Is(err, ErrPayloadRejected) {
+				http.Error(w, "Payload rejected", http.StatusUnprocessableEntity)
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Error(err)
+			return
+		}
+	}
+
+	// The content type is checked against the data possibly rewritten by the validators
+	var contentType string
+	if p := r.PostForm.Get("content_type"); p != "" {
+		if contentType, err = normalizeContentType(p, data); err != nil {
+			if errors.Is(err, ErrContentTypeMismatch) {
+				http.Error(w, "The \"data\" parameter doesn't match the \"content_type\" parameter", http.StatusBadRequest)
+				return
+			}
+
+			http.Error(w, "Invalid \"content_type\" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	u := AcquireUpdate()
+	defer u.Release()
+
+	if err := addAuthorizedTargets(u.Targets, claims, r.PostForm["target"]); err != nil {
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+
+		var terr targetsNotAuthorizedError
+		if h.config.GetBool("debug") && errors.As(err, &terr) {
+			// Help to debug the integration by telling which targets aren't allowed
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(struct {
+				Error               string   `json:"error"`
+				UnauthorizedTargets []string `json:"unauthorized_targets"`
+			}{ErrTargetNotAuthorized.Error(), terr})
+
+			return
+		}
+
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
 
+	if h.resolver != nil {
+		if err := expandTargets(h.resolver, h.config.GetStringSlice("target_resolver_prefixes"), u.Targets); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Error(err)
+			return
+		}
+	}
+
 	var retry uint64
 	retryString := r.PostForm.Get("retry")
 	if retryString != "" {
@@ -63,10 +177,76 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	u := &Update{
-		Targets: targets,
-		Topics:  topics,
-		Event:   Event{data, r.PostForm.Get("id"), r.PostForm.Get("type"), retry},
+	var dryRun bool
+	if dryRunString := r.PostForm.Get("dry_run"); dryRunString != "" {
+		dryRun, err = strconv.ParseBool(dryRunString)
+		if err != nil {
+			http.Error(w, "Invalid \"dry_run\" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if ttlString := r.PostForm.Get("ttl"); ttlString != "" {
+		ttl, err = time.ParseDuration(ttlString)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "Invalid \"ttl\" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var latestOnly bool
+	if latestOnlyString := r.PostForm.Get("latest_only"); latestOnlyString != "" {
+		latestOnly, err = strconv.ParseBool(latestOnlyString)
+		if err != nil {
+			http.Error(w, "Invalid \"latest_only\" parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	eventType := r.PostForm.Get("type")
+	switch {
+	case tombstone != "":
+		eventType = tombstoneEventType
+	case eventType == "":
+		eventType = h.defaultEventType(topics)
+	}
+
+	u.Topics = append(u.Topics, topics...)
+	if len(h.topicHierarchy) > 0 {
+		u.Topics = addParentTopics(h.topicHierarchy, u.Topics)
+	}
+	u.Event = Event{data, r.PostForm.Get("id"), eventType, retry, contentType}
+	if ttl > 0 {
+		u.Expires = time.Now().Add(ttl)
+	}
+	u.LatestOnly = latestOnly
+	u.Tombstone = tombstone
+	u.Publisher = claims.Subject
+
+	if dryRun {
+		n := h.connections.count(u)
+		log.WithFields(h.createLogFields(r, u, nil)).WithFields(log.Fields{"subscribers": n}).Info("Update published in dry-run mode")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Subscribers int `json:"subscribers"`
+		}{n})
+
+		return
+	}
+
+	if h.coalescer != nil {
+		// The ID is returned to the publisher even if the update is coalesced
+		if u.ID == "" {
+			u.ID = uuid.Must(uuid.NewV4()).String()
+		}
+
+		if h.coalescer.hold(u) {
+			io.WriteString(w, u.ID)
+			log.WithFields(h.createLogFields(r, u, nil)).Info("Update coalesced")
+			return
+		}
 	}
 
 	// Broadcast the update
@@ -77,21 +257,58 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, u.ID)
 	log.WithFields(h.createLogFields(r, u, nil)).Info("Update published")
 
+	h.metrics.Publish(r, time.Since(start))
+	h.published(u)
+}
+
+// published updates the metrics and forwards the update to the optional features once it has been dispatched.
+func (h *Hub) published(u *Update) {
 	h.metrics.NewUpdate(u)
+	if h.recentUpdates != nil {
+		h.recentUpdates.add(u)
+	}
+	if h.mirror != nil {
+		h.mirror.publish(u)
+	}
+	for _, s := range h.sinks {
+		s.publish(u)
+	}
+	if h.topicTracker != nil {
+		h.topicTracker.publish(u.Topics)
+	}
 }
 
-func getAuthorizedTargets(claims *claims, t []string) (map[string]struct{}, error) {
+// addAuthorizedTargets adds the given targets to the targets map, or returns a targetsNotAuthorizedError listing the targets the publisher isn't allowed to use.
+func addAuthorizedTargets(targets map[string]struct{}, claims *claims, t []string) error {
 	authorizedAlltargets, authorizedTargets := authorizedTargets(claims, true)
-	targets := make(map[string]struct{}, len(t))
+
+	var denied targetsNotAuthorizedError
 	for _, t := range t {
 		if !authorizedAlltargets {
-			_, ok := authorizedTargets[t]
-			if !ok {
-				return nil, fmt.Errorf("%q: %w", t, ErrTargetNotAuthorized)
+			if _, ok := authorizedTargets[t]; !ok {
+				denied = append(denied, t)
+				continue
 			}
 		}
 		targets[t] = struct{}{}
 	}
 
-	return targets, nil
+	if len(denied) > 0 {
+		return denied
+	}
+
+	return nil
+}
+
+// defaultEventType returns the event type configured for the first "event_types" rule matching one of the given topics.
+func (h *Hub) defaultEventType(topics []string) string {
+	for _, rule := range h.eventTypes {
+		for _, topic := range topics {
+			if rule.matches(topic) {
+				return rule.eventType
+			}
+		}
+	}
+
+	return ""
 }
@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package hub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func FuzzPublishForm(f *testing.F) {
+	f.Add("topic=http%3A%2F%2Fexample.com%2Fbooks%2F1&data=foo", "application/x-www-form-urlencoded")
+	f.Add("topic=a&topic=b&data=foo&id=bar&type=baz&retry=10&private=on&target=t&ttl=1m&latest_only=1&dry_run=true", "application/x-www-form-urlencoded")
+	f.Add("topic=a&data=foo&retry=-1&ttl=0s", "application/x-www-form-urlencoded")
+	f.Add("topic=%zz&data=%", "application/x-www-form-urlencoded; charset=utf-8")
+	f.Add("--b\r\nContent-Disposition: form-data; name=\"topic\"\r\n\r\na\r\n--b--\r\n", "multipart/form-data; boundary=b")
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, body, contentType string) {
+		hub := createDummy()
+		defer hub.Stop()
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(body))
+		req.Header.Add("Content-Type", contentType)
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		if w.Code >= http.StatusInternalServerError {
+			t.Errorf("unexpected status code %d for %q", w.Code, body)
+		}
+	})
+}
+
+// signFuzzJWT signs the raw JSON payload with the publisher key of the dummy hub.
+func signFuzzJWT(payload string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	mac := hmac.New(sha256.New, []byte("publisher"))
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func FuzzPublishJWTClaims(f *testing.F) {
+	f.Add(`{"mercure":{"publish":["*"]}}`)
+	f.Add(`{"mercure":{"publish":["foo","bar"],"subscribe":["*"],"payload":{"foo":"bar"}}}`)
+	f.Add(`{"mercure":{"publish":"*"}}`)
+	f.Add(`{"mercure":{"publish":null},"exp":"tomorrow"}`)
+	f.Add(`{"mercure":[]}`)
+	f.Add(`{`)
+
+	f.Fuzz(func(t *testing.T, payload string) {
+		hub := createDummy()
+		defer hub.Stop()
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader("topic=http%3A%2F%2Fexample.com%2Fbooks%2F1&data=foo&target=foo"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+signFuzzJWT(payload))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		switch w.Code {
+		case http.StatusOK, http.StatusUnauthorized:
+		default:
+			t.Errorf("unexpected status code %d for %q", w.Code, payload)
+		}
+	})
+}
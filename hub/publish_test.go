@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -8,10 +9,14 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gofrs/uuid"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yosida95/uritemplate"
 )
 
 func TestNoAuthorizationHeader(t *testing.T) {
@@ -130,6 +135,167 @@ func TestPublishInvalidRetry(t *testing.T) {
 	assert.Equal(t, "Invalid \"retry\" parameter\n", w.Body.String())
 }
 
+func TestPublishInvalidTTL(t *testing.T) {
+	hub := createDummy()
+
+	for _, ttl := range []string{"invalid", "-1s"} {
+		form := url.Values{}
+		form.Add("topic", "http://example.com/books/1")
+		form.Add("data", "foo")
+		form.Add("ttl", ttl)
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Invalid \"ttl\" parameter\n", w.Body.String())
+	}
+}
+
+func TestPublishInvalidLatestOnly(t *testing.T) {
+	hub := createDummy()
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+	form.Add("latest_only", "invalid")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"latest_only\" parameter\n", w.Body.String())
+}
+
+func TestPublishTTLAndLatestOnly(t *testing.T) {
+	hub := createDummy()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+	form.Add("ttl", "1m")
+	form.Add("latest_only", "1")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+	before := time.Now()
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	u := <-pipe.Read()
+	assert.True(t, u.LatestOnly)
+	assert.WithinDuration(t, before.Add(time.Minute), u.Expires, time.Second)
+	u.Release()
+}
+
+func TestPublishContentType(t *testing.T) {
+	hub := createDummy()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	publish := func(contentType, data string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Add("topic", "http://example.com/books/1")
+		form.Add("data", data)
+		form.Add("content_type", contentType)
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w := publish("Application/JSON; Charset=UTF-8", `{"title": "Dune"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	u := <-pipe.Read()
+	assert.Equal(t, "application/json; charset=UTF-8", u.ContentType)
+	u.Release()
+
+	w = publish("application/json", "Dune")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "The \"data\" parameter doesn't match the \"content_type\" parameter\n", w.Body.String())
+
+	w = publish("json", "{}")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"content_type\" parameter\n", w.Body.String())
+}
+
+func TestPublishDryRun(t *testing.T) {
+	hub := createDummy()
+
+	topics := []string{"http://example.com/books/{id}"}
+	hub.connections.add(NewSubscriber(false, map[string]struct{}{"foo": {}}, topics, nil, []*uritemplate.Template{uritemplate.MustNew(topics[0])}, ""), nil)
+	hub.connections.add(NewSubscriber(false, map[string]struct{}{"bar": {}}, topics, nil, []*uritemplate.Template{uritemplate.MustNew(topics[0])}, ""), nil)
+	hub.connections.add(NewSubscriber(true, nil, []string{"http://example.com/authors/1"}, []string{"http://example.com/authors/1"}, nil, ""), nil)
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+	form.Add("target", "foo")
+	form.Add("dry_run", "1")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"foo"}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"subscribers": 1}`, w.Body.String())
+
+	// The update isn't dispatched
+	select {
+	case <-pipe.Read():
+		t.Fatal("the update must not be dispatched")
+	default:
+	}
+}
+
+func TestPublishInvalidDryRun(t *testing.T) {
+	hub := createDummy()
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+	form.Add("dry_run", "invalid")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"dry_run\" parameter\n", w.Body.String())
+}
+
 func TestPublishNotAuthorizedTarget(t *testing.T) {
 	hub := createDummy()
 
@@ -149,12 +315,53 @@ func TestPublishNotAuthorizedTarget(t *testing.T) {
 	defer resp.Body.Close()
 
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusUnauthorized)+"\n", w.Body.String())
+}
+
+func TestPublishNotAuthorizedTargetDebug(t *testing.T) {
+	hub := createDummy()
+	hub.config.Set("debug", true)
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+	form.Add("target", "foo")
+	form.Add("target", "not-allowed")
+	form.Add("target", "bar")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"foo"}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"target not authorized","unauthorized_targets":["not-allowed","bar"]}`, w.Body.String())
+}
+
+func TestAddAuthorizedTargets(t *testing.T) {
+	targets := make(map[string]struct{})
+	c := &claims{Mercure: mercureClaim{Publish: []string{"foo"}}}
+
+	err := addAuthorizedTargets(targets, c, []string{"foo", "bar", "baz"})
+	assert.True(t, errors.Is(err, ErrTargetNotAuthorized))
+	assert.Equal(t, targetsNotAuthorizedError{"bar", "baz"}, err)
+	assert.EqualError(t, err, `["bar" "baz"]: target not authorized`)
+
+	c.Mercure.Publish = []string{"*"}
+	assert.Nil(t, addAuthorizedTargets(targets, c, []string{"bar"}))
+	assert.Equal(t, map[string]struct{}{"foo": {}, "bar": {}}, targets)
 }
 
 func TestPublishOK(t *testing.T) {
 	hub := createDummy()
 
-	pipe, err := hub.transport.CreatePipe("")
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 
@@ -199,7 +406,7 @@ func TestPublishOK(t *testing.T) {
 func TestPublishGenerateUUID(t *testing.T) {
 	hub := createDummy()
 
-	pipe, err := hub.transport.CreatePipe("")
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
 	assert.Nil(t, err)
 	require.NotNil(t, pipe)
 
@@ -270,3 +477,112 @@ func TestPublishWithErrorInTransport(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Equal(t, "id", string(body))
 }
+
+func TestPublishDefaultEventType(t *testing.T) {
+	v := viper.New()
+	v.Set("event_types", []string{"book.updated=http://example.com/books/{id}", "other=http://example.com/books/1"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		u, ok := <-pipe.Read()
+		assert.True(t, ok)
+		require.NotNil(t, u)
+		assert.Equal(t, "book.updated", u.Type)
+
+		u, ok = <-pipe.Read()
+		assert.True(t, ok)
+		require.NotNil(t, u)
+		assert.Equal(t, "custom", u.Type)
+
+		u, ok = <-pipe.Read()
+		assert.True(t, ok)
+		require.NotNil(t, u)
+		assert.Equal(t, "", u.Type)
+	}()
+
+	for _, f := range []url.Values{
+		{"topic": {"http://example.com/books/1"}, "data": {"Hello!"}},
+		{"topic": {"http://example.com/books/1"}, "data": {"Hello!"}, "type": {"custom"}},
+		{"topic": {"http://example.com/reviews/1"}, "data": {"Hello!"}},
+	} {
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(f.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	}
+
+	wg.Wait()
+}
+
+func TestPublishRecordsPublisher(t *testing.T) {
+	hub := createDummy()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Claims = &claims{Mercure: mercureClaim{Publish: []string{}}, StandardClaims: jwt.StandardClaims{Subject: "billing-service"}}
+	tokenString, _ := token.SignedString(hub.getJWTKey(publisherRole))
+
+	form := url.Values{}
+	form.Add("topic", "http://example.com/books/1")
+	form.Add("data", "foo")
+
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	u := <-pipe.Read()
+	assert.Equal(t, "billing-service", u.Publisher)
+	assert.NotContains(t, u.String(), "billing-service")
+	u.Release()
+}
+
+func TestPublishTombstone(t *testing.T) {
+	hub := createDummy()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	assert.Nil(t, err)
+	require.NotNil(t, pipe)
+
+	publish := func(form url.Values) {
+		form.Add("topic", "http://example.com/books/1")
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	publish(url.Values{"tombstone": {"urn:uuid:1"}, "type": {"book"}})
+	u := <-pipe.Read()
+	assert.Equal(t, "urn:uuid:1", u.Tombstone)
+	assert.Equal(t, tombstoneEventType, u.Type)
+	assert.Equal(t, `{"id":"urn:uuid:1"}`, u.Data)
+	u.Release()
+
+	publish(url.Values{"tombstone": {"*"}, "data": {"published by mistake"}})
+	u = <-pipe.Read()
+	assert.Equal(t, "*", u.Tombstone)
+	assert.Equal(t, tombstoneEventType, u.Type)
+	assert.Equal(t, "published by mistake", u.Data)
+	u.Release()
+}
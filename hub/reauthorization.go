@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ErrReauthorization is returned when the authorization of a subscriber cannot be re-evaluated.
+var ErrReauthorization = errors.New("subscriber reauthorization failed")
+
+// subscriberAuthorizer re-evaluates the authorization of the connected subscribers by querying an HTTP endpoint,
+// so the revoked entitlements take effect on the long-lived connections.
+// The subject of the subscriber is passed in the "subject" query parameter and its topics in the "topic" ones.
+// The endpoint must return a 2xx status code if the subscriber is still authorized, and 401 or 403 if it must be disconnected.
+type subscriberAuthorizer struct {
+	url    *url.URL
+	client *http.Client
+	// interval is the minimum duration between two checks of the same connection
+	interval time.Duration
+}
+
+// newSubscriberAuthorizer creates the authorizer configured by the "subscriber_authorization_url" parameter, or returns nil if it isn't set.
+func newSubscriberAuthorizer(v *viper.Viper) (*subscriberAuthorizer, error) {
+	authorizationURL, err := getSecret(v, "subscriber_authorization_url")
+	if err != nil || authorizationURL == "" {
+		return nil, err
+	}
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf(`%w: invalid "subscriber_authorization_url" parameter %q`, ErrInvalidConfig, authorizationURL)
+	}
+
+	interval := v.GetDuration("subscriber_authorization_interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf(`%w: the "subscriber_authorization_interval" parameter must be positive`, ErrInvalidConfig)
+	}
+
+	return &subscriberAuthorizer{u, &http.Client{Timeout: 5 * time.Second}, interval}, nil
+}
+
+// authorize returns false if the subscriber isn't authorized anymore.
+func (a *subscriberAuthorizer) authorize(s *Subscriber) (bool, error) {
+	u := *a.url
+	q := u.Query()
+	q.Set("subject", s.Subject)
+	for _, topic := range s.Topics {
+		q.Add("topic", topic)
+	}
+	u.RawQuery = q.Encode()
+
+	resp, err := a.client.Get(u.String())
+	if err != nil {
+		return true, fmt.Errorf("%q: %s: %w", s.Subject, err, ErrReauthorization)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return true, fmt.Errorf("%q: unexpected status code %d: %w", s.Subject, resp.StatusCode, ErrReauthorization)
+	}
+
+	return true, nil
+}
+
+// reauthorize returns false if the subscriber must be disconnected because its authorization has been revoked.
+// The subscriber stays connected if the authorization endpoint fails.
+func (h *Hub) reauthorize(s *Subscriber) bool {
+	authorized, err := h.authorizer.authorize(s)
+	if err != nil {
+		log.WithFields(log.Fields{"subscriber_topics": s.Topics}).Error(err)
+		return true
+	}
+	if !authorized {
+		log.WithFields(log.Fields{"subscriber_topics": s.Topics, "subscriber_subject": s.Subject}).Info("Subscriber authorization revoked")
+	}
+
+	return authorized
+}
@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func createAuthorizationEndpoint(revoked *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("subject") == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case revoked.Load() || r.URL.Query().Get("subject") == "revoked":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+}
+
+func TestNewSubscriberAuthorizer(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+	a, err := newSubscriberAuthorizer(v)
+	assert.Nil(t, a)
+	assert.Nil(t, err)
+
+	v.Set("subscriber_authorization_url", "ftp://example.com")
+	_, err = newSubscriberAuthorizer(v)
+	assert.EqualError(t, err, `invalid config: invalid "subscriber_authorization_url" parameter "ftp://example.com"`)
+
+	v.Set("subscriber_authorization_url", "https://example.com/authorize")
+	v.Set("subscriber_authorization_interval", time.Duration(0))
+	_, err = newSubscriberAuthorizer(v)
+	assert.EqualError(t, err, `invalid config: the "subscriber_authorization_interval" parameter must be positive`)
+}
+
+func TestSubscriberAuthorizer(t *testing.T) {
+	var revoked atomic.Bool
+	ts := createAuthorizationEndpoint(&revoked)
+	defer ts.Close()
+
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("subscriber_authorization_url", ts.URL)
+	a, err := newSubscriberAuthorizer(v)
+	require.Nil(t, err)
+	assert.Equal(t, 5*time.Minute, a.interval)
+
+	authorized, err := a.authorize(&Subscriber{Subject: "alice", Topics: []string{"https://example.com/books/1"}})
+	assert.True(t, authorized)
+	assert.Nil(t, err)
+
+	authorized, err = a.authorize(&Subscriber{Subject: "revoked"})
+	assert.False(t, authorized)
+	assert.Nil(t, err)
+
+	// The subscriber stays connected when the endpoint fails
+	authorized, err = a.authorize(&Subscriber{Subject: "broken"})
+	assert.True(t, authorized)
+	assert.EqualError(t, err, `"broken": unexpected status code 500: subscriber reauthorization failed`)
+}
+
+func TestSubscribeReauthorization(t *testing.T) {
+	var revoked atomic.Bool
+	ts := createAuthorizationEndpoint(&revoked)
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("subscriber_authorization_url", ts.URL)
+	v.Set("subscriber_authorization_interval", time.Nanosecond)
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic="+url.QueryEscape("https://example.com/books/1"), nil))
+	}()
+
+	require.Eventually(t, func() bool {
+		return hub.connections.activeCount() == 1
+	}, time.Second, time.Millisecond)
+
+	hub.transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "d1"}})
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(hub.metrics.subscriberBytes) > 0
+	}, time.Second, time.Millisecond)
+
+	revoked.Store(true)
+	hub.transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "b", Data: "d2"}})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber hasn't been disconnected")
+	}
+	assert.Equal(t, ": instance hub-test\nid: a\ndata: d1\n\nevent: mercure-disconnect\ndata: {\"reason\":\"revoked\",\"last_event_id\":\"a\"}\n\n", w.Body.String())
+}
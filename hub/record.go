@@ -0,0 +1,157 @@
+package hub
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+// Updates stored by the transports are wrapped in a versioned envelope, so partial writes and corruptions are detected record by record:
+//
+//	version (1 byte) | encoding (1 byte) | length of the payload (4 bytes) | CRC-32C of the payload (4 bytes) | payload
+//
+// The payload is the JSON document of the update, compressed according to the encoding. The length and the checksum are the ones of the stored payload.
+// When the encrypted flag of the encoding is set, the compressed document is encrypted with AES-GCM, and the payload is the nonce followed by the ciphertext.
+// Records stored by older versions of the hub are plain JSON documents, they are still readable.
+const (
+	recordVersion             = 1
+	recordEncodingJSON        = 0
+	recordEncodingJSONDeflate = 1
+	recordEncodingEncrypted   = 0x80
+	recordHeaderSize          = 10
+)
+
+// ErrCorruptedRecord is returned when a stored update cannot be decoded.
+var ErrCorruptedRecord = errors.New("corrupted record")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli) //nolint:gochecknoglobals
+
+// newRecordCipher creates the cipher encrypting the records from a base64-encoded AES key of 16, 24 or 32 bytes.
+func newRecordCipher(key string) (cipher.AEAD, error) {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encodeRecord serializes the update in a record.
+func encodeRecord(u *Update) ([]byte, error) {
+	return encodeRecordAs(u, recordEncodingJSON, nil)
+}
+
+// encodeRecordAs serializes the update in a record using the given encoding, and encrypts it if aead isn't nil.
+func encodeRecordAs(u *Update, encoding byte, aead cipher.AEAD) ([]byte, error) {
+	payload, err := json.Marshal(*u)
+	if err != nil {
+		return nil, err
+	}
+
+	switch encoding {
+	case recordEncodingJSON:
+	case recordEncodingJSONDeflate:
+		var b bytes.Buffer
+		w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+		w.Write(payload)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		payload = b.Bytes()
+	default:
+		return nil, fmt.Errorf("unsupported record encoding %d", encoding)
+	}
+
+	if aead != nil {
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		payload = aead.Seal(nonce, nonce, payload, nil)
+		encoding |= recordEncodingEncrypted
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	record[0] = recordVersion
+	record[1] = encoding
+	binary.BigEndian.PutUint32(record[2:6], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[6:10], crc32.Checksum(payload, crc32cTable))
+
+	return append(record, payload...), nil
+}
+
+// decodeRecord deserializes the update contained in a record, or in a plain JSON document stored by older versions.
+func decodeRecord(data []byte) (*Update, error) {
+	return decodeRecordWith(data, nil)
+}
+
+// decodeRecordWith deserializes the update contained in a record, decrypting it with aead if it is encrypted.
+func decodeRecordWith(data []byte, aead cipher.AEAD) (*Update, error) {
+	payload := data
+	if len(data) == 0 || data[0] != '{' {
+		var encoding byte
+		if len(data) > 1 {
+			encoding = data[1] &^ recordEncodingEncrypted
+		}
+
+		switch {
+		case len(data) < recordHeaderSize:
+			return nil, fmt.Errorf("%w: truncated header", ErrCorruptedRecord)
+		case data[0] != recordVersion:
+			return nil, fmt.Errorf("%w: unsupported version %d", ErrCorruptedRecord, data[0])
+		case encoding != recordEncodingJSON && encoding != recordEncodingJSONDeflate:
+			return nil, fmt.Errorf("%w: unsupported encoding %d", ErrCorruptedRecord, data[1])
+		}
+
+		payload = data[recordHeaderSize:]
+		if length := binary.BigEndian.Uint32(data[2:6]); uint64(length) != uint64(len(payload)) {
+			return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrCorruptedRecord, length, len(payload))
+		}
+		if crc32.Checksum(payload, crc32cTable) != binary.BigEndian.Uint32(data[6:10]) {
+			return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptedRecord)
+		}
+
+		if data[1]&recordEncodingEncrypted != 0 {
+			if aead == nil {
+				return nil, fmt.Errorf("%w: encrypted record, no key configured", ErrCorruptedRecord)
+			}
+			if len(payload) < aead.NonceSize() {
+				return nil, fmt.Errorf("%w: truncated nonce", ErrCorruptedRecord)
+			}
+
+			var err error
+			if payload, err = aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrCorruptedRecord, err)
+			}
+		}
+
+		if encoding == recordEncodingJSONDeflate {
+			var err error
+			if payload, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(payload))); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrCorruptedRecord, err)
+			}
+		}
+	}
+
+	var update *Update
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorruptedRecord, err)
+	}
+
+	return update, nil
+}
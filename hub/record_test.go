@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	u := &Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "id", Data: "data"}, Time: time.Unix(1, 0).UTC(), Publisher: "publisher"}
+
+	record, err := encodeRecord(u)
+	require.Nil(t, err)
+	assert.Equal(t, byte(recordVersion), record[0])
+	assert.Equal(t, byte(recordEncodingJSON), record[1])
+
+	decoded, err := decodeRecord(record)
+	require.Nil(t, err)
+	assert.Equal(t, u.Topics, decoded.Topics)
+	assert.Equal(t, u.Event, decoded.Event)
+	assert.True(t, u.Time.Equal(decoded.Time))
+	assert.Equal(t, "publisher", decoded.Publisher)
+}
+
+func TestDeflateRecord(t *testing.T) {
+	u := &Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "id", Data: strings.Repeat("data", 100)}}
+
+	record, err := encodeRecordAs(u, recordEncodingJSONDeflate, nil)
+	require.Nil(t, err)
+	assert.Equal(t, byte(recordEncodingJSONDeflate), record[1])
+
+	uncompressed, _ := encodeRecord(u)
+	assert.Less(t, len(record), len(uncompressed))
+
+	decoded, err := decodeRecord(record)
+	require.Nil(t, err)
+	assert.Equal(t, u.Event, decoded.Event)
+
+	// The checksum is valid, but the payload isn't a deflate stream
+	uncompressed[1] = recordEncodingJSONDeflate
+	_, err = decodeRecord(uncompressed)
+	assert.True(t, errors.Is(err, ErrCorruptedRecord))
+
+	_, err = encodeRecordAs(u, 9, nil)
+	assert.EqualError(t, err, "unsupported record encoding 9")
+}
+
+func TestEncryptedRecord(t *testing.T) {
+	aead, err := newRecordCipher(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	require.Nil(t, err)
+
+	u := &Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "id", Data: "secret data"}}
+	for _, encoding := range []byte{recordEncodingJSON, recordEncodingJSONDeflate} {
+		record, err := encodeRecordAs(u, encoding, aead)
+		require.Nil(t, err)
+		assert.Equal(t, encoding|recordEncodingEncrypted, record[1])
+		assert.NotContains(t, string(record), "secret data")
+
+		decoded, err := decodeRecordWith(record, aead)
+		require.Nil(t, err)
+		assert.Equal(t, u.Event, decoded.Event)
+
+		_, err = decodeRecord(record)
+		assert.EqualError(t, err, "corrupted record: encrypted record, no key configured")
+
+		other, _ := newRecordCipher(base64.StdEncoding.EncodeToString([]byte("fedcba9876543210")))
+		_, err = decodeRecordWith(record, other)
+		assert.True(t, errors.Is(err, ErrCorruptedRecord))
+	}
+
+	// Unencrypted records are still readable
+	record, _ := encodeRecord(u)
+	decoded, err := decodeRecordWith(record, aead)
+	require.Nil(t, err)
+	assert.Equal(t, u.Event, decoded.Event)
+}
+
+func TestNewRecordCipher(t *testing.T) {
+	_, err := newRecordCipher("not base64")
+	assert.NotNil(t, err)
+
+	_, err = newRecordCipher(base64.StdEncoding.EncodeToString([]byte("too short")))
+	assert.NotNil(t, err)
+}
+
+func TestDecodeLegacyRecord(t *testing.T) {
+	decoded, err := decodeRecord([]byte(`{"Topics":["https://example.com/books/1"],"ID":"id"}`))
+	require.Nil(t, err)
+	assert.Equal(t, "id", decoded.ID)
+
+	_, err = decodeRecord([]byte(`{"Topics":`))
+	assert.True(t, errors.Is(err, ErrCorruptedRecord))
+}
+
+func TestDecodeCorruptedRecord(t *testing.T) {
+	record, _ := encodeRecord(&Update{Event: Event{ID: "id", Data: "data"}})
+
+	corrupt := func(f func(r []byte) []byte) []byte {
+		return f(append([]byte(nil), record...))
+	}
+
+	length := len(record) - recordHeaderSize
+	for expected, data := range map[string][]byte{
+		"corrupted record: truncated header":                                         record[:5],
+		"corrupted record: unsupported version 2":                                    corrupt(func(r []byte) []byte { r[0] = 2; return r }),
+		"corrupted record: unsupported encoding 9":                                   corrupt(func(r []byte) []byte { r[1] = 9; return r }),
+		fmt.Sprintf("corrupted record: expected %d bytes, got %d", length, length-1): corrupt(func(r []byte) []byte { return r[:len(r)-1] }),
+		"corrupted record: checksum mismatch":                                        corrupt(func(r []byte) []byte { r[len(r)-2] = 'X'; return r }),
+	} {
+		_, err := decodeRecord(data)
+		assert.EqualError(t, err, expected)
+		assert.True(t, errors.Is(err, ErrCorruptedRecord))
+	}
+}
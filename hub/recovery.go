@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recentUpdates keeps the last published updates in a ring buffer, they are included in the diagnostics bundles.
+type recentUpdates struct {
+	sync.Mutex
+	updates []tailedUpdate
+	next    int
+	full    bool
+}
+
+// newRecentUpdates creates a ring buffer, or returns nil if size isn't positive.
+func newRecentUpdates(size int) *recentUpdates {
+	if size <= 0 {
+		return nil
+	}
+
+	return &recentUpdates{updates: make([]tailedUpdate, size)}
+}
+
+func (r *recentUpdates) add(u *Update) {
+	t := newTailedUpdate(u)
+	// The update may be reused once released
+	t.Topics = append([]string(nil), u.Topics...)
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.updates[r.next] = t
+	if r.next++; r.next == len(r.updates) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot returns the updates, from the oldest to the most recent.
+func (r *recentUpdates) snapshot() []tailedUpdate {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.full {
+		return append([]tailedUpdate{}, r.updates[:r.next]...)
+	}
+
+	return append(append([]tailedUpdate{}, r.updates[r.next:]...), r.updates[:r.next]...)
+}
+
+// diagnosticsBundle contains the state of the hub when a panic occurred, for postmortem analysis.
+type diagnosticsBundle struct {
+	Time          time.Time      `json:"time"`
+	Request       string         `json:"request"`
+	Panic         string         `json:"panic"`
+	Stack         string         `json:"stack"`
+	Goroutines    string         `json:"goroutines"`
+	RecentUpdates []tailedUpdate `json:"recent_updates"`
+}
+
+// recoveryHandler recovers from the panics occurring in the handlers: the stack trace is logged, a metric is collected and a 500 error is returned.
+// If the "diagnostics_dir" configuration parameter is set, a diagnostics bundle is written in this directory too.
+func (h *Hub) recoveryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Sentinel value used to abort the request silently
+				panic(err)
+			}
+
+			stack := string(debug.Stack())
+			fields := log.Fields{"remote_addr": r.RemoteAddr, "method": r.Method, "path": r.URL.Path, "stack": stack}
+
+			h.metrics.Panic()
+			if dir := h.config.GetString("diagnostics_dir"); dir != "" {
+				path, werr := h.writeDiagnosticsBundle(dir, r, err, stack, time.Now())
+				if werr != nil {
+					log.Error(fmt.Errorf("diagnostics bundle: %w", werr))
+				} else {
+					fields["diagnostics_bundle"] = path
+				}
+			}
+			log.WithFields(fields).Error(fmt.Errorf("panic: %v", err))
+
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeDiagnosticsBundle writes the bundle as a JSON document in the given directory, and returns its path.
+func (h *Hub) writeDiagnosticsBundle(dir string, r *http.Request, err interface{}, stack string, now time.Time) (string, error) {
+	var goroutines bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&goroutines, 2)
+
+	b := diagnosticsBundle{
+		Time:       now.UTC(),
+		Request:    r.Method + " " + r.URL.Path,
+		Panic:      fmt.Sprint(err),
+		Stack:      stack,
+		Goroutines: goroutines.String(),
+	}
+	if h.recentUpdates != nil {
+		b.RecentUpdates = h.recentUpdates.snapshot()
+	}
+
+	data, jerr := json.MarshalIndent(b, "", "  ")
+	if jerr != nil {
+		return "", jerr
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("mercure-diagnostics-%s.json", now.UTC().Format("20060102T150405.000000000Z")))
+
+	return path, ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,104 @@
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentUpdates(t *testing.T) {
+	assert.Nil(t, newRecentUpdates(0))
+
+	r := newRecentUpdates(2)
+	assert.Empty(t, r.snapshot())
+
+	for i := 1; i <= 3; i++ {
+		u := AcquireUpdate()
+		u.Topics = append(u.Topics, "https://example.com/books/"+strconv.Itoa(i))
+		u.ID = strconv.Itoa(i)
+		r.add(u)
+		u.Release()
+	}
+
+	s := r.snapshot()
+	require.Len(t, s, 2)
+	assert.Equal(t, "2", s[0].ID)
+	assert.Equal(t, []string{"https://example.com/books/2"}, s[0].Topics)
+	assert.Equal(t, "3", s[1].ID)
+	assert.Equal(t, []string{"https://example.com/books/3"}, s[1].Topics)
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	h := createDummy()
+	handler := h.recoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", defaultHubURL, nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError)+"\n", w.Body.String())
+	assert.Equal(t, 1.0, testutil.ToFloat64(h.metrics.panics))
+	assert.Equal(t, "panic: boom", hook.LastEntry().Message)
+	assert.Contains(t, hook.LastEntry().Data["stack"], "recovery_test.go")
+	assert.NotContains(t, hook.LastEntry().Data, "diagnostics_bundle")
+
+	// The sentinel used to abort requests is propagated
+	abort := h.recoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", defaultHubURL, nil))
+	})
+}
+
+func TestRecoveryHandlerDiagnosticsBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-diagnostics")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	h := createDummy()
+	h.config.Set("diagnostics_dir", dir)
+	h.recentUpdates = newRecentUpdates(10)
+	h.recentUpdates.add(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "d1"}})
+
+	handler := h.recoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", defaultHubURL, nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "mercure-diagnostics-*.json"))
+	require.Len(t, files, 1)
+	assert.Equal(t, files[0], hook.LastEntry().Data["diagnostics_bundle"])
+
+	data, err := ioutil.ReadFile(files[0])
+	require.Nil(t, err)
+
+	var b diagnosticsBundle
+	require.Nil(t, json.Unmarshal(data, &b))
+	assert.Equal(t, "POST "+defaultHubURL, b.Request)
+	assert.Equal(t, "boom", b.Panic)
+	assert.Contains(t, b.Stack, "recovery_test.go")
+	assert.Contains(t, b.Goroutines, "goroutine")
+	require.Len(t, b.RecentUpdates, 1)
+	assert.Equal(t, "a", b.RecentUpdates[0].ID)
+}
@@ -0,0 +1,414 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRelayReconnectDelay    = time.Second
+	defaultRelayMaxReconnectDelay = 30 * time.Second
+)
+
+// RelayTransport implements the TransportInterface by chaining the hub to an upstream hub.
+// Updates are published to the upstream hub, and the updates of the mirrored topics are received through a subscription to the upstream hub.
+// Server-sent events don't include the topics and the targets: the mirrored updates are dispatched in the topic used to subscribe to them, with the targets configured in the DSN.
+type RelayTransport struct {
+	sync.RWMutex
+	hubURL            *url.URL
+	client            *http.Client
+	topics            []string
+	targets           []string
+	subscriberJWT     string
+	publisherJWT      string
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	pipes             map[*Pipe]struct{}
+	done              chan struct{}
+	cancel            context.CancelFunc
+	bufferSize        int
+	bufferFullTimeout time.Duration
+	pipeBufferFactory PipeBufferFactory
+}
+
+// NewRelayTransport create a new RelayTransport.
+// The "mercure" scheme connects to the upstream hub using HTTPS (or HTTP if the "tls" parameter is set to 0), the "mercure+unix" scheme connects through a Unix socket.
+func NewRelayTransport(u *url.URL, bufferSize int, bufferFullTimeout time.Duration) (*RelayTransport, error) {
+	var err error
+	q := u.Query()
+
+	topics := q["topic"]
+	if len(topics) == 0 {
+		return nil, fmt.Errorf(`%q: missing "topic" parameter: %w`, redactDSN(u), ErrInvalidTransportDSN)
+	}
+
+	reconnectDelay := defaultRelayReconnectDelay
+	if p := q.Get("reconnect_delay"); p != "" {
+		if reconnectDelay, err = time.ParseDuration(p); err != nil || reconnectDelay <= 0 {
+			return nil, fmt.Errorf(`%q: invalid "reconnect_delay" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	maxReconnectDelay := defaultRelayMaxReconnectDelay
+	if p := q.Get("max_reconnect_delay"); p != "" {
+		if maxReconnectDelay, err = time.ParseDuration(p); err != nil || maxReconnectDelay < reconnectDelay {
+			return nil, fmt.Errorf(`%q: invalid "max_reconnect_delay" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	hubURL, client, err := relayHubURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriberJWT, publisherJWT := q.Get("jwt"), q.Get("jwt")
+	if p := q.Get("subscriber_jwt"); p != "" {
+		subscriberJWT = p
+	}
+	if p := q.Get("publisher_jwt"); p != "" {
+		publisherJWT = p
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &RelayTransport{
+		hubURL:            hubURL,
+		client:            client,
+		topics:            topics,
+		targets:           q["target"],
+		subscriberJWT:     subscriberJWT,
+		publisherJWT:      publisherJWT,
+		reconnectDelay:    reconnectDelay,
+		maxReconnectDelay: maxReconnectDelay,
+		pipes:             make(map[*Pipe]struct{}),
+		done:              make(chan struct{}),
+		cancel:            cancel,
+		bufferSize:        bufferSize,
+		bufferFullTimeout: bufferFullTimeout,
+	}
+
+	for _, topic := range topics {
+		go t.subscribe(ctx, topic)
+	}
+
+	return t, nil
+}
+
+// relayHubURL computes the URL of the upstream hub and the HTTP client to use to connect to it.
+func relayHubURL(u *url.URL) (*url.URL, *http.Client, error) {
+	hubPath := u.Query().Get("hub_path")
+
+	switch u.Scheme {
+	case "mercure":
+		if u.Host == "" {
+			return nil, nil, fmt.Errorf(`%q: missing host: %w`, redactDSN(u), ErrInvalidTransportDSN)
+		}
+
+		scheme := "https"
+		if u.Query().Get("tls") == "0" {
+			scheme = "http"
+		}
+
+		if hubPath == "" {
+			hubPath = u.Path
+		}
+		if hubPath == "" {
+			hubPath = defaultHubURL
+		}
+
+		return &url.URL{Scheme: scheme, Host: u.Host, Path: hubPath}, &http.Client{}, nil
+
+	case "mercure+unix":
+		socket := u.Path
+		if socket == "" {
+			return nil, nil, fmt.Errorf(`%q: missing socket path: %w`, redactDSN(u), ErrInvalidTransportDSN)
+		}
+
+		if hubPath == "" {
+			hubPath = defaultHubURL
+		}
+
+		var d net.Dialer
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}}
+
+		return &url.URL{Scheme: "http", Host: "unix", Path: hubPath}, client, nil
+	}
+
+	return nil, nil, fmt.Errorf(`%q: unsupported scheme: %w`, redactDSN(u), ErrInvalidTransportDSN)
+}
+
+// Write publishes the update to the upstream hub.
+// The update is then dispatched to local subscribers when it's received through the subscription to the upstream hub.
+func (t *RelayTransport) Write(update *Update) error {
+	select {
+	case <-t.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	req, err := newPublishRequest(t.hubURL, t.publisherJWT, update)
+	if err != nil || req == nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("relay: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay: unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// newPublishRequest creates the request publishing the update to the given hub.
+// Returns a nil request if the update is already expired: no subscriber would receive it.
+func newPublishRequest(hubURL *url.URL, jwt string, update *Update) (*http.Request, error) {
+	form := url.Values{"topic": update.Topics, "data": {update.Data}, "id": {update.ID}}
+	if update.Type != "" {
+		form.Set("type", update.Type)
+	}
+	if update.Retry != 0 {
+		form.Set("retry", strconv.FormatUint(update.Retry, 10))
+	}
+	if update.ContentType != "" {
+		form.Set("content_type", update.ContentType)
+	}
+	if !update.Expires.IsZero() {
+		ttl := time.Until(update.Expires)
+		if ttl <= 0 {
+			return nil, nil
+		}
+		form.Set("ttl", ttl.String())
+	}
+	if update.LatestOnly {
+		form.Set("latest_only", "true")
+	}
+	for target := range update.Targets {
+		form.Add("target", target)
+	}
+
+	req, err := http.NewRequest("POST", hubURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+jwt)
+	}
+
+	return req, nil
+}
+
+// subscribe mirrors the updates of the given topic, and reconnects with an exponential backoff when the connection is lost.
+// The ID of the last received event is used to retrieve the updates published while disconnected.
+func (t *RelayTransport) subscribe(ctx context.Context, topic string) {
+	var lastEventID string
+	delay := t.reconnectDelay
+
+	for {
+		err := t.stream(ctx, topic, &lastEventID, func() { delay = t.reconnectDelay })
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.WithFields(log.Fields{"topic": topic, "delay": delay}).Warn(fmt.Errorf("relay: %w", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > t.maxReconnectDelay {
+			delay = t.maxReconnectDelay
+		}
+	}
+}
+
+// stream reads the events sent by the upstream hub until the connection is closed.
+func (t *RelayTransport) stream(ctx context.Context, topic string, lastEventID *string, connected func()) error {
+	u := *t.hubURL
+	u.RawQuery = url.Values{"topic": {topic}}.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if t.subscriberJWT != "" {
+		req.Header.Set("Authorization", "Bearer "+t.subscriberJWT)
+	}
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	connected()
+
+	var (
+		event   Event
+		data    []string
+		hasData bool
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// End of the event
+			if hasData {
+				event.Data = strings.Join(data, "\n")
+				*lastEventID = event.ID
+				t.dispatch(t.newMirroredUpdate(topic, event))
+			}
+			event, data, hasData = Event{}, data[:0], false
+
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue // Comment
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "retry":
+			event.Retry, _ = strconv.ParseUint(value, 10, 64)
+		case "content-type":
+			event.ContentType = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("connection closed by the upstream hub")
+}
+
+func (t *RelayTransport) newMirroredUpdate(topic string, event Event) *Update {
+	targets := make(map[string]struct{}, len(t.targets))
+	for _, target := range t.targets {
+		targets[target] = struct{}{}
+	}
+
+	return &Update{Targets: targets, Topics: []string{topic}, Event: event}
+}
+
+// dispatch sends the update to the local pipes.
+func (t *RelayTransport) dispatch(update *Update) {
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+
+	for pipe := range t.pipes {
+		if !pipe.Write(update) {
+			delete(t.pipes, pipe)
+		}
+	}
+}
+
+// CreatePipe returns a pipe receiving the mirrored updates. The history isn't supported.
+func (t *RelayTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	if cursor.Kind != CursorLatest {
+		return nil, ErrUnsupportedCursor
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	select {
+	case <-t.done:
+		return nil, ErrClosedTransport
+	default:
+	}
+
+	pipe := t.pipeBufferFactory.newPipe(t.bufferSize, t.bufferFullTimeout)
+	t.pipes[pipe] = struct{}{}
+
+	return pipe, nil
+}
+
+// supportsHistory returns false: the mirrored updates aren't stored.
+func (t *RelayTransport) supportsHistory() bool {
+	return false
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *RelayTransport) transportConfig() *transportConfig {
+	scheme := "mercure"
+	if t.hubURL.Host == "unix" {
+		scheme = "mercure+unix"
+	}
+
+	options := bufferOptions(t.bufferSize, t.bufferFullTimeout)
+	options["hub_url"] = t.hubURL.String()
+	options["topic"] = t.topics
+	options["target"] = t.targets
+	options["reconnect_delay"] = t.reconnectDelay.String()
+	options["max_reconnect_delay"] = t.maxReconnectDelay.String()
+
+	return &transportConfig{Scheme: scheme, Options: options}
+}
+
+// Close closes the Transport.
+func (t *RelayTransport) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+
+	t.cancel()
+
+	t.Lock()
+	defer t.Unlock()
+	for pipe := range t.pipes {
+		pipe.closeUpdates()
+	}
+	close(t.done)
+
+	return nil
+}
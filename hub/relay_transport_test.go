@@ -0,0 +1,229 @@
+package hub
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createUpstream starts a hub accepting anonymous subscribers, to be used as the upstream of a RelayTransport.
+func createUpstream(t *testing.T, listener net.Listener) (*Hub, *LocalTransport, *httptest.Server) {
+	upstreamTransport := NewLocalTransport(5, time.Second)
+	upstream := createDummyWithTransportAndConfig(upstreamTransport, viper.New())
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			upstream.PublishHandler(w, r)
+			return
+		}
+
+		upstream.SubscribeHandler(w, r)
+	}))
+	if listener != nil {
+		server.Listener.Close()
+		server.Listener = listener
+	}
+	server.Start()
+
+	return upstream, upstreamTransport, server
+}
+
+// waitForSubscribers waits until the upstream transport has the given number of open pipes.
+func waitForSubscribers(t *testing.T, transport *LocalTransport, count int) {
+	require.Eventually(t, func() bool {
+		transport.RLock()
+		defer transport.RUnlock()
+
+		open := 0
+		for pipe := range transport.pipes {
+			if !pipe.IsClosed() {
+				open++
+			}
+		}
+
+		return open == count
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestNewRelayTransportInvalidDSN(t *testing.T) {
+	u, _ := url.Parse("mercure://example.com")
+	_, err := NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure://example.com": missing "topic" parameter: invalid transport DSN`)
+
+	u, _ = url.Parse("mercure:///foo?topic=foo")
+	_, err = NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure:///foo?topic=foo": missing host: invalid transport DSN`)
+
+	u, _ = url.Parse("mercure+unix://?topic=foo")
+	_, err = NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure+unix:?topic=foo": missing socket path: invalid transport DSN`)
+
+	u, _ = url.Parse("mercure://example.com?topic=foo&reconnect_delay=invalid")
+	_, err = NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure://example.com?topic=foo&reconnect_delay=invalid": invalid "reconnect_delay" parameter "invalid": invalid transport DSN`)
+
+	u, _ = url.Parse("mercure://example.com?topic=foo&reconnect_delay=2s&max_reconnect_delay=1s")
+	_, err = NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure://example.com?topic=foo&reconnect_delay=2s&max_reconnect_delay=1s": invalid "max_reconnect_delay" parameter "1s": invalid transport DSN`)
+
+	u, _ = url.Parse("mercure://example.com?topic=foo&jwt=secret&reconnect_delay=invalid")
+	_, err = NewRelayTransport(u, 5, time.Second)
+	assert.EqualError(t, err, `"mercure://example.com?jwt=xxxxx&reconnect_delay=invalid&topic=foo": invalid "reconnect_delay" parameter "invalid": invalid transport DSN`)
+}
+
+func TestRelayHubURL(t *testing.T) {
+	u, _ := url.Parse("mercure://example.com?topic=foo")
+	hubURL, _, err := relayHubURL(u)
+	require.Nil(t, err)
+	assert.Equal(t, "https://example.com/.well-known/mercure", hubURL.String())
+
+	u, _ = url.Parse("mercure://example.com:8080/hub?topic=foo&tls=0")
+	hubURL, _, err = relayHubURL(u)
+	require.Nil(t, err)
+	assert.Equal(t, "http://example.com:8080/hub", hubURL.String())
+
+	u, _ = url.Parse("mercure+unix:///var/run/mercure.sock?topic=foo&hub_path=/hub")
+	hubURL, _, err = relayHubURL(u)
+	require.Nil(t, err)
+	assert.Equal(t, "http://unix/hub", hubURL.String())
+}
+
+func TestRelayTransport(t *testing.T) {
+	upstream, upstreamTransport, server := createUpstream(t, nil)
+	defer server.Close()
+	defer upstream.Stop()
+
+	u, _ := url.Parse(server.URL)
+	q := url.Values{
+		"tls":             {"0"},
+		"topic":           {"https://example.com/books/1"},
+		"target":          {"foo"},
+		"publisher_jwt":   {createDummyAuthorizedJWT(upstream, publisherRole, []string{"*"})},
+		"reconnect_delay": {"10ms"},
+	}
+	u, _ = url.Parse("mercure://" + u.Host + defaultHubURL + "?" + q.Encode())
+
+	transport, err := NewRelayTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	waitForSubscribers(t, upstreamTransport, 1)
+
+	require.Nil(t, transport.Write(&Update{
+		Topics: []string{"https://example.com/books/1"},
+		Event:  Event{ID: "a", Data: "line 1\nline 2", Type: "bar", Retry: 3, ContentType: "text/plain"},
+	}))
+
+	u1 := <-pipe.Read()
+	assert.Equal(t, []string{"https://example.com/books/1"}, u1.Topics)
+	assert.Equal(t, map[string]struct{}{"foo": {}}, u1.Targets)
+	assert.Equal(t, Event{ID: "a", Data: "line 1\nline 2", Type: "bar", Retry: 3, ContentType: "text/plain"}, u1.Event)
+
+	// The relay reconnects when the connection is lost
+	server.CloseClientConnections()
+	waitForSubscribers(t, upstreamTransport, 0)
+	waitForSubscribers(t, upstreamTransport, 1)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "b", Data: "baz"}}))
+
+	u2 := <-pipe.Read()
+	assert.Equal(t, "b", u2.ID)
+}
+
+func TestRelayTransportTTLAndLatestOnly(t *testing.T) {
+	upstream, upstreamTransport, server := createUpstream(t, nil)
+	defer server.Close()
+	defer upstream.Stop()
+
+	u, _ := url.Parse(server.URL)
+	q := url.Values{
+		"tls":           {"0"},
+		"topic":         {"https://example.com/books/1"},
+		"publisher_jwt": {createDummyAuthorizedJWT(upstream, publisherRole, []string{"*"})},
+	}
+	u, _ = url.Parse("mercure://" + u.Host + defaultHubURL + "?" + q.Encode())
+
+	transport, err := NewRelayTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	upstreamPipe, err := upstreamTransport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	// Already expired updates aren't forwarded
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "foo"}, Expires: time.Now().Add(-time.Second)}))
+
+	expires := time.Now().Add(time.Minute)
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "b", Data: "foo"}, Expires: expires, LatestOnly: true}))
+
+	u1 := <-upstreamPipe.Read()
+	assert.Equal(t, "b", u1.ID)
+	assert.True(t, u1.LatestOnly)
+	assert.WithinDuration(t, expires, u1.Expires, time.Second)
+}
+
+func TestRelayTransportUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "mercure.sock")
+	listener, err := net.Listen("unix", socket)
+	require.Nil(t, err)
+
+	upstream, upstreamTransport, server := createUpstream(t, listener)
+	defer server.Close()
+	defer upstream.Stop()
+
+	q := url.Values{
+		"topic":         {"https://example.com/books/1"},
+		"publisher_jwt": {createDummyAuthorizedJWT(upstream, publisherRole, []string{"*"})},
+	}
+	u, _ := url.Parse("mercure+unix://" + socket + "?" + q.Encode())
+
+	transport, err := NewRelayTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	waitForSubscribers(t, upstreamTransport, 1)
+
+	require.Nil(t, transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "foo"}}))
+
+	u1 := <-pipe.Read()
+	assert.Equal(t, "foo", u1.Data)
+}
+
+func TestRelayTransportClosed(t *testing.T) {
+	u, _ := url.Parse("mercure://127.0.0.1:1?topic=foo&tls=0")
+	transport, err := NewRelayTransport(u, 5, time.Second)
+	require.Nil(t, err)
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Close())
+	assert.Nil(t, transport.Close())
+
+	_, ok := <-pipe.Read()
+	assert.False(t, ok)
+
+	_, err = transport.CreatePipe(LatestCursor())
+	assert.Equal(t, ErrClosedTransport, err)
+	assert.Equal(t, ErrClosedTransport, transport.Write(&Update{}))
+}
@@ -0,0 +1,118 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// replayLimiter caps the number of simultaneous history replays: when a lot of subscribers reconnect at the same time (after a deploy for instance),
+// the replays exceeding the limit are queued instead of all reading the database concurrently and starving the live dispatch.
+// The replays are also paused while the memory usage is above the watermark of the memoryGuard, and their duration is collected in the metrics.
+// A nil replayLimiter doesn't limit anything.
+type replayLimiter struct {
+	sync.Mutex
+	// slots is nil if the number of simultaneous replays isn't limited
+	slots   chan struct{}
+	memory  *memoryGuard
+	metrics *Metrics
+	active  int
+	queued  int
+	// started contains the time at which the running replays acquired their slot
+	started map[*Pipe]time.Time
+}
+
+// replayLimitedTransport is implemented by the transports replaying the history.
+type replayLimitedTransport interface {
+	setReplayLimiter(l *replayLimiter)
+}
+
+// newReplayLimiter returns a limiter allowing max simultaneous replays (unlimited if max isn't positive) and pausing them under memory pressure,
+// or nil if there is nothing to limit nor to collect.
+func newReplayLimiter(max int, memory *memoryGuard, metrics *Metrics) *replayLimiter {
+	if max <= 0 && memory == nil && metrics == nil {
+		return nil
+	}
+
+	l := &replayLimiter{memory: memory, metrics: metrics, started: make(map[*Pipe]time.Time)}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+
+	return l
+}
+
+// acquire waits for a replay slot. It returns false if the pipe is closed while waiting, the replay must not be done then.
+func (l *replayLimiter) acquire(pipe *Pipe) bool {
+	if l == nil {
+		return true
+	}
+
+	l.update(0, 1)
+	if l.wait(pipe) {
+		l.update(1, -1)
+
+		l.Lock()
+		l.started[pipe] = time.Now()
+		l.Unlock()
+
+		return true
+	}
+	l.update(0, -1)
+
+	return false
+}
+
+// wait waits until the memory usage is below the watermark, then for a free slot. It returns false if the pipe is closed while waiting.
+func (l *replayLimiter) wait(pipe *Pipe) bool {
+	select {
+	case <-l.memory.relievedChan():
+	case <-pipe.done:
+		return false
+	case <-pipe.closing:
+		return false
+	}
+
+	if l.slots == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-pipe.done:
+	case <-pipe.closing:
+	}
+
+	return false
+}
+
+// release frees the slot taken by acquire for the pipe, once the history has been fetched.
+func (l *replayLimiter) release(pipe *Pipe) {
+	if l == nil {
+		return
+	}
+
+	l.Lock()
+	start := l.started[pipe]
+	delete(l.started, pipe)
+	l.Unlock()
+	if l.metrics != nil {
+		l.metrics.HistoryFetched(time.Since(start))
+	}
+
+	if l.slots != nil {
+		<-l.slots
+	}
+	l.update(-1, 0)
+}
+
+func (l *replayLimiter) update(active, queued int) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.active += active
+	l.queued += queued
+	if l.metrics != nil {
+		l.metrics.Replays(l.active, l.queued)
+	}
+}
@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeValue(t *testing.T, g interface{ Write(*dto.Metric) error }) float64 {
+	var metricOut dto.Metric
+	require.Nil(t, g.Write(&metricOut))
+
+	return metricOut.Gauge.GetValue()
+}
+
+func TestNilReplayLimiter(t *testing.T) {
+	assert.Nil(t, newReplayLimiter(0, nil, nil))
+
+	var l *replayLimiter
+	pipe := NewPipe(5, time.Second)
+	assert.True(t, l.acquire(pipe))
+	l.release(pipe)
+}
+
+func TestReplayLimiterQueue(t *testing.T) {
+	m := NewMetrics()
+	l := newReplayLimiter(1, nil, m)
+
+	first := NewPipe(5, time.Second)
+	assert.True(t, l.acquire(first))
+	assert.Equal(t, 1.0, gaugeValue(t, m.replays))
+
+	second := NewPipe(5, time.Second)
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(second)
+	}()
+
+	require.Eventually(t, func() bool { return gaugeValue(t, m.replaysQueued) == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("the replay must be queued")
+	default:
+	}
+
+	l.release(first)
+	assert.True(t, <-acquired)
+	assert.Equal(t, 1.0, gaugeValue(t, m.replays))
+	assert.Equal(t, 0.0, gaugeValue(t, m.replaysQueued))
+
+	l.release(second)
+	assert.Equal(t, 0.0, gaugeValue(t, m.replays))
+	assert.Empty(t, l.started)
+	assert.Equal(t, uint64(2), histogramSampleCount(t, m.historyFetches))
+}
+
+func TestReplayLimiterClosedPipe(t *testing.T) {
+	m := NewMetrics()
+	l := newReplayLimiter(1, nil, m)
+	require.True(t, l.acquire(NewPipe(5, time.Second)))
+
+	pipe := NewPipe(5, time.Second)
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(pipe)
+	}()
+
+	require.Eventually(t, func() bool { return gaugeValue(t, m.replaysQueued) == 1 }, time.Second, time.Millisecond)
+	pipe.Close()
+	assert.False(t, <-acquired)
+	assert.Equal(t, 0.0, gaugeValue(t, m.replaysQueued))
+	assert.Equal(t, 1.0, gaugeValue(t, m.replays))
+}
+
+func TestHubReplayLimiter(t *testing.T) {
+	path := "replay-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".db"
+	defer os.Remove(path)
+
+	u, _ := url.Parse("bolt://" + path)
+	transport, err := NewBoltTransport(u, 5, time.Second)
+	require.Nil(t, err)
+	defer transport.Close()
+
+	v := viper.New()
+	v.Set("max_concurrent_replays", 2)
+	hub := createDummyWithTransportAndConfig(transport, v)
+
+	require.NotNil(t, transport.replayLimiter)
+	assert.Equal(t, 2, cap(transport.replayLimiter.slots))
+	assert.Equal(t, hub.metrics, transport.replayLimiter.metrics)
+}
+
+func TestReplayLimiterPausedUnderMemoryPressure(t *testing.T) {
+	g, check := newTestMemoryGuard(t, nil)
+	check(200)
+
+	l := newReplayLimiter(0, g, nil)
+	assert.NotNil(t, l)
+
+	paused := NewPipe(5, time.Second)
+	acquired := make(chan bool)
+	go func() {
+		acquired <- l.acquire(paused)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the replay must be paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	check(50)
+	select {
+	case ok := <-acquired:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("the replay must be resumed")
+	}
+	l.release(paused)
+
+	// A closed pipe stops waiting
+	check(200)
+	pipe := NewPipe(5, time.Second)
+	pipe.Close()
+	assert.False(t, l.acquire(pipe))
+}
@@ -0,0 +1,69 @@
+package hub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resumeHint returns a hint allowing the subscriber to resume after the given event using the "resume" query parameter.
+// The hint contains the event ID signed with the "resume_hint_key" configuration parameter, it's empty if the key isn't set.
+func (h *Hub) resumeHint(lastEventID string) string {
+	key, err := getSecret(h.config, "resume_hint_key")
+	if err != nil {
+		log.Error(err)
+	}
+	if key == "" || lastEventID == "" {
+		return ""
+	}
+
+	return signResumeHint([]byte(key), lastEventID)
+}
+
+// resumeHintEventID returns the event ID contained in the given hint, or false if the hint hasn't been signed by this hub.
+func (h *Hub) resumeHintEventID(hint string) (string, bool) {
+	key, err := getSecret(h.config, "resume_hint_key")
+	if err != nil {
+		log.Error(err)
+	}
+	if key == "" {
+		return "", false
+	}
+
+	return verifyResumeHint([]byte(key), hint)
+}
+
+// signResumeHint creates a hint formatted as "base64url(event ID).base64url(HMAC-SHA256(event ID))".
+func signResumeHint(key []byte, lastEventID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(lastEventID))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(lastEventID)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyResumeHint(key []byte, hint string) (string, bool) {
+	parts := strings.SplitN(hint, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(id) == 0 {
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(id)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", false
+	}
+
+	return string(id), true
+}
@@ -0,0 +1,39 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeHint(t *testing.T) {
+	hint := signResumeHint([]byte("secret"), "urn:uuid:a")
+
+	id, ok := verifyResumeHint([]byte("secret"), hint)
+	assert.True(t, ok)
+	assert.Equal(t, "urn:uuid:a", id)
+
+	_, ok = verifyResumeHint([]byte("other"), hint)
+	assert.False(t, ok)
+
+	for _, invalid := range []string{"", "foo", "@.@", ".", hint + "a", signResumeHint([]byte("secret"), "b")[:2] + hint[2:]} {
+		_, ok = verifyResumeHint([]byte("secret"), invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestHubResumeHint(t *testing.T) {
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), viper.New())
+	assert.Empty(t, hub.resumeHint("a"))
+	_, ok := hub.resumeHintEventID(signResumeHint([]byte(""), "a"))
+	assert.False(t, ok)
+
+	hub.config.Set("resume_hint_key", "secret")
+	assert.Empty(t, hub.resumeHint(""))
+
+	id, ok := hub.resumeHintEventID(hub.resumeHint("a"))
+	assert.True(t, ok)
+	assert.Equal(t, "a", id)
+}
@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/atomic"
+)
+
+// ErrRetryQueueFull is returned when an update cannot be written by the transport and the retry queue is full.
+var ErrRetryQueueFull = errors.New("hub: retry queue full")
+
+type retryItem struct {
+	update *Update
+	failed bool
+}
+
+// retrier writes updates in the transport, and retries with an exponential backoff if the transport returns an error.
+// Updates are queued in memory while they are retried, the order of the updates is preserved.
+type retrier struct {
+	transport Transport
+	metrics   *Metrics
+	retries   int
+	delay     time.Duration
+	queue     chan retryItem
+	pending   atomic.Int32
+	done      chan struct{}
+}
+
+func newRetrier(t Transport, m *Metrics, retries int, delay time.Duration, queueSize int) *retrier {
+	r := &retrier{
+		transport: t,
+		metrics:   m,
+		retries:   retries,
+		delay:     delay,
+		queue:     make(chan retryItem, queueSize),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+
+	return r
+}
+
+// Write pushes the update in the transport, or queues it if the write fails or if previous updates are still queued.
+func (r *retrier) Write(u *Update) error {
+	if r.pending.Load() == 0 {
+		err := r.transport.Write(u)
+		if err == nil || errors.Is(err, ErrClosedTransport) {
+			return err
+		}
+
+		log.WithFields(log.Fields{"event_id": u.ID}).Warn(err)
+
+		return r.enqueue(retryItem{u, true})
+	}
+
+	return r.enqueue(retryItem{u, false})
+}
+
+func (r *retrier) enqueue(i retryItem) error {
+	select {
+	case <-r.done:
+		return ErrClosedTransport
+	default:
+	}
+
+	// The update will be released once processed by the queue
+	i.update.Retain()
+	r.pending.Inc()
+
+	select {
+	case r.queue <- i:
+		return nil
+	default:
+		r.pending.Dec()
+		i.update.Release()
+		r.metrics.DropUpdate(i.update)
+
+		return ErrRetryQueueFull
+	}
+}
+
+func (r *retrier) run() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case i := <-r.queue:
+			r.retry(i)
+			r.pending.Dec()
+			i.update.Release()
+		}
+	}
+}
+
+// retry writes the update, waiting twice as long between each failed attempt.
+func (r *retrier) retry(i retryItem) {
+	if !i.failed {
+		err := r.transport.Write(i.update)
+		if err == nil {
+			return
+		}
+
+		log.WithFields(log.Fields{"event_id": i.update.ID}).Warn(err)
+	}
+
+	delay := r.delay
+	for attempt := 0; attempt < r.retries; attempt++ {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+
+		r.metrics.RetryUpdate(i.update)
+		err := r.transport.Write(i.update)
+		if err == nil {
+			return
+		}
+
+		log.WithFields(log.Fields{"event_id": i.update.ID, "attempt": attempt + 1}).Warn(err)
+		if errors.Is(err, ErrClosedTransport) {
+			break
+		}
+
+		delay *= 2
+	}
+
+	log.WithFields(log.Fields{"event_id": i.update.ID, "update_topics": i.update.Topics}).Error("Update dropped")
+	r.metrics.DropUpdate(i.update)
+}
+
+// Close stops retrying, queued updates are dropped.
+func (r *retrier) Close() {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+}
@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTransientTransport = errors.New("transient error")
+
+// flakyTransport fails the given number of writes before delegating to the wrapped transport.
+type flakyTransport struct {
+	sync.Mutex
+	Transport
+	failures int
+}
+
+func (t *flakyTransport) Write(update *Update) error {
+	t.Lock()
+	if t.failures > 0 {
+		t.failures--
+		t.Unlock()
+
+		return errTransientTransport
+	}
+	t.Unlock()
+
+	return t.Transport.Write(update)
+}
+
+func TestRetrierWrite(t *testing.T) {
+	transport := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 2}
+	defer transport.Close()
+
+	m := NewMetrics()
+	r := newRetrier(transport, m, 3, time.Millisecond, 10)
+	defer r.Close()
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	assert.Nil(t, r.Write(&Update{Topics: []string{"http://example.com/1"}, Event: Event{ID: "1"}}))
+	assert.Nil(t, r.Write(&Update{Topics: []string{"http://example.com/2"}, Event: Event{ID: "2"}}))
+
+	// Order is preserved
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+	assert.Equal(t, "2", (<-pipe.Read()).ID)
+
+	assertCounterValue(t, 2.0, m.updatesRetried, "http://example.com/1")
+	assertCounterValue(t, 0.0, m.updatesRetried, "http://example.com/2")
+	assertCounterValue(t, 0.0, m.updatesDropped, "http://example.com/1")
+}
+
+func TestRetrierDrop(t *testing.T) {
+	transport := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 10}
+	defer transport.Close()
+
+	m := NewMetrics()
+	r := newRetrier(transport, m, 2, time.Millisecond, 10)
+	defer r.Close()
+
+	assert.Nil(t, r.Write(&Update{Topics: []string{"http://example.com/1"}}))
+
+	for r.pending.Load() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assertCounterValue(t, 2.0, m.updatesRetried, "http://example.com/1")
+	assertCounterValue(t, 1.0, m.updatesDropped, "http://example.com/1")
+}
+
+func TestRetrierQueueFull(t *testing.T) {
+	transport := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 10}
+	defer transport.Close()
+
+	m := NewMetrics()
+	r := newRetrier(transport, m, 1, time.Hour, 1)
+	defer r.Close()
+
+	assert.Nil(t, r.Write(&Update{Topics: []string{"http://example.com/1"}}))
+	for len(r.queue) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, r.Write(&Update{Topics: []string{"http://example.com/2"}}))
+	assert.Equal(t, ErrRetryQueueFull, r.Write(&Update{Topics: []string{"http://example.com/3"}}))
+
+	assertCounterValue(t, 1.0, m.updatesDropped, "http://example.com/3")
+}
+
+func TestRetrierClosedTransport(t *testing.T) {
+	transport := NewLocalTransport(5, time.Second)
+	transport.Close()
+
+	r := newRetrier(transport, NewMetrics(), 3, time.Millisecond, 10)
+	defer r.Close()
+
+	assert.Equal(t, ErrClosedTransport, r.Write(&Update{}))
+}
+
+func TestHubDispatchRetries(t *testing.T) {
+	v := viper.New()
+	v.Set("dispatch_retries", 3)
+	v.Set("dispatch_retry_delay", time.Millisecond)
+	transport := &flakyTransport{Transport: NewLocalTransport(5, time.Second), failures: 1}
+	h := createDummyWithTransportAndConfig(transport, v)
+	defer h.Stop()
+	require.NotNil(t, h.retrier)
+
+	pipe, err := transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	assert.Nil(t, h.dispatch(&Update{Event: Event{ID: "1"}}))
+	assert.Equal(t, "1", (<-pipe.Read()).ID)
+}
@@ -0,0 +1,181 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Bucket sends requests to a bucket of S3, or of any S3-compatible storage, using path-style URLs.
+type s3Bucket struct {
+	endpoint        string
+	bucket          string
+	prefix          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+}
+
+// newS3Bucket creates a bucket from a DSN such as s3://bucket/prefix?region=eu-west-3, it also returns its name (s3:bucket/prefix).
+// The region and the credentials default to the AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+// The errors wrap errInvalidDSN.
+func newS3Bucket(u *url.URL, client *http.Client, errInvalidDSN error) (*s3Bucket, string, error) {
+	q := u.Query()
+	param := func(name, env string) string {
+		if v := q.Get(name); v != "" {
+			return v
+		}
+
+		return os.Getenv(env)
+	}
+
+	if u.Host == "" {
+		return nil, "", fmt.Errorf(`s3: must be formatted as "s3://bucket/prefix": %w`, errInvalidDSN)
+	}
+	name := "s3:" + u.Host + u.Path
+
+	region := param("region", "AWS_REGION")
+	if region == "" {
+		return nil, "", fmt.Errorf(`%s: missing "region" parameter: %w`, name, errInvalidDSN)
+	}
+
+	accessKeyID := param("access_key_id", "AWS_ACCESS_KEY_ID")
+	secretAccessKey := param("secret_access_key", "AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, "", fmt.Errorf(`%s: missing "access_key_id" or "secret_access_key" parameter: %w`, name, errInvalidDSN)
+	}
+
+	endpoint := "https://s3." + region + ".amazonaws.com"
+	if p := q.Get("endpoint"); p != "" {
+		endpoint = strings.TrimSuffix(p, "/")
+	}
+
+	return &s3Bucket{
+		endpoint:        endpoint,
+		bucket:          u.Host,
+		prefix:          strings.Trim(u.Path, "/"),
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    param("session_token", "AWS_SESSION_TOKEN"),
+		client:          client,
+	}, name, nil
+}
+
+// objectKey returns the key of the object having the given name under the prefix of the bucket.
+func (b *s3Bucket) objectKey(name string) string {
+	if b.prefix == "" {
+		return name
+	}
+
+	return b.prefix + "/" + name
+}
+
+// do sends a signed request about the object having the given key, or about the bucket if the key is empty.
+// An error is returned if the status code isn't 200, otherwise the caller must close the body of the response.
+func (b *s3Bucket) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := b.endpoint + "/" + b.bucket
+	if key != "" {
+		u += "/" + key
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	bodyHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash[:]))
+	signAWSRequest(req, body, b.accessKeyID, b.secretAccessKey, b.sessionToken, b.region, "s3", time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+
+		return nil, fmt.Errorf("s3: %s %s: status code %d: %s", method, req.URL.Path, resp.StatusCode, data)
+	}
+
+	return resp, nil
+}
+
+// put uploads the body in the object having the given key.
+func (b *s3Bucket) put(ctx context.Context, key string, body []byte, contentType string) error {
+	resp, err := b.do(ctx, "PUT", key, nil, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// get returns the content of the object having the given key, the caller must close it.
+func (b *s3Bucket) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, "GET", key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// s3ListResult is the response of the ListObjectsV2 operation.
+type s3ListResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns the keys of the objects under the prefix of the bucket, in lexical order.
+func (b *s3Bucket) list(ctx context.Context) ([]string, error) {
+	query := url.Values{"list-type": {"2"}}
+	if b.prefix != "" {
+		query.Set("prefix", b.prefix+"/")
+	}
+
+	var keys []string
+	for {
+		resp, err := b.do(ctx, "GET", "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: list %s: %w", b.bucket, err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
@@ -0,0 +1,107 @@
+package hub
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testS3Server emulates the PUT, GET and ListObjectsV2 operations of S3 on a single bucket, returning at most 2 keys per page.
+type testS3Server struct {
+	*httptest.Server
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func newTestS3Server(t *testing.T, bucket string) *testS3Server {
+	s := &testS3Server{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/")
+		if !strings.HasPrefix(r.URL.Path, "/"+bucket) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+bucket), "/")
+
+		s.Lock()
+		defer s.Unlock()
+
+		switch {
+		case r.Method == "PUT":
+			s.objects[key], _ = ioutil.ReadAll(r.Body)
+		case key != "":
+			data, ok := s.objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		default:
+			var keys []string
+			for k := range s.objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("continuation-token") {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			var result s3ListResult
+			if len(keys) > 2 {
+				keys = keys[:2]
+				result.IsTruncated = true
+				result.NextContinuationToken = keys[1]
+			}
+			for _, k := range keys {
+				result.Contents = append(result.Contents, struct{ Key string }{k})
+			}
+			xml.NewEncoder(w).Encode(result)
+		}
+	}))
+
+	return s
+}
+
+func TestS3Bucket(t *testing.T) {
+	server := newTestS3Server(t, "archives")
+	defer server.Close()
+
+	u, _ := url.Parse("s3://archives/mercure/?region=us-east-1&access_key_id=id&secret_access_key=secret&endpoint=" + url.QueryEscape(server.URL))
+	b, name, err := newS3Bucket(u, server.Client(), ErrInvalidTransportDSN)
+	require.Nil(t, err)
+	assert.Equal(t, "s3:archives/mercure/", name)
+	assert.Equal(t, "mercure/1", b.objectKey("1"))
+
+	ctx := context.Background()
+	for _, key := range []string{"3", "1", "2"} {
+		require.Nil(t, b.put(ctx, b.objectKey(key), []byte("data "+key), "text/plain"))
+	}
+	server.objects["other/4"] = []byte("data 4")
+
+	keys, err := b.list(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"mercure/1", "mercure/2", "mercure/3"}, keys)
+
+	body, err := b.get(ctx, "mercure/2")
+	require.Nil(t, err)
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "data 2", string(data))
+
+	_, err = b.get(ctx, "mercure/4")
+	assert.EqualError(t, err, "s3: GET /archives/mercure/4: status code 404: ")
+
+	u, _ = url.Parse("s3:///mercure")
+	_, _, err = newS3Bucket(u, server.Client(), ErrInvalidTransportDSN)
+	assert.True(t, errors.Is(err, ErrInvalidTransportDSN))
+}
@@ -0,0 +1,158 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrSandboxUnsupported is returned when the sandbox is enabled on a platform not supporting it.
+	ErrSandboxUnsupported = errors.New("sandbox: not supported on this platform")
+	// ErrSandboxIncompatible is returned when a feature enabled in the configuration cannot work in the sandbox.
+	ErrSandboxIncompatible = errors.New("sandbox: incompatible configuration")
+)
+
+// sandboxPath is a filesystem path the hub still needs to access once sandboxed, with unveil(2) permissions.
+type sandboxPath struct {
+	path        string
+	permissions string
+}
+
+// sandboxPaths returns the paths the hub may access after startup: the database, the TLS material and the directories used by the enabled features.
+func sandboxPaths(v *viper.Viper) []sandboxPath {
+	// Root certificates, used by outgoing TLS connections
+	paths := []sandboxPath{{"/etc/ssl", "r"}}
+
+	tu, _ := getSecret(v, "transport_url")
+	u, err := url.Parse(tu)
+	if err == nil && u.Scheme == "filelog" {
+		dir := u.Path
+		if dir == "" {
+			dir = u.Host
+		}
+		// The rotation creates and removes files in the directory
+		paths = append(paths, sandboxPath{dir, "rwc"})
+	}
+	if err == nil && u.Scheme == "bolt" {
+		path := u.Path
+		if path == "" {
+			path = u.Host
+		}
+		switch {
+		case boltReadOnly(u):
+			// The rotated databases are only listed and read
+			paths = append(paths, sandboxPath{path, "r"})
+		case boltCompacts(u):
+			// The compacted copy is created next to the database, then replaces it
+			paths = append(paths, sandboxPath{filepath.Dir(path), "rwc"})
+		case u.Query().Get("rotate") == "":
+			paths = append(paths, sandboxPath{path, "rw"})
+		default:
+			// The rotation creates and removes files in the directory
+			paths = append(paths, sandboxPath{path, "rwc"})
+			if archiveDir := u.Query().Get("archive_dir"); archiveDir != "" {
+				paths = append(paths, sandboxPath{archiveDir, "rwc"})
+			}
+		}
+	}
+
+	for _, file := range []string{v.GetString("cert_file"), v.GetString("key_file")} {
+		if file != "" {
+			paths = append(paths, sandboxPath{file, "r"})
+		}
+	}
+
+	// Secret files are read again when they are rotated
+	for _, file := range secretFilePaths(v) {
+		paths = append(paths, sandboxPath{file, "r"})
+	}
+
+	if dir := v.GetString("acme_cert_dir"); dir != "" && len(v.GetStringSlice("acme_hosts")) > 0 {
+		paths = append(paths, sandboxPath{dir, "rwc"})
+	}
+
+	if v.GetString("update_buffer_strategy") == "disk" {
+		dir := v.GetString("update_buffer_spill_dir")
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		paths = append(paths, sandboxPath{dir, "rwc"})
+	}
+
+	if dir := v.GetString("diagnostics_dir"); dir != "" {
+		paths = append(paths, sandboxPath{dir, "rwc"})
+	}
+
+	if v.GetBool("debug") || v.GetBool("demo") {
+		paths = append(paths, sandboxPath{"public", "r"})
+	}
+
+	return paths
+}
+
+// boltCompacts returns true if the Bolt database of the DSN may be compacted, the rotated databases are compacted in their directory.
+func boltCompacts(u *url.URL) bool {
+	q := u.Query()
+
+	return q.Get("rotate") == "" && (q.Get("compaction_threshold") != "" || q.Get("max_file_size") != "")
+}
+
+// boltReadOnly returns true if the Bolt database of the DSN is opened in read-only mode, the files are then never created nor written.
+func boltReadOnly(u *url.URL) bool {
+	readOnly, _ := strconv.ParseBool(u.Query().Get("readonly"))
+
+	return readOnly
+}
+
+// capabilityModeCompatible checks that the configuration doesn't use features opening files or connections after startup,
+// which isn't allowed in the Capsicum capability mode.
+func capabilityModeCompatible(v *viper.Viper) error {
+	if tu, _ := getSecret(v, "transport_url"); tu != "" {
+		u, err := url.Parse(tu)
+		if err != nil {
+			return fmt.Errorf("transport_url: %w", err)
+		}
+
+		switch u.Scheme {
+		case "null", "local":
+		case "bolt":
+			if u.Query().Get("rotate") != "" && !boltReadOnly(u) {
+				return fmt.Errorf("%w: the rotation of the Bolt database creates files", ErrSandboxIncompatible)
+			}
+			if boltCompacts(u) {
+				return fmt.Errorf("%w: the compaction of the Bolt database creates files", ErrSandboxIncompatible)
+			}
+		case "filelog":
+			return fmt.Errorf("%w: the \"filelog\" transport creates files", ErrSandboxIncompatible)
+		default:
+			return fmt.Errorf("%w: the %q transport opens connections", ErrSandboxIncompatible, u.Scheme)
+		}
+	}
+
+	for _, p := range []struct {
+		enabled bool
+		feature string
+	}{
+		{len(v.GetStringSlice("acme_hosts")) > 0, `"acme_hosts" requires connecting to the ACME server`},
+		{v.GetString("target_resolver_url") != "", `"target_resolver_url" requires connecting to the resolver`},
+		{v.GetString("subscriber_authorization_url") != "", `"subscriber_authorization_url" requires connecting to the authorization endpoint`},
+		{v.GetString("mirror_url") != "", `"mirror_url" requires connecting to the secondary hub`},
+		{len(v.GetStringSlice("analytics_sinks")) > 0, `"analytics_sinks" requires connecting to the analytics destinations`},
+		{usesVault(v), `the secrets stored in Vault require connecting to Vault`},
+		{v.GetString("update_buffer_strategy") == "disk", `the "disk" buffer strategy creates files`},
+		{v.GetString("diagnostics_dir") != "", `the diagnostics bundles are written in new files`},
+		{v.GetBool("debug") || v.GetBool("demo"), `the demo serves files from the "public" directory`},
+	} {
+		if p.enabled {
+			return fmt.Errorf("%w: %s", ErrSandboxIncompatible, p.feature)
+		}
+	}
+
+	return nil
+}
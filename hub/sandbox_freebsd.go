@@ -0,0 +1,15 @@
+package hub
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// enterSandbox enters the Capsicum capability mode: the already opened file descriptors, including the listening socket, remain usable,
+// but no file or connection can be opened anymore.
+func (h *Hub) enterSandbox() error {
+	if err := capabilityModeCompatible(h.config); err != nil {
+		return err
+	}
+
+	return unix.CapEnter()
+}
@@ -0,0 +1,218 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock isn't available in the vendored version of golang.org/x/sys, the numbers are the same on all architectures.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+
+	landlockAccessFSExecute    = 1 << 0
+	landlockAccessFSWriteFile  = 1 << 1
+	landlockAccessFSReadFile   = 1 << 2
+	landlockAccessFSReadDir    = 1 << 3
+	landlockAccessFSRemoveDir  = 1 << 4
+	landlockAccessFSRemoveFile = 1 << 5
+	landlockAccessFSMakeDir    = 1 << 7
+	landlockAccessFSMakeReg    = 1 << 8
+
+	// All the rights of the first version of the ABI, the ones not granted by a rule are denied
+	landlockAccessFSHandled = 1<<13 - 1
+	// Rights applying to files, other rights are only valid for directories
+	landlockAccessFSFile = landlockAccessFSExecute | landlockAccessFSWriteFile | landlockAccessFSReadFile
+)
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	bpfLdWAbs  = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK    = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK    = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK    = 0x06 // BPF_RET | BPF_K
+	seccompNr  = 0    // offsetof(struct seccomp_data, nr)
+	seccompArc = 4    // offsetof(struct seccomp_data, arch)
+)
+
+// sandboxLinuxPaths are read by the resolver and the TLS stack on Linux, in addition to sandboxPaths.
+var sandboxLinuxPaths = []sandboxPath{ //nolint:gochecknoglobals
+	{"/etc/resolv.conf", "r"},
+	{"/etc/hosts", "r"},
+	{"/etc/nsswitch.conf", "r"},
+	{"/etc/pki", "r"},
+}
+
+// seccompDeniedSyscalls are never used by the hub, and are useful to an attacker.
+var seccompDeniedSyscalls = []uintptr{ //nolint:gochecknoglobals
+	unix.SYS_EXECVE,
+	unix.SYS_EXECVEAT,
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_CHROOT,
+	unix.SYS_UNSHARE,
+	unix.SYS_SETNS,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_REBOOT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	unix.SYS_BPF,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_KEYCTL,
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_USERFAULTFD,
+	unix.SYS_ACCT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+}
+
+// enterSandbox restricts the file access with Landlock, and forbids dangerous system calls with a seccomp filter.
+// Both apply to all the threads of the process, and require a binary built with CGO_ENABLED=0.
+func (h *Hub) enterSandbox() error {
+	// Required to restrict an unprivileged process
+	if _, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); errno != 0 {
+		return fmt.Errorf("sandbox: prctl(PR_SET_NO_NEW_PRIVS): %w", errno)
+	}
+
+	if err := landlockRestrict(append(sandboxPaths(h.config), sandboxLinuxPaths...)); err != nil {
+		return fmt.Errorf("sandbox: landlock: %w", err)
+	}
+
+	if err := seccompDeny(seccompDeniedSyscalls); err != nil {
+		return fmt.Errorf("sandbox: seccomp: %w", err)
+	}
+
+	return nil
+}
+
+// landlockRestrict denies the access to the filesystem, except to the given paths.
+func landlockRestrict(paths []sandboxPath) error {
+	if abi, _, errno := unix.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion); errno != 0 || abi < 1 {
+		return fmt.Errorf("%w: %v", ErrSandboxUnsupported, errno)
+	}
+
+	handled := uint64(landlockAccessFSHandled)
+	fd, _, errno := unix.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&handled)), unsafe.Sizeof(handled), 0)
+	if errno != 0 {
+		return errno
+	}
+	defer unix.Close(int(fd))
+
+	for _, p := range paths {
+		if err := landlockAddPath(int(fd), p); err != nil {
+			return fmt.Errorf("%s: %w", p.path, err)
+		}
+	}
+
+	if _, _, errno := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// landlockAddPath allows the access to the path and its content, missing paths are ignored.
+func landlockAddPath(rulesetFd int, p sandboxPath) error {
+	var access uint64
+	if strings.Contains(p.permissions, "r") {
+		access |= landlockAccessFSReadFile | landlockAccessFSReadDir
+	}
+	if strings.Contains(p.permissions, "w") {
+		access |= landlockAccessFSWriteFile
+	}
+	if strings.Contains(p.permissions, "c") {
+		access |= landlockAccessFSMakeReg | landlockAccessFSMakeDir | landlockAccessFSRemoveFile | landlockAccessFSRemoveDir
+	}
+
+	fd, err := unix.Open(p.path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if fi, err := os.Stat(p.path); err == nil && !fi.IsDir() {
+		access &= landlockAccessFSFile
+	}
+
+	// struct landlock_path_beneath_attr is packed
+	var attr [12]byte
+	*(*uint64)(unsafe.Pointer(&attr[0])) = access
+	*(*int32)(unsafe.Pointer(&attr[8])) = int32(fd)
+
+	if _, _, errno := unix.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// seccompDeny installs a filter making the given system calls fail with EPERM in all the threads.
+func seccompDeny(syscalls []uintptr) error {
+	if seccompAuditArch == 0 {
+		return ErrSandboxUnsupported
+	}
+
+	filter := seccompFilter(syscalls)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// seccompFilter returns the BPF program killing the process if the system call doesn't use the native ABI,
+// and making the given system calls fail with EPERM.
+func seccompFilter(syscalls []uintptr) []unix.SockFilter {
+	n := len(syscalls)
+	filter := make([]unix.SockFilter, 0, n+8)
+	filter = append(filter,
+		unix.SockFilter{Code: bpfLdWAbs, K: seccompArc},
+		unix.SockFilter{Code: bpfJeqK, Jt: 1, K: seccompAuditArch},
+		unix.SockFilter{Code: bpfRetK, K: seccompRetKillProcess},
+		unix.SockFilter{Code: bpfLdWAbs, K: seccompNr},
+	)
+	if seccompX32SyscallBit != 0 {
+		// The x32 system calls have the same architecture, but other numbers
+		filter = append(filter,
+			unix.SockFilter{Code: bpfJgeK, Jf: 1, K: seccompX32SyscallBit},
+			unix.SockFilter{Code: bpfRetK, K: seccompRetKillProcess},
+		)
+	}
+	for i, nr := range syscalls {
+		// Jump to the EPERM return
+		filter = append(filter, unix.SockFilter{Code: bpfJeqK, Jt: uint8(n - i), K: uint32(nr)})
+	}
+	filter = append(filter,
+		unix.SockFilter{Code: bpfRetK, K: seccompRetAllow},
+		unix.SockFilter{Code: bpfRetK, K: seccompRetErrno | uint32(unix.EPERM)},
+	)
+
+	return filter
+}
@@ -0,0 +1,8 @@
+package hub
+
+const (
+	// AUDIT_ARCH_X86_64, checked by the seccomp filter.
+	seccompAuditArch = 0xc000003e
+	// __X32_SYSCALL_BIT, the numbers of the x32 ABI system calls bypass the ones of the denied calls.
+	seccompX32SyscallBit = 0x40000000
+)
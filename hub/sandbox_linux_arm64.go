@@ -0,0 +1,8 @@
+package hub
+
+const (
+	// AUDIT_ARCH_AARCH64, checked by the seccomp filter.
+	seccompAuditArch = 0xc00000b7
+	// There is no x32 ABI on this architecture.
+	seccompX32SyscallBit = 0
+)
@@ -0,0 +1,10 @@
+//go:build linux && !amd64 && !arm64
+// +build linux,!amd64,!arm64
+
+package hub
+
+const (
+	// The seccomp filter isn't supported on this architecture.
+	seccompAuditArch     = 0
+	seccompX32SyscallBit = 0
+)
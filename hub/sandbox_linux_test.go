@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const sandboxUnavailableExitCode = 3
+
+func TestEnterSandboxLinux(t *testing.T) {
+	if dir := os.Getenv("BE_SANDBOXED"); dir != "" {
+		// The sandbox can't be left, it is entered in a child process
+		v := viper.New()
+		v.Set("transport_url", "bolt://"+filepath.Join(dir, "updates.db"))
+		h := createDummyWithTransportAndConfig(NewLocalTransport(5, 0), v)
+
+		if err := h.enterSandbox(); err != nil {
+			if errors.Is(err, ErrSandboxUnsupported) || errors.Is(err, syscall.ENOTSUP) {
+				os.Exit(sandboxUnavailableExitCode)
+			}
+			panic(err)
+		}
+
+		if _, err := ioutil.ReadFile(filepath.Join(dir, "updates.db")); err != nil {
+			panic(err)
+		}
+		if _, err := ioutil.ReadFile(filepath.Join(dir, "secret")); !errors.Is(err, syscall.EACCES) {
+			panic("the sandbox doesn't restrict the file access")
+		}
+		if err := exec.Command("/bin/true").Run(); !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.EACCES) {
+			panic("the sandbox doesn't forbid execve")
+		}
+
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "mercure-sandbox")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "updates.db"), []byte("db"), 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600))
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestEnterSandboxLinux") //nolint:gosec
+	cmd.Env = append(os.Environ(), "BE_SANDBOXED="+dir)
+	out, err := cmd.CombinedOutput()
+
+	var e *exec.ExitError
+	if errors.As(err, &e) && e.ExitCode() == sandboxUnavailableExitCode {
+		t.Skip("Landlock is unavailable, or the test binary has been built with cgo")
+	}
+	assert.Nil(t, err, string(out))
+}
+
+// evalSeccompFilter runs the seccomp program for a system call, and returns the action.
+func evalSeccompFilter(t *testing.T, filter []unix.SockFilter, arch, nr uint32) uint32 {
+	t.Helper()
+
+	var a uint32
+	for pc := 0; pc < len(filter); pc++ {
+		ins := filter[pc]
+		switch ins.Code {
+		case bpfLdWAbs:
+			a = map[uint32]uint32{seccompNr: nr, seccompArc: arch}[ins.K]
+		case bpfJeqK:
+			if a == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfJgeK:
+			if a >= ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfRetK:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %#x", ins.Code)
+		}
+	}
+	t.Fatal("the program doesn't return")
+
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	if seccompAuditArch == 0 {
+		t.Skip("seccomp isn't supported on this architecture")
+	}
+
+	filter := seccompFilter([]uintptr{unix.SYS_EXECVE, unix.SYS_PTRACE})
+	eperm := seccompRetErrno | uint32(unix.EPERM)
+
+	assert.Equal(t, uint32(seccompRetAllow), evalSeccompFilter(t, filter, seccompAuditArch, unix.SYS_READ))
+	assert.Equal(t, eperm, evalSeccompFilter(t, filter, seccompAuditArch, unix.SYS_EXECVE))
+	assert.Equal(t, eperm, evalSeccompFilter(t, filter, seccompAuditArch, unix.SYS_PTRACE))
+	assert.Equal(t, uint32(seccompRetKillProcess), evalSeccompFilter(t, filter, 0, unix.SYS_READ))
+
+	if seccompX32SyscallBit == 0 {
+		return
+	}
+
+	// The x32 system calls are rejected, the denied ones could be called through their x32 numbers
+	assert.Contains(t, filter, unix.SockFilter{Code: bpfJgeK, Jf: 1, K: seccompX32SyscallBit})
+	assert.Equal(t, uint32(seccompRetKillProcess), evalSeccompFilter(t, filter, seccompAuditArch, seccompX32SyscallBit|unix.SYS_EXECVE))
+	assert.Equal(t, uint32(seccompRetKillProcess), evalSeccompFilter(t, filter, seccompAuditArch, seccompX32SyscallBit|unix.SYS_READ))
+}
@@ -0,0 +1,25 @@
+package hub
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// enterSandbox restricts the filesystem view with unveil(2) and the allowed system calls with pledge(2).
+func (h *Hub) enterSandbox() error {
+	for _, p := range sandboxPaths(h.config) {
+		if err := unix.Unveil(p.path, p.permissions); err != nil {
+			return err
+		}
+	}
+	if err := unix.UnveilBlock(); err != nil {
+		return err
+	}
+
+	promises := "stdio rpath wpath cpath flock inet dns unix"
+	if h.validators != nil {
+		// The WebAssembly compiler maps executable memory
+		promises += " prot_exec"
+	}
+
+	return unix.PledgePromises(promises)
+}
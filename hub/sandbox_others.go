@@ -0,0 +1,9 @@
+//go:build !openbsd && !freebsd && !linux
+// +build !openbsd,!freebsd,!linux
+
+package hub
+
+// enterSandbox isn't supported on this platform.
+func (h *Hub) enterSandbox() error {
+	return ErrSandboxUnsupported
+}
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxPaths(t *testing.T) {
+	v := viper.New()
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}}, sandboxPaths(v))
+
+	v.Set("transport_url", "bolt:///var/lib/mercure/updates.db")
+	v.Set("cert_file", "cert.pem")
+	v.Set("key_file", "key.pem")
+	v.Set("acme_hosts", []string{"example.com"})
+	v.Set("acme_cert_dir", "/var/lib/mercure")
+	v.Set("update_buffer_strategy", "disk")
+	v.Set("diagnostics_dir", "/var/log/mercure")
+	v.Set("demo", true)
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"/var/lib/mercure/updates.db", "rw"}, {"cert.pem", "r"}, {"key.pem", "r"}, {"/var/lib/mercure", "rwc"}, {os.TempDir(), "rwc"}, {"/var/log/mercure", "rwc"}, {"public", "r"}}, sandboxPaths(v))
+
+	v = viper.New()
+	v.Set("transport_url", "bolt:///var/lib/mercure/updates?rotate=24h&archive_dir=/var/archives/mercure")
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"/var/lib/mercure/updates", "rwc"}, {"/var/archives/mercure", "rwc"}}, sandboxPaths(v))
+
+	v = viper.New()
+	v.Set("transport_url", "bolt:///var/lib/mercure/updates?readonly=1&rotate=24h")
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"/var/lib/mercure/updates", "r"}}, sandboxPaths(v))
+
+	v = viper.New()
+	v.Set("transport_url", "bolt:///var/lib/mercure/updates.db?compaction_threshold=0.5")
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"/var/lib/mercure", "rwc"}}, sandboxPaths(v))
+
+	v = viper.New()
+	v.Set("transport_url", "filelog:///var/log/mercure?rotate=24h")
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"/var/log/mercure", "rwc"}}, sandboxPaths(v))
+
+	v.Set("transport_url", "filelog://mercure")
+	assert.Equal(t, []sandboxPath{{"/etc/ssl", "r"}, {"mercure", "rwc"}}, sandboxPaths(v))
+}
+
+func TestCapabilityModeCompatible(t *testing.T) {
+	v := viper.New()
+	assert.Nil(t, capabilityModeCompatible(v))
+
+	v.Set("transport_url", "local://local")
+	assert.Nil(t, capabilityModeCompatible(v))
+
+	v.Set("transport_url", "bolt://test.db")
+	assert.Nil(t, capabilityModeCompatible(v))
+
+	v.Set("transport_url", "bolt://updates?rotate=1h")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the rotation of the Bolt database creates files`)
+
+	v.Set("transport_url", "bolt://updates?rotate=1h&readonly=1")
+	assert.Nil(t, capabilityModeCompatible(v))
+
+	v.Set("transport_url", "bolt://test.db?max_file_size=1048576")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the compaction of the Bolt database creates files`)
+
+	v.Set("transport_url", "filelog:///var/log/mercure")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the "filelog" transport creates files`)
+
+	v.Set("transport_url", "mysql://localhost/mercure")
+	err := capabilityModeCompatible(v)
+	assert.EqualError(t, err, `sandbox: incompatible configuration: the "mysql" transport opens connections`)
+	assert.True(t, errors.Is(err, ErrSandboxIncompatible))
+
+	v = viper.New()
+	v.Set("mirror_url", "https://staging.example.com/.well-known/mercure")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: "mirror_url" requires connecting to the secondary hub`)
+
+	v = viper.New()
+	v.Set("analytics_sinks", []string{"s3://analytics"})
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: "analytics_sinks" requires connecting to the analytics destinations`)
+
+	v = viper.New()
+	v.Set("jwt_key", "vault:secret/data/mercure#jwt_key")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the secrets stored in Vault require connecting to Vault`)
+
+	v = viper.New()
+	v.Set("update_buffer_strategy", "disk")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the "disk" buffer strategy creates files`)
+
+	v = viper.New()
+	v.Set("diagnostics_dir", "/var/log/mercure")
+	assert.EqualError(t, capabilityModeCompatible(v), `sandbox: incompatible configuration: the diagnostics bundles are written in new files`)
+}
+
+func TestEnterSandboxUnsupported(t *testing.T) {
+	if runtime.GOOS == "openbsd" || runtime.GOOS == "freebsd" || runtime.GOOS == "linux" {
+		t.Skip("sandboxing is supported on this platform")
+	}
+
+	h := createDummy()
+	assert.Equal(t, ErrSandboxUnsupported, h.enterSandbox())
+}
@@ -0,0 +1,125 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrInvalidSecretReference is returned when a secret reference cannot be resolved.
+var ErrInvalidSecretReference = errors.New("invalid secret reference")
+
+const (
+	secretEnvPrefix   = "env:"
+	secretFilePrefix  = "file://"
+	secretVaultPrefix = "vault:"
+	// secretFileTTL is the duration during which the content of a secret file is cached, rotated secrets are taken into account after this delay
+	secretFileTTL = 10 * time.Second
+)
+
+// secretKeys are the configuration parameters containing secrets, they can reference an environment variable ("env:NAME"), a file ("file:///run/secrets/name")
+// or a field of a HashiCorp Vault secret ("vault:secret/data/mercure#field").
+var secretKeys = []string{"jwt_key", "publisher_jwt_key", "subscriber_jwt_key", "transport_url", "acme_dns_provider", "target_resolver_url", "subscriber_authorization_url", "mirror_url", "mirror_jwt", "resume_hint_key", "vault_token"}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// secretFiles caches the content of the secret files, to not read them on every request.
+var secretFiles = struct {
+	sync.Mutex
+	m map[string]cachedSecret
+}{m: make(map[string]cachedSecret)}
+
+// getSecret returns the value of the given configuration parameter, resolving it if it's a secret reference.
+func getSecret(v *viper.Viper, key string) (string, error) {
+	value, err := resolveSecret(v, v.GetString(key))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// resolveSecret returns the value of the referenced environment variable, file or Vault secret, or the value itself if it isn't a reference.
+// The trailing newlines of files are removed.
+func resolveSecret(v *viper.Viper, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretEnvPrefix):
+		name := value[len(secretEnvPrefix):]
+		secret, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			return "", fmt.Errorf("%q: environment variable not set: %w", value, ErrInvalidSecretReference)
+		}
+
+		return secret, nil
+
+	case strings.HasPrefix(value, secretFilePrefix):
+		return readSecretFile(value[len(secretFilePrefix):], time.Now())
+
+	case strings.HasPrefix(value, secretVaultPrefix):
+		return readVaultSecret(v, value[len(secretVaultPrefix):], time.Now())
+	}
+
+	return value, nil
+}
+
+func readSecretFile(path string, now time.Time) (string, error) {
+	secretFiles.Lock()
+	defer secretFiles.Unlock()
+
+	if s, ok := secretFiles.m[path]; ok && now.Before(s.expires) {
+		return s.value, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%q: %v: %w", path, err, ErrInvalidSecretReference)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	secretFiles.m[path] = cachedSecret{value, now.Add(secretFileTTL)}
+
+	return value, nil
+}
+
+// validateSecrets checks that all the secret references of the configuration can be resolved.
+func validateSecrets(v *viper.Viper) error {
+	for _, key := range secretKeys {
+		if _, err := getSecret(v, key); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+
+	return nil
+}
+
+// usesVault checks if one of the secrets of the configuration is stored in Vault.
+func usesVault(v *viper.Viper) bool {
+	for _, key := range secretKeys {
+		if strings.HasPrefix(v.GetString(key), secretVaultPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// secretFilePaths returns the paths of the files referenced by the configuration.
+func secretFilePaths(v *viper.Viper) []string {
+	var paths []string
+	for _, key := range secretKeys {
+		if value := v.GetString(key); strings.HasPrefix(value, secretFilePrefix) {
+			paths = append(paths, value[len(secretFilePrefix):])
+		}
+	}
+
+	return paths
+}
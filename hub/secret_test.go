@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecret(t *testing.T) {
+	v, err := resolveSecret(viper.New(), "plain")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", v)
+
+	os.Setenv("MERCURE_TEST_SECRET", "from-env")
+	defer os.Unsetenv("MERCURE_TEST_SECRET")
+	v, err = resolveSecret(viper.New(), "env:MERCURE_TEST_SECRET")
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", v)
+
+	_, err = resolveSecret(viper.New(), "env:MERCURE_TEST_UNDEFINED")
+	assert.EqualError(t, err, `"env:MERCURE_TEST_UNDEFINED": environment variable not set: invalid secret reference`)
+	assert.True(t, errors.Is(err, ErrInvalidSecretReference))
+
+	_, err = resolveSecret(viper.New(), "file:///does/not/exist")
+	assert.True(t, errors.Is(err, ErrInvalidSecretReference))
+}
+
+func TestReadSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-secrets")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jwt_key")
+	require.Nil(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+
+	now := time.Now()
+	v, err := readSecretFile(path, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", v)
+
+	// Rotated secrets are taken into account once the cache expires
+	require.Nil(t, ioutil.WriteFile(path, []byte("second\r\n"), 0600))
+	v, _ = readSecretFile(path, now.Add(time.Second))
+	assert.Equal(t, "first", v)
+	v, _ = readSecretFile(path, now.Add(secretFileTTL))
+	assert.Equal(t, "second", v)
+}
+
+func TestSecretReferencesInConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mercure-secrets")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "publisher_jwt_key")
+	require.Nil(t, ioutil.WriteFile(path, []byte("publisher\n"), 0600))
+	os.Setenv("MERCURE_TEST_TRANSPORT_URL", "null://")
+	defer os.Unsetenv("MERCURE_TEST_TRANSPORT_URL")
+
+	v := viper.New()
+	v.Set("publisher_jwt_key", "file://"+path)
+	v.Set("subscriber_jwt_key", "subscriber")
+	v.Set("transport_url", "env:MERCURE_TEST_TRANSPORT_URL")
+	assert.Nil(t, ValidateConfig(v))
+	assert.Contains(t, sandboxPaths(v), sandboxPath{path, "r"})
+
+	h, err := NewHub(v)
+	require.Nil(t, err)
+	defer h.Stop()
+	assert.IsType(t, &LocalTransport{}, h.transport)
+	assert.Equal(t, []byte("publisher"), h.getJWTKey(publisherRole))
+	assert.Equal(t, []byte("subscriber"), h.getJWTKey(subscriberRole))
+
+	v.Set("jwt_key", "env:MERCURE_TEST_UNDEFINED")
+	assert.EqualError(t, ValidateConfig(v), `invalid config: jwt_key: "env:MERCURE_TEST_UNDEFINED": environment variable not set: invalid secret reference`)
+}
@@ -0,0 +1,116 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/spf13/viper"
+)
+
+const (
+	selfTestTopic  = "https://mercure.rocks/self-test/"
+	selfTestTarget = "https://mercure.rocks/targets/self-test"
+)
+
+var (
+	// ErrSelfTestFailed is returned when at least one of the self-test checks fails.
+	ErrSelfTestFailed = errors.New("self-test failed")
+
+	selfTestTimeout = 5 * time.Second //nolint:gochecknoglobals
+)
+
+// SelfTest boots the configured transport, publishes probe updates and checks that they are delivered live and through the history.
+// A diagnostic report is written in w. Probes are only visible to subscribers authorized for the "https://mercure.rocks/targets/self-test" target.
+func SelfTest(v *viper.Viper, w io.Writer) error {
+	fmt.Fprintln(w, "Mercure self-test")
+
+	h, err := NewHub(v)
+	if err != nil {
+		fmt.Fprintf(w, "[FAIL] configuration and transport: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	defer h.Stop()
+	fmt.Fprintf(w, "[OK] configuration and transport (%T)\n", h.transport)
+
+	return h.selfTest(w)
+}
+
+func (h *Hub) selfTest(w io.Writer) error {
+	pipe, err := h.transport.CreatePipe(LatestCursor())
+	if err != nil {
+		fmt.Fprintf(w, "[FAIL] subscription: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	defer pipe.Close()
+
+	first := newSelfTestUpdate()
+	start := time.Now()
+	if err := h.dispatch(first); err != nil {
+		fmt.Fprintf(w, "[FAIL] publication: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	fmt.Fprintf(w, "[OK] publication (%s)\n", time.Since(start))
+
+	if err := waitForSelfTestUpdate(pipe, first.ID); err != nil {
+		fmt.Fprintf(w, "[FAIL] live delivery: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	fmt.Fprintf(w, "[OK] live delivery (%s)\n", time.Since(start))
+
+	second := newSelfTestUpdate()
+	if err := h.dispatch(second); err != nil {
+		fmt.Fprintf(w, "[FAIL] publication: %s\n", err)
+		return ErrSelfTestFailed
+	}
+
+	start = time.Now()
+	historyPipe, err := h.transport.CreatePipe(AfterIDCursor(first.ID))
+	if errors.Is(err, ErrUnsupportedCursor) {
+		fmt.Fprintln(w, "[SKIP] history replay: not supported by this transport")
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(w, "[FAIL] history replay: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	defer historyPipe.Close()
+
+	if err := waitForSelfTestUpdate(historyPipe, second.ID); err != nil {
+		fmt.Fprintf(w, "[FAIL] history replay: %s\n", err)
+		return ErrSelfTestFailed
+	}
+	fmt.Fprintf(w, "[OK] history replay (%s)\n", time.Since(start))
+
+	return nil
+}
+
+func newSelfTestUpdate() *Update {
+	id := uuid.Must(uuid.NewV4()).String()
+
+	return &Update{
+		Topics:  []string{selfTestTopic + id},
+		Targets: map[string]struct{}{selfTestTarget: {}},
+		Event:   Event{Data: "self-test", ID: id},
+	}
+}
+
+// waitForSelfTestUpdate reads the pipe until the update with the given ID is received.
+func waitForSelfTestUpdate(pipe *Pipe, id string) error {
+	timeout := time.After(selfTestTimeout)
+	for {
+		select {
+		case u, ok := <-pipe.Read():
+			if !ok {
+				return ErrClosedPipe
+			}
+			if u.ID == id {
+				return nil
+			}
+		case <-timeout:
+			return fmt.Errorf("update %q not received after %s", id, selfTestTimeout)
+		}
+	}
+}
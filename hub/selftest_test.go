@@ -0,0 +1,56 @@
+package hub
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTestBolt(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("jwt_key", "foo")
+	v.Set("transport_url", "bolt://test.db")
+	defer os.Remove("test.db")
+
+	var b bytes.Buffer
+	assert.Nil(t, SelfTest(v, &b))
+	assert.Contains(t, b.String(), "[OK] configuration and transport (*hub.BoltTransport)\n")
+	assert.Contains(t, b.String(), "[OK] live delivery")
+	assert.Contains(t, b.String(), "[OK] history replay")
+}
+
+func TestSelfTestLocal(t *testing.T) {
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("jwt_key", "foo")
+	v.Set("transport_url", "null://")
+
+	var b bytes.Buffer
+	assert.Nil(t, SelfTest(v, &b))
+	assert.Contains(t, b.String(), "[OK] live delivery")
+	assert.Contains(t, b.String(), "[SKIP] history replay: not supported by this transport\n")
+}
+
+func TestSelfTestInvalidConfig(t *testing.T) {
+	var b bytes.Buffer
+	assert.Equal(t, ErrSelfTestFailed, SelfTest(viper.New(), &b))
+	assert.Contains(t, b.String(), "[FAIL] configuration and transport: invalid config")
+}
+
+func TestSelfTestClosedTransport(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer os.Remove("test.db")
+	transport.Close()
+
+	var b bytes.Buffer
+	h := createDummyWithTransportAndConfig(transport, viper.New())
+	assert.Equal(t, ErrSelfTestFailed, h.selfTest(&b))
+	assert.Equal(t, "[FAIL] subscription: hub: read/write on closed Transport\n", b.String())
+}
@@ -2,11 +2,15 @@ package hub
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -38,10 +42,12 @@ func (h *Hub) Serve() {
 
 	if !acme && certFile == "" && keyFile == "" {
 		log.WithFields(log.Fields{"protocol": "http", "addr": addr}).Info("Mercure started")
-		err = h.server.ListenAndServe()
+		err = h.listenAndServe(":http", h.server.Serve)
 	} else {
 		// TLS
-		if acme {
+		if acme && h.config.GetString("acme_dns_provider") != "" {
+			h.server.TLSConfig = h.dnsTLSConfig(acmeHosts, done)
+		} else if acme {
 			certManager := &autocert.Manager{
 				Prompt:     autocert.AcceptTOS,
 				HostPolicy: autocert.HostWhitelist(acmeHosts...),
@@ -57,8 +63,21 @@ func (h *Hub) Serve() {
 			go http.ListenAndServe(h.config.GetString("acme_http01_addr"), certManager.HTTPHandler(nil))
 		}
 
+		if certFile != "" && h.config.GetBool("sandbox") {
+			// The files cannot be opened anymore once the process is sandboxed
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if h.server.TLSConfig == nil {
+				h.server.TLSConfig = &tls.Config{}
+			}
+			h.server.TLSConfig.Certificates = append(h.server.TLSConfig.Certificates, cert)
+			certFile, keyFile = "", ""
+		}
+
 		log.WithFields(log.Fields{"protocol": "https", "addr": addr}).Info("Mercure started")
-		err = h.server.ListenAndServeTLS(certFile, keyFile)
+		err = h.listenAndServe(":https", func(l net.Listener) error { return h.server.ServeTLS(l, certFile, keyFile) })
 	}
 
 	if !errors.Is(err, http.ErrServerClosed) {
@@ -68,10 +87,65 @@ func (h *Hub) Serve() {
 	<-done
 }
 
+// listenAndServe listens on the configured address (or defaultAddr if not set), restricts the process if the sandbox is enabled, then serves.
+func (h *Hub) listenAndServe(defaultAddr string, serve func(net.Listener) error) error {
+	addr := h.server.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if h.config.GetBool("sandbox") {
+		if err := h.enterSandbox(); err != nil {
+			l.Close()
+			return err
+		}
+		log.Info("Sandbox enabled")
+	}
+
+	return serve(l)
+}
+
+// dnsTLSConfig obtains the certificate using the ACME dns-01 challenge, this allows to issue wildcard certificates and doesn't require the hub to be reachable by the ACME server.
+func (h *Hub) dnsTLSConfig(acmeHosts []string, done <-chan struct{}) *tls.Config {
+	dsn, err := getSecret(h.config, "acme_dns_provider")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider, err := newDNSProvider(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cache autocert.Cache
+	if acmeCertDir := h.config.GetString("acme_cert_dir"); acmeCertDir != "" {
+		cache = autocert.DirCache(acmeCertDir)
+	}
+
+	certManager := newDNSCertManager(acmeHosts, provider, cache)
+	if err := certManager.Start(done); err != nil {
+		log.Fatal(err)
+	}
+
+	return &tls.Config{GetCertificate: certManager.GetCertificate, NextProtos: []string{"h2", "http/1.1"}}
+}
+
+// Shutdown gracefully stops the server started by Serve, then the hub.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	return h.server.Shutdown(ctx)
+}
+
 func (h *Hub) listenShutdown() <-chan struct{} {
 	idleConnsClosed := make(chan struct{})
 
 	h.server.RegisterOnShutdown(func() {
+		// The subscribers are notified before the transport is closed, so they can resume from the last event they received
+		h.drainSubscribers(h.config.GetDuration("shutdown_drain"))
 		h.Stop()
 		select {
 		case <-idleConnsClosed:
@@ -85,7 +159,7 @@ func (h *Hub) listenShutdown() <-chan struct{} {
 		signal.Notify(sigint, os.Interrupt)
 		<-sigint
 
-		if err := h.server.Shutdown(context.Background()); err != nil {
+		if err := h.Shutdown(context.Background()); err != nil {
 			log.Error(err)
 		}
 		log.Infoln("My Baby Shot Me Down")
@@ -107,6 +181,17 @@ func (h *Hub) chainHandlers(acmeHosts []string) http.Handler {
 
 	r.HandleFunc(defaultHubURL, h.SubscribeHandler).Methods("GET", "HEAD")
 	r.HandleFunc(defaultHubURL, h.PublishHandler).Methods("POST")
+	r.HandleFunc(defaultHubURL+"/maintenance", h.MaintenanceHandler).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc(defaultHubURL+"/admin/config/transport", h.TransportConfigHandler).Methods("GET")
+	r.HandleFunc(defaultHubURL+"/admin/pipes", h.PipesHandler).Methods("GET")
+	r.HandleFunc(defaultHubURL+"/disconnect", h.DisconnectHandler).Methods("POST")
+	r.HandleFunc(defaultHubURL+"/debug/updates", h.DebugTailHandler).Methods("GET")
+	if len(h.config.GetStringSlice("public_stats_topics")) > 0 {
+		r.HandleFunc(defaultHubURL+"/stats/public", h.PublicStatsHandler).Methods("GET")
+	}
+	if h.shards != nil {
+		r.HandleFunc(defaultHubURL+"/route", h.RouteHandler).Methods("GET")
+	}
 	if debug || h.config.GetBool("demo") {
 		r.PathPrefix("/demo").HandlerFunc(Demo).Methods("GET", "HEAD")
 		r.PathPrefix("/").Handler(http.FileServer(http.Dir("public")))
@@ -114,9 +199,11 @@ func (h *Hub) chainHandlers(acmeHosts []string) http.Handler {
 		r.HandleFunc("/", welcomeHandler).Methods("GET", "HEAD")
 	}
 
+	allowedHosts, allowedHostsAreRegex := allowedHostPatterns(acmeHosts)
 	secureMiddleware := secure.New(secure.Options{
 		IsDevelopment:         debug,
-		AllowedHosts:          acmeHosts,
+		AllowedHosts:          allowedHosts,
+		AllowedHostsAreRegex:  allowedHostsAreRegex,
 		FrameDeny:             true,
 		ContentTypeNosniff:    true,
 		BrowserXssFilter:      true,
@@ -124,12 +211,8 @@ func (h *Hub) chainHandlers(acmeHosts []string) http.Handler {
 	})
 
 	var corsHandler http.Handler
-	corsAllowedOrigins := h.config.GetStringSlice("cors_allowed_origins")
-	if len(corsAllowedOrigins) > 0 {
-		allowedOrigins := handlers.AllowedOrigins(corsAllowedOrigins)
-		allowedHeaders := handlers.AllowedHeaders([]string{"authorization", "cache-control"})
-
-		corsHandler = handlers.CORS(handlers.AllowCredentials(), allowedOrigins, allowedHeaders)(r)
+	if len(h.config.GetStringSlice("cors_allowed_origins")) > 0 {
+		corsHandler = h.corsHandler(r)
 	} else {
 		corsHandler = r
 	}
@@ -149,13 +232,9 @@ func (h *Hub) chainHandlers(acmeHosts []string) http.Handler {
 	}
 
 	secureHandler := secureMiddleware.Handler(useForwardedHeadersHandlers)
-	loggingHandler := handlers.CombinedLoggingHandler(os.Stderr, secureHandler)
-	recoveryHandler := handlers.RecoveryHandler(
-		handlers.RecoveryLogger(log.New()),
-		handlers.PrintRecoveryStack(debug),
-	)(loggingHandler)
 
-	return recoveryHandler
+	// The recovery is done before logging the request, so the 500 status code appears in the access log
+	return handlers.CombinedLoggingHandler(os.Stderr, h.recoveryHandler(secureHandler))
 }
 
 // addHealthCheck adds a /healthz URL for health checks and /metrics if enable that doesn't pollute the HTTP logs.
@@ -164,15 +243,19 @@ func (h *Hub) healthCheck(acmeHosts []string) http.Handler {
 	mainRouter.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "ok")
 	}).Methods("GET", "HEAD")
+	mainRouter.HandleFunc("/readyz", h.readyHandler).Methods("GET", "HEAD")
 
 	if h.config.GetBool("metrics") {
 		h.metrics.Register(mainRouter)
+		if h.egress != nil {
+			mainRouter.Handle("/metrics/egress", h.egress).Methods("GET")
+		}
 	}
 
 	handler := h.chainHandlers(acmeHosts)
 	mainRouter.PathPrefix("/").Handler(handler)
 
-	return mainRouter
+	return h.recoveryHandler(mainRouter)
 }
 
 func welcomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -180,3 +263,28 @@ func welcomeHandler(w http.ResponseWriter, r *http.Request) {
 <title>Mercure Hub</title>
 <h1>Welcome to <a href="https://mercure.rocks">Mercure</a>!</h1>`)
 }
+
+// allowedHostPatterns converts the hosts to regular expressions if one of them is a wildcard, a wildcard matches exactly one label.
+func allowedHostPatterns(hosts []string) ([]string, bool) {
+	wildcard := false
+	for _, host := range hosts {
+		if strings.HasPrefix(host, "*.") {
+			wildcard = true
+			break
+		}
+	}
+	if !wildcard {
+		return hosts, false
+	}
+
+	patterns := make([]string, len(hosts))
+	for i, host := range hosts {
+		if strings.HasPrefix(host, "*.") {
+			patterns[i] = `[^.]+\.` + regexp.QuoteMeta(host[2:])
+		} else {
+			patterns[i] = regexp.QuoteMeta(host)
+		}
+	}
+
+	return patterns, true
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -139,7 +140,8 @@ func TestServe(t *testing.T) {
 		defer resp.Body.Close()
 		body, _ := ioutil.ReadAll(resp.Body)
 
-		assert.Equal(t, []byte(":\nid: first\ndata: hello\n\n"), body)
+		// The subscribers are notified of the shutdown, with the ID to resume from
+		assert.Equal(t, []byte(": instance hub-test\nid: first\ndata: hello\n\nevent: mercure-disconnect\ndata: {\"reason\":\"shutdown\",\"last_event_id\":\"first\"}\n\n"), body)
 	}()
 
 	go func() {
@@ -151,7 +153,8 @@ func TestServe(t *testing.T) {
 		defer resp.Body.Close()
 		body, _ := ioutil.ReadAll(resp.Body)
 
-		assert.Equal(t, []byte(":\nid: first\ndata: hello\n\n"), body)
+		// The subscribers are notified of the shutdown, with the ID to resume from
+		assert.Equal(t, []byte(": instance hub-test\nid: first\ndata: hello\n\nevent: mercure-disconnect\ndata: {\"reason\":\"shutdown\",\"last_event_id\":\"first\"}\n\n"), body)
 	}()
 
 	wgConnected.Wait()
@@ -303,6 +306,59 @@ func TestServeAcme(t *testing.T) {
 	h.server.Shutdown(context.Background())
 }
 
+func TestServeAcmeDNS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cert")
+	defer os.RemoveAll(dir)
+
+	// A valid certificate is in the cache, the ACME server isn't contacted
+	hosts := []string{"example.com", "*.example.com"}
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "dns01+example.com,*.example.com"), createPEMBundle(t, hosts, time.Now().Add(60*24*time.Hour)), 0600))
+
+	v := viper.New()
+	v.Set("acme_hosts", hosts)
+	v.Set("acme_cert_dir", dir)
+	v.Set("acme_dns_provider", "cloudflare://?api_token=secret&zone_id=zone")
+	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	go h.Serve()
+
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "hub.example.com", InsecureSkipVerify: true}, //nolint:gosec
+	}
+	client := http.Client{Transport: transport, Timeout: 100 * time.Millisecond}
+
+	var resp *http.Response
+	for resp == nil {
+		req, _ := http.NewRequest("GET", "https://"+testAddr+"/", nil)
+		req.Host = "hub.example.com"
+		resp, _ = client.Do(req) //nolint:bodyclose
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, hosts, resp.TLS.PeerCertificates[0].DNSNames)
+
+	req, _ := http.NewRequest("GET", "https://"+testAddr+"/", nil)
+	req.Host = "example.org"
+	resp2, err := client.Do(req)
+	require.Nil(t, err)
+	defer resp2.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, resp2.StatusCode)
+
+	h.server.Shutdown(context.Background())
+}
+
+func TestAllowedHostPatterns(t *testing.T) {
+	patterns, regex := allowedHostPatterns([]string{"example.com"})
+	assert.Equal(t, []string{"example.com"}, patterns)
+	assert.False(t, regex)
+
+	patterns, regex = allowedHostPatterns([]string{"example.com", "*.example.com"})
+	assert.Equal(t, []string{`example\.com`, `[^.]+\.example\.com`}, patterns)
+	assert.True(t, regex)
+}
+
 func TestMetricsAccess(t *testing.T) {
 	v := viper.New()
 	v.Set("metrics", true)
@@ -320,6 +376,35 @@ func TestMetricsAccess(t *testing.T) {
 
 	assert.Equal(t, 200, resp.StatusCode)
 
+	// The egress endpoint is opt-in
+	respEgress, err := client.Get("http://" + testAddr + "/metrics/egress")
+	require.Nil(t, err)
+	defer respEgress.Body.Close()
+
+	assert.Equal(t, 404, respEgress.StatusCode)
+
+	h.server.Shutdown(context.Background())
+}
+
+func TestMetricsEgressAccess(t *testing.T) {
+	v := viper.New()
+	v.Set("metrics", true)
+	v.Set("metrics_egress", true)
+	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	go h.Serve()
+
+	client := http.Client{Timeout: 100 * time.Millisecond}
+
+	var resp *http.Response
+	for resp == nil {
+		resp, _ = client.Get("http://" + testAddr + "/metrics/egress") //nolint:bodyclose
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
 	h.server.Shutdown(context.Background())
 }
 
@@ -340,12 +425,12 @@ func TestMetricsCollect(t *testing.T) {
 	body = url.Values{"topic": {"http://example.com/foo/1"}, "data": {"second hello"}, "id": {"second"}}
 	server.publish(body)
 
-	server.assertMetric("mercure_subcribers{topic=\"http://example.com/foo/1\"} 1")
-	server.assertMetric("mercure_subcribers{topic=\"http://example.com/alt/1\"} 2")
-	server.assertMetric("mercure_subcribers_total{topic=\"http://example.com/foo/1\"} 1")
-	server.assertMetric("mercure_subcribers_total{topic=\"http://example.com/alt/1\"} 3")
-	server.assertMetric("mercure_updates_total{topic=\"http://example.com/foo/1\"} 2")
-	server.assertMetric("mercure_updates_total{topic=\"http://example.com/alt/1\"} 1")
+	server.assertMetric("mercure_subcribers{instance_id=\"hub-test\",topic=\"http://example.com/foo/1\"} 1")
+	server.assertMetric("mercure_subcribers{instance_id=\"hub-test\",topic=\"http://example.com/alt/1\"} 2")
+	server.assertMetric("mercure_subcribers_total{instance_id=\"hub-test\",topic=\"http://example.com/foo/1\"} 1")
+	server.assertMetric("mercure_subcribers_total{instance_id=\"hub-test\",topic=\"http://example.com/alt/1\"} 3")
+	server.assertMetric("mercure_updates_total{instance_id=\"hub-test\",topic=\"http://example.com/foo/1\"} 2")
+	server.assertMetric("mercure_updates_total{instance_id=\"hub-test\",topic=\"http://example.com/alt/1\"} 1")
 
 	server.shutdown()
 }
@@ -424,13 +509,26 @@ func (s *testServer) waitSubscribers() {
 	s.wgConnected.Wait()
 }
 
+// assertMetric waits for the metric to be exposed, the disconnections of the subscribers are detected asynchronously.
 func (s *testServer) assertMetric(metric string) {
+	var body string
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		body = s.fetchMetrics()
+		if strings.Contains(body, metric) || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	assert.Contains(s.t, body, metric)
+}
+
+func (s *testServer) fetchMetrics() string {
 	resp, err := s.client.Get("http://" + testAddr + "/metrics")
-	assert.Nil(s.t, err)
+	require.Nil(s.t, err)
 	defer resp.Body.Close()
 
 	b, err := ioutil.ReadAll(resp.Body)
-	assert.Nil(s.t, err)
+	require.Nil(s.t, err)
 
-	assert.Contains(s.t, string(b), metric)
+	return string(b)
 }
@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shardVirtualNodes is the number of points of every node on the ring, to spread the topics evenly.
+const shardVirtualNodes = 128
+
+type shardNode struct {
+	id  string
+	url string
+}
+
+// shardRing assigns the topics to the nodes of the cluster using consistent hashing:
+// adding or removing a node only moves the topics of the neighboring points of the ring.
+type shardRing struct {
+	hashes []uint64
+	nodes  []*shardNode
+}
+
+// newShardRing parses the "shard_nodes" list, formatted as "id=url", it returns nil if the list is empty.
+func newShardRing(nodes []string) (*shardRing, error) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	r := &shardRing{}
+	ids := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		parts := strings.SplitN(n, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(`%w: invalid "shard_nodes" node %q, must be formatted as "id=url"`, ErrInvalidConfig, n)
+		}
+		if _, ok := ids[parts[0]]; ok {
+			return nil, fmt.Errorf(`%w: duplicate "shard_nodes" node %q`, ErrInvalidConfig, parts[0])
+		}
+		ids[parts[0]] = struct{}{}
+
+		node := &shardNode{parts[0], parts[1]}
+		for i := 0; i < shardVirtualNodes; i++ {
+			r.hashes = append(r.hashes, shardHash(node.id+"#"+strconv.Itoa(i)))
+			r.nodes = append(r.nodes, node)
+		}
+	}
+
+	sort.Sort(r)
+
+	return r, nil
+}
+
+// owner returns the node owning the topic: the first one following the hash of the topic on the ring.
+func (r *shardRing) owner(topic string) *shardNode {
+	h := shardHash(topic)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.nodes[i]
+}
+
+func (r *shardRing) Len() int           { return len(r.hashes) }
+func (r *shardRing) Less(i, j int) bool { return r.hashes[i] < r.hashes[j] }
+func (r *shardRing) Swap(i, j int) {
+	r.hashes[i], r.hashes[j] = r.hashes[j], r.hashes[i]
+	r.nodes[i], r.nodes[j] = r.nodes[j], r.nodes[i]
+}
+
+func shardHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	return h.Sum64()
+}
+
+// RouteHandler returns the node of the cluster owning the topic passed in the "topic" query parameter,
+// so smart clients and load balancers can connect directly to it.
+func (h *Hub) RouteHandler(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "Missing \"topic\" parameter", http.StatusBadRequest)
+		return
+	}
+
+	node := h.shards.owner(topic)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Topic string `json:"topic"`
+		Node  string `json:"node"`
+		URL   string `json:"url"`
+		Self  bool   `json:"self"`
+	}{topic, node.id, node.url, node.id == h.config.GetString("node_id")})
+}
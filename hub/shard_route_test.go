@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShardRing(t *testing.T) {
+	r, err := newShardRing(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	_, err = newShardRing([]string{"node-1"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: invalid "shard_nodes" node "node-1", must be formatted as "id=url"`)
+
+	_, err = newShardRing([]string{"node-1=https://a.example.com", "node-1=https://b.example.com"})
+	assert.EqualError(t, err, `invalid config: duplicate "shard_nodes" node "node-1"`)
+}
+
+func TestShardRingOwner(t *testing.T) {
+	r, err := newShardRing([]string{"node-1=https://1.example.com", "node-2=https://2.example.com", "node-3=https://3.example.com"})
+	require.Nil(t, err)
+
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		topic := "https://example.com/books/" + strconv.Itoa(i)
+		owners[topic] = r.owner(topic).id
+		counts[owners[topic]]++
+
+		// The assignment is stable
+		assert.Equal(t, owners[topic], r.owner(topic).id)
+	}
+
+	// The topics are spread across all nodes
+	for _, id := range []string{"node-1", "node-2", "node-3"} {
+		assert.Greater(t, counts[id], 500)
+	}
+
+	// Removing a node only moves its own topics
+	r, err = newShardRing([]string{"node-1=https://1.example.com", "node-2=https://2.example.com"})
+	require.Nil(t, err)
+	for topic, id := range owners {
+		if id != "node-3" {
+			assert.Equal(t, id, r.owner(topic).id)
+		}
+	}
+}
+
+func TestRouteHandler(t *testing.T) {
+	v := viper.New()
+	v.Set("shard_nodes", []string{"node-1=https://1.example.com/.well-known/mercure"})
+	v.Set("node_id", "node-1")
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	w := httptest.NewRecorder()
+	hub.RouteHandler(w, httptest.NewRequest("GET", defaultHubURL+"/route?topic="+url.QueryEscape("https://example.com/books/1"), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, `{"topic":"https://example.com/books/1","node":"node-1","url":"https://1.example.com/.well-known/mercure","self":true}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	hub.RouteHandler(w, httptest.NewRequest("GET", defaultHubURL+"/route", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,47 @@
+package hub
+
+import (
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// shutdownDisconnectReason is the reason sent to the subscribers disconnected when the hub is gracefully stopped
+	shutdownDisconnectReason = "shutdown"
+	// shutdownGracePeriod is how long the connections can take to close after the drain duration
+	shutdownGracePeriod  = 5 * time.Second
+	shutdownPollInterval = 10 * time.Millisecond
+)
+
+// drainSubscribers sends the last event of a graceful disconnection, containing the ID of the last event they received, to the subscribers connected to this node.
+// They are disconnected at a random time during the drain duration to spread the reconnections, or immediately if it is zero.
+// It returns when all the connections are closed, or when the grace period has elapsed after the drain duration.
+//
+// It must be called once the server stopped accepting new requests: over HTTP/2, the clients have received a GOAWAY frame and will
+// open a new connection, to another node or to the restarted one, to resume from the last event ID without losing updates.
+func (h *Hub) drainSubscribers(drain time.Duration) {
+	subscribers := h.connections.list()
+	for _, s := range subscribers {
+		s := s
+
+		var delay time.Duration
+		if drain > 0 {
+			delay = time.Duration(rand.Int63n(int64(drain)))
+		}
+		time.AfterFunc(delay, func() { h.connections.disconnectSubscriber(s, shutdownDisconnectReason) })
+	}
+
+	deadline := time.Now().Add(drain + shutdownGracePeriod)
+	for h.connections.activeCount() > 0 {
+		if time.Now().After(deadline) {
+			log.WithFields(log.Fields{"subscribers": h.connections.activeCount()}).Warn("Shutdown: the drain duration elapsed before all the subscribers were disconnected")
+			return
+		}
+
+		time.Sleep(shutdownPollInterval)
+	}
+
+	log.WithFields(log.Fields{"subscribers": len(subscribers)}).Info("Shutdown: subscribers drained")
+}
@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainSubscribers(t *testing.T) {
+	v := viper.New()
+	v.Set("resume_hint_key", "secret")
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.SubscribeHandler(w, httptest.NewRequest("GET", defaultHubURL+"?topic="+url.QueryEscape("https://example.com/books/1"), nil))
+	}()
+
+	require.Eventually(t, func() bool {
+		return hub.connections.activeCount() == 1
+	}, time.Second, time.Millisecond)
+
+	hub.transport.Write(&Update{Topics: []string{"https://example.com/books/1"}, Event: Event{ID: "a", Data: "d1"}})
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(hub.metrics.subscriberBytes) > 0
+	}, time.Second, time.Millisecond)
+
+	hub.drainSubscribers(0)
+
+	assert.Equal(t, 0, hub.connections.activeCount())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the subscriber hasn't been disconnected")
+	}
+
+	hint := signResumeHint([]byte("secret"), "a")
+	assert.Equal(t, ": instance hub-test\nid: a\ndata: d1\n\nevent: mercure-disconnect\ndata: {\"reason\":\"shutdown\",\"last_event_id\":\"a\",\"resume\":\""+hint+"\"}\n\n", w.Body.String())
+}
+
+func TestDrainSubscribersSpread(t *testing.T) {
+	hub := createAnonymousDummy()
+	defer hub.Stop()
+
+	dones := make([]chan struct{}, 3)
+	for i := range dones {
+		done := make(chan struct{})
+		dones[i] = done
+		go func() {
+			defer close(done)
+			hub.SubscribeHandler(httptest.NewRecorder(), httptest.NewRequest("GET", defaultHubURL+"?topic=foo", nil))
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return hub.connections.activeCount() == 3
+	}, time.Second, time.Millisecond)
+
+	start := time.Now()
+	hub.drainSubscribers(50 * time.Millisecond)
+	assert.Less(t, int64(time.Since(start)), int64(shutdownGracePeriod))
+
+	for _, done := range dones {
+		<-done
+	}
+	assert.Empty(t, hub.connections.list())
+}
+
+func TestDrainSubscribersWithoutSubscribers(t *testing.T) {
+	hub := createAnonymousDummy()
+	defer hub.Stop()
+
+	start := time.Now()
+	hub.drainSubscribers(time.Minute)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +25,39 @@ type subscription struct {
 	Active bool   `json:"active"`
 	mercureClaim
 	Address string `json:"address,omitempty"`
+	// Subscriber is the stable ID of the subscriber, if derived from a JWT claim
+	Subscriber string `json:"subscriber,omitempty"`
+	// Instance is the ID of the hub process the subscriber is connected to
+	Instance string `json:"instance,omitempty"`
+}
+
+// Reasons of the end of a subscription, reported in the access log.
+const (
+	disconnectClient       = "client"
+	disconnectServer       = "server"
+	disconnectSlowConsumer = "slow-consumer"
+	disconnectAdmin        = "admin"
+	disconnectRevoked      = "revoked"
+	disconnectChaos        = "chaos"
+)
+
+// session collects the statistics of a subscription, logged when the connection ends.
+type session struct {
+	start  time.Time
+	events uint64
+	bytes  uint64
+	reason string
+	// lastEventID is the ID of the last update of the history delivered to the subscriber
+	lastEventID string
+}
+
+func (s *session) fields() log.Fields {
+	return log.Fields{
+		"duration":          time.Since(s.start),
+		"events":            s.events,
+		"bytes":             s.bytes,
+		"disconnect_reason": s.reason,
+	}
 }
 
 // SubscribeHandler create a keep alive connection and send the events to the subscribers.
@@ -37,13 +71,71 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	s := &session{start: time.Now(), reason: disconnectServer, lastEventID: subscriber.LastEventID}
 	defer h.cleanup(subscriber)
-	defer unsubscribed()
-	defer pipe.Close()
+	defer func() { unsubscribed(s) }()
+	defer func() {
+		pipe.Close()
+		h.metrics.PipeClosed(pipe.Stats())
+	}()
+
+	// The projection has been validated by initSubscription
+	projection := h.projections[r.URL.Query().Get("projection")]
 
 	hearthbeatInterval := h.config.GetDuration("heartbeat_interval")
 	var cancel context.CancelFunc
 
+	if h.config.GetBool("subscriber_greeting") {
+		n, _ := io.WriteString(w, h.greetingEvent(subscriber, hearthbeatInterval))
+		f.Flush()
+		s.bytes += uint64(n)
+		h.recordEgress(subscriber, n)
+	}
+
+	// When the maintenance mode drains the hub, the subscriber is disconnected after a random delay
+	draining := h.maintenance.drainChan()
+	var drainTimer <-chan time.Time
+
+	send := func(update *Update) bool {
+		serializedUpdate := projection.serialize(update, h.eventFormat)
+		if !h.publish(serializedUpdate, subscriber, w, r) {
+			return false
+		}
+
+		s.events++
+		s.bytes += uint64(len(serializedUpdate.event))
+		h.recordEgress(subscriber, len(serializedUpdate.event))
+		if nil != cancel {
+			cancel()
+		}
+
+		return true
+	}
+
+	// terminate sends the last event of a graceful disconnection
+	terminate := func(reason string) {
+		n, _ := io.WriteString(w, disconnectEvent(reason, s.lastEventID, h.resumeHint(s.lastEventID)))
+		f.Flush()
+		s.bytes += uint64(n)
+		h.recordEgress(subscriber, n)
+	}
+
+	// The updates of the ops topics are published by this node only, a nil channel if the subscriber isn't interested in them
+	var opsUpdates chan *Update
+	if h.ops != nil {
+		opsUpdates = h.ops.subscribe(subscriber)
+		defer h.ops.unsubscribe(opsUpdates)
+	}
+
+	disconnect := h.connections.add(subscriber, pipe)
+	defer h.connections.remove(subscriber)
+
+	// The authorization of the subscriber is re-evaluated when an update is delivered, at most once per interval
+	var nextAuthorization time.Time
+	if h.authorizer != nil {
+		nextAuthorization = time.Now().Add(h.authorizer.interval)
+	}
+
 	for {
 		ctx := context.Background()
 		if hearthbeatInterval != time.Duration(0) {
@@ -54,27 +146,106 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			// Listen to the closing of the http connection via the Request's Context
+			s.reason = disconnectClient
 			return
+		case <-draining:
+			if delay, ok := h.maintenance.drainDelay(); ok {
+				draining = nil
+				drainTimer = time.After(delay)
+			} else {
+				draining = h.maintenance.drainChan()
+			}
+		case <-drainTimer:
+			if h.maintenance.isDraining() {
+				terminate(drainDisconnectReason)
+				return
+			}
+
+			// The maintenance mode has been disabled in the meantime
+			draining = h.maintenance.drainChan()
+			drainTimer = nil
 		case <-ctx.Done():
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 				// Send a SSE comment as a heartbeat, to prevent issues with some proxies and old browsers
-				fmt.Fprint(w, ":\n")
+				n, _ := fmt.Fprint(w, ":\n")
 				f.Flush()
+				s.bytes += uint64(n)
+				h.recordEgress(subscriber, n)
 			}
+		case reason := <-disconnect:
+			terminate(reason)
+			s.reason = disconnectAdmin
+			return
+		case update := <-opsUpdates:
+			send(update)
 		case update, ok := <-pipe.Read():
 			if !ok {
+				if pipe.Overflowed() {
+					s.reason = disconnectSlowConsumer
+				}
+				return
+			}
+
+			// When the subscriber is behind, deliver only the relevant part of the queued updates
+			backlog, open := readBacklog(pipe, update)
+			if h.authorizer != nil && !time.Now().Before(nextAuthorization) {
+				nextAuthorization = time.Now().Add(h.authorizer.interval)
+				if !h.reauthorize(subscriber) {
+					for _, u := range backlog {
+						u.Release()
+					}
+					terminate(revokedDisconnectReason)
+					s.reason = disconnectRevoked
+					return
+				}
+			}
+			chaosDisconnect := false
+			for _, u := range compactBacklog(backlog, subscriber, time.Now()) {
+				if h.chaos != nil && h.chaos.drop(u) {
+					continue
+				}
+				if send(u) {
+					s.lastEventID = u.ID
+					if h.chaos != nil && h.chaos.disconnect() {
+						chaosDisconnect = true
+						break
+					}
+				}
+			}
+			for _, u := range backlog {
+				u.Release()
+			}
+			if chaosDisconnect {
+				// Like a network failure, no disconnection event is sent
+				s.reason = disconnectChaos
 				return
 			}
-			if h.publish(newSerializedUpdate(update), subscriber, w, r) && nil != cancel {
-				cancel()
+
+			// The updates dropped by the buffer were queued after the ones already read
+			if d, ok := pipe.takeDropped(); ok {
+				n, _ := io.WriteString(w, droppedEvent(d))
+				f.Flush()
+				s.bytes += uint64(n)
+				h.recordEgress(subscriber, n)
+			}
+
+			if !open {
+				if pipe.Overflowed() {
+					s.reason = disconnectSlowConsumer
+				}
+				return
 			}
 		}
 	}
 }
 
 // initSubscription initializes the connection.
-func (h *Hub) initSubscription(w http.ResponseWriter, r *http.Request) (*Subscriber, *Pipe, func(), bool) {
-	fields := log.Fields{"remote_addr": r.RemoteAddr}
+func (h *Hub) initSubscription(w http.ResponseWriter, r *http.Request) (*Subscriber, *Pipe, func(*session), bool) {
+	fields := log.Fields{"instance_id": h.instanceID, "remote_addr": r.RemoteAddr}
+
+	if h.rejectForMaintenance(w, true) || h.rejectForMemoryPressure(w) {
+		return nil, nil, nil, false
+	}
 
 	claims, err := authorize(r, h.getJWTKey(subscriberRole), h.getJWTAlgorithm(subscriberRole), nil)
 	if h.config.GetBool("debug") && claims != nil {
@@ -93,37 +264,94 @@ func (h *Hub) initSubscription(w http.ResponseWriter, r *http.Request) (*Subscri
 	}
 	fields["subscriber_topics"] = topics
 
+	since, err := retrieveSince(r)
+	if err != nil {
+		http.Error(w, "Invalid \"since\" parameter.", http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+
+	var conflate bool
+	if c := r.URL.Query().Get("conflate"); c != "" {
+		if conflate, err = strconv.ParseBool(c); err != nil {
+			http.Error(w, "Invalid \"conflate\" parameter.", http.StatusBadRequest)
+			return nil, nil, nil, false
+		}
+	}
+
+	if name := r.URL.Query().Get("projection"); name != "" {
+		if _, ok := h.projections[name]; !ok {
+			http.Error(w, "Invalid \"projection\" parameter.", http.StatusBadRequest)
+			return nil, nil, nil, false
+		}
+	}
+
+	lastEventID := retrieveLastEventID(r)
+	if hint := r.URL.Query().Get("resume"); hint != "" {
+		// The resume hint takes precedence, it has been issued by the hub itself
+		id, ok := h.resumeHintEventID(hint)
+		if !ok {
+			http.Error(w, "Invalid \"resume\" parameter.", http.StatusBadRequest)
+			return nil, nil, nil, false
+		}
+		lastEventID = id
+	}
+
 	rawTopics, templateTopics := h.parseTopics(topics)
 
 	authorizedAlltargets, authorizedTargets := authorizedTargets(claims, false)
-	subscriber := NewSubscriber(authorizedAlltargets, authorizedTargets, topics, rawTopics, templateTopics, retrieveLastEventID(r))
+	subscriber := NewSubscriber(authorizedAlltargets, authorizedTargets, topics, rawTopics, templateTopics, lastEventID)
+	if claims != nil {
+		subscriber.Subject = claims.Subject
+	}
 
 	encodedTopics := escapeTopics(topics)
 
 	// Connection events must be sent before creating the pipe to prevent a deadlock
+	// The connection ID must stay unique, a same subscriber can open several connections at once
 	connectionID := uuid.Must(uuid.NewV4()).String()
+	if subscriberID := h.subscriberID(claims); subscriberID != "" {
+		fields["subscriber_id"] = subscriberID
+	}
 	var address string
 	if h.config.GetBool("subscriptions_include_ip") {
 		address, _, _ = net.SplitHostPort(r.RemoteAddr)
 	}
 	h.dispatchSubscriptionUpdate(topics, encodedTopics, connectionID, claims, true, address)
-	pipe, err := h.transport.CreatePipe(subscriber.LastEventID)
+	var historyTopics []string
+	if len(templateTopics) == 0 {
+		// The templates can't be used to narrow the history
+		historyTopics = rawTopics
+	}
+	pipe, err := h.createPipe(subscriber.LastEventID, since, historyTopics)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		h.dispatchSubscriptionUpdate(topics, encodedTopics, connectionID, claims, false, address)
 		log.WithFields(fields).Error(err)
 		return nil, nil, nil, false
 	}
-	sendHeaders(w)
+	if c := h.conflation(conflate); c != nil {
+		pipe.Conflate(h.config.GetInt("update_buffer_overflow_size"), c)
+	}
+	pipe.trackDropped(func(u *Update) bool {
+		return len(u.Topics) > 0 && subscriber.IsAuthorized(u) && subscriber.IsSubscribed(u)
+	})
+	sendHeaders(w, h.instanceID)
 	log.WithFields(fields).Info("New subscriber")
 
 	h.metrics.NewSubscriber(subscriber)
+	h.metrics.PipeCreated()
+	if h.topicTracker != nil {
+		h.topicTracker.subscribe(topics)
+	}
 
-	unsubscribed := func() {
+	unsubscribed := func(s *session) {
 		h.dispatchSubscriptionUpdate(topics, encodedTopics, connectionID, claims, false, address)
-		log.WithFields(fields).Info("Subscriber disconnected")
+		log.WithFields(fields).WithFields(s.fields()).Info("Subscriber disconnected")
 
 		h.metrics.SubscriberDisconnect(subscriber)
+		if h.topicTracker != nil {
+			h.topicTracker.unsubscribe(topics)
+		}
 	}
 
 	return subscriber, pipe, unsubscribed, true
@@ -163,7 +391,7 @@ func (h *Hub) getURITemplate(topic string) *uritemplate.Template {
 }
 
 // sendHeaders sends correct HTTP headers to create a keep-alive connection.
-func sendHeaders(w http.ResponseWriter) {
+func sendHeaders(w http.ResponseWriter, instanceID string) {
 	// Keep alive, useful only for HTTP 1 clients https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Keep-Alive
 	w.Header().Set("Connection", "keep-alive")
 
@@ -178,19 +406,73 @@ func sendHeaders(w http.ResponseWriter) {
 	// NGINX support https://www.nginx.com/resources/wiki/start/topics/examples/x-accel/#x-accel-buffering
 	w.Header().Set("X-Accel-Buffering", "no")
 
-	// Write a comment in the body
+	// Write a comment containing the ID of the hub process in the body
 	// Go currently doesn't provide a better way to flush the headers
-	fmt.Fprint(w, ":\n")
+	if instanceID == "" {
+		fmt.Fprint(w, ":\n")
+	} else {
+		fmt.Fprintf(w, ": instance %s\n", instanceID)
+	}
 	w.(http.Flusher).Flush()
 }
 
-// retrieveLastEventID extracts the Last-Event-ID from the corresponding HTTP header with a fallback on the query parameter.
+// earliestEventID is the Last-Event-ID replaying all the updates still stored by the transport.
+const earliestEventID = "earliest"
+
+// retrieveLastEventID extracts the Last-Event-ID from the corresponding HTTP header with a fallback on the "lastEventID" and "Last-Event-ID" query parameters.
 func retrieveLastEventID(r *http.Request) string {
 	if id := r.Header.Get("Last-Event-ID"); id != "" {
 		return id
 	}
 
-	return r.URL.Query().Get("Last-Event-ID")
+	query := r.URL.Query()
+	if id := query.Get("lastEventID"); id != "" {
+		return id
+	}
+
+	return query.Get("Last-Event-ID")
+}
+
+// retrieveSince extracts the duration of the history to replay from the "since" query parameter.
+func retrieveSince(r *http.Request) (time.Duration, error) {
+	p := r.URL.Query().Get("since")
+	if p == "" {
+		return 0, nil
+	}
+
+	since, err := time.ParseDuration(p)
+	if err != nil || since < 0 {
+		return 0, fmt.Errorf("invalid since parameter %q", p)
+	}
+
+	return since, nil
+}
+
+// createPipe creates a pipe fetching the updates since the given ID (the whole history for the "earliest" ID) or,
+// if no ID is provided, the updates published during the given duration.
+// If topics isn't empty, the transport may only fetch the updates of the history having one of them.
+// If the transport doesn't support the history, only the updates published after the creation of the pipe are sent.
+func (h *Hub) createPipe(lastEventID string, since time.Duration, topics []string) (*Pipe, error) {
+	cursor := LatestCursor()
+	switch {
+	case lastEventID == earliestEventID:
+		cursor = EarliestCursor()
+	case lastEventID != "":
+		cursor = AfterIDCursor(lastEventID)
+	case since > 0:
+		cursor = AfterTimeCursor(time.Now().Add(-since))
+	}
+	cursor.Topics = topics
+
+	pipe, err := h.transport.CreatePipe(cursor)
+	if errors.Is(err, ErrUnsupportedCursor) {
+		pipe, err = h.transport.CreatePipe(LatestCursor())
+	}
+	if err == nil && h.memory != nil {
+		pipe.setMemoryGuard(h.memory)
+	}
+
+	return pipe, err
 }
 
 // publish sends the update to the client, if authorized.
@@ -217,18 +499,22 @@ func (h *Hub) publish(serializedUpdate *serializedUpdate, subscriber *Subscriber
 // cleanup removes unused uritemplate.Template instances from memory.
 func (h *Hub) cleanup(s *Subscriber) {
 	keys := make([]string, 0, len(s.RawTopics)+len(s.TemplateTopics))
-	copy(s.RawTopics, keys)
+	keys = append(keys, s.RawTopics...)
 	for _, uriTemplate := range s.TemplateTopics {
 		keys = append(keys, uriTemplate.Raw())
 	}
 
 	h.uriTemplates.Lock()
 	for _, key := range keys {
-		counter := h.uriTemplates.m[key].counter
-		if counter == 0 {
+		tplCache, ok := h.uriTemplates.m[key]
+		if !ok {
+			continue
+		}
+
+		if tplCache.counter <= 1 {
 			delete(h.uriTemplates.m, key)
 		} else {
-			h.uriTemplates.m[key].counter = counter - 1
+			tplCache.counter--
 		}
 	}
 	h.uriTemplates.Unlock()
@@ -239,13 +525,16 @@ func (h *Hub) dispatchSubscriptionUpdate(topics, encodedTopics []string, connect
 		return
 	}
 
+	subscriberID := h.subscriberID(claims)
 	for k, topic := range topics {
 		connection := &subscription{
-			ID:      "https://mercure.rocks/subscriptions/" + encodedTopics[k] + "/" + connectionID,
-			Type:    "https://mercure.rocks/Subscription",
-			Topic:   topic,
-			Active:  active,
-			Address: address,
+			ID:         "https://mercure.rocks/subscriptions/" + encodedTopics[k] + "/" + connectionID,
+			Type:       "https://mercure.rocks/Subscription",
+			Topic:      topic,
+			Active:     active,
+			Address:    address,
+			Subscriber: subscriberID,
+			Instance:   h.instanceID,
 		}
 
 		if claims == nil {
@@ -275,6 +564,22 @@ func (h *Hub) dispatchSubscriptionUpdate(topics, encodedTopics []string, connect
 	}
 }
 
+// subscriberID returns the stable ID of the subscriber, derived from the JWT claim set in the "subscriber_id_claim" configuration parameter.
+// It returns an empty string if the parameter isn't set or if the JWT doesn't contain the claim.
+func (h *Hub) subscriberID(claims *claims) string {
+	name := h.config.GetString("subscriber_id_claim")
+	if name == "" || claims == nil {
+		return ""
+	}
+
+	id, ok := claims.claim(name)
+	if !ok {
+		return ""
+	}
+
+	return url.PathEscape(id)
+}
+
 func escapeTopics(topics []string) []string {
 	encodedTopics := make([]string, 0, len(topics))
 	for _, topic := range topics {
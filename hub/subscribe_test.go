@@ -2,6 +2,7 @@ package hub
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -14,8 +15,10 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type responseWriterMock struct {
@@ -163,7 +166,7 @@ func (*createPipeErrorTransport) Write(update *Update) error {
 	return nil
 }
 
-func (*createPipeErrorTransport) CreatePipe(fromID string) (*Pipe, error) {
+func (*createPipeErrorTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
 	return nil, errFailedToCreatePipe
 }
 
@@ -237,7 +240,7 @@ func testSubscribe(numberOfSubscribers int, t *testing.T) {
 
 			w := &responseTester{
 				expectedStatusCode: http.StatusOK,
-				expectedBody:       ":\nid: b\ndata: Hello World\n\nid: c\ndata: Great\n\nid: d\ndata: Faulty IRI\n\nid: e\ndata: string\n\n",
+				expectedBody:       ": instance hub-test\nid: b\ndata: Hello World\n\nid: c\ndata: Great\n\nid: d\ndata: Faulty IRI\n\nid: e\ndata: string\n\n",
 				t:                  t,
 				cancel:             cancel,
 			}
@@ -326,7 +329,7 @@ func TestSubscribeTarget(t *testing.T) {
 
 	w := &responseTester{
 		expectedStatusCode: http.StatusOK,
-		expectedBody:       ":\nevent: test\nid: b\ndata: Hello World\n\nretry: 1\nid: c\ndata: Great\n\n",
+		expectedBody:       ": instance hub-test\nevent: test\nid: b\ndata: Hello World\n\nretry: 1\nid: c\ndata: Great\n\n",
 		t:                  t,
 		cancel:             cancel,
 	}
@@ -335,6 +338,30 @@ func TestSubscribeTarget(t *testing.T) {
 	hub.Stop()
 }
 
+func TestSubscriptionEventsSubscriberID(t *testing.T) {
+	hub := createDummy()
+	hub.config.Set("dispatch_subscriptions", true)
+	hub.config.Set("subscriber_id_claim", "client.id")
+	defer hub.Stop()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	c := &claims{raw: json.RawMessage(`{"client": {"id": "alice/1"}}`)}
+	id := hub.subscriberID(c)
+	assert.Equal(t, "alice%2F1", id)
+
+	hub.dispatchSubscriptionUpdate([]string{"https://example.com"}, escapeTopics([]string{"https://example.com"}), "connection-1", c, true, "")
+
+	// The subscription is identified by the connection, the subscriber ID is only exposed in the "subscriber" property
+	u := <-pipe.Read()
+	assert.Equal(t, []string{"https://mercure.rocks/subscriptions/https%3A%2F%2Fexample.com/connection-1"}, u.Topics)
+	assert.Contains(t, u.Data, `"subscriber": "alice%2F1"`)
+
+	assert.Empty(t, hub.subscriberID(nil))
+	assert.Empty(t, hub.subscriberID(&claims{raw: json.RawMessage(`{}`)}))
+}
+
 func TestSubscriptionEvents(t *testing.T) {
 	hub := createDummy()
 	hub.config.Set("dispatch_subscriptions", true)
@@ -366,6 +393,7 @@ func TestSubscriptionEvents(t *testing.T) {
 		assert.Contains(t, bodyContent, `data:   "active": true,`)
 		assert.Contains(t, bodyContent, `data:   "active": false,`)
 		assert.Contains(t, bodyContent, `data:   "address": "`)
+		assert.Contains(t, bodyContent, `data:   "instance": "hub-test"`)
 	}()
 
 	go func() {
@@ -381,7 +409,7 @@ func TestSubscriptionEvents(t *testing.T) {
 		body, _ := ioutil.ReadAll(resp.Body)
 
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
-		assert.Equal(t, ":\n", string(body))
+		assert.Equal(t, ": instance hub-test\n", string(body))
 	}()
 
 	go func() {
@@ -405,7 +433,7 @@ func TestSubscriptionEvents(t *testing.T) {
 
 		w := &responseTester{
 			expectedStatusCode: http.StatusOK,
-			expectedBody:       ":\n",
+			expectedBody:       ": instance hub-test\n",
 			t:                  t,
 			cancel:             cancelRequest2,
 		}
@@ -454,7 +482,7 @@ func TestSubscribeAllTargets(t *testing.T) {
 
 	w := &responseTester{
 		expectedStatusCode: http.StatusOK,
-		expectedBody:       ":\nid: a\ndata: Foo\n\nevent: test\nid: b\ndata: Hello World\n\n",
+		expectedBody:       ": instance hub-test\nid: a\ndata: Foo\n\nevent: test\nid: b\ndata: Hello World\n\n",
 		t:                  t,
 		cancel:             cancel,
 	}
@@ -497,7 +525,7 @@ func TestSendMissedEvents(t *testing.T) {
 
 		w := &responseTester{
 			expectedStatusCode: http.StatusOK,
-			expectedBody:       ":\nid: b\ndata: d2\n\n",
+			expectedBody:       ": instance hub-test\nid: b\ndata: d2\n\n",
 			t:                  t,
 			cancel:             cancel,
 		}
@@ -514,7 +542,99 @@ func TestSendMissedEvents(t *testing.T) {
 
 		w := &responseTester{
 			expectedStatusCode: http.StatusOK,
-			expectedBody:       ":\nid: b\ndata: d2\n\n",
+			expectedBody:       ": instance hub-test\nid: b\ndata: d2\n\n",
+			t:                  t,
+			cancel:             cancel,
+		}
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	wg.Wait()
+	hub.Stop()
+}
+
+func TestSendMissedEventsResumeHint(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	v := viper.New()
+	v.Set("resume_hint_key", "secret")
+	hub := createDummyWithTransportAndConfig(transport, v)
+
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/a"},
+		Event:  Event{ID: "a", Data: "d1"},
+	})
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/b"},
+		Event:  Event{ID: "b", Data: "d2"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&resume="+signResumeHint([]byte("secret"), "a"), nil).WithContext(ctx)
+	// The hint takes precedence over a stale Last-Event-ID
+	req.Header.Add("Last-Event-ID", "unknown")
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: b\ndata: d2\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
+
+func TestSendMissedEventsEarliest(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	hub := createDummyWithTransportAndConfig(transport, viper.New())
+
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/a"},
+		Event:  Event{ID: "a", Data: "d1"},
+	})
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/b"},
+		Event:  Event{ID: "b", Data: "d2"},
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&lastEventID=earliest", nil).WithContext(ctx)
+
+		w := &responseTester{
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       ": instance hub-test\nid: a\ndata: d1\n\nid: b\ndata: d2\n\n",
+			t:                  t,
+			cancel:             cancel,
+		}
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}", nil).WithContext(ctx)
+		req.Header.Add("Last-Event-ID", "earliest")
+
+		w := &responseTester{
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       ": instance hub-test\nid: a\ndata: d1\n\nid: b\ndata: d2\n\n",
 			t:                  t,
 			cancel:             cancel,
 		}
@@ -526,6 +646,92 @@ func TestSendMissedEvents(t *testing.T) {
 	hub.Stop()
 }
 
+func TestSendEventsSince(t *testing.T) {
+	u, _ := url.Parse("bolt://test.db")
+	transport, _ := NewBoltTransport(u, 5, time.Second)
+	defer transport.Close()
+	defer os.Remove("test.db")
+
+	hub := createDummyWithTransportAndConfig(transport, viper.New())
+
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/a"},
+		Event:  Event{ID: "a", Data: "d1"},
+		Time:   time.Now().Add(-time.Hour),
+	})
+	transport.Write(&Update{
+		Topics: []string{"http://example.com/foos/b"},
+		Event:  Event{ID: "b", Data: "d2"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&since=10m", nil).WithContext(ctx)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: b\ndata: d2\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
+
+func TestSubscribeLastEventIDWithoutHistory(t *testing.T) {
+	hub := createAnonymousDummy()
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/foos/b"},
+				Event:  Event{ID: "b", Data: "d2"},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}", nil).WithContext(ctx)
+	req.Header.Add("Last-Event-ID", "a")
+
+	// The transport doesn't support the history, live updates are sent
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: b\ndata: d2\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
+
+func TestSubscribeInvalidSince(t *testing.T) {
+	hub := createAnonymousDummy()
+
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&since=foo", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "Invalid \"since\" parameter.\n", w.Body.String())
+	assert.Empty(t, hub.uriTemplates.m)
+}
+
 func TestSubscribeHeartbeat(t *testing.T) {
 	hub := createAnonymousDummy()
 	hub.config.Set("heartbeat_interval", 5*time.Millisecond)
@@ -555,13 +761,167 @@ func TestSubscribeHeartbeat(t *testing.T) {
 
 	w := &responseTester{
 		expectedStatusCode: http.StatusOK,
-		expectedBody:       ":\nid: b\ndata: Hello World\n\n:\n",
+		expectedBody:       ": instance hub-test\nid: b\ndata: Hello World\n\n:\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
+
+// sessionLogEntry returns the log entry emitted when the subscription ended.
+func sessionLogEntry(t *testing.T, hook *test.Hook) *log.Entry {
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Subscriber disconnected" {
+			return e
+		}
+	}
+
+	t.Fatal("no session log entry")
+
+	return nil
+}
+
+func TestSubscribeSessionLog(t *testing.T) {
+	level := log.GetLevel()
+	log.SetLevel(log.InfoLevel)
+	defer log.SetLevel(level)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	hub := createAnonymousDummy()
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/books/1"},
+				Event:  Event{Data: "Hello World", ID: "b"},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil).WithContext(ctx)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: b\ndata: Hello World\n\n",
 		t:                  t,
 		cancel:             cancel,
 	}
 
 	hub.SubscribeHandler(w, req)
 	hub.Stop()
+
+	e := sessionLogEntry(t, hook)
+	assert.Equal(t, []string{"http://example.com/books/1"}, e.Data["subscriber_topics"])
+	assert.Equal(t, uint64(1), e.Data["events"])
+	assert.Equal(t, uint64(len("id: b\ndata: Hello World\n\n")), e.Data["bytes"])
+	assert.Equal(t, disconnectClient, e.Data["disconnect_reason"])
+	assert.IsType(t, time.Duration(0), e.Data["duration"])
+}
+
+func TestSubscribeSessionLogServerClose(t *testing.T) {
+	level := log.GetLevel()
+	log.SetLevel(log.InfoLevel)
+	defer log.SetLevel(level)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	hub := createAnonymousDummy()
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if !empty {
+				hub.transport.Close()
+				return
+			}
+		}
+	}()
+
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil)
+	hub.SubscribeHandler(httptest.NewRecorder(), req)
+
+	e := sessionLogEntry(t, hook)
+	assert.Equal(t, uint64(0), e.Data["events"])
+	assert.Equal(t, disconnectServer, e.Data["disconnect_reason"])
+}
+
+// blockingResponseWriter blocks when an event is written, until unblock is closed.
+type blockingResponseWriter struct {
+	*httptest.ResponseRecorder
+	blocked chan struct{}
+	unblock chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingResponseWriter) Write(buf []byte) (int, error) {
+	if !strings.HasPrefix(string(buf), ":") {
+		w.once.Do(func() {
+			close(w.blocked)
+			<-w.unblock
+		})
+	}
+
+	return w.ResponseRecorder.Write(buf)
+}
+
+func TestSubscribeSessionLogSlowConsumer(t *testing.T) {
+	level := log.GetLevel()
+	log.SetLevel(log.InfoLevel)
+	defer log.SetLevel(level)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(1, time.Millisecond), viper.New())
+	defer hub.Stop()
+	s, _ := hub.transport.(*LocalTransport)
+
+	w := &blockingResponseWriter{ResponseRecorder: httptest.NewRecorder(), blocked: make(chan struct{}), unblock: make(chan struct{})}
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if !empty {
+				break
+			}
+		}
+
+		hub.transport.Write(&Update{Topics: []string{"http://example.com/books/1"}, Event: Event{Data: "a", ID: "a"}})
+		<-w.blocked
+
+		// The subscriber is blocked, the second update fills the pipe and the third one overflows it
+		hub.transport.Write(&Update{Topics: []string{"http://example.com/books/1"}, Event: Event{Data: "b", ID: "b"}})
+		hub.transport.Write(&Update{Topics: []string{"http://example.com/books/1"}, Event: Event{Data: "c", ID: "c"}})
+		close(w.unblock)
+	}()
+
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil)
+	hub.SubscribeHandler(w, req)
+
+	e := sessionLogEntry(t, hook)
+	assert.Equal(t, uint64(2), e.Data["events"])
+	assert.Equal(t, disconnectSlowConsumer, e.Data["disconnect_reason"])
 }
 
 func BenchmarkSubscribe(b *testing.B) {
@@ -570,3 +930,130 @@ func BenchmarkSubscribe(b *testing.B) {
 		testSubscribe(1000, nil)
 	}
 }
+
+func TestSubscribeCleanupURITemplates(t *testing.T) {
+	hub := createDummy()
+
+	topics := []string{"http://example.com/books/1", "http://example.com/reviews/{id}"}
+	rawTopics, templateTopics := hub.parseTopics(topics)
+	s1 := NewSubscriber(false, nil, topics, rawTopics, templateTopics, "")
+	rawTopics, templateTopics = hub.parseTopics(topics)
+	s2 := NewSubscriber(false, nil, topics, rawTopics, templateTopics, "")
+	assert.Len(t, hub.uriTemplates.m, 2)
+
+	hub.cleanup(s1)
+	assert.Len(t, hub.uriTemplates.m, 2)
+
+	hub.cleanup(s2)
+	assert.Empty(t, hub.uriTemplates.m)
+}
+
+func TestSubscribeInvalidResumeHint(t *testing.T) {
+	v := viper.New()
+	v.Set("resume_hint_key", "secret")
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	for _, hint := range []string{"foo", signResumeHint([]byte("other"), "a")} {
+		req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&resume="+hint, nil)
+		w := httptest.NewRecorder()
+		hub.SubscribeHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "Invalid \"resume\" parameter.\n", w.Body.String())
+	}
+}
+
+func TestSubscribeInvalidProjection(t *testing.T) {
+	v := viper.New()
+	v.Set("projections", []string{"light={{json .id}}"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/foos/{id}&projection=unknown", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid \"projection\" parameter.\n", w.Body.String())
+}
+
+func TestSubscribeProjection(t *testing.T) {
+	v := viper.New()
+	v.Set("projections", []string{`light={"temperature":{{json .temperature}}}`})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/sensors/1"},
+				Event:  Event{Data: `{"temperature":21.5,"humidity":40,"history":[20,21]}`, ID: "a"},
+			})
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/sensors/1"},
+				Event:  Event{Data: "not JSON", ID: "b"},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/sensors/1&projection=light", nil).WithContext(ctx)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\nid: a\ndata: {\"temperature\":21.5}\n\nid: b\ndata: not JSON\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
+
+func TestSubscribeEventFormat(t *testing.T) {
+	v := viper.New()
+	v.Set("sse_fields", []string{"data", "event"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	s, _ := hub.transport.(*LocalTransport)
+
+	go func() {
+		for {
+			s.RLock()
+			empty := len(s.pipes) == 0
+			s.RUnlock()
+
+			if empty {
+				continue
+			}
+
+			hub.transport.Write(&Update{
+				Topics: []string{"http://example.com/books/1"},
+				Event:  Event{Data: "Hello", ID: "a", Type: "greeting", Retry: 5},
+			})
+
+			return
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", defaultHubURL+"?topic=http://example.com/books/1", nil).WithContext(ctx)
+
+	w := &responseTester{
+		expectedStatusCode: http.StatusOK,
+		expectedBody:       ": instance hub-test\ndata: Hello\nevent: greeting\n\n",
+		t:                  t,
+		cancel:             cancel,
+	}
+
+	hub.SubscribeHandler(w, req)
+	hub.Stop()
+}
@@ -12,12 +12,14 @@ type Subscriber struct {
 	RawTopics      []string
 	TemplateTopics []*uritemplate.Template
 	LastEventID    string
-	matchCache     map[string]bool
+	// Subject is the "sub" claim of the JWT used to subscribe, if any
+	Subject    string
+	matchCache map[string]bool
 }
 
 // NewSubscriber creates a subscriber.
 func NewSubscriber(allTargets bool, targets map[string]struct{}, topics []string, rawTopics []string, templateTopics []*uritemplate.Template, lastEventID string) *Subscriber {
-	return &Subscriber{allTargets, targets, topics, rawTopics, templateTopics, lastEventID, make(map[string]bool)}
+	return &Subscriber{allTargets, targets, topics, rawTopics, templateTopics, lastEventID, "", make(map[string]bool)}
 }
 
 // IsAuthorized checks if the subscriber can access to at least one of the update's intended targets.
@@ -47,21 +49,29 @@ func (s *Subscriber) IsSubscribed(u *Update) bool {
 			continue
 		}
 
-		for _, rt := range s.RawTopics {
-			if ut == rt {
-				s.matchCache[ut] = true
-				return true
-			}
+		match := s.matchTopic(ut)
+		s.matchCache[ut] = match
+		if match {
+			return true
 		}
+	}
 
-		for _, tt := range s.TemplateTopics {
-			if tt.Match(ut) != nil {
-				s.matchCache[ut] = true
-				return true
-			}
+	return false
+}
+
+// matchTopic checks if the topic matches one of the topics the subscriber has subscribed to, without using the cache.
+// Contrary to IsSubscribed, it can be called concurrently.
+func (s *Subscriber) matchTopic(topic string) bool {
+	for _, rt := range s.RawTopics {
+		if topic == rt {
+			return true
 		}
+	}
 
-		s.matchCache[ut] = false
+	for _, tt := range s.TemplateTopics {
+		if tt.Match(topic) != nil {
+			return true
+		}
 	}
 
 	return false
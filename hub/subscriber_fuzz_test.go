@@ -0,0 +1,33 @@
+//go:build go1.18
+// +build go1.18
+
+package hub
+
+import (
+	"testing"
+)
+
+func FuzzTopicSelector(f *testing.F) {
+	f.Add("https://example.com/books/{id}", "https://example.com/books/1")
+	f.Add("https://example.com/{+path}{?q*}", "https://example.com/foo/bar?q=1&r=2")
+	f.Add("{/segments*}{#fragment}", "/a/b/c#d")
+	f.Add("{var:3}{.ext}{;params*}", "abc.json;a=1")
+	f.Add("https://example.com/{", "https://example.com/{")
+	f.Add("{%zz}", "")
+
+	f.Fuzz(func(t *testing.T, selector, topic string) {
+		hub := createDummy()
+		defer hub.Stop()
+
+		rawTopics, templateTopics := hub.parseTopics([]string{selector})
+		s := NewSubscriber(true, nil, []string{selector}, rawTopics, templateTopics, "")
+
+		u := &Update{Topics: []string{topic}}
+		if s.IsSubscribed(u) != s.matchTopic(topic) {
+			t.Errorf("inconsistent match of %q against %q", topic, selector)
+		}
+		if selector == topic && !s.IsSubscribed(u) && len(templateTopics) == 0 {
+			t.Errorf("raw selector %q doesn't match itself", selector)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrTargetResolution is returned when symbolic targets cannot be expanded.
+var ErrTargetResolution = errors.New("target resolution failed")
+
+// TargetResolver expands a symbolic target (e.g. "group:editors") into the concrete targets it represents.
+type TargetResolver interface {
+	Resolve(target string) ([]string, error)
+}
+
+type resolvedTargets struct {
+	targets []string
+	expires time.Time
+}
+
+// HTTPTargetResolver resolves targets by querying an HTTP endpoint, results are cached.
+// The target is passed in the "target" query parameter, the endpoint must return a JSON array of strings.
+type HTTPTargetResolver struct {
+	sync.Mutex
+	url      *url.URL
+	client   *http.Client
+	cacheTTL time.Duration
+	cache    map[string]resolvedTargets
+}
+
+// NewHTTPTargetResolver creates an HTTPTargetResolver.
+func NewHTTPTargetResolver(u *url.URL, cacheTTL time.Duration) *HTTPTargetResolver {
+	return &HTTPTargetResolver{
+		url:      u,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		cacheTTL: cacheTTL,
+		cache:    make(map[string]resolvedTargets),
+	}
+}
+
+// Resolve returns the targets corresponding to the given symbolic target.
+func (r *HTTPTargetResolver) Resolve(target string) ([]string, error) {
+	now := time.Now()
+
+	r.Lock()
+	if c, ok := r.cache[target]; ok && now.Before(c.expires) {
+		r.Unlock()
+		return c.targets, nil
+	}
+	r.Unlock()
+
+	u := *r.url
+	q := u.Query()
+	q.Set("target", target)
+	u.RawQuery = q.Encode()
+
+	resp, err := r.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s: %w", target, err, ErrTargetResolution)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%q: unexpected status code %d: %w", target, resp.StatusCode, ErrTargetResolution)
+	}
+
+	var targets []string
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return nil, fmt.Errorf("%q: %s: %w", target, err, ErrTargetResolution)
+	}
+
+	if r.cacheTTL > 0 {
+		r.Lock()
+		r.cache[target] = resolvedTargets{targets, now.Add(r.cacheTTL)}
+		r.Unlock()
+	}
+
+	return targets, nil
+}
+
+// newTargetResolver creates the resolver configured by the "target_resolver_url" parameter, or returns nil if it isn't set.
+func newTargetResolver(v *viper.Viper) (TargetResolver, error) {
+	resolverURL, err := getSecret(v, "target_resolver_url")
+	if err != nil || resolverURL == "" {
+		return nil, err
+	}
+
+	u, err := url.Parse(resolverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf(`%w: invalid "target_resolver_url" parameter %q`, ErrInvalidConfig, resolverURL)
+	}
+
+	return NewHTTPTargetResolver(u, v.GetDuration("target_resolver_cache_ttl")), nil
+}
+
+// expandTargets replaces the symbolic targets (the ones starting with one of the given prefixes) by the targets they represent.
+func expandTargets(r TargetResolver, prefixes []string, targets map[string]struct{}) error {
+	var symbolicTargets []string
+	for target := range targets {
+		if hasAnyPrefix(target, prefixes) {
+			symbolicTargets = append(symbolicTargets, target)
+		}
+	}
+
+	for _, target := range symbolicTargets {
+		resolved, err := r.Resolve(target)
+		if err != nil {
+			return err
+		}
+
+		delete(targets, target)
+		for _, t := range resolved {
+			targets[t] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+
+	return false
+}
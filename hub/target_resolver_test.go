@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func createTargetDirectory(calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Inc()
+		switch r.URL.Query().Get("target") {
+		case "group:editors":
+			fmt.Fprint(w, `["user:1", "user:2"]`)
+		case "group:invalid":
+			fmt.Fprint(w, `invalid`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestHTTPTargetResolver(t *testing.T) {
+	var calls atomic.Int32
+	ts := createTargetDirectory(&calls)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	r := NewHTTPTargetResolver(u, time.Minute)
+
+	targets, err := r.Resolve("group:editors")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, targets)
+
+	targets, err = r.Resolve("group:editors")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, targets)
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err = r.Resolve("group:unknown")
+	assert.EqualError(t, err, `"group:unknown": unexpected status code 404: target resolution failed`)
+
+	_, err = r.Resolve("group:invalid")
+	assert.Error(t, err)
+}
+
+func TestExpandTargets(t *testing.T) {
+	var calls atomic.Int32
+	ts := createTargetDirectory(&calls)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	r := NewHTTPTargetResolver(u, 0)
+
+	targets := map[string]struct{}{"group:editors": {}, "user:3": {}}
+	assert.Nil(t, expandTargets(r, []string{"group:"}, targets))
+	assert.Equal(t, map[string]struct{}{"user:1": {}, "user:2": {}, "user:3": {}}, targets)
+
+	assert.Error(t, expandTargets(r, []string{"group:"}, map[string]struct{}{"group:unknown": {}}))
+}
+
+func TestNewTargetResolverInvalidURL(t *testing.T) {
+	v := viper.New()
+	v.Set("jwt_key", "foo")
+	v.Set("target_resolver_url", "ldap://example.com")
+
+	assert.EqualError(t, ValidateConfig(v), `invalid config: invalid "target_resolver_url" parameter "ldap://example.com"`)
+}
+
+func TestPublishExpandsTargets(t *testing.T) {
+	var calls atomic.Int32
+	ts := createTargetDirectory(&calls)
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("target_resolver_url", ts.URL)
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		u, ok := <-pipe.Read()
+		require.True(t, ok)
+		assert.Equal(t, map[string]struct{}{"user:1": {}, "user:2": {}}, u.Targets)
+	}()
+
+	for target, status := range map[string]int{"group:editors": http.StatusOK, "group:unknown": http.StatusServiceUnavailable} {
+		form := url.Values{"topic": {"http://example.com/books/1"}, "data": {"Hello!"}, "target": {target}}
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+		assert.Equal(t, status, w.Result().StatusCode)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,26 @@
+package hub
+
+import "encoding/json"
+
+const (
+	// tombstoneEventType is the type of the events notifying the subscribers of the deletion of previous updates
+	tombstoneEventType = "mercure-tombstone"
+	// tombstoneTopic is the value of the "tombstone" parameter deleting all the previous updates of the canonical topic
+	tombstoneTopic = "*"
+)
+
+// tombstoneData returns the default payload of a tombstone: the ID of the deleted update, or the topic whose updates are deleted.
+func tombstoneData(tombstone, topic string) string {
+	var data []byte
+	if tombstone == tombstoneTopic {
+		data, _ = json.Marshal(struct {
+			Topic string `json:"topic"`
+		}{topic})
+	} else {
+		data, _ = json.Marshal(struct {
+			ID string `json:"id"`
+		}{tombstone})
+	}
+
+	return string(data)
+}
@@ -0,0 +1,12 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstoneData(t *testing.T) {
+	assert.Equal(t, `{"id":"urn:uuid:1"}`, tombstoneData("urn:uuid:1", "http://example.com/books/1"))
+	assert.Equal(t, `{"topic":"http://example.com/books/1"}`, tombstoneData(tombstoneTopic, "http://example.com/books/1"))
+}
@@ -0,0 +1,100 @@
+package hub
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/yosida95/uritemplate"
+)
+
+// topicHierarchyRule adds a parent topic to the updates published in topics matching its selector.
+type topicHierarchyRule struct {
+	selector         string
+	selectorTemplate *uritemplate.Template
+	parent           string
+	parentTemplate   *uritemplate.Template
+}
+
+// parentOf returns the parent topic of the given topic, or an empty string if the rule doesn't match.
+// If the parent is an URI template, it's expanded using the variables extracted from the topic.
+func (r *topicHierarchyRule) parentOf(topic string) string {
+	if r.selectorTemplate == nil {
+		if topic != r.selector {
+			return ""
+		}
+
+		return r.parent
+	}
+
+	values := r.selectorTemplate.Match(topic)
+	if values == nil {
+		return ""
+	}
+
+	if r.parentTemplate == nil {
+		return r.parent
+	}
+
+	parent, err := r.parentTemplate.Expand(values)
+	if err != nil {
+		return ""
+	}
+
+	return parent
+}
+
+// parseTopicHierarchy parses the "topic_hierarchy" rules, formatted as "selector>parent".
+// The selector is a raw topic or an URI template, the parent is a raw topic or an URI template using the variables of the selector.
+func parseTopicHierarchy(rules []string) []*topicHierarchyRule {
+	parsed := make([]*topicHierarchyRule, 0, len(rules))
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, ">", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.WithFields(log.Fields{"rule": rule}).Error(`Invalid "topic_hierarchy" rule, must be formatted as "selector>parent"`)
+			continue
+		}
+
+		r := &topicHierarchyRule{selector: parts[0], parent: parts[1]}
+		if strings.Contains(r.selector, "{") {
+			r.selectorTemplate, _ = uritemplate.New(r.selector) // Returns nil in case of error, will be considered as a raw string
+		}
+		if strings.Contains(r.parent, "{") {
+			r.parentTemplate, _ = uritemplate.New(r.parent)
+		}
+
+		parsed = append(parsed, r)
+	}
+
+	return parsed
+}
+
+// addParentTopics appends the parents of the given topics, and the parents of these parents, as alternate topics.
+func addParentTopics(rules []*topicHierarchyRule, topics []string) []string {
+	seen := make(map[string]struct{}, len(topics))
+	for _, t := range topics {
+		seen[t] = struct{}{}
+	}
+
+	// Each rule can only add one level, this prevents infinite loops with recursive rules
+	for i, level := 0, topics; i < len(rules) && len(level) > 0; i++ {
+		var next []string
+		for _, t := range level {
+			for _, r := range rules {
+				p := r.parentOf(t)
+				if p == "" {
+					continue
+				}
+
+				if _, ok := seen[p]; !ok {
+					seen[p] = struct{}{}
+					next = append(next, p)
+				}
+			}
+		}
+
+		topics = append(topics, next...)
+		level = next
+	}
+
+	return topics
+}
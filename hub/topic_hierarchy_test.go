@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopicHierarchy(t *testing.T) {
+	rules := parseTopicHierarchy([]string{"invalid", ">foo", "https://example.com/books/{id}>https://example.com/books", "foo>bar"})
+	require.Len(t, rules, 2)
+
+	assert.NotNil(t, rules[0].selectorTemplate)
+	assert.Nil(t, rules[0].parentTemplate)
+	assert.Nil(t, rules[1].selectorTemplate)
+}
+
+func TestAddParentTopics(t *testing.T) {
+	rules := parseTopicHierarchy([]string{
+		"https://example.com/authors/{author}/books/{id}>https://example.com/authors/{author}",
+		"https://example.com/authors/{author}>https://example.com/authors",
+		"https://example.com/books/1>https://example.com/books",
+		"https://example.com/books/1>https://example.com/books",
+	})
+
+	assert.Equal(t, []string{"https://example.com/reviews/1"}, addParentTopics(rules, []string{"https://example.com/reviews/1"}))
+	assert.Equal(t, []string{"https://example.com/books/1", "https://example.com/books"}, addParentTopics(rules, []string{"https://example.com/books/1"}))
+	assert.Equal(t, []string{"https://example.com/books/1", "https://example.com/books"}, addParentTopics(rules, []string{"https://example.com/books/1", "https://example.com/books"}))
+	assert.Equal(t,
+		[]string{"https://example.com/authors/kevin/books/1", "https://example.com/authors/kevin", "https://example.com/authors"},
+		addParentTopics(rules, []string{"https://example.com/authors/kevin/books/1"}),
+	)
+}
+
+func TestAddParentTopicsRecursiveRule(t *testing.T) {
+	rules := parseTopicHierarchy([]string{"{+topic}>{+topic}/parent"})
+
+	assert.Equal(t, []string{"foo", "foo/parent"}, addParentTopics(rules, []string{"foo"}))
+}
+
+func TestPublishTopicHierarchy(t *testing.T) {
+	v := viper.New()
+	v.Set("topic_hierarchy", []string{"http://example.com/books/{id}>http://example.com/books"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	pipe, err := hub.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	form := url.Values{"topic": {"http://example.com/books/1"}, "data": {"Hello!"}}
+	req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", "Bearer "+createDummyAuthorizedJWT(hub, publisherRole, []string{}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	u := <-pipe.Read()
+	assert.Equal(t, []string{"http://example.com/books/1", "http://example.com/books"}, u.Topics)
+
+	s := NewSubscriber(false, nil, []string{"http://example.com/books"}, []string{"http://example.com/books"}, nil, "")
+	assert.True(t, s.IsSubscribed(u))
+}
@@ -0,0 +1,93 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTopicNamespaceReserved is returned when a publisher uses a topic of a namespace reserved to another owner.
+var ErrTopicNamespaceReserved = errors.New("topic namespace reserved")
+
+// topicNamespaceError describes the topic a publisher isn't allowed to use.
+type topicNamespaceError struct {
+	topic  string
+	prefix string
+}
+
+func (e *topicNamespaceError) Error() string {
+	return fmt.Sprintf("%q: the namespace %q is reserved: %s", e.topic, e.prefix, ErrTopicNamespaceReserved)
+}
+
+func (e *topicNamespaceError) Unwrap() error {
+	return ErrTopicNamespaceReserved
+}
+
+// topicNamespace reserves the topics starting with the prefix to the publishers whose JWT claim has one of the owner values.
+type topicNamespace struct {
+	prefix string
+	owners map[string]struct{}
+}
+
+// topicNamespaces restrict the topic prefixes publishers may use, according to a claim of their JWT (e.g. a team or a tenant).
+// The topics not in a reserved namespace can be used by all the publishers.
+type topicNamespaces struct {
+	claim string
+	// namespaces are sorted by decreasing prefix length, a topic belongs to the most specific namespace
+	namespaces []*topicNamespace
+}
+
+// newTopicNamespaces parses the "topic_namespaces" configuration parameter, formatted as "owner=prefix".
+// Several owners can share a namespace by repeating the prefix. It returns nil if there are no rules.
+func newTopicNamespaces(claim string, rules []string) (*topicNamespaces, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if claim == "" {
+		return nil, fmt.Errorf(`%w: the "topic_namespace_claim" parameter is required by the "topic_namespaces" parameter`, ErrInvalidConfig)
+	}
+
+	byPrefix := make(map[string]*topicNamespace, len(rules))
+	n := &topicNamespaces{claim: claim}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(`%w: invalid "topic_namespaces" rule %q, must be formatted as "owner=prefix"`, ErrInvalidConfig, rule)
+		}
+
+		ns, ok := byPrefix[parts[1]]
+		if !ok {
+			ns = &topicNamespace{prefix: parts[1], owners: make(map[string]struct{})}
+			byPrefix[parts[1]] = ns
+			n.namespaces = append(n.namespaces, ns)
+		}
+		ns.owners[parts[0]] = struct{}{}
+	}
+
+	sort.SliceStable(n.namespaces, func(i, j int) bool {
+		return len(n.namespaces[i].prefix) > len(n.namespaces[j].prefix)
+	})
+
+	return n, nil
+}
+
+// authorize returns a topicNamespaceError if one of the topics is in a namespace not reserved to the publisher.
+func (n *topicNamespaces) authorize(claims *claims, topics []string) error {
+	owner, _ := claims.claim(n.claim)
+	for _, topic := range topics {
+		for _, ns := range n.namespaces {
+			if !strings.HasPrefix(topic, ns.prefix) {
+				continue
+			}
+
+			if _, ok := ns.owners[owner]; !ok || owner == "" {
+				return &topicNamespaceError{topic, ns.prefix}
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTopicNamespaces(t *testing.T) {
+	n, err := newTopicNamespaces("", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, n)
+
+	n, err = newTopicNamespaces("team", []string{"billing=https://example.com/billing/", "shipping=https://example.com/", "admin=https://example.com/billing/"})
+	require.Nil(t, err)
+	require.Len(t, n.namespaces, 2)
+	assert.Equal(t, "https://example.com/billing/", n.namespaces[0].prefix)
+	assert.Equal(t, map[string]struct{}{"billing": {}, "admin": {}}, n.namespaces[0].owners)
+
+	_, err = newTopicNamespaces("", []string{"billing=https://example.com/billing/"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: the "topic_namespace_claim" parameter is required by the "topic_namespaces" parameter`)
+
+	_, err = newTopicNamespaces("team", []string{"https://example.com/billing/"})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.EqualError(t, err, `invalid config: invalid "topic_namespaces" rule "https://example.com/billing/", must be formatted as "owner=prefix"`)
+}
+
+func TestTopicNamespacesAuthorize(t *testing.T) {
+	n, err := newTopicNamespaces("org.team", []string{"billing=https://example.com/billing/", "shipping=https://example.com/", "admin=https://example.com/billing/"})
+	require.Nil(t, err)
+
+	billing := &claims{raw: json.RawMessage(`{"org": {"team": "billing"}}`)}
+	shipping := &claims{raw: json.RawMessage(`{"org": {"team": "shipping"}}`)}
+	admin := &claims{raw: json.RawMessage(`{"org": {"team": "admin"}}`)}
+	anonymous := &claims{raw: json.RawMessage(`{}`)}
+
+	assert.Nil(t, n.authorize(billing, []string{"https://example.com/billing/1", "https://example.org/1"}))
+	assert.Nil(t, n.authorize(admin, []string{"https://example.com/billing/1"}))
+	assert.Nil(t, n.authorize(shipping, []string{"https://example.com/shipping/1"}))
+	assert.Nil(t, n.authorize(anonymous, []string{"https://example.org/1"}), "the topics not in a namespace can be used by all the publishers")
+
+	err = n.authorize(shipping, []string{"https://example.com/shipping/1", "https://example.com/billing/1"})
+	assert.True(t, errors.Is(err, ErrTopicNamespaceReserved))
+	assert.EqualError(t, err, `"https://example.com/billing/1": the namespace "https://example.com/billing/" is reserved: topic namespace reserved`)
+
+	assert.NotNil(t, n.authorize(billing, []string{"https://example.com/shipping/1"}), "the most specific namespace isn't the one of the topic")
+	assert.NotNil(t, n.authorize(anonymous, []string{"https://example.com/shipping/1"}))
+}
+
+func TestPublishTopicNamespaces(t *testing.T) {
+	v := viper.New()
+	v.Set("topic_namespace_claim", "team")
+	v.Set("topic_namespaces", []string{"billing=https://example.com/billing/"})
+	hub := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer hub.Stop()
+
+	publish := func(team string) *httptest.ResponseRecorder {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"mercure": map[string]interface{}{"publish": []string{}}, "team": team})
+		tokenString, _ := token.SignedString(hub.getJWTKey(publisherRole))
+
+		form := url.Values{}
+		form.Add("topic", "https://example.com/billing/invoices/1")
+		form.Add("data", "Hello!")
+
+		req := httptest.NewRequest("POST", defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w := publish("billing")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = publish("shipping")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `"https://example.com/billing/invoices/1": the namespace "https://example.com/billing/" is reserved: topic namespace reserved`+"\n", w.Body.String())
+}
@@ -0,0 +1,172 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type topicState struct {
+	subscribers  int
+	lastActivity time.Time
+}
+
+// topicTracker records the activity of topics, to reclaim the resources associated with the ones that have been idle for too long.
+// A topic is idle when it has no subscribers and no update has been published since the timeout.
+type topicTracker struct {
+	sync.Mutex
+	topics   map[string]*topicState
+	timeout  time.Duration
+	onExpire func(topic string)
+	done     chan struct{}
+}
+
+func newTopicTracker(timeout time.Duration, onExpire func(topic string)) *topicTracker {
+	tt := &topicTracker{
+		topics:   make(map[string]*topicState),
+		timeout:  timeout,
+		onExpire: onExpire,
+		done:     make(chan struct{}),
+	}
+	go tt.run()
+
+	return tt
+}
+
+func (tt *topicTracker) state(topic string) *topicState {
+	s, ok := tt.topics[topic]
+	if !ok {
+		s = &topicState{}
+		tt.topics[topic] = s
+	}
+
+	return s
+}
+
+// publish records that an update has been published in the given topics.
+func (tt *topicTracker) publish(topics []string) {
+	now := time.Now()
+
+	tt.Lock()
+	for _, t := range topics {
+		tt.state(t).lastActivity = now
+	}
+	tt.Unlock()
+}
+
+// subscribe records that a subscriber subscribed to the given topics.
+func (tt *topicTracker) subscribe(topics []string) {
+	now := time.Now()
+
+	tt.Lock()
+	for _, t := range topics {
+		s := tt.state(t)
+		s.subscribers++
+		s.lastActivity = now
+	}
+	tt.Unlock()
+}
+
+// unsubscribe records that a subscriber subscribed to the given topics disconnected.
+func (tt *topicTracker) unsubscribe(topics []string) {
+	now := time.Now()
+
+	tt.Lock()
+	for _, t := range topics {
+		s := tt.state(t)
+		if s.subscribers > 0 {
+			s.subscribers--
+		}
+		s.lastActivity = now
+	}
+	tt.Unlock()
+}
+
+// len returns the number of tracked topics.
+func (tt *topicTracker) len() int {
+	tt.Lock()
+	defer tt.Unlock()
+
+	return len(tt.topics)
+}
+
+// expire stops tracking the topics idle since the timeout, and calls onExpire for each of them.
+func (tt *topicTracker) expire(now time.Time) {
+	var expired []string
+
+	tt.Lock()
+	for t, s := range tt.topics {
+		if s.subscribers == 0 && now.Sub(s.lastActivity) >= tt.timeout {
+			delete(tt.topics, t)
+			expired = append(expired, t)
+		}
+	}
+	tt.Unlock()
+
+	// Called without holding the lock, because onExpire may publish updates
+	for _, t := range expired {
+		tt.onExpire(t)
+	}
+}
+
+func (tt *topicTracker) run() {
+	ticker := time.NewTicker(tt.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tt.done:
+			return
+		case now := <-ticker.C:
+			tt.expire(now)
+		}
+	}
+}
+
+// Close stops the expiration loop.
+func (tt *topicTracker) Close() {
+	select {
+	case <-tt.done:
+	default:
+		close(tt.done)
+	}
+}
+
+type topicExpiration struct {
+	ID     string `json:"@id"`
+	Type   string `json:"@type"`
+	Topic  string `json:"topic"`
+	Active bool   `json:"active"`
+}
+
+// expireTopic reclaims the resources associated with an idle topic.
+func (h *Hub) expireTopic(topic string) {
+	h.metrics.TopicExpired(topic)
+	log.WithFields(log.Fields{"topic": topic}).Info("Topic expired")
+
+	if !h.config.GetBool("dispatch_subscriptions") {
+		return
+	}
+
+	encodedTopic := url.QueryEscape(topic)
+	e := &topicExpiration{
+		ID:    "https://mercure.rocks/topics/" + encodedTopic,
+		Type:  "https://mercure.rocks/Topic",
+		Topic: topic,
+	}
+
+	json, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	h.transport.Write(&Update{
+		Topics:  []string{e.ID},
+		Targets: map[string]struct{}{"https://mercure.rocks/targets/topics": {}, "https://mercure.rocks/targets/topics/" + encodedTopic: {}},
+		Event:   Event{Data: string(json), ID: uuid.Must(uuid.NewV4()).String()},
+	})
+}
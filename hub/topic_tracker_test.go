@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicTrackerExpire(t *testing.T) {
+	var (
+		m       sync.Mutex
+		expired []string
+	)
+	tt := newTopicTracker(time.Hour, func(topic string) {
+		m.Lock()
+		expired = append(expired, topic)
+		m.Unlock()
+	})
+	defer tt.Close()
+
+	tt.publish([]string{"http://example.com/1", "http://example.com/2"})
+	tt.subscribe([]string{"http://example.com/2", "http://example.com/3"})
+	assert.Equal(t, 3, tt.len())
+
+	tt.expire(time.Now())
+	assert.Empty(t, expired)
+
+	tt.expire(time.Now().Add(time.Hour))
+	assert.Equal(t, []string{"http://example.com/1"}, expired)
+	assert.Equal(t, 2, tt.len())
+
+	tt.unsubscribe([]string{"http://example.com/2", "http://example.com/3"})
+	tt.expire(time.Now().Add(time.Hour))
+	assert.Len(t, expired, 3)
+	assert.Equal(t, 0, tt.len())
+}
+
+func TestTopicTrackerRun(t *testing.T) {
+	expired := make(chan string, 1)
+	tt := newTopicTracker(10*time.Millisecond, func(topic string) {
+		expired <- topic
+	})
+	defer tt.Close()
+
+	tt.publish([]string{"http://example.com/1"})
+	assert.Equal(t, "http://example.com/1", <-expired)
+}
+
+func TestHubExpireTopic(t *testing.T) {
+	v := viper.New()
+	v.Set("dispatch_subscriptions", true)
+	v.Set("topic_idle_timeout", time.Hour)
+	h := createDummyWithTransportAndConfig(NewLocalTransport(5, time.Second), v)
+	defer h.Stop()
+	require.NotNil(t, h.topicTracker)
+
+	pipe, err := h.transport.CreatePipe(LatestCursor())
+	require.Nil(t, err)
+
+	h.metrics.NewUpdate(&Update{Topics: []string{"http://example.com/1"}})
+	h.expireTopic("http://example.com/1")
+
+	u := <-pipe.Read()
+	assert.Equal(t, []string{"https://mercure.rocks/topics/http%3A%2F%2Fexample.com%2F1"}, u.Topics)
+	assert.Contains(t, u.Targets, "https://mercure.rocks/targets/topics")
+	assert.Contains(t, u.Data, `"topic": "http://example.com/1"`)
+	assert.Contains(t, u.Data, `"active": false`)
+
+	assertCounterValue(t, 0.0, h.metrics.updatesTotal, "http://example.com/1")
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,12 +18,26 @@ type Transport interface {
 	Write(update *Update) error
 
 	// CreatePipe returns a pipe fetching updates from the given point in time.
-	CreatePipe(fromID string) (*Pipe, error)
+	// ErrUnsupportedCursor must be returned if the kind of the cursor isn't supported.
+	CreatePipe(cursor Cursor) (*Pipe, error)
 
 	// Close closes the Transport.
 	Close() error
 }
 
+// historyTransport is implemented by the transports which may not store the updates.
+// The transports not implementing it are assumed to support the history.
+type historyTransport interface {
+	supportsHistory() bool
+}
+
+// strictOrderingTransport is implemented by the transports able to deliver the history before the live updates.
+type strictOrderingTransport interface {
+	setStrictOrdering(maxHeldUpdates int)
+}
+
+const defaultLocalHistorySize = 1000
+
 var (
 	// ErrInvalidTransportDSN is returned when the Transport's DSN is invalid
 	ErrInvalidTransportDSN = errors.New("invalid transport DSN")
@@ -29,38 +45,216 @@ var (
 	ErrClosedTransport = errors.New("hub: read/write on closed Transport")
 )
 
+// secretTransportParameters contains the DSN parameters holding secrets, never included in the error messages.
+var secretTransportParameters = map[string]struct{}{
+	"jwt":               {},
+	"subscriber_jwt":    {},
+	"publisher_jwt":     {},
+	"encryption_key":    {},
+	"secret_access_key": {},
+}
+
+// redactDSN returns the DSN with its password, its secret parameters and the passwords of the nested DSNs replaced by "xxxxx".
+func redactDSN(u *url.URL) string {
+	q := u.Query()
+	if !redactQuery(q) {
+		return u.Redacted()
+	}
+
+	r := *u
+	r.RawQuery = q.Encode()
+
+	return r.Redacted()
+}
+
+// redactQuery redacts the secret parameters and the nested DSNs containing secrets, and returns true if a value has been redacted.
+func redactQuery(q url.Values) bool {
+	redacted := false
+	for name, values := range q {
+		for i, v := range values {
+			if _, ok := secretTransportParameters[name]; ok {
+				values[i] = "xxxxx"
+				redacted = true
+
+				continue
+			}
+
+			nested, err := url.Parse(v)
+			if err != nil || nested.Scheme == "" {
+				continue
+			}
+
+			_, hasPassword := nested.User.Password()
+			if nq := nested.Query(); redactQuery(nq) {
+				nested.RawQuery = nq.Encode()
+			} else if !hasPassword {
+				continue
+			}
+
+			values[i] = nested.Redacted()
+			redacted = true
+		}
+	}
+
+	return redacted
+}
+
+// redactParseError removes the DSN, which may contain credentials, from the errors returned by url.Parse.
+func redactParseError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
+// TransportFactory creates a transport from its DSN.
+type TransportFactory func(u *url.URL) (Transport, error)
+
+var (
+	transportFactoriesMu sync.RWMutex
+	transportFactories   = make(map[string]TransportFactory)
+)
+
+// RegisterTransport makes a third-party transport available in the "transport_url" configuration parameter, for the DSNs using the given scheme.
+// A transport registered for the scheme of a built-in transport replaces it.
+func RegisterTransport(scheme string, factory TransportFactory) {
+	transportFactoriesMu.Lock()
+	defer transportFactoriesMu.Unlock()
+
+	transportFactories[strings.ToLower(scheme)] = factory
+}
+
 // NewTransport create a transport using the backend matching the given TransportURL.
 func NewTransport(config *viper.Viper) (Transport, error) {
 	bs := config.GetInt("update_buffer_size")
 	bt := config.GetDuration("update_buffer_full_timeout")
-	tu := config.GetString("transport_url")
+	pbf, err := NewPipeBufferFactory(config.GetString("update_buffer_strategy"), config.GetInt("update_buffer_overflow_size"), config.GetString("update_buffer_spill_dir"))
+	if err != nil {
+		return nil, err
+	}
+
+	tu, err := getSecret(config, "transport_url")
+	if err != nil {
+		return nil, err
+	}
 	if tu == "" {
-		return NewLocalTransport(bs, bt), nil
+		t := NewLocalTransport(bs, bt)
+		t.pipeBufferFactory = pbf
+
+		return t, nil
 	}
 
+	return newTransport(tu, bs, bt, pbf)
+}
+
+// newTransportWithConfig creates a transport using the backend matching the given DSN, and the buffer configured at the hub level.
+func newTransportWithConfig(config *viper.Viper, dsn string) (Transport, error) {
+	pbf, err := NewPipeBufferFactory(config.GetString("update_buffer_strategy"), config.GetInt("update_buffer_overflow_size"), config.GetString("update_buffer_spill_dir"))
+	if err != nil {
+		return nil, err
+	}
+
+	return newTransport(dsn, config.GetInt("update_buffer_size"), config.GetDuration("update_buffer_full_timeout"), pbf)
+}
+
+// newTransport creates a transport using the backend matching the given DSN.
+func newTransport(tu string, bs int, bt time.Duration, pbf PipeBufferFactory) (Transport, error) {
 	u, err := url.Parse(tu)
 	if err != nil {
-		return nil, fmt.Errorf("transport_url: %w", err)
+		return nil, fmt.Errorf("transport_url: %w", redactParseError(err))
+	}
+
+	transportFactoriesMu.RLock()
+	factory, ok := transportFactories[u.Scheme]
+	transportFactoriesMu.RUnlock()
+	if ok {
+		return factory(u)
 	}
 
 	switch u.Scheme {
 	case "null":
-		return NewLocalTransport(bs, bt), nil
+		t := NewLocalTransport(bs, bt)
+		t.pipeBufferFactory = pbf
+
+		return t, nil
+
+	case "local":
+		t, err := NewLocalTransportWithHistory(u, bs, bt)
+		if err != nil {
+			return nil, err
+		}
+		t.pipeBufferFactory = pbf
+
+		return t, nil
 
 	case "bolt":
-		return NewBoltTransport(u, bs, bt)
+		t, err := NewBoltTransport(u, bs, bt)
+		if err != nil {
+			return nil, err
+		}
+		t.pipeBufferFactory = pbf
+
+		return t, nil
+
+	case "filelog":
+		t, err := NewFileTransport(u, bs, bt)
+		if err != nil {
+			return nil, err
+		}
+		t.pipeBufferFactory = pbf
+
+		return t, nil
+
+	case "mysql":
+		t, err := NewMySQLTransport(u, bs, bt)
+		if err != nil {
+			return nil, err
+		}
+		t.pipeBufferFactory = pbf
+
+		return t, nil
+
+	case "failover":
+		return newFailoverTransportFromURL(u, func(dsn string) (Transport, error) {
+			return newTransport(dsn, bs, bt, pbf)
+		})
+
+	case "cutover":
+		return newCutoverTransportFromURL(u, func(dsn string) (Transport, error) {
+			return newTransport(dsn, bs, bt, pbf)
+		})
+
+	case "mercure", "mercure+unix":
+		t, err := NewRelayTransport(u, bs, bt)
+		if err != nil {
+			return nil, err
+		}
+		t.pipeBufferFactory = pbf
+
+		return t, nil
 	}
 
 	return nil, fmt.Errorf("%q: no such transport available: %w", tu, ErrInvalidTransportDSN)
 }
 
 // LocalTransport implements the TransportInterface without database and simply broadcast the live Updates.
+// It can keep the most recent updates in memory, to replay them to the subscribers reconnecting.
 type LocalTransport struct {
 	sync.RWMutex
 	pipes             map[*Pipe]struct{}
 	done              chan struct{}
 	bufferSize        int
 	bufferFullTimeout time.Duration
+	pipeBufferFactory PipeBufferFactory
+	replayLimiter     *replayLimiter
+	maxHeldUpdates    int
+
+	// history is a ring buffer storing the historySize most recent updates, next is the index where the next update is stored
+	history     []*Update
+	historySize int
+	next        int
 }
 
 // NewLocalTransport create a new LocalTransport.
@@ -73,6 +267,23 @@ func NewLocalTransport(bufferSize int, bufferFullTimeout time.Duration) *LocalTr
 	}
 }
 
+// NewLocalTransportWithHistory creates a LocalTransport keeping the most recent updates in memory.
+// The number of updates kept is set by the "size" parameter of the DSN (e.g. local://?size=10000), they are lost when the hub stops.
+func NewLocalTransportWithHistory(u *url.URL, bufferSize int, bufferFullTimeout time.Duration) (*LocalTransport, error) {
+	size := defaultLocalHistorySize
+	if p := u.Query().Get("size"); p != "" {
+		var err error
+		if size, err = strconv.Atoi(p); err != nil || size < 0 {
+			return nil, fmt.Errorf(`%q: invalid "size" parameter %q: %w`, redactDSN(u), p, ErrInvalidTransportDSN)
+		}
+	}
+
+	t := NewLocalTransport(bufferSize, bufferFullTimeout)
+	t.historySize = size
+
+	return t, nil
+}
+
 // Write pushes updates in the Transport.
 func (t *LocalTransport) Write(update *Update) error {
 	select {
@@ -81,8 +292,24 @@ func (t *LocalTransport) Write(update *Update) error {
 	default:
 	}
 
+	if t.historySize > 0 && update.Time.IsZero() {
+		update.Time = time.Now()
+	}
+
 	t.Lock()
 	defer t.Unlock()
+
+	if t.historySize > 0 {
+		update.Retain()
+		if len(t.history) < t.historySize {
+			t.history = append(t.history, update)
+		} else {
+			t.history[t.next].Release()
+			t.history[t.next] = update
+		}
+		t.next = (t.next + 1) % t.historySize
+	}
+
 	for pipe := range t.pipes {
 		if !pipe.Write(update) {
 			delete(t.pipes, pipe)
@@ -92,8 +319,13 @@ func (t *LocalTransport) Write(update *Update) error {
 	return nil
 }
 
-// CreatePipe returns a pipe fetching updates from the given point in time.
-func (t *LocalTransport) CreatePipe(fromID string) (*Pipe, error) {
+// CreatePipe returns a pipe receiving the updates published after its creation.
+// The history is only supported if the updates are kept in memory.
+func (t *LocalTransport) CreatePipe(cursor Cursor) (*Pipe, error) {
+	if cursor.Kind > CursorAfterTime || (cursor.Kind != CursorLatest && t.historySize == 0) {
+		return nil, ErrUnsupportedCursor
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
@@ -103,12 +335,89 @@ func (t *LocalTransport) CreatePipe(fromID string) (*Pipe, error) {
 	default:
 	}
 
-	pipe := NewPipe(t.bufferSize, t.bufferFullTimeout)
+	pipe := t.pipeBufferFactory.newPipe(t.bufferSize, t.bufferFullTimeout)
 	t.pipes[pipe] = struct{}{}
+	if cursor.Kind == CursorLatest {
+		return pipe, nil
+	}
+
+	// The updates of the history are retained until they are sent, even if they are evicted in the meantime
+	// Until the ring buffer is full, next is also its length and the oldest update is the first one
+	oldest := 0
+	if len(t.history) == t.historySize {
+		oldest = t.next
+	}
+	history := make([]*Update, 0, len(t.history))
+	history = append(history, t.history[oldest:]...)
+	history = append(history, t.history[:oldest]...)
+	for _, u := range history {
+		u.Retain()
+	}
+
+	pipe.holdLive(t.maxHeldUpdates)
+	go t.fetch(cursor, history, pipe)
 
 	return pipe, nil
 }
 
+// supportsHistory returns true if the updates are kept in memory.
+func (t *LocalTransport) supportsHistory() bool {
+	return t.historySize > 0
+}
+
+// setReplayLimiter limits the number of simultaneous history replays.
+func (t *LocalTransport) setReplayLimiter(l *replayLimiter) {
+	t.replayLimiter = l
+}
+
+// setStrictOrdering holds up to maxHeldUpdates live updates while the history is replayed, to deliver them after it.
+func (t *LocalTransport) setStrictOrdering(maxHeldUpdates int) {
+	t.maxHeldUpdates = maxHeldUpdates
+}
+
+// fetch sends the updates of the history from the point in time defined by the cursor, and releases them.
+func (t *LocalTransport) fetch(cursor Cursor, history []*Update, pipe *Pipe) {
+	defer func() {
+		for _, u := range history {
+			u.Release()
+		}
+	}()
+
+	defer pipe.releaseLive()
+	if !t.replayLimiter.acquire(pipe) {
+		return
+	}
+	defer t.replayLimiter.release(pipe)
+
+	afterFromID := cursor.Kind != CursorAfterID
+	for _, u := range history {
+		if !afterFromID {
+			afterFromID = u.ID == cursor.ID
+			continue
+		}
+
+		if cursor.Kind == CursorAfterTime && u.Time.Before(cursor.Time) {
+			continue
+		}
+
+		if !pipe.writeHistory(u) {
+			return
+		}
+	}
+}
+
+// transportConfig returns the effective configuration of the transport.
+func (t *LocalTransport) transportConfig() *transportConfig {
+	scheme := "null"
+	options := bufferOptions(t.bufferSize, t.bufferFullTimeout)
+	if t.historySize > 0 {
+		scheme = "local"
+		options["size"] = t.historySize
+	}
+
+	return &transportConfig{Scheme: scheme, Options: options}
+}
+
 // Close closes the Transport.
 func (t *LocalTransport) Close() error {
 	select {
@@ -117,12 +426,17 @@ func (t *LocalTransport) Close() error {
 	default:
 	}
 
-	t.RLock()
-	defer t.RUnlock()
+	t.Lock()
+	defer t.Unlock()
 	for pipe := range t.pipes {
-		close(pipe.Read())
+		pipe.closeUpdates()
 	}
 	close(t.done)
 
+	for _, u := range t.history {
+		u.Release()
+	}
+	t.history = nil
+
 	return nil
 }
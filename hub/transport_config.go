@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// transportConfig is the effective configuration of a transport, once its DSN has been parsed and the defaults applied.
+// The credentials are never included.
+type transportConfig struct {
+	Scheme  string                 `json:"scheme,omitempty"`
+	Type    string                 `json:"type"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	// History is the configuration of the store of the history, for the transports relying on a secondary one
+	History *transportConfig `json:"history,omitempty"`
+	// Transports are the configurations of the transports the transport delegates to, by order of preference
+	Transports []*transportConfig `json:"transports,omitempty"`
+}
+
+// introspectableTransport is implemented by the transports able to describe their effective configuration.
+type introspectableTransport interface {
+	transportConfig() *transportConfig
+}
+
+// describeTransport returns the effective configuration of the transport.
+// Only the type is known for the transports not implementing introspectableTransport.
+func describeTransport(t Transport) *transportConfig {
+	c := &transportConfig{}
+	if t, ok := t.(introspectableTransport); ok {
+		c = t.transportConfig()
+	}
+	c.Type = fmt.Sprintf("%T", t)
+
+	return c
+}
+
+// historyConfig returns the configuration of the secondary store of the history, nil if there is none.
+func historyConfig(history *BoltTransport) *transportConfig {
+	if history == nil {
+		return nil
+	}
+
+	return describeTransport(history)
+}
+
+// bufferOptions returns the options shared by all the transports, configured at the hub level.
+func bufferOptions(bufferSize int, bufferFullTimeout time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"buffer_size":         bufferSize,
+		"buffer_full_timeout": bufferFullTimeout.String(),
+	}
+}
+
+// TransportConfigHandler returns the effective configuration of the transport, to check that the options of the DSN are taken into account.
+// A JWT having the "admin" Mercure claim, signed with the publisher key, must be passed in the Authorization header.
+func (h *Hub) TransportConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := authorize(r, h.getJWTKey(publisherRole), h.getJWTAlgorithm(publisherRole), nil)
+	if err != nil || claims == nil || !claims.Mercure.Admin {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		log.WithFields(log.Fields{"remote_addr": r.RemoteAddr}).Info(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeTransport(h.transport))
+}
@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transportConfigRequest(h *Hub, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", defaultHubURL+"/admin/config/transport", nil)
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.TransportConfigHandler(w, req)
+
+	return w
+}
+
+func TestTransportConfigHandlerUnauthorized(t *testing.T) {
+	hub := createDummy()
+	defer hub.Stop()
+
+	w := transportConfigRequest(hub, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = transportConfigRequest(hub, createDummyAuthorizedJWT(hub, publisherRole, []string{"*"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTransportConfigHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.db")
+	v := viper.New()
+	SetConfigDefaults(v)
+	v.Set("transport_url", "bolt://"+path+"?size=100&compaction_threshold=0.5&max_file_size=1048576&batch_interval=5ms&no_sync=1")
+	transport, err := NewTransport(v)
+	require.Nil(t, err)
+
+	hub := createDummyWithTransportAndConfig(transport, v)
+	defer hub.Stop()
+
+	w := transportConfigRequest(hub, createAdminJWT(hub))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"scheme": "bolt",
+		"type": "*hub.BoltTransport",
+		"options": {
+			"buffer_size": 5,
+			"buffer_full_timeout": "1s",
+			"bucket_name": "updates",
+			"size": 100,
+			"cleanup_frequency": 0.3,
+			"topic_index": false,
+			"id_index": false,
+			"encrypted": false,
+			"compaction_threshold": 0.5,
+			"compaction_interval": "1m0s",
+			"max_file_size": 1048576,
+			"batch_interval": "5ms",
+			"batch_size": 1000,
+			"no_sync": true,
+			"path": "`+path+`"
+		}
+	}`, w.Body.String())
+}
+
+func TestDescribeTransport(t *testing.T) {
+	local := NewLocalTransport(5, time.Second)
+	defer local.Close()
+	assert.Equal(t, &transportConfig{Scheme: "null", Type: "*hub.LocalTransport", Options: map[string]interface{}{"buffer_size": 5, "buffer_full_timeout": "1s"}}, describeTransport(local))
+
+	assert.Equal(t, &transportConfig{Type: "*hub.createPipeErrorTransport"}, describeTransport(&createPipeErrorTransport{}))
+
+	u, _ := url.Parse("local://?size=10")
+	withHistory, err := NewLocalTransportWithHistory(u, 5, time.Second)
+	require.Nil(t, err)
+
+	failover := NewFailoverTransport([]Transport{withHistory, &createPipeErrorTransport{}}, time.Minute)
+	defer failover.Close()
+	assert.Equal(t, &transportConfig{
+		Scheme:  "failover",
+		Type:    "*hub.FailoverTransport",
+		Options: map[string]interface{}{"probe_interval": "1m0s", "active": 0},
+		Transports: []*transportConfig{
+			{Scheme: "local", Type: "*hub.LocalTransport", Options: map[string]interface{}{"buffer_size": 5, "buffer_full_timeout": "1s", "size": 10}},
+			{Type: "*hub.createPipeErrorTransport"},
+		},
+	}, describeTransport(failover))
+}
@@ -0,0 +1,112 @@
+package hub_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/hub"
+	"github.com/dunglas/mercure/hub/transporttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		transport := hub.NewLocalTransport(5, time.Second)
+
+		return transport, func() { transport.Close() }
+	})
+}
+
+func TestLocalTransportWithHistoryConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		u, _ := url.Parse("local://?size=100")
+		transport, err := hub.NewLocalTransportWithHistory(u, 5, time.Second)
+		require.Nil(t, err)
+
+		return transport, func() { transport.Close() }
+	})
+}
+
+func TestInterceptedTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		u, _ := url.Parse("local://?size=100")
+		local, err := hub.NewLocalTransportWithHistory(u, 5, time.Second)
+		require.Nil(t, err)
+
+		transport := hub.WrapTransport(local, func(update *hub.Update, next hub.WriteFunc) error {
+			return next(update)
+		})
+
+		return transport, func() { transport.Close() }
+	})
+}
+
+func TestFailoverTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		u, _ := url.Parse("local://?size=100")
+		primary, err := hub.NewLocalTransportWithHistory(u, 5, time.Second)
+		require.Nil(t, err)
+		secondary, err := hub.NewLocalTransportWithHistory(u, 5, time.Second)
+		require.Nil(t, err)
+
+		transport := hub.NewFailoverTransport([]hub.Transport{primary, secondary}, time.Second)
+
+		return transport, func() { transport.Close() }
+	})
+}
+
+func TestBoltTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		path := "conformance-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".db"
+		u, _ := url.Parse("bolt://" + path)
+		transport, err := hub.NewBoltTransport(u, 5, time.Second)
+		require.Nil(t, err)
+
+		return transport, func() {
+			transport.Close()
+			os.Remove(path)
+		}
+	})
+}
+
+func TestBoltTransportBatchConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		path := "conformance-batch-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".db"
+		u, _ := url.Parse("bolt://" + path + "?batch_interval=5ms")
+		transport, err := hub.NewBoltTransport(u, 5, time.Second)
+		require.Nil(t, err)
+
+		return transport, func() {
+			transport.Close()
+			os.Remove(path)
+		}
+	})
+}
+
+func TestFileTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		dir, err := ioutil.TempDir("", "mercure-conformance")
+		require.Nil(t, err)
+
+		u, _ := url.Parse("filelog://" + dir)
+		transport, err := hub.NewFileTransport(u, 5, time.Second)
+		require.Nil(t, err)
+
+		return transport, func() {
+			transport.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestMySQLTransportConformance(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+		transport := hub.CreateMySQLTransport(t, "")
+
+		return transport, func() { transport.Close() }
+	})
+}
@@ -0,0 +1,70 @@
+package transporttest
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var goroutineIDRegexp = regexp.MustCompile(`^goroutine (\d+) `)
+
+// goroutineStacks returns the stacks of the running goroutines, by ID.
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if m := goroutineIDRegexp.FindSubmatch(s); m != nil {
+			stacks[string(m[1])] = string(s)
+		}
+	}
+
+	return stacks
+}
+
+// CheckGoroutines records the running goroutines. The returned function fails the test if goroutines started since then
+// are still running after Timeout, it must be called once all the resources (transports, servers...) have been released:
+//
+//	check := transporttest.CheckGoroutines(t)
+//	transport := NewMyTransport(...)
+//	// ...
+//	transport.Close()
+//	check()
+func CheckGoroutines(t *testing.T) func() {
+	before := goroutineStacks()
+
+	return func() {
+		t.Helper()
+
+		var leaked []string
+		deadline := time.Now().Add(Timeout)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range goroutineStacks() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if len(leaked) != 0 {
+			t.Errorf("%d leaked goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	}
+}
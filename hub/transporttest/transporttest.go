@@ -0,0 +1,173 @@
+// Package transporttest provides a conformance test suite for the implementations of hub.Transport.
+//
+// Third-party transports can check that they honor the semantics the hub relies on:
+//
+//	func TestMyTransport(t *testing.T) {
+//		transporttest.Run(t, func(t *testing.T) (hub.Transport, func()) {
+//			transport, err := NewMyTransport(...)
+//			require.Nil(t, err)
+//
+//			return transport, func() { transport.Close() }
+//		})
+//	}
+package transporttest
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/hub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Timeout is the delay after which an expected update is considered as missing.
+var Timeout = 5 * time.Second
+
+// Factory creates a new empty transport, and a function releasing the resources it uses.
+// The transport must not contain updates written by other tests.
+type Factory func(t *testing.T) (hub.Transport, func())
+
+// Run checks that the transports created by the factory honor the semantics the hub relies on:
+//
+//   - the live updates are sent to the pipes in the order they are written, without altering them
+//   - the history is replayed from the earliest update and after a given ID, in order, followed by the live updates
+//   - ErrUnsupportedCursor is returned for the cursors the transport doesn't support, the history tests are then skipped
+//   - the pipes are closed with the transport, which then returns ErrClosedTransport
+//   - no goroutine is leaked once the transport is closed and its resources released, even if pipes were abandoned
+//
+// The history may be eventually consistent: the written updates may be replayed only after a delay.
+func Run(t *testing.T, factory Factory) {
+	t.Run("Live", func(t *testing.T) { testLive(t, factory) })
+	t.Run("History", func(t *testing.T) { testHistory(t, factory) })
+	t.Run("Close", func(t *testing.T) { testClose(t, factory) })
+	t.Run("Leaks", func(t *testing.T) { testLeaks(t, factory) })
+}
+
+// readUpdate reads the next update of the pipe, it fails the test if none is received in time.
+func readUpdate(t *testing.T, pipe *hub.Pipe) *hub.Update {
+	t.Helper()
+
+	select {
+	case u, ok := <-pipe.Read():
+		require.True(t, ok, "pipe closed")
+		return u
+	case <-time.After(Timeout):
+		require.FailNow(t, "no update received")
+		return nil
+	}
+}
+
+func testLive(t *testing.T, factory Factory) {
+	transport, cleanup := factory(t)
+	defer cleanup()
+
+	pipe, err := transport.CreatePipe(hub.LatestCursor())
+	require.Nil(t, err)
+
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, transport.Write(&hub.Update{Topics: []string{"https://example.com/" + strconv.Itoa(i)}, Event: hub.Event{ID: strconv.Itoa(i), Data: "data " + strconv.Itoa(i)}}))
+	}
+
+	for i := 1; i <= 5; i++ {
+		u := readUpdate(t, pipe)
+		assert.Equal(t, strconv.Itoa(i), u.ID)
+		assert.Equal(t, []string{"https://example.com/" + strconv.Itoa(i)}, u.Topics)
+		assert.Equal(t, "data "+strconv.Itoa(i), u.Data)
+	}
+}
+
+func testHistory(t *testing.T, factory Factory) {
+	transport, cleanup := factory(t)
+	defer cleanup()
+
+	probe, err := transport.CreatePipe(hub.EarliestCursor())
+	if err == hub.ErrUnsupportedCursor {
+		t.Skip("history not supported")
+	}
+	require.Nil(t, err)
+	probe.Close()
+
+	for i := 1; i <= 10; i++ {
+		require.Nil(t, transport.Write(&hub.Update{Topics: []string{"https://example.com/foo"}, Event: hub.Event{ID: strconv.Itoa(i)}}))
+	}
+
+	// The history may be eventually consistent: wait for the updates to be stored
+	require.Eventually(t, func() bool {
+		pipe, err := transport.CreatePipe(hub.AfterIDCursor("9"))
+		require.Nil(t, err)
+		defer pipe.Close()
+
+		select {
+		case u := <-pipe.Read():
+			return u != nil && u.ID == "10"
+		case <-time.After(time.Second):
+			return false
+		}
+	}, 2*Timeout, 10*time.Millisecond)
+
+	pipe, err := transport.CreatePipe(hub.EarliestCursor())
+	require.Nil(t, err)
+	for i := 1; i <= 10; i++ {
+		assert.Equal(t, strconv.Itoa(i), readUpdate(t, pipe).ID)
+	}
+
+	pipe, err = transport.CreatePipe(hub.AfterIDCursor("7"))
+	require.Nil(t, err)
+	for i := 8; i <= 10; i++ {
+		assert.Equal(t, strconv.Itoa(i), readUpdate(t, pipe).ID)
+	}
+
+	// The live updates follow the history
+	require.Nil(t, transport.Write(&hub.Update{Event: hub.Event{ID: "11"}}))
+	assert.Equal(t, "11", readUpdate(t, pipe).ID)
+}
+
+func testClose(t *testing.T, factory Factory) {
+	transport, cleanup := factory(t)
+	defer cleanup()
+
+	pipe, err := transport.CreatePipe(hub.LatestCursor())
+	require.Nil(t, err)
+
+	require.Nil(t, transport.Close())
+	assert.Nil(t, transport.Close())
+
+	_, err = transport.CreatePipe(hub.LatestCursor())
+	assert.Equal(t, hub.ErrClosedTransport, err)
+	assert.Equal(t, hub.ErrClosedTransport, transport.Write(&hub.Update{}))
+
+	// The pipes are closed with the transport
+	select {
+	case _, ok := <-pipe.Read():
+		assert.False(t, ok)
+	case <-time.After(Timeout):
+		assert.Fail(t, "pipe not closed")
+	}
+}
+
+func testLeaks(t *testing.T, factory Factory) {
+	check := CheckGoroutines(t)
+	transport, cleanup := factory(t)
+
+	live, err := transport.CreatePipe(hub.LatestCursor())
+	require.Nil(t, err)
+
+	// The subscriber replaying the history goes away without reading it
+	history, err := transport.CreatePipe(hub.EarliestCursor())
+	if err != hub.ErrUnsupportedCursor {
+		require.Nil(t, err)
+		defer history.Close()
+	}
+
+	for i := 1; i <= 3; i++ {
+		require.Nil(t, transport.Write(&hub.Update{Topics: []string{"https://example.com/foo"}, Event: hub.Event{ID: strconv.Itoa(i)}}))
+	}
+	readUpdate(t, live)
+	live.Close()
+
+	require.Nil(t, transport.Close())
+	cleanup()
+	check()
+}
@@ -0,0 +1,16 @@
+package transporttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/hub"
+)
+
+func TestRunLocalTransport(t *testing.T) {
+	Run(t, func(t *testing.T) (hub.Transport, func()) {
+		transport := hub.NewLocalTransport(5, time.Second)
+
+		return transport, func() { transport.Close() }
+	})
+}
@@ -1,5 +1,19 @@
 package hub
 
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// updatePool stores released updates to reduce allocations.
+var updatePool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return &Update{Targets: make(map[string]struct{})}
+	},
+}
+
 // Update represents an update to send to subscribers.
 type Update struct {
 	// The target audience.
@@ -11,6 +25,70 @@ type Update struct {
 
 	// The Server-Sent Event to send.
 	Event
+
+	// The time at which the update has been stored, set by the transports supporting time-based history.
+	Time time.Time
+
+	// The time after which the update must not be delivered anymore, zero if it never expires.
+	Expires time.Time
+
+	// When true, subscribers catching up only receive the newest of the queued updates of the same topic.
+	LatestOnly bool
+
+	// The ID of the update deleted by this one, or "*" to delete all the previous updates of the canonical topic.
+	// Subscribers catching up don't receive the queued updates deleted by a tombstone.
+	Tombstone string
+
+	// The subject ("sub" claim of the JWT) of the publisher, stored with the update for auditing purposes.
+	// It is never sent to the subscribers, and is empty for the updates published by the hub itself.
+	Publisher string
+
+	// refs counts the references to a pooled update, it's put back in the pool when it drops to zero.
+	refs   atomic.Int32
+	pooled bool
+}
+
+// AcquireUpdate returns an empty Update from the pool, holding one reference.
+// Call Release when the update isn't used anymore.
+func AcquireUpdate() *Update {
+	u := updatePool.Get().(*Update)
+	u.pooled = true
+	u.refs.Store(1)
+
+	return u
+}
+
+// Retain adds a reference to the update, it will not be reused until the matching call to Release.
+func (u *Update) Retain() {
+	if u != nil && u.pooled {
+		u.refs.Inc()
+	}
+}
+
+// Release removes a reference to the update. When no references are left, the update is reset and put back in the pool.
+// Updates not created using AcquireUpdate are left to the garbage collector.
+func (u *Update) Release() {
+	if u == nil || !u.pooled || u.refs.Dec() > 0 {
+		return
+	}
+
+	for t := range u.Targets {
+		delete(u.Targets, t)
+	}
+	u.Topics = u.Topics[:0]
+	u.Event = Event{}
+	u.Time = time.Time{}
+	u.Expires = time.Time{}
+	u.LatestOnly = false
+	u.Tombstone = ""
+	u.Publisher = ""
+	u.pooled = false
+	updatePool.Put(u)
+}
+
+// Expired returns true if the update must not be delivered anymore.
+func (u *Update) Expired(now time.Time) bool {
+	return !u.Expires.IsZero() && now.After(u.Expires)
 }
 
 type serializedUpdate struct {
@@ -18,6 +96,6 @@ type serializedUpdate struct {
 	event string
 }
 
-func newSerializedUpdate(u *Update) *serializedUpdate {
-	return &serializedUpdate{u, u.String()}
+func newSerializedUpdate(u *Update, f *eventFormat) *serializedUpdate {
+	return &serializedUpdate{u, f.format(&u.Event)}
 }
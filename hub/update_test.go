@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRelease(t *testing.T) {
+	u := AcquireUpdate()
+	u.Targets["foo"] = struct{}{}
+	u.Topics = append(u.Topics, "http://example.com/books/1")
+	u.Event = Event{Data: "data", ID: "id"}
+	u.Expires = time.Now()
+	u.LatestOnly = true
+	u.Publisher = "publisher"
+	u.Tombstone = "previous"
+
+	u.Retain()
+	u.Release()
+	assert.Equal(t, "id", u.ID)
+	assert.Len(t, u.Targets, 1)
+
+	u.Release()
+	assert.Empty(t, u.ID)
+	assert.Empty(t, u.Targets)
+	assert.Empty(t, u.Topics)
+	assert.True(t, u.Expires.IsZero())
+	assert.False(t, u.LatestOnly)
+	assert.Empty(t, u.Publisher)
+	assert.Empty(t, u.Tombstone)
+	assert.False(t, u.pooled)
+}
+
+func TestUpdateReleaseNotPooled(t *testing.T) {
+	u := &Update{Topics: []string{"http://example.com/books/1"}, Event: Event{ID: "id"}}
+
+	u.Retain()
+	u.Release()
+	u.Release()
+	assert.Equal(t, "id", u.ID)
+	assert.Equal(t, []string{"http://example.com/books/1"}, u.Topics)
+}
+
+func TestUpdateReleasedByPipe(t *testing.T) {
+	u := AcquireUpdate()
+	u.ID = "id"
+
+	pipe := NewPipe(1, time.Millisecond)
+	assert.True(t, pipe.Write(u))
+	assert.False(t, pipe.Write(u))
+
+	u.Release()
+	assert.Equal(t, "id", u.ID)
+
+	(<-pipe.Read()).Release()
+	assert.Empty(t, u.ID)
+}
+
+func TestUpdateExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, (&Update{}).Expired(now))
+	assert.False(t, (&Update{Expires: now.Add(time.Second)}).Expired(now))
+	assert.True(t, (&Update{Expires: now.Add(-time.Second)}).Expired(now))
+}
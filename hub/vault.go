@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultVaultTimeout = 5 * time.Second
+
+type vaultSecret struct {
+	fields  map[string]interface{}
+	expires time.Time
+}
+
+// vaultSecrets caches the secrets retrieved from Vault, they are fetched again once the "vault_refresh_interval" is elapsed.
+// The lock is never held while a secret is fetched: the concurrent reads of the same secret share the fetch in progress.
+var vaultSecrets = struct {
+	sync.Mutex
+	m       map[string]vaultSecret
+	fetches map[string]*vaultFetch
+}{m: make(map[string]vaultSecret), fetches: make(map[string]*vaultFetch)}
+
+// vaultFetch is a fetch of a secret in progress, its result is available once done is closed.
+type vaultFetch struct {
+	done chan struct{}
+	// fields are the fields of the secret, or the previous ones if it couldn't be fetched
+	fields map[string]interface{}
+	// err is set if the secret couldn't be fetched and isn't cached
+	err error
+}
+
+var vaultClient = &http.Client{Timeout: defaultVaultTimeout}
+
+// readVaultSecret returns a field of a secret stored in HashiCorp Vault, the reference is formatted as "path#field".
+// Both the KV version 1 and version 2 secrets engines are supported. If Vault cannot be reached when the secret must be refreshed,
+// the previous value is used until the next refresh.
+func readVaultSecret(v *viper.Viper, ref string, now time.Time) (string, error) {
+	parts := strings.SplitN(ref, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf(`%q: must be formatted as "vault:path#field": %w`, secretVaultPrefix+ref, ErrInvalidSecretReference)
+	}
+	path, field := strings.Trim(parts[0], "/"), parts[1]
+
+	addr := strings.TrimRight(v.GetString("vault_addr"), "/")
+	if addr == "" {
+		return "", fmt.Errorf(`%q: the "vault_addr" configuration parameter must be set: %w`, secretVaultPrefix+ref, ErrInvalidSecretReference)
+	}
+	secretURL := addr + "/v1/" + path
+
+	vaultSecrets.Lock()
+	s, cached := vaultSecrets.m[secretURL]
+	if cached && now.Before(s.expires) {
+		vaultSecrets.Unlock()
+
+		return vaultSecretField(s.fields, ref, field)
+	}
+
+	f, fetching := vaultSecrets.fetches[secretURL]
+	if !fetching {
+		f = &vaultFetch{done: make(chan struct{})}
+		vaultSecrets.fetches[secretURL] = f
+	}
+	vaultSecrets.Unlock()
+
+	if fetching {
+		<-f.done
+	} else {
+		fetchVaultSecretOnce(v, f, secretURL, path, now)
+	}
+
+	if f.err != nil {
+		return "", fmt.Errorf("%q: %v: %w", secretVaultPrefix+ref, f.err, ErrInvalidSecretReference)
+	}
+
+	return vaultSecretField(f.fields, ref, field)
+}
+
+// fetchVaultSecretOnce fetches the secret for all the reads waiting for f, and caches it.
+func fetchVaultSecretOnce(v *viper.Viper, f *vaultFetch, secretURL, path string, now time.Time) {
+	defer close(f.done)
+
+	fields, err := fetchVaultSecret(v, secretURL)
+
+	vaultSecrets.Lock()
+	defer vaultSecrets.Unlock()
+
+	delete(vaultSecrets.fetches, secretURL)
+	s, cached := vaultSecrets.m[secretURL]
+	switch {
+	case err == nil:
+		s.fields = fields
+	case cached:
+		log.WithFields(log.Fields{"path": path}).Warn(fmt.Errorf("vault: using the previous value of the secret: %w", err))
+	default:
+		f.err = err
+
+		return
+	}
+
+	s.expires = now.Add(v.GetDuration("vault_refresh_interval"))
+	vaultSecrets.m[secretURL] = s
+	f.fields = s.fields
+}
+
+// vaultSecretField returns the value of a field of a secret, it must be a string.
+func vaultSecretField(fields map[string]interface{}, ref, field string) (string, error) {
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("%q: missing field %q: %w", secretVaultPrefix+ref, field, ErrInvalidSecretReference)
+	}
+
+	return value, nil
+}
+
+// fetchVaultSecret reads the secret using the Vault HTTP API.
+func fetchVaultSecret(v *viper.Viper, secretURL string) (map[string]interface{}, error) {
+	if strings.HasPrefix(v.GetString("vault_token"), secretVaultPrefix) {
+		return nil, fmt.Errorf(`the "vault_token" configuration parameter cannot be stored in Vault`)
+	}
+	token, err := getSecret(v, "vault_token")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", secretURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace := v.GetString("vault_namespace"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	// The KV version 2 secrets engine wraps the fields in a "data" object, next to the "metadata" of the version
+	if data, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+
+	return body.Data, nil
+}
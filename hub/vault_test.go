@@ -0,0 +1,151 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func newVaultServer(t *testing.T, requests *atomic.Int32, failing *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		if failing.Load() || r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/mercure":
+			assert.Equal(t, "tenant", r.Header.Get("X-Vault-Namespace"))
+			w.Write([]byte(`{"data":{"data":{"jwt_key":"kv2","size":1},"metadata":{"version":3}}}`))
+		case "/v1/kv/mercure":
+			w.Write([]byte(`{"data":{"jwt_key":"kv1"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestReadVaultSecret(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	ts := newVaultServer(t, &requests, &failing)
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("vault_addr", ts.URL+"/")
+	v.Set("vault_token", "root")
+	v.Set("vault_namespace", "tenant")
+	v.Set("vault_refresh_interval", time.Minute)
+
+	now := time.Now()
+	value, err := readVaultSecret(v, "secret/data/mercure#jwt_key", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "kv2", value)
+
+	value, err = readVaultSecret(v, "/kv/mercure#jwt_key", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "kv1", value)
+
+	// Cached until the refresh interval is elapsed
+	_, err = readVaultSecret(v, "secret/data/mercure#size", now)
+	assert.EqualError(t, err, `"vault:secret/data/mercure#size": missing field "size": invalid secret reference`)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// The previous value is used if Vault is unavailable
+	failing.Store(true)
+	value, err = readVaultSecret(v, "secret/data/mercure#jwt_key", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, "kv2", value)
+	assert.Equal(t, int32(3), requests.Load())
+
+	_, err = readVaultSecret(v, "secret/data/unknown#jwt_key", now)
+	assert.EqualError(t, err, `"vault:secret/data/unknown#jwt_key": unexpected status code 403: invalid secret reference`)
+}
+
+func TestReadVaultSecretConcurrentFetches(t *testing.T) {
+	var slowRequests atomic.Int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/slow/mercure" {
+			if slowRequests.Inc() == 1 {
+				close(fetching)
+			}
+			<-release
+		}
+
+		w.Write([]byte(`{"data":{"jwt_key":"` + r.URL.Path + `"}}`))
+	}))
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("vault_addr", ts.URL)
+	v.Set("vault_refresh_interval", time.Minute)
+
+	now := time.Now()
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			value, err := readVaultSecret(v, "slow/mercure#jwt_key", now)
+			assert.Nil(t, err)
+			results <- value
+		}()
+	}
+	<-fetching
+
+	// Another secret can be read while the slow one is being fetched
+	value, err := readVaultSecret(v, "kv/mercure#jwt_key", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "/v1/kv/mercure", value)
+
+	close(release)
+	assert.Equal(t, "/v1/slow/mercure", <-results)
+	assert.Equal(t, "/v1/slow/mercure", <-results)
+	assert.Equal(t, int32(1), slowRequests.Load())
+}
+
+func TestReadVaultSecretInvalidReference(t *testing.T) {
+	v := viper.New()
+
+	_, err := readVaultSecret(v, "secret/data/mercure", time.Now())
+	assert.EqualError(t, err, `"vault:secret/data/mercure": must be formatted as "vault:path#field": invalid secret reference`)
+
+	_, err = readVaultSecret(v, "secret/data/mercure#jwt_key", time.Now())
+	assert.EqualError(t, err, `"vault:secret/data/mercure#jwt_key": the "vault_addr" configuration parameter must be set: invalid secret reference`)
+
+	v.Set("vault_addr", "http://127.0.0.1:0")
+	v.Set("vault_token", "vault:secret/data/token#token")
+	err = validateSecrets(v)
+	assert.EqualError(t, err, `invalid config: vault_token: "vault:secret/data/token#token": the "vault_token" configuration parameter cannot be stored in Vault: invalid secret reference`)
+}
+
+func TestVaultJWTKey(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	ts := newVaultServer(t, &requests, &failing)
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("vault_addr", ts.URL)
+	v.Set("vault_token", "root")
+	v.Set("vault_namespace", "tenant")
+	v.Set("jwt_key", "vault:secret/data/mercure#jwt_key")
+	v.Set("transport_url", "null://")
+	require.Nil(t, ValidateConfig(v))
+
+	h, err := NewHub(v)
+	require.Nil(t, err)
+	defer h.Stop()
+	assert.Equal(t, []byte("kv2"), h.getJWTKey(publisherRole))
+
+	v.Set("jwt_key", "vault:secret/data/mercure#unknown")
+	err = ValidateConfig(v)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
@@ -79,6 +79,30 @@ foo`;
             .catch(e => error(e))
     }
 
+    // Subscribers count, available if the topic is allowed by the "public_stats_topics" option
+    const watchers = document.querySelector('#watchers');
+    let watchersInterval;
+    function watch(topic) {
+        clearInterval(watchersInterval);
+        watchers.textContent = '';
+        if (!topic) return;
+
+        const u = new URL(settingsForm.hubUrl.value + '/stats/public');
+        u.searchParams.append('topic', topic);
+
+        const refresh = () => fetch(u)
+            .then(response => {
+                if (!response.ok) throw new Error(response.statusText);
+
+                return response.json();
+            })
+            .then(({ subscribers }) => watchers.textContent = `${subscribers} subscriber(s) watching ${topic}`)
+            .catch(() => clearInterval(watchersInterval));
+
+        refresh();
+        watchersInterval = setInterval(refresh, 5000);
+    }
+
     // Subscribe
     const template = document.querySelector('#update');
     let ol, eventSource;
@@ -117,10 +141,12 @@ foo`;
         };
         eventSource.onerror = error;
         this.elements.unsubscribe.disabled = false;
+        watch(topicList[0]);
     };
     subscribeForm.elements.unsubscribe.onclick = function () {
         eventSource.close();
         this.disabled = true;
+        watch(null);
     };
 
     // Publish